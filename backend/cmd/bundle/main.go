@@ -0,0 +1,125 @@
+// Command bundle exports whiteboards as portable bundle archives and imports them, talking to
+// the database and blob store directly:
+//
+//	bundle export -board ID [-o FILE]
+//	bundle import -user ID [-into ID] [-name NAME] FILE
+//
+// The database is given by -dsn and the blob store by SKETCHIVE_BLOB_DIR, as for the server.
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"sketchive/internal/blob"
+	"sketchive/internal/db"
+	"sketchive/internal/services"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+const defaultDSN = "root:@tcp(127.0.0.1:3306)/sketchive"
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	fmt.Fprintln(os.Stderr, "  bundle export -board ID [-o FILE]")
+	fmt.Fprintln(os.Stderr, "  bundle import -user ID [-into ID] [-name NAME] FILE")
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "export":
+		exportCommand(os.Args[2:])
+	case "import":
+		importCommand(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func exportCommand(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	dsn := flags.String("dsn", defaultDSN, "MySQL data source name")
+	board := flags.Int("board", 0, "ID of the whiteboard to export")
+	output := flags.String("o", "", "file to write, whiteboard-ID.zip by default")
+	flags.Parse(args)
+	if *board <= 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *output == "" {
+		*output = fmt.Sprintf("whiteboard-%d.zip", *board)
+	}
+
+	store := connect(*dsn)
+	var content bytes.Buffer
+	if err := services.ExportBundle(*board, &content, store, time.Now()); err != nil {
+		log.Fatal("Export failed: ", err)
+	}
+	if err := os.WriteFile(*output, content.Bytes(), 0o644); err != nil {
+		log.Fatal("Could not write the bundle: ", err)
+	}
+	fmt.Printf("Exported whiteboard %d to %s\n", *board, *output)
+}
+
+func importCommand(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dsn := flags.String("dsn", defaultDSN, "MySQL data source name")
+	user := flags.Int("user", 0, "ID of the user who owns the imported content")
+	into := flags.Int("into", 0, "ID of a whiteboard to merge into instead of creating a new one")
+	name := flags.String("name", "", "name of the new whiteboard, the bundle's by default")
+	flags.Parse(args)
+	if *user <= 0 || flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	content, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		log.Fatal("Could not read the bundle: ", err)
+	}
+	store := connect(*dsn)
+	result, err := services.ImportBundle(bytes.NewReader(content), int64(len(content)), store,
+		services.ImportOptions{UserID: *user, WhiteboardID: *into, Name: *name})
+	if err != nil {
+		log.Fatal("Import failed: ", err)
+	}
+	action := "Merged into"
+	if result.Created {
+		action = "Created"
+	}
+	fmt.Printf("%s whiteboard %d %q: %d strokes, %d elements, %d groups\n", action, result.Whiteboard.ID,
+		result.Whiteboard.Name, len(result.Strokes), len(result.Elements), len(result.Groups))
+}
+
+// connect opens the database and the blob store
+func connect(dsn string) blob.Store {
+	database, err := sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal("Could not open the database: ", err)
+	}
+	if err := database.Ping(); err != nil {
+		log.Fatal("Could not connect to the database: ", err)
+	}
+	db.SetDB(database)
+
+	blobDir := os.Getenv("SKETCHIVE_BLOB_DIR")
+	if blobDir == "" {
+		blobDir = "data/blobs"
+	}
+	store, err := blob.NewLocalStore(blobDir)
+	if err != nil {
+		log.Fatal("Could not open the blob store: ", err)
+	}
+	return store
+}
@@ -5,11 +5,16 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gorilla/websocket"
 
-	// "sketchive/internal/api"
+	"sketchive/internal/api"
+	"sketchive/internal/blob"
 	"sketchive/internal/db"
+	"sketchive/internal/services"
+	sockets "sketchive/internal/websocket"
 
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -118,9 +123,16 @@ type Client struct {
 	send chan []byte
 }
 
+// reply is a message for a single client
+type reply struct {
+	client  *Client
+	message []byte
+}
+
 type Hub struct {
 	clients    map[*Client]bool
 	broadcast  chan []byte
+	reply      chan reply
 	register   chan *Client
 	unregister chan *Client
 }
@@ -128,6 +140,7 @@ type Hub struct {
 var hub = Hub{
 	clients:    make(map[*Client]bool),
 	broadcast:  make(chan []byte),
+	reply:      make(chan reply),
 	register:   make(chan *Client),
 	unregister: make(chan *Client),
 }
@@ -144,6 +157,15 @@ func (c *Client) readPump() {
 			hub.unregister <- c
 			break
 		}
+
+		// Operations like transforms are applied by the server, which broadcasts the result.
+		// Replies go through the hub, the only goroutine that closes send channels.
+		if answer, handled := sockets.HandleMessage(message); handled {
+			if answer != nil {
+				hub.reply <- reply{client: c, message: answer}
+			}
+			continue
+		}
 		hub.broadcast <- message
 	}
 }
@@ -181,17 +203,27 @@ func (h *Hub) run() {
 			}
 		case message := <-h.broadcast:
 			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-				}
+				h.send(client, message)
+			}
+		case r := <-h.reply:
+			// The client may have been dropped since it asked
+			if h.clients[r.client] {
+				h.send(r.client, r.message)
 			}
 		}
 	}
 }
 
+// send queues a message for a client, dropping the client when it can't keep up
+func (h *Hub) send(client *Client, message []byte) {
+	select {
+	case client.send <- message:
+	default:
+		close(client.send)
+		delete(h.clients, client)
+	}
+}
+
 func handleConnections(w http.ResponseWriter, r *http.Request) {
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -225,13 +257,39 @@ func main() {
 
 	db.SetDB(database)
 
+	// Uploaded images live on the local disk, next to the server by default
+	blobDir := os.Getenv("SKETCHIVE_BLOB_DIR")
+	if blobDir == "" {
+		blobDir = "data/blobs"
+	}
+	store, err := blob.NewLocalStore(blobDir)
+	if err != nil {
+		log.Fatal("Could not open the blob store:", err)
+	}
+	api.SetBlobStore(store)
+
+	// How long editors can undo clearing a board, e.g. "30m"
+	if window := os.Getenv("SKETCHIVE_CLEAR_UNDO_WINDOW"); window != "" {
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 {
+			log.Fatal("Invalid SKETCHIVE_CLEAR_UNDO_WINDOW:", window)
+		}
+		services.SetClearUndoWindow(d)
+	}
+
 	mux := http.NewServeMux()
 
+	registerRoutes(mux)
+
 	// WebSocket endpoint
 	mux.HandleFunc("/ws", handleConnections)
 
 	// Start the hub in a separate goroutine
 	go hub.run()
+	services.SetBroadcaster(func(message []byte) {
+		hub.broadcast <- message
+	})
+	services.StartCheckpointer(services.DefaultCheckpointOps, services.DefaultCheckpointInterval)
 
 	// Start the server with CORS enabled
 	fmt.Println("Starting server on :8080")
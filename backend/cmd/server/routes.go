@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+
+	"sketchive/internal/api"
+)
+
+// registerRoutes wires the REST endpoints into the mux
+func registerRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/whiteboards", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			api.GetWhiteboard(w, r)
+		case "POST":
+			api.CreateWhiteboard(w, r)
+		case "PUT":
+			api.UpdateWhiteboard(w, r)
+		case "DELETE":
+			api.DeleteWhiteboard(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/whiteboards/clear", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			api.ClearWhiteboardHandler(w, r)
+		} else {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Stroke related endpoints
+	mux.HandleFunc("/strokes", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			api.AddStroke(w, r)
+		case "GET":
+			api.GetStrokesHistoryByWhiteboard(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Endpoint for updating stroke status (marking strokes as deleted)
+	mux.HandleFunc("/strokes/delete", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			api.UpdateStrokeForDeletion(w, r)
+		} else {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("GET /whiteboards/{id}/strokes", api.GetStrokesPage)
+	mux.HandleFunc("POST /whiteboards/{id}/strokes/transform", api.TransformStrokes)
+
+	// Board content
+	mux.HandleFunc("GET /whiteboards/{id}/content", api.GetWhiteboardContent)
+	mux.HandleFunc("POST /whiteboards/{id}/select", api.SelectContent)
+
+	// Canvas settings and content bounds
+	mux.HandleFunc("GET /whiteboards/{id}/canvas", api.GetCanvas)
+	mux.HandleFunc("PUT /whiteboards/{id}/canvas", api.UpdateCanvas)
+
+	// Undo and redo
+	mux.HandleFunc("GET /whiteboards/{id}/history", api.GetHistory)
+	mux.HandleFunc("POST /whiteboards/{id}/undo", api.Undo)
+	mux.HandleFunc("POST /whiteboards/{id}/redo", api.Redo)
+
+	// Operation log
+	mux.HandleFunc("GET /whiteboards/{id}/log", api.GetOperationLog)
+	mux.HandleFunc("GET /whiteboards/{id}/log/check", api.CheckOperationLog)
+
+	// Versions
+	mux.HandleFunc("GET /whiteboards/{id}/versions", api.GetVersions)
+	mux.HandleFunc("POST /whiteboards/{id}/versions", api.CreateVersion)
+	mux.HandleFunc("GET /whiteboards/{id}/versions/{versionID}", api.GetVersion)
+	mux.HandleFunc("POST /whiteboards/{id}/versions/{versionID}/restore", api.RestoreVersion)
+	mux.HandleFunc("GET /whiteboards/{id}/diff", api.DiffWhiteboard)
+
+	// Exports
+	mux.HandleFunc("GET /whiteboards/{id}/export.svg", api.ExportSVG)
+	mux.HandleFunc("GET /whiteboards/{id}/export.png", api.ExportPNG)
+	mux.HandleFunc("GET /whiteboards/{id}/export.pdf", api.ExportPDF)
+
+	// Portable bundles, imported as a new board or merged into an existing one
+	mux.HandleFunc("GET /whiteboards/{id}/bundle", api.ExportBundle)
+	mux.HandleFunc("POST /whiteboards/import", api.ImportBundle)
+	mux.HandleFunc("POST /whiteboards/{id}/import", api.ImportBundle)
+
+	// Recorded clears, which editors can undo for a while
+	mux.HandleFunc("GET /whiteboards/{id}/clears", api.GetClears)
+	mux.HandleFunc("POST /whiteboards/{id}/clears/{clearID}/undo", api.UndoClear)
+
+	// Groups
+	mux.HandleFunc("GET /whiteboards/{id}/groups", api.GetGroups)
+	mux.HandleFunc("POST /whiteboards/{id}/groups", api.CreateGroup)
+	mux.HandleFunc("DELETE /whiteboards/{id}/groups/{groupID}", api.Ungroup)
+	mux.HandleFunc("POST /whiteboards/{id}/transform", api.TransformContent)
+
+	// Layers
+	mux.HandleFunc("GET /whiteboards/{id}/layers", api.GetLayers)
+	mux.HandleFunc("POST /whiteboards/{id}/layers", api.CreateLayer)
+	mux.HandleFunc("POST /whiteboards/{id}/layers/order", api.ReorderLayers)
+	mux.HandleFunc("PUT /whiteboards/{id}/layers/{layerID}", api.UpdateLayer)
+	mux.HandleFunc("DELETE /whiteboards/{id}/layers/{layerID}", api.DeleteLayer)
+
+	// Shape elements
+	mux.HandleFunc("GET /whiteboards/{id}/elements", api.GetElementsByWhiteboard)
+	mux.HandleFunc("POST /whiteboards/{id}/elements", api.AddElement)
+	mux.HandleFunc("POST /whiteboards/{id}/elements/erase", api.EraseElements)
+	mux.HandleFunc("PUT /whiteboards/{id}/elements/{elementID}", api.UpdateElement)
+	mux.HandleFunc("DELETE /whiteboards/{id}/elements/{elementID}", api.DeleteElement)
+
+	// Sticky notes and voting
+	mux.HandleFunc("GET /whiteboards/{id}/stickies", api.GetStickies)
+	mux.HandleFunc("POST /whiteboards/{id}/stickies", api.CreateSticky)
+	mux.HandleFunc("PUT /whiteboards/{id}/stickies/{stickyID}", api.UpdateSticky)
+	mux.HandleFunc("DELETE /whiteboards/{id}/stickies/{stickyID}", api.DeleteSticky)
+	mux.HandleFunc("POST /whiteboards/{id}/stickies/{stickyID}/votes", api.CastVote)
+	mux.HandleFunc("DELETE /whiteboards/{id}/stickies/{stickyID}/votes", api.RetractVote)
+	mux.HandleFunc("GET /whiteboards/{id}/votes", api.GetVotes)
+	mux.HandleFunc("POST /whiteboards/{id}/vote-sessions", api.StartVoteSession)
+	mux.HandleFunc("POST /whiteboards/{id}/vote-sessions/end", api.EndVoteSession)
+
+	// Images
+	mux.HandleFunc("POST /whiteboards/{id}/images", api.UploadImage)
+	mux.HandleFunc("GET /blobs/{hash}", api.GetBlob)
+}
@@ -1,10 +1,10 @@
-require github.com/go-sql-driver/mysql v1.8.1
-
 require (
-	filippo.io/edwards25519 v1.1.0 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/go-sql-driver/mysql v1.8.1
+	github.com/gorilla/websocket v1.5.3
 )
 
+require filippo.io/edwards25519 v1.1.0 // indirect
+
 module sketchive
 
 go 1.22.6
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sketchive/internal/services"
+	"strconv"
+	"time"
+)
+
+// maxBundleSize caps the size of an uploaded bundle archive
+const maxBundleSize = 256 << 20
+
+// ExportBundle returns a whiteboard as a bundle archive that ImportBundle, here or on another
+// server, can turn back into a board
+func ExportBundle(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// Buffered so a failure halfway still gets an error response
+	var content bytes.Buffer
+	if err := services.ExportBundle(whiteboardID, &content, blobStore, time.Now()); err != nil {
+		writeServiceError(w, err, "Failed to export the whiteboard bundle")
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="whiteboard-%d.zip"`, whiteboardID))
+	w.Write(content.Bytes())
+}
+
+// ImportBundle reads a bundle archive from the request body. Posted to /whiteboards/import it
+// creates a new board named by the optional name query parameter; posted to
+// /whiteboards/{id}/import it merges the bundle into that board. userID is required and
+// becomes the owner of everything imported.
+func ImportBundle(w http.ResponseWriter, r *http.Request) {
+	options := services.ImportOptions{Name: r.URL.Query().Get("name")}
+	if r.PathValue("id") != "" {
+		var ok bool
+		if options.WhiteboardID, ok = whiteboardIDFromPath(w, r); !ok {
+			return
+		}
+	}
+	var err error
+	if options.UserID, err = strconv.Atoi(r.URL.Query().Get("userID")); err != nil {
+		http.Error(w, "Missing or invalid userID", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBundleSize)
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Bundle is larger than 256MB", http.StatusRequestEntityTooLarge)
+			return
+		}
+		log.Println("Error reading uploaded bundle:", err)
+		http.Error(w, "Failed to read bundle", http.StatusBadRequest)
+		return
+	}
+
+	result, err := services.ImportBundle(bytes.NewReader(content), int64(len(content)), blobStore, options)
+	if err != nil {
+		writeServiceError(w, err, "Failed to import the whiteboard bundle")
+		return
+	}
+	if result.Created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(result)
+}
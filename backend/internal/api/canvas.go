@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sketchive/internal/db"
+	"sketchive/internal/services"
+	"strconv"
+)
+
+// canvasResponse is a board's canvas settings along with the box around its content,
+// which clients use for zoom-to-fit
+type canvasResponse struct {
+	Canvas        services.Canvas `json:"canvas"`
+	ContentBounds *db.Bounds      `json:"contentBounds"`
+}
+
+// GetCanvas returns the canvas settings of a whiteboard, with defaults filled in, and its content bounds
+func GetCanvas(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	canvas, err := services.GetCanvas(whiteboardID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to get canvas settings")
+		return
+	}
+	bounds, err := services.ContentBounds(whiteboardID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to get content bounds")
+		return
+	}
+
+	json.NewEncoder(w).Encode(canvasResponse{Canvas: canvas, ContentBounds: bounds})
+}
+
+// UpdateCanvas replaces the canvas settings of a whiteboard. Fields left out get the
+// server defaults. Pass ?userID= to attribute the change.
+func UpdateCanvas(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := strconv.Atoi(r.URL.Query().Get("userID"))
+
+	var settings db.CanvasSettings
+	err := json.NewDecoder(r.Body).Decode(&settings)
+	if err != nil {
+		log.Println("Error decoding canvas settings (UpdateCanvas()):", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	canvas, err := services.UpdateCanvas(whiteboardID, userID, settings)
+	if err != nil {
+		writeServiceError(w, err, "Failed to update canvas settings")
+		return
+	}
+	bounds, err := services.ContentBounds(whiteboardID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to get content bounds")
+		return
+	}
+
+	json.NewEncoder(w).Encode(canvasResponse{Canvas: canvas, ContentBounds: bounds})
+}
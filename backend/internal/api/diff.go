@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sketchive/internal/services"
+	"strconv"
+)
+
+// DiffWhiteboard lists what changed on a whiteboard between two points. Each side is given
+// as a version (fromVersion, toVersion) or a time (from, to, RFC 3339 or Unix milliseconds);
+// a side left out is the board as it is now. With ?format=svg the diff is drawn instead,
+// with additions in green, removals in red and modifications in blue.
+func DiffWhiteboard(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+
+	var points [2]services.DiffPoint
+	for i, side := range []string{"from", "to"} {
+		versionParam, timeParam := side+"Version", side
+		if query.Has(versionParam) && query.Has(timeParam) {
+			http.Error(w, "Give either "+versionParam+" or "+timeParam+", not both", http.StatusBadRequest)
+			return
+		}
+		if value := query.Get(versionParam); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil || id <= 0 {
+				http.Error(w, "Invalid "+versionParam, http.StatusBadRequest)
+				return
+			}
+			points[i].VersionID = id
+		}
+		if value := query.Get(timeParam); value != "" {
+			t, err := parseTimestamp(value)
+			if err != nil {
+				http.Error(w, timeParam+" must be an RFC 3339 timestamp or Unix milliseconds", http.StatusBadRequest)
+				return
+			}
+			points[i].AsOf = &t
+		}
+	}
+
+	diff, err := services.DiffBoard(whiteboardID, points[0], points[1])
+	if err != nil {
+		writeServiceError(w, err, "Failed to compare the whiteboard versions")
+		return
+	}
+
+	switch query.Get("format") {
+	case "", "json":
+		json.NewEncoder(w).Encode(diff)
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(diff.RenderSVG())
+	default:
+		http.Error(w, "format must be json or svg", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,309 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"sketchive/internal/services"
+	"time"
+)
+
+// Defaults for text elements created without explicit typography
+const (
+	defaultFontFamily = "sans-serif"
+	defaultFontSize   = 16
+)
+
+// AddElement creates an element (rectangle, ellipse, line, arrow, polygon, text) on a whiteboard
+func AddElement(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var element db.Element
+	err := json.NewDecoder(r.Body).Decode(&element)
+	if err != nil {
+		log.Println("Error decoding element data:", err)
+		http.Error(w, "Error decoding element", http.StatusBadRequest)
+		return
+	}
+	element.WhiteboardID = whiteboardID
+
+	err = prepareElement(&element)
+	if err != nil {
+		log.Println("Invalid element:", err)
+		http.Error(w, "Invalid element: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	element.LayerID, err = services.ResolveLayer(whiteboardID, element.LayerID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to find the element's layer")
+		return
+	}
+	element.CreatedAt = time.Now()
+
+	err = db.InsertElement(&element, services.LogElements(whiteboardID, element.OwnerID, services.LogElementAdded))
+	if err != nil {
+		log.Println("Error inserting element into database:", err)
+		http.Error(w, "Error inserting element", http.StatusInternalServerError)
+		return
+	}
+	services.IndexElements(whiteboardID, element)
+	services.RecordAdd(whiteboardID, element.OwnerID, services.ContentIDs{ElementIDs: []int{element.ID}})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(element)
+}
+
+// UpdateElement replaces the geometry, style and type specific data of an element,
+// which is how elements are moved, resized and edited. userID, who makes the change, is required.
+func UpdateElement(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	elementID, ok := intFromPath(w, r, "elementID")
+	if !ok {
+		return
+	}
+	userID, ok := actorFromQuery(w, r)
+	if !ok {
+		return
+	}
+
+	existing, err := db.GetElementByID(whiteboardID, elementID)
+	if err != nil || existing.Deleted {
+		log.Println("Error fetching element to update:", err)
+		http.Error(w, "Element not found", http.StatusNotFound)
+		return
+	}
+
+	var element db.Element
+	err = json.NewDecoder(r.Body).Decode(&element)
+	if err != nil {
+		log.Println("Error decoding element data:", err)
+		http.Error(w, "Error decoding element", http.StatusBadRequest)
+		return
+	}
+	// Content on a locked layer can't change, and can't be moved onto one
+	err = services.EnsureLayerEditable(whiteboardID, existing.LayerID)
+	if err == nil && element.LayerID != 0 && element.LayerID != existing.LayerID {
+		err = services.EnsureLayerEditable(whiteboardID, element.LayerID)
+	}
+	if err != nil {
+		writeServiceError(w, err, "Failed to check the element's layer")
+		return
+	}
+	if element.LayerID == 0 {
+		element.LayerID = existing.LayerID
+	}
+
+	element.ID = existing.ID
+	element.WhiteboardID = existing.WhiteboardID
+	element.OwnerID = existing.OwnerID
+	element.Type = existing.Type
+	element.CreatedAt = existing.CreatedAt
+	// A partial update keeps the image blob and the text body unless new ones are given
+	if element.Image == nil {
+		element.Image = existing.Image
+	}
+	if element.Text == nil {
+		element.Text = existing.Text
+	}
+
+	err = prepareElement(&element)
+	if err != nil {
+		log.Println("Invalid element:", err)
+		http.Error(w, "Invalid element: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	followed, err := db.UpdateElement(&element, services.Following(element.ID),
+		services.LogElements(whiteboardID, userID, services.LogElementsUpdated))
+	if errors.Is(err, db.ErrElementNotFound) {
+		http.Error(w, "Element not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Error updating element:", err)
+		http.Error(w, "Failed to update element", http.StatusInternalServerError)
+		return
+	}
+	services.IndexElements(whiteboardID, element)
+	services.RecordElementEdit(whiteboardID, userID, existing, &element)
+	if err := services.ElementsChanged(whiteboardID, userID, followed, element.ID); err != nil {
+		log.Println("Error updating the element's groups:", err)
+		http.Error(w, "Failed to update the element's groups", http.StatusInternalServerError)
+		return
+	}
+	services.ConnectorsUpdated(whiteboardID, userID, followed)
+
+	json.NewEncoder(w).Encode(element)
+}
+
+// GetElementsByWhiteboard returns the non-deleted elements of a whiteboard
+func GetElementsByWhiteboard(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	elements, err := db.GetElementsByWhiteboardID(whiteboardID)
+	if err != nil {
+		log.Println("Error retrieving elements from database:", err)
+		http.Error(w, "Failed to retrieve elements", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(elements)
+}
+
+// DeleteElement marks a single element of a whiteboard as deleted. userID, who deletes it and
+// can undo the deletion, is required.
+func DeleteElement(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	elementID, ok := intFromPath(w, r, "elementID")
+	if !ok {
+		return
+	}
+	userID, ok := actorFromQuery(w, r)
+	if !ok {
+		return
+	}
+
+	existing, err := db.GetElementByID(whiteboardID, elementID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to get element")
+		return
+	}
+	err = services.EnsureLayerEditable(whiteboardID, existing.LayerID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to check the element's layer")
+		return
+	}
+
+	followed, err := db.MarkElementsDeleted(whiteboardID, []int{elementID}, services.Following(elementID),
+		services.LogDeleted(whiteboardID, userID), services.LogElements(whiteboardID, userID, services.LogElementsUpdated))
+	if err != nil {
+		log.Println("Error deleting element:", err)
+		http.Error(w, "Failed to delete element", http.StatusInternalServerError)
+		return
+	}
+	services.UnindexElements(whiteboardID, elementID)
+	services.RecordErase(whiteboardID, userID, services.ContentIDs{ElementIDs: []int{elementID}})
+	if err := services.ElementsDeleted(whiteboardID, userID, followed, elementID); err != nil {
+		log.Println("Error updating the element's groups:", err)
+		http.Error(w, "Failed to update the element's groups", http.StatusInternalServerError)
+		return
+	}
+	services.ConnectorsUpdated(whiteboardID, userID, followed)
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Element deleted successfully"})
+}
+
+// EraseElements marks the elements touched by the eraser box as deleted.
+// Unlike stroke erasing, the elements are tested against their real outline,
+// so erasing inside an unfilled rectangle or next to a diagonal line leaves it alone.
+// userID, who erases and can undo the erase, is required.
+func EraseElements(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := actorFromQuery(w, r)
+	if !ok {
+		return
+	}
+
+	var eraserBox geometry.Rect
+	err := json.NewDecoder(r.Body).Decode(&eraserBox)
+	if err != nil {
+		log.Println("Error decoding eraser bounding box data:", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	erased, err := services.EraseElementsInBox(whiteboardID, userID, eraserBox)
+	if err != nil {
+		log.Println("Error erasing elements:", err)
+		http.Error(w, "Failed to erase elements", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Erased %d elements on whiteboard ID %d\n", len(erased), whiteboardID)
+	json.NewEncoder(w).Encode(map[string]any{"erased": erased})
+}
+
+// prepareElement fills in defaults, validates the element, computes its size and bounding box
+// and checks that it stays on the board's canvas
+func prepareElement(element *db.Element) error {
+	element.Deleted = false
+
+	// Arrows and connectors point at their last point unless the client says otherwise
+	if (element.Type == db.ElementArrow || element.Type == db.ElementConnector) && element.EndArrowhead == "" {
+		element.EndArrowhead = db.ArrowheadTriangle
+	}
+	if element.Type == db.ElementConnector {
+		if err := services.PrepareConnector(element); err != nil {
+			return err
+		}
+	}
+	if element.Type == db.ElementText && element.Text != nil {
+		applyTextDefaults(element.Text)
+	}
+	if element.Type == db.ElementSticky {
+		if err := services.PrepareSticky(element); err != nil {
+			return err
+		}
+	}
+	if element.Type == db.ElementImage && element.Image != nil {
+		// Image details always come from the stored blob, never from the client
+		blob, err := db.GetBlobByHash(element.Image.BlobHash)
+		if err != nil {
+			return fmt.Errorf("image blob %q: %w", element.Image.BlobHash, err)
+		}
+		element.Image = imagePropsFromBlob(blob)
+	}
+	return placeElement(element)
+}
+
+// placeElement validates a prepared element, computes its size and bounding box and checks
+// that it stays on the board's canvas
+func placeElement(element *db.Element) error {
+	err := geometry.ValidateElement(element)
+	if err != nil {
+		return err
+	}
+	geometry.SyncElementBox(element)
+	geometry.MeasureTextElement(element)
+
+	bounds, err := geometry.ElementBounds(element)
+	if err != nil {
+		return err
+	}
+	element.MinX, element.MaxX, element.MinY, element.MaxY = bounds.MinX, bounds.MaxX, bounds.MinY, bounds.MaxY
+	return services.ValidateElementPlacement(element)
+}
+
+func applyTextDefaults(t *db.TextProps) {
+	if t.FontFamily == "" {
+		t.FontFamily = defaultFontFamily
+	}
+	if t.FontSize == 0 {
+		t.FontSize = defaultFontSize
+	}
+	if t.Align == "" {
+		t.Align = db.AlignLeft
+	}
+	if t.Color == "" {
+		t.Color = "#000000"
+	}
+}
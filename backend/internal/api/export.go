@@ -0,0 +1,203 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"sketchive/internal/services"
+	"strconv"
+	"time"
+)
+
+// exportOptionsFromQuery reads the options shared by every export format:
+//
+//	crop=content|canvas              what to export when no region is given
+//	x, y, width, height              a board region to export instead
+//	background=<color>|transparent   defaults to white
+//	padding=<board units>            added around the exported area
+func exportOptionsFromQuery(r *http.Request) (services.ExportOptions, error) {
+	query := r.URL.Query()
+	options := services.ExportOptions{Crop: query.Get("crop"), Background: "#ffffff"}
+	if query.Has("background") {
+		options.Background = query.Get("background")
+	}
+
+	var err error
+	if value := query.Get("padding"); value != "" {
+		if options.Padding, err = strconv.ParseFloat(value, 64); err != nil {
+			return options, errors.New("invalid padding")
+		}
+	}
+
+	if query.Has("x") || query.Has("y") || query.Has("width") || query.Has("height") {
+		var region [4]float64
+		for i, name := range []string{"x", "y", "width", "height"} {
+			if region[i], err = strconv.ParseFloat(query.Get(name), 64); err != nil {
+				return options, errors.New("a region needs numeric x, y, width and height")
+			}
+			if err := geometry.CheckCoordinate(name, region[i]); err != nil {
+				return options, err
+			}
+		}
+		options.Region = &geometry.Rect{MinX: region[0], MinY: region[1], MaxX: region[0] + region[2], MaxY: region[1] + region[3]}
+	}
+	return options, nil
+}
+
+// prepareExport reads the export options and collects the board content, writing the error
+// response itself and returning nil when either fails
+func prepareExport(w http.ResponseWriter, r *http.Request) *services.BoardExport {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return nil
+	}
+	options, err := exportOptionsFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	export, err := services.PrepareExport(whiteboardID, options)
+	if err != nil {
+		writeServiceError(w, err, "Failed to export the whiteboard")
+		return nil
+	}
+	return export
+}
+
+// ExportSVG renders the visible content of a whiteboard as an SVG document, with images
+// embedded so the file stands on its own
+func ExportSVG(w http.ResponseWriter, r *http.Request) {
+	export := prepareExport(w, r)
+	if export == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="whiteboard-%d.svg"`, export.Whiteboard.ID))
+	w.Write(export.RenderSVG(embedImage))
+}
+
+// ExportPNG renders the visible content of a whiteboard as a PNG image. Besides the shared
+// export options it takes either scale=<pixels per board unit> or pixelWidth and/or
+// pixelHeight to fit the exported area into.
+func ExportPNG(w http.ResponseWriter, r *http.Request) {
+	export := prepareExport(w, r)
+	if export == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	var options services.PNGOptions
+	var err error
+	if value := query.Get("scale"); value != "" {
+		if options.Scale, err = strconv.ParseFloat(value, 64); err != nil {
+			http.Error(w, "Invalid scale", http.StatusBadRequest)
+			return
+		}
+	}
+	for _, size := range []struct {
+		name  string
+		value *int
+	}{{"pixelWidth", &options.Width}, {"pixelHeight", &options.Height}} {
+		if value := query.Get(size.name); value != "" {
+			if *size.value, err = strconv.Atoi(value); err != nil {
+				http.Error(w, "Invalid "+size.name, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	content, err := export.RenderPNG(options, decodeImage)
+	if err != nil {
+		writeServiceError(w, err, "Failed to export the whiteboard")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="whiteboard-%d.png"`, export.Whiteboard.ID))
+	w.Write(content)
+}
+
+// ExportPDF renders the visible content of a whiteboard as a PDF document. Besides the shared
+// export options it takes:
+//
+//	paging=single|tiles|frames        one page, tiles at a fixed scale or a page per frame
+//	pageSize=a3|a4|a5|letter|legal|tabloid
+//	orientation=auto|portrait|landscape
+//	scale=<points per board unit>     the scale of tiles
+//	titlePage=false                   leaves out the page naming the board
+func ExportPDF(w http.ResponseWriter, r *http.Request) {
+	export := prepareExport(w, r)
+	if export == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	options := services.PDFOptions{PageSize: query.Get("pageSize"), Orientation: query.Get("orientation"),
+		Paging: query.Get("paging"), TitlePage: true}
+	var err error
+	if value := query.Get("scale"); value != "" {
+		if options.Scale, err = strconv.ParseFloat(value, 64); err != nil {
+			http.Error(w, "Invalid scale", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("titlePage"); value != "" {
+		if options.TitlePage, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "Invalid titlePage", http.StatusBadRequest)
+			return
+		}
+	}
+
+	content, err := export.RenderPDF(options, time.Now(), decodeImage)
+	if err != nil {
+		writeServiceError(w, err, "Failed to export the whiteboard")
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="whiteboard-%d.pdf"`, export.Whiteboard.ID))
+	w.Write(content)
+}
+
+// decodeImage reads and decodes an image blob for a raster export
+func decodeImage(props *db.ImageProps) (image.Image, error) {
+	content, err := readBlob(props.BlobHash)
+	if err == nil {
+		var img image.Image
+		if img, _, err = image.Decode(bytes.NewReader(content)); err == nil {
+			return img, nil
+		}
+	}
+	log.Printf("Error decoding blob %s for an export, drawing a placeholder: %v\n", props.BlobHash, err)
+	return nil, err
+}
+
+// embedImage returns an image blob as a data URI, or the blob route when it can't be read
+func embedImage(image *db.ImageProps) string {
+	link := "/blobs/" + image.BlobHash
+	content, err := readBlob(image.BlobHash)
+	if err != nil {
+		log.Printf("Error embedding blob %s in an export, linking it instead: %v\n", image.BlobHash, err)
+		return link
+	}
+	return "data:" + image.MimeType + ";base64," + base64.StdEncoding.EncodeToString(content)
+}
+
+// readBlob returns the content of a stored blob
+func readBlob(hash string) ([]byte, error) {
+	if blobStore == nil {
+		return nil, errors.New("no blob store is configured")
+	}
+	content, err := blobStore.Open(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	return io.ReadAll(content)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"sketchive/internal/services"
+	"strconv"
+)
+
+// GetGroups returns the groups of a whiteboard with their members
+func GetGroups(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	groups, err := db.GetGroupsByWhiteboardID(whiteboardID)
+	if err != nil {
+		log.Println("Error fetching groups (GetGroups()):", err)
+		http.Error(w, "Failed to get groups", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(groups)
+}
+
+// CreateGroup groups strokes, elements and other groups so they are selected and transformed as one
+func CreateGroup(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		UserID int `json:"userID"`
+		services.ContentIDs
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("Error decoding group request:", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	group, err := services.CreateGroup(whiteboardID, request.UserID, request.ContentIDs)
+	if err != nil {
+		writeServiceError(w, err, "Failed to create group")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(group)
+}
+
+// Ungroup removes a group, leaving its members on the board. The optional userID
+// query parameter names who ungrouped it in the broadcast event.
+func Ungroup(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	groupID, ok := intFromPath(w, r, "groupID")
+	if !ok {
+		return
+	}
+	userID, _ := strconv.Atoi(r.URL.Query().Get("userID"))
+
+	err := services.Ungroup(whiteboardID, userID, groupID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to ungroup")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Group removed successfully"})
+}
+
+// TransformContent moves, rotates and scales strokes, elements and groups in one atomic step.
+// Grouped items always bring the rest of their group along.
+func TransformContent(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		UserID int `json:"userID"`
+		services.ContentIDs
+		Transform geometry.Transform `json:"transform"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("Error decoding transform request:", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := services.TransformContent(whiteboardID, request.UserID, request.ContentIDs, request.Transform)
+	if err != nil {
+		writeServiceError(w, err, "Failed to transform content")
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
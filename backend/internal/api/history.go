@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sketchive/internal/services"
+	"strconv"
+)
+
+// GetHistory lists the operations a user can undo and redo on a whiteboard, given as ?userID=
+func GetHistory(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	userID, err := strconv.Atoi(r.URL.Query().Get("userID"))
+	if err != nil {
+		http.Error(w, "Missing or invalid userID", http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(services.GetHistory(whiteboardID, userID))
+}
+
+// Undo reverts the last operation the user made on the whiteboard
+func Undo(w http.ResponseWriter, r *http.Request) {
+	historyStep(w, r, services.Undo, "Failed to undo")
+}
+
+// Redo applies the user's last undone operation again
+func Redo(w http.ResponseWriter, r *http.Request) {
+	historyStep(w, r, services.Redo, "Failed to redo")
+}
+
+func historyStep(w http.ResponseWriter, r *http.Request, step func(whiteboardID, userID int) (services.HistoryResult, error), message string) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		UserID int `json:"userID"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("Error decoding undo/redo request:", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := step(whiteboardID, request.UserID)
+	if err != nil {
+		writeServiceError(w, err, message)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
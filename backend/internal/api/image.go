@@ -0,0 +1,247 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"image"
+	_ "image/gif" // register decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"sketchive/internal/blob"
+	"sketchive/internal/db"
+	"sketchive/internal/services"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxImageSize is the largest image file accepted by UploadImage
+	maxImageSize = 10 << 20
+	// maxImageDimension caps the pixel width and height of uploaded images
+	maxImageDimension = 16384
+)
+
+// allowedImageTypes are the sniffed content types UploadImage accepts
+var allowedImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+// blobStore keeps uploaded images, should be set in main.go
+var blobStore blob.Store
+
+func SetBlobStore(store blob.Store) {
+	blobStore = store
+}
+
+func imagePropsFromBlob(b *db.Blob) *db.ImageProps {
+	return &db.ImageProps{
+		BlobHash:      b.Hash,
+		MimeType:      b.MimeType,
+		NaturalWidth:  b.Width,
+		NaturalHeight: b.Height,
+	}
+}
+
+// UploadImage stores an uploaded image and places it on the whiteboard as an image element.
+// The request is multipart/form-data with the file in "image" and optional x, y, width,
+// height, rotation, ownerID and layerID fields. Width and height default to the image's natural size.
+// Identical files are stored only once.
+func UploadImage(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	if blobStore == nil {
+		log.Println("Error: image upload called without a blob store")
+		http.Error(w, "Image uploads are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Leave some room for the other form fields around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageSize+1<<20)
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Image is larger than 10MB", http.StatusRequestEntityTooLarge)
+			return
+		}
+		log.Println("Error reading uploaded image:", err)
+		http.Error(w, "Missing image file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxImageSize {
+		http.Error(w, "Image is larger than 10MB", http.StatusRequestEntityTooLarge)
+		return
+	}
+	content, err := io.ReadAll(io.LimitReader(file, maxImageSize+1))
+	if err != nil {
+		log.Println("Error reading uploaded image:", err)
+		http.Error(w, "Failed to read image", http.StatusBadRequest)
+		return
+	}
+	if len(content) > maxImageSize {
+		http.Error(w, "Image is larger than 10MB", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Trust the bytes, not the client's Content-Type
+	mimeType := http.DetectContentType(content)
+	if !allowedImageTypes[mimeType] {
+		log.Printf("Rejected upload of type %s\n", mimeType)
+		http.Error(w, "Unsupported image type "+mimeType+", use PNG, JPEG or GIF", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		log.Println("Error decoding image header:", err)
+		http.Error(w, "Invalid image file", http.StatusBadRequest)
+		return
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > maxImageDimension || config.Height > maxImageDimension {
+		http.Error(w, "Image dimensions are out of range", http.StatusBadRequest)
+		return
+	}
+
+	sum := sha256.Sum256(content)
+	newBlob := db.Blob{
+		Hash:      hex.EncodeToString(sum[:]),
+		MimeType:  mimeType,
+		Size:      int64(len(content)),
+		Width:     config.Width,
+		Height:    config.Height,
+		CreatedAt: time.Now(),
+	}
+
+	// The form and the layer are checked before the blob is stored, so a bad request leaves no blob behind
+	element := db.Element{
+		WhiteboardID: whiteboardID,
+		Type:         db.ElementImage,
+		Width:        float64(config.Width),
+		Height:       float64(config.Height),
+		Image:        imagePropsFromBlob(&newBlob),
+	}
+	for field, target := range map[string]*int{"ownerID": &element.OwnerID, "layerID": &element.LayerID} {
+		value := r.FormValue(field)
+		if value == "" {
+			continue
+		}
+		*target, err = strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid "+field+" value", http.StatusBadRequest)
+			return
+		}
+	}
+	for field, target := range map[string]*float64{
+		"x": &element.X, "y": &element.Y, "width": &element.Width, "height": &element.Height, "rotation": &element.Rotation,
+	} {
+		value := r.FormValue(field)
+		if value == "" {
+			continue
+		}
+		*target, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			http.Error(w, "Invalid "+field+" value", http.StatusBadRequest)
+			return
+		}
+	}
+	element.LayerID, err = services.ResolveLayer(whiteboardID, element.LayerID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to find the image's layer")
+		return
+	}
+	// The image details come from the checked upload, as they would from the stored blob
+	err = placeElement(&element)
+	if err != nil {
+		log.Println("Invalid image element:", err)
+		http.Error(w, "Invalid element: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = storeBlob(&newBlob, content)
+	if err != nil {
+		log.Println("Error storing image blob:", err)
+		http.Error(w, "Failed to store image", http.StatusInternalServerError)
+		return
+	}
+	element.CreatedAt = time.Now()
+
+	err = db.InsertElement(&element, services.LogElements(whiteboardID, element.OwnerID, services.LogElementAdded))
+	if err != nil {
+		log.Println("Error inserting image element:", err)
+		http.Error(w, "Error inserting image element", http.StatusInternalServerError)
+		return
+	}
+	services.IndexElements(whiteboardID, element)
+	services.RecordAdd(whiteboardID, element.OwnerID, services.ContentIDs{ElementIDs: []int{element.ID}})
+
+	log.Printf("Placed image %s (%dx%d) on whiteboard ID %d\n", newBlob.Hash, config.Width, config.Height, whiteboardID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(element)
+}
+
+// storeBlob writes the content to the blob store unless an identical file is already there
+func storeBlob(b *db.Blob, content []byte) error {
+	exists, err := blobStore.Exists(b.Hash)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := blobStore.Put(b.Hash, bytes.NewReader(content)); err != nil {
+			return err
+		}
+	} else {
+		log.Printf("Blob %s already stored, reusing it\n", b.Hash)
+	}
+	return db.InsertBlob(b)
+}
+
+// GetBlob serves the content of a stored blob. Blobs are content addressed,
+// so the response can be cached forever.
+func GetBlob(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+
+	info, err := db.GetBlobByHash(hash)
+	if err == db.ErrBlobNotFound {
+		http.Error(w, "Blob not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Error fetching blob info:", err)
+		http.Error(w, "Failed to get blob", http.StatusInternalServerError)
+		return
+	}
+	if blobStore == nil {
+		http.Error(w, "Image uploads are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	content, err := blobStore.Open(hash)
+	if err == blob.ErrNotFound {
+		log.Printf("Error: blob %s is recorded but missing from the store\n", hash)
+		http.Error(w, "Blob not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Error opening blob:", err)
+		http.Error(w, "Failed to get blob", http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", info.MimeType)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	io.Copy(w, content)
+}
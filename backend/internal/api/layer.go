@@ -0,0 +1,222 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sketchive/internal/db"
+	"sketchive/internal/services"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetLayers returns the layers of a whiteboard from bottom to top
+func GetLayers(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	layers, err := db.GetLayersByWhiteboardID(whiteboardID)
+	if err != nil {
+		log.Println("Error fetching layers (GetLayers()):", err)
+		http.Error(w, "Failed to get layers", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(layers)
+}
+
+// CreateLayer adds a new layer on top of the whiteboard's existing layers
+func CreateLayer(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Name    string `json:"name"`
+		Visible *bool  `json:"visible"`
+		Locked  bool   `json:"locked"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("Error decoding layer (CreateLayer()):", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	layer := db.Layer{
+		WhiteboardID: whiteboardID,
+		Name:         strings.TrimSpace(request.Name),
+		Visible:      request.Visible == nil || *request.Visible,
+		Locked:       request.Locked,
+		CreatedAt:    time.Now(),
+	}
+	if layer.Name == "" {
+		http.Error(w, "Layer name can't be empty", http.StatusBadRequest)
+		return
+	}
+
+	// The optional userID is logged as the layer's author
+	userID, _ := strconv.Atoi(r.URL.Query().Get("userID"))
+	err = db.InsertLayer(&layer, services.LogOperation(whiteboardID, userID, services.LogLayerCreated, &layer))
+	if err != nil {
+		log.Println("Error inserting layer (CreateLayer()):", err)
+		http.Error(w, "Failed to create layer", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(layer)
+}
+
+// UpdateLayer renames a layer or changes its visibility and lock flag.
+// Fields left out of the request keep their value.
+func UpdateLayer(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	layerID, ok := intFromPath(w, r, "layerID")
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Name    *string `json:"name"`
+		Visible *bool   `json:"visible"`
+		Locked  *bool   `json:"locked"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("Error decoding layer (UpdateLayer()):", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	layer, err := db.GetLayerByID(whiteboardID, layerID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to get layer")
+		return
+	}
+	if request.Name != nil {
+		layer.Name = strings.TrimSpace(*request.Name)
+		if layer.Name == "" {
+			http.Error(w, "Layer name can't be empty", http.StatusBadRequest)
+			return
+		}
+	}
+	if request.Visible != nil {
+		layer.Visible = *request.Visible
+	}
+	if request.Locked != nil {
+		layer.Locked = *request.Locked
+	}
+
+	userID, _ := strconv.Atoi(r.URL.Query().Get("userID"))
+	err = db.UpdateLayer(layer, services.LogOperation(whiteboardID, userID, services.LogLayerUpdated, layer))
+	if err != nil {
+		log.Println("Error updating layer (UpdateLayer()):", err)
+		http.Error(w, "Failed to update layer", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(layer)
+}
+
+// ReorderLayers sets the z-order of the layers. The request lists every layer ID from bottom to top.
+func ReorderLayers(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		LayerIDs []int `json:"layerIDs"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("Error decoding layer order (ReorderLayers()):", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, _ := strconv.Atoi(r.URL.Query().Get("userID"))
+	err = db.ReorderLayers(whiteboardID, request.LayerIDs, services.LogOperation(whiteboardID, userID, services.LogLayersReordered, request))
+	if err != nil {
+		writeServiceError(w, err, "Failed to reorder layers")
+		return
+	}
+
+	layers, err := db.GetLayersByWhiteboardID(whiteboardID)
+	if err != nil {
+		log.Println("Error fetching layers (ReorderLayers()):", err)
+		http.Error(w, "Failed to get layers", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(layers)
+}
+
+// DeleteLayer removes a layer. With ?moveTo=<layerID> its content moves to that layer,
+// otherwise the content is deleted along with it.
+func DeleteLayer(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	layerID, ok := intFromPath(w, r, "layerID")
+	if !ok {
+		return
+	}
+
+	moveTo := 0
+	if value := r.URL.Query().Get("moveTo"); value != "" {
+		var err error
+		moveTo, err = strconv.Atoi(value)
+		if err != nil || moveTo == layerID {
+			http.Error(w, "Invalid moveTo layer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	userID, _ := strconv.Atoi(r.URL.Query().Get("userID"))
+
+	// Deleting the layer's content saves the board as a version first
+	if moveTo == 0 {
+		layer, err := db.GetLayerByID(whiteboardID, layerID)
+		if err != nil {
+			writeServiceError(w, err, "Failed to get layer")
+			return
+		}
+		_, err = services.AutoSnapshot(whiteboardID, userID, fmt.Sprintf("Before deleting layer %q", layer.Name))
+		if err != nil {
+			writeServiceError(w, err, "Failed to save the board before deleting the layer")
+			return
+		}
+	}
+
+	deleted := services.LogOperation(whiteboardID, userID, services.LogLayerDeleted, services.LogPayload{LayerID: layerID, MoveTo: moveTo})
+	// Connectors bound to deleted elements follow in the same transaction, and are logged with it
+	strokeIDs, elementIDs, followed, err := db.DeleteLayer(whiteboardID, layerID, moveTo, services.Following,
+		deleted, services.LogElements(whiteboardID, userID, services.LogElementsUpdated))
+	if err != nil {
+		writeServiceError(w, err, "Failed to delete layer")
+		return
+	}
+	services.ForgetBoard(whiteboardID)
+	services.RefreshContentBounds(whiteboardID)
+	if err := services.StrokesDeleted(whiteboardID, userID, strokeIDs...); err != nil {
+		writeServiceError(w, err, "Failed to update the groups of the layer's strokes")
+		return
+	}
+	if err := services.ElementsDeleted(whiteboardID, userID, followed, elementIDs...); err != nil {
+		writeServiceError(w, err, "Failed to update the groups of the layer's elements")
+		return
+	}
+	services.ConnectorsUpdated(whiteboardID, userID, followed)
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Layer deleted successfully"})
+}
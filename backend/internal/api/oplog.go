@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sketchive/internal/services"
+	"strconv"
+)
+
+// GetOperationLog returns a page of a whiteboard's operation log. ?after=<seq> starts after
+// that entry and ?limit= sets the page size.
+func GetOperationLog(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var after, limit int
+	for name, target := range map[string]*int{"after": &after, "limit": &limit} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			http.Error(w, name+" must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		*target = n
+	}
+
+	entries, err := services.GetLog(whiteboardID, after, limit)
+	if err != nil {
+		writeServiceError(w, err, "Failed to get the operation log")
+		return
+	}
+	json.NewEncoder(w).Encode(entries)
+}
+
+// CheckOperationLog replays a whiteboard's operation log and reports where the stored
+// strokes and elements differ from the replay
+func CheckOperationLog(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := services.CheckConsistency(whiteboardID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to check the operation log")
+		return
+	}
+	json.NewEncoder(w).Encode(report)
+}
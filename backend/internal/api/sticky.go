@@ -0,0 +1,222 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sketchive/internal/services"
+	"strconv"
+)
+
+// GetStickies returns the sticky notes of a whiteboard
+func GetStickies(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	stickies, err := services.GetStickies(whiteboardID)
+	if err != nil {
+		log.Println("Error fetching sticky notes (GetStickies()):", err)
+		http.Error(w, "Failed to get sticky notes", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(stickies)
+}
+
+// stickyRequest is the body of sticky note create and update requests
+type stickyRequest struct {
+	UserID int `json:"userID"`
+	services.StickyChanges
+}
+
+// CreateSticky adds a sticky note authored by userID. Position, size, color and text
+// are optional; new notes are 200x200 and yellow.
+func CreateSticky(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var request stickyRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("Error decoding sticky note (CreateSticky()):", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sticky, err := services.CreateSticky(whiteboardID, request.UserID, request.StickyChanges)
+	if err != nil {
+		writeServiceError(w, err, "Failed to create sticky note")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sticky)
+}
+
+// UpdateSticky changes the fields given in the request and keeps the others
+func UpdateSticky(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	stickyID, ok := intFromPath(w, r, "stickyID")
+	if !ok {
+		return
+	}
+
+	var request stickyRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("Error decoding sticky note (UpdateSticky()):", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sticky, err := services.UpdateSticky(whiteboardID, request.UserID, stickyID, request.StickyChanges)
+	if err != nil {
+		writeServiceError(w, err, "Failed to update sticky note")
+		return
+	}
+
+	json.NewEncoder(w).Encode(sticky)
+}
+
+// DeleteSticky removes a sticky note; the userID query parameter names who deleted it
+func DeleteSticky(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	stickyID, ok := intFromPath(w, r, "stickyID")
+	if !ok {
+		return
+	}
+	userID, _ := strconv.Atoi(r.URL.Query().Get("userID"))
+
+	err := services.DeleteSticky(whiteboardID, userID, stickyID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to delete sticky note")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Sticky note deleted successfully"})
+}
+
+// StartVoteSession opens a round of voting on the board's sticky notes
+func StartVoteSession(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		UserID       int `json:"userID"`
+		VotesPerUser int `json:"votesPerUser"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("Error decoding vote session (StartVoteSession()):", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	session, err := services.StartVoteSession(whiteboardID, request.UserID, request.VotesPerUser)
+	if err != nil {
+		writeServiceError(w, err, "Failed to start vote session")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+// EndVoteSession closes the open vote session and returns the final tallies
+func EndVoteSession(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := strconv.Atoi(r.URL.Query().Get("userID"))
+
+	results, err := services.EndVoteSession(whiteboardID, userID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to end vote session")
+		return
+	}
+
+	json.NewEncoder(w).Encode(results)
+}
+
+// GetVotes returns the tallies of the current or last vote session. With the userID
+// query parameter the response also says how many votes that user has left.
+func GetVotes(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := strconv.Atoi(r.URL.Query().Get("userID"))
+
+	results, err := services.GetVoteResults(whiteboardID, userID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to get votes")
+		return
+	}
+
+	json.NewEncoder(w).Encode(results)
+}
+
+// CastVote puts one of the user's votes on a sticky note
+func CastVote(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	stickyID, ok := intFromPath(w, r, "stickyID")
+	if !ok {
+		return
+	}
+
+	var request struct {
+		UserID int `json:"userID"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("Error decoding vote (CastVote()):", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	results, err := services.CastVote(whiteboardID, request.UserID, stickyID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to cast vote")
+		return
+	}
+
+	json.NewEncoder(w).Encode(results)
+}
+
+// RetractVote takes back one of the user's votes on a sticky note; the user is given
+// by the userID query parameter
+func RetractVote(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	stickyID, ok := intFromPath(w, r, "stickyID")
+	if !ok {
+		return
+	}
+	userID, _ := strconv.Atoi(r.URL.Query().Get("userID"))
+
+	results, err := services.RetractVote(whiteboardID, userID, stickyID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to retract vote")
+		return
+	}
+
+	json.NewEncoder(w).Encode(results)
+}
@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"sketchive/internal/services"
+	"sketchive/internal/style"
 	"strconv"
 	"time"
 )
@@ -46,6 +50,17 @@ func AddStroke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = geometry.ValidatePath(newStroke.Path)
+	if err != nil {
+		http.Error(w, "Invalid stroke: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = style.NormalizeStroke(&newStroke)
+	if err != nil {
+		http.Error(w, "Invalid stroke style: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Calculate bounding box for the stroke
 	minX, maxX, minY, maxY, err := calculateBoundingBox(newStroke.Path)
 	if err != nil {
@@ -58,15 +73,30 @@ func AddStroke(w http.ResponseWriter, r *http.Request) {
 	newStroke.MinY = minY
 	newStroke.MaxY = maxY
 
+	// Board limits: points per stroke, width and the canvas area
+	err = services.ValidateStroke(&newStroke)
+	if err != nil {
+		writeServiceError(w, err, "Failed to check the stroke against the board's canvas")
+		return
+	}
+
+	newStroke.LayerID, err = services.ResolveLayer(newStroke.WhiteboardID, newStroke.LayerID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to find the stroke's layer")
+		return
+	}
+
 	newStroke.CreatedAt = time.Now()
 	log.Printf("Decoded stroke data: %+v\n", newStroke)
 
-	err = db.InsertStroke(&newStroke)
+	err = db.InsertStroke(&newStroke, services.LogStrokes(newStroke.WhiteboardID, newStroke.OwnerID, services.LogStrokeAdded))
 	if err != nil {
 		log.Println("Error inserting stroke into database:", err)
 		http.Error(w, "Error inserting stroke", http.StatusInternalServerError)
 		return
 	}
+	services.IndexStrokes(newStroke.WhiteboardID, newStroke)
+	services.RecordAdd(newStroke.WhiteboardID, newStroke.OwnerID, services.ContentIDs{StrokeIDs: []int{newStroke.ID}})
 
 	log.Println("Stroke inserted successfully")
 	json.NewEncoder(w).Encode(newStroke)
@@ -116,6 +146,7 @@ func UpdateStrokeForDeletion(w http.ResponseWriter, r *http.Request) {
 
 	var eraserBox struct {
 		WhiteboardID int     `json:"whiteboardID"`
+		UserID       int     `json:"userID"` // the user who can undo the erase
 		MinX         float64 `json:"minX"`
 		MaxX         float64 `json:"maxX"`
 		MinY         float64 `json:"minY"`
@@ -132,8 +163,9 @@ func UpdateStrokeForDeletion(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Marking strokes for deletion in whiteboard ID %d with bounding box (%f, %f, %f, %f)\n",
 		eraserBox.WhiteboardID, eraserBox.MinX, eraserBox.MaxX, eraserBox.MinY, eraserBox.MaxY)
 
-	// Update strokes in the database that fall within the eraser bounding box
-	err = db.MarkStrokesDeletedByBoundingBox(eraserBox.WhiteboardID, eraserBox.MinX, eraserBox.MaxX, eraserBox.MinY, eraserBox.MaxY)
+	// Mark the strokes whose bounding box overlaps the eraser, found through the board's spatial index
+	box := geometry.Rect{MinX: eraserBox.MinX, MaxX: eraserBox.MaxX, MinY: eraserBox.MinY, MaxY: eraserBox.MaxY}
+	_, err = services.EraseStrokesInBox(eraserBox.WhiteboardID, eraserBox.UserID, box)
 	if err != nil {
 		log.Println("Error marking strokes as deleted:", err)
 		http.Error(w, "Failed to mark strokes as deleted", http.StatusInternalServerError)
@@ -144,3 +176,108 @@ func UpdateStrokeForDeletion(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Strokes marked as deleted successfully"})
 }
+
+// TransformStrokes applies a move, rotation and scale to a set of strokes of a whiteboard
+func TransformStrokes(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		UserID    int                `json:"userID"`
+		StrokeIDs []int              `json:"strokeIDs"`
+		Transform geometry.Transform `json:"transform"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("Error decoding transform request:", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	strokes, err := services.TransformStrokes(whiteboardID, request.UserID, request.StrokeIDs, request.Transform)
+	if err != nil {
+		writeServiceError(w, err, "Failed to transform strokes")
+		return
+	}
+
+	json.NewEncoder(w).Encode(strokes)
+}
+
+// GetStrokesPage returns the strokes of a whiteboard intersecting an optional viewport
+// (minX, maxX, minY, maxY query parameters), one page at a time. Pass the returned
+// nextCursor as cursor to get the following page; limit sets the page size.
+// With ?asOf= it returns the board's content at that time instead, see GetContentAsOf.
+func GetStrokesPage(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+
+	var viewport *geometry.Rect
+	if query.Has("minX") || query.Has("maxX") || query.Has("minY") || query.Has("maxY") {
+		var box geometry.Rect
+		for name, target := range map[string]*float64{"minX": &box.MinX, "maxX": &box.MaxX, "minY": &box.MinY, "maxY": &box.MaxY} {
+			value, err := strconv.ParseFloat(query.Get(name), 64)
+			if err != nil || math.IsNaN(value) {
+				http.Error(w, "Viewport needs numeric minX, maxX, minY and maxY", http.StatusBadRequest)
+				return
+			}
+			*target = value
+		}
+		viewport = &box
+	}
+
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if query.Has("asOf") {
+		GetContentAsOf(w, r, whiteboardID, viewport, limit)
+		return
+	}
+
+	page, err := services.GetStrokesPage(whiteboardID, viewport, limit, query.Get("cursor"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to retrieve strokes")
+		return
+	}
+
+	json.NewEncoder(w).Encode(page)
+}
+
+// GetContentAsOf returns the strokes and elements a whiteboard had at the time given as ?asOf=,
+// either an RFC 3339 timestamp or Unix milliseconds. Strokes erased since are included.
+// Like the current content it is limited to the viewport and paged with limit and cursor.
+func GetContentAsOf(w http.ResponseWriter, r *http.Request, whiteboardID int, viewport *geometry.Rect, limit int) {
+	value := r.URL.Query().Get("asOf")
+	asOf, err := parseTimestamp(value)
+	if err != nil {
+		http.Error(w, "asOf must be an RFC 3339 timestamp or Unix milliseconds", http.StatusBadRequest)
+		return
+	}
+
+	content, err := services.ContentPageAt(whiteboardID, asOf, viewport, limit, r.URL.Query().Get("cursor"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to get the board as of "+value)
+		return
+	}
+	json.NewEncoder(w).Encode(content)
+}
+
+// parseTimestamp reads a query parameter time, either RFC 3339 or Unix milliseconds, as UTC
+func parseTimestamp(value string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t.UTC(), err
+}
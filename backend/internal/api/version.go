@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sketchive/internal/services"
+)
+
+// CreateVersion saves the current content of a whiteboard as a named version
+func CreateVersion(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Name   string `json:"name"`
+		UserID int    `json:"userID"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("Error decoding version request:", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	version, err := services.CreateVersion(whiteboardID, request.UserID, request.Name)
+	if err != nil {
+		writeServiceError(w, err, "Failed to save version")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(version)
+}
+
+// GetVersions lists the versions of a whiteboard with their author and time, newest first
+func GetVersions(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := services.GetVersions(whiteboardID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to get versions")
+		return
+	}
+	json.NewEncoder(w).Encode(versions)
+}
+
+// GetVersion returns a version along with the board content it holds
+func GetVersion(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	versionID, ok := intFromPath(w, r, "versionID")
+	if !ok {
+		return
+	}
+
+	version, err := services.GetVersion(whiteboardID, versionID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to get version")
+		return
+	}
+	json.NewEncoder(w).Encode(version)
+}
+
+// RestoreVersion brings the whiteboard back to a version. The response names the automatic
+// version holding the content the restore replaced.
+func RestoreVersion(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	versionID, ok := intFromPath(w, r, "versionID")
+	if !ok {
+		return
+	}
+
+	var request struct {
+		UserID int `json:"userID"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("Error decoding restore request:", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := services.RestoreVersion(whiteboardID, request.UserID, versionID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to restore version")
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
@@ -2,9 +2,11 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"sketchive/internal/db"
+	"sketchive/internal/services"
 	"strconv"
 	"time"
 )
@@ -80,8 +82,9 @@ func UpdateWhiteboard(w http.ResponseWriter, r *http.Request) {
 	}
 
 	updatedBoard.UpdatedAt = time.Now()
-	// Correct function call with integer ID
-	err = db.UpdateWhiteboard(id, &updatedBoard)
+	// The optional userID is logged as the user who changed the board
+	userID, _ := strconv.Atoi(r.URL.Query().Get("userID"))
+	err = db.UpdateWhiteboard(id, &updatedBoard, services.LogOperation(id, userID, services.LogBoardUpdated, &updatedBoard))
 	if err != nil {
 		log.Println("Error updating whiteboard (UpdateWhiteboard()):", err)
 		http.Error(w, "Failed to update the whiteboard", http.StatusInternalServerError)
@@ -113,6 +116,8 @@ func DeleteWhiteboard(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to delete whiteboard", http.StatusInternalServerError)
 		return
 	}
+	services.ForgetBoard(id)
+	services.ForgetHistory(id)
 
 	json.NewEncoder(w).Encode(map[string]string{"message": "Whiteboard deleted successfully"})
 }
@@ -132,15 +137,181 @@ func ClearWhiteboardHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Call the DB function to clear strokes for the whiteboard
-	err = db.ClearStrokesByWhiteboardID(whiteboardID)
+	// The optional userID lets that user undo the clear from their history
+	userID, _ := strconv.Atoi(r.URL.Query().Get("userID"))
+
+	cleared, err := services.ClearBoard(whiteboardID, userID)
 	if err != nil {
-		log.Println("Error deleting whiteboard (ClearWhiteboardHandler()):", err)
-		http.Error(w, "Failed to clear strokes", http.StatusInternalServerError)
+		log.Println("Error clearing whiteboard (ClearWhiteboardHandler()):", err)
+		http.Error(w, "Failed to clear whiteboard", http.StatusInternalServerError)
 		return
 	}
 
 	log.Printf("Successfully cleared strokes for whiteboard ID %d\n", whiteboardID)
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Whiteboard cleared successfully"})
+	json.NewEncoder(w).Encode(map[string]any{"message": "Whiteboard cleared successfully", "clear": cleared})
+}
+
+// GetClears lists the clears of a whiteboard, newest first, with their undo windows
+func GetClears(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	clears, err := services.GetClears(whiteboardID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to retrieve clears")
+		return
+	}
+	json.NewEncoder(w).Encode(clears)
+}
+
+// UndoClear brings back what a clear removed. Any editor or admin can, within the undo window.
+func UndoClear(w http.ResponseWriter, r *http.Request) {
+	whiteboardID, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	clearID, ok := intFromPath(w, r, "clearID")
+	if !ok {
+		return
+	}
+
+	var request struct {
+		UserID int `json:"userID"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Println("Error decoding undo clear request:", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := services.UndoClear(whiteboardID, clearID, request.UserID)
+	if err != nil {
+		writeServiceError(w, err, "Failed to undo the clear")
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// whiteboardIDFromPath reads the {id} path value of routes like /whiteboards/{id}/elements.
+// It writes the error response itself and returns false when the ID is missing or invalid.
+func whiteboardIDFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	return intFromPath(w, r, "id")
+}
+
+// intFromPath reads an integer path value, writing a 400 response when it is missing or invalid
+func intFromPath(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	value := r.PathValue(name)
+	if value == "" {
+		log.Printf("Error: missing %s in request path %s", name, r.URL.Path)
+		http.Error(w, "Missing "+name+" in path", http.StatusBadRequest)
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Error converting %s to int: %v", name, err)
+		http.Error(w, "Invalid "+name+" in path", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// actorFromQuery reads the ?userID= of the user making a change, writing a 400 response when
+// it is missing or invalid, so the log can say who did what
+func actorFromQuery(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("userID"))
+	if err != nil || userID <= 0 {
+		http.Error(w, "Missing or invalid userID", http.StatusBadRequest)
+		return 0, false
+	}
+	return userID, true
+}
+
+// writeServiceError maps errors from the services and db packages onto HTTP responses:
+// bad requests become 400, missing rights 403, missing items 404, locked content 409 and
+// anything else a 500 with the given message
+func writeServiceError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, db.ErrStrokeNotFound), errors.Is(err, db.ErrElementNotFound), errors.Is(err, db.ErrLayerNotFound),
+		errors.Is(err, db.ErrGroupNotFound), errors.Is(err, db.ErrNoVoteSession), errors.Is(err, db.ErrWhiteboardNotFound),
+		errors.Is(err, db.ErrVersionNotFound), errors.Is(err, db.ErrClearNotFound), errors.Is(err, db.ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrLocked), errors.Is(err, db.ErrLastLayer), errors.Is(err, db.ErrAlreadyGrouped),
+		errors.Is(err, db.ErrVoteSessionOpen), errors.Is(err, db.ErrVoteLimit), errors.Is(err, db.ErrNoVote),
+		errors.Is(err, services.ErrNothingToUndo), errors.Is(err, services.ErrNothingToRedo),
+		errors.Is(err, db.ErrClearUndone), errors.Is(err, db.ErrUndoWindowClosed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("%s: %v", message, err)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+// GetWhiteboardContent returns everything drawn on the visible layers of a whiteboard:
+// its layers, freehand strokes and elements in drawing order, and its groups
+func GetWhiteboardContent(w http.ResponseWriter, r *http.Request) {
+	id, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// Loads start from the board's checkpoint rather than reading every stroke row
+	strokes, elements, err := services.LoadBoardContent(id)
+	if err != nil {
+		writeServiceError(w, err, "Failed to retrieve the whiteboard content")
+		return
+	}
+
+	layers, err := db.GetLayersByWhiteboardID(id)
+	if err != nil {
+		log.Println("Error retrieving layers (GetWhiteboardContent()):", err)
+		http.Error(w, "Failed to retrieve layers", http.StatusInternalServerError)
+		return
+	}
+
+	groups, err := db.GetGroupsByWhiteboardID(id)
+	if err != nil {
+		log.Println("Error retrieving groups (GetWhiteboardContent()):", err)
+		http.Error(w, "Failed to retrieve groups", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"whiteboardID": id,
+		"layers":       layers,
+		"strokes":      strokes,
+		"elements":     elements,
+		"groups":       groups,
+	})
+}
+
+// SelectContent returns the IDs of the strokes and elements inside a rectangle or lasso
+func SelectContent(w http.ResponseWriter, r *http.Request) {
+	id, ok := whiteboardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var request services.SelectRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("Error decoding selection request (SelectContent()):", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := services.Select(id, request)
+	if err != nil {
+		writeServiceError(w, err, "Failed to select content")
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
 }
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrBlobNotFound is returned when no blob row exists for a hash
+var ErrBlobNotFound = errors.New("blob not found")
+
+// Blob describes an uploaded file kept in the blob store, addressed by its SHA-256 hash
+type Blob struct {
+	Hash      string    `json:"hash"`
+	MimeType  string    `json:"mimeType"`
+	Size      int64     `json:"size"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InsertBlob records a blob. Inserting a hash that already exists is a no-op,
+// so two concurrent uploads of the same file don't fail.
+func InsertBlob(blob *Blob) error {
+	if err := insertBlob(db, blob); err != nil {
+		log.Println("Error inserting blob:", err)
+		return err
+	}
+	return nil
+}
+
+func insertBlob(ex execer, blob *Blob) error {
+	query := `INSERT IGNORE INTO blobs (hash, mime_type, size, width, height, created_at)
+              VALUES (?, ?, ?, ?, ?, ?)`
+
+	_, err := ex.Exec(query, blob.Hash, blob.MimeType, blob.Size, blob.Width, blob.Height, blob.CreatedAt)
+	return err
+}
+
+// GetBlobByHash returns the blob with the given hash, or ErrBlobNotFound
+func GetBlobByHash(hash string) (*Blob, error) {
+	var blob Blob
+	var createdAtStr string
+
+	query := `SELECT hash, mime_type, size, width, height, created_at FROM blobs WHERE hash = ?`
+	err := db.QueryRow(query, hash).Scan(&blob.Hash, &blob.MimeType, &blob.Size, &blob.Width, &blob.Height, &createdAtStr)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrBlobNotFound
+		}
+		log.Println("Error fetching blob:", err)
+		return nil, err
+	}
+
+	blob.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+	if err != nil {
+		log.Println("Error parsing blob created_at:", err)
+		return nil, err
+	}
+	return &blob, nil
+}
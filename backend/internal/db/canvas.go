@@ -0,0 +1,117 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Canvas modes
+const (
+	// CanvasInfinite lets content go anywhere within MaxExtent of the origin
+	CanvasInfinite = "infinite"
+	// CanvasBounded keeps content inside a fixed drawable area
+	CanvasBounded = "bounded"
+)
+
+// ErrWhiteboardNotFound is returned when a whiteboard doesn't exist
+var ErrWhiteboardNotFound = errors.New("whiteboard not found")
+
+// Bounds is an axis aligned box on a board
+type Bounds struct {
+	MinX float64 `json:"minX"`
+	MaxX float64 `json:"maxX"`
+	MinY float64 `json:"minY"`
+	MaxY float64 `json:"maxY"`
+}
+
+// CanvasSettings limits where and how much can be drawn on a board.
+// Zero values mean the server defaults, which the services package fills in.
+type CanvasSettings struct {
+	Mode               string  `json:"mode"`
+	Bounds             *Bounds `json:"bounds,omitempty"`    // the drawable area of a bounded canvas
+	MaxExtent          float64 `json:"maxExtent,omitempty"` // how far from the origin content of an infinite canvas may reach
+	MaxPointsPerStroke int     `json:"maxPointsPerStroke,omitempty"`
+	MaxStrokeWidth     float64 `json:"maxStrokeWidth,omitempty"`
+}
+
+// GetCanvasSettings returns the stored canvas settings of a whiteboard. Boards that never
+// had settings saved get zero settings.
+func GetCanvasSettings(whiteboardID int) (CanvasSettings, error) {
+	var settings CanvasSettings
+	var canvas []byte
+	err := db.QueryRow(`SELECT canvas FROM whiteboards WHERE id = ?`, whiteboardID).Scan(&canvas)
+	if err == sql.ErrNoRows {
+		return settings, fmt.Errorf("whiteboard %d: %w", whiteboardID, ErrWhiteboardNotFound)
+	}
+	if err != nil {
+		log.Println("Error fetching canvas settings:", err)
+		return settings, err
+	}
+	if len(canvas) > 0 {
+		if err := json.Unmarshal(canvas, &settings); err != nil {
+			return settings, fmt.Errorf("decoding canvas settings of whiteboard %d: %w", whiteboardID, err)
+		}
+	}
+	return settings, nil
+}
+
+// UpdateCanvasSettings stores the canvas settings of a whiteboard
+func UpdateCanvasSettings(whiteboardID int, settings CanvasSettings, journals ...Journal) error {
+	canvas, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	err = withLog(whiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		// Locking the row also makes sure the board exists, MySQL reports 0 rows for an unchanged row
+		if err := lockWhiteboard(tx, whiteboardID); err != nil {
+			return Change{}, err
+		}
+		_, err := tx.Exec(`UPDATE whiteboards SET canvas = ? WHERE id = ?`, canvas, whiteboardID)
+		return Change{}, err
+	})
+	if err != nil {
+		log.Println("Error updating canvas settings:", err)
+		return err
+	}
+	return nil
+}
+
+// GetContentBounds returns the stored box around a whiteboard's content, nil for an empty board
+func GetContentBounds(whiteboardID int) (*Bounds, error) {
+	var minX, maxX, minY, maxY sql.NullFloat64
+	err := db.QueryRow(`SELECT content_minX, content_maxX, content_minY, content_maxY FROM whiteboards WHERE id = ?`,
+		whiteboardID).Scan(&minX, &maxX, &minY, &maxY)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("whiteboard %d: %w", whiteboardID, ErrWhiteboardNotFound)
+	}
+	if err != nil {
+		log.Println("Error fetching content bounds:", err)
+		return nil, err
+	}
+	return nullableBounds(minX, maxX, minY, maxY), nil
+}
+
+// UpdateContentBounds stores the box around a whiteboard's content, nil for an empty board
+func UpdateContentBounds(whiteboardID int, bounds *Bounds) error {
+	var args []any
+	if bounds != nil {
+		args = []any{bounds.MinX, bounds.MaxX, bounds.MinY, bounds.MaxY, whiteboardID}
+	} else {
+		args = []any{nil, nil, nil, nil, whiteboardID}
+	}
+	_, err := db.Exec(`UPDATE whiteboards SET content_minX = ?, content_maxX = ?, content_minY = ?, content_maxY = ? WHERE id = ?`, args...)
+	if err != nil {
+		log.Println("Error updating content bounds:", err)
+	}
+	return err
+}
+
+func nullableBounds(minX, maxX, minY, maxY sql.NullFloat64) *Bounds {
+	if !minX.Valid || !maxX.Valid || !minY.Valid || !maxY.Valid {
+		return nil
+	}
+	return &Bounds{MinX: minX.Float64, MaxX: maxX.Float64, MinY: minY.Float64, MaxY: maxY.Float64}
+}
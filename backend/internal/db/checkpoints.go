@@ -0,0 +1,66 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Checkpoint is the encoded content of a whiteboard as of an entry of its operation log
+type Checkpoint struct {
+	WhiteboardID int
+	Format       int // how State is encoded
+	Seq          int // the last operation log entry the checkpoint includes
+	StrokeCount  int
+	ElementCount int
+	Checksum     string // SHA-256 of State, in hex
+	State        []byte
+	CreatedAt    time.Time
+}
+
+// SaveCheckpoint stores the checkpoint of a whiteboard, replacing the previous one
+func SaveCheckpoint(checkpoint *Checkpoint) error {
+	query := `INSERT INTO board_checkpoints (whiteboard_id, format, seq, stroke_count, element_count, checksum, state, created_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+              ON DUPLICATE KEY UPDATE format = VALUES(format), seq = VALUES(seq), stroke_count = VALUES(stroke_count),
+                  element_count = VALUES(element_count), checksum = VALUES(checksum), state = VALUES(state), created_at = VALUES(created_at)`
+	_, err := db.Exec(query, checkpoint.WhiteboardID, checkpoint.Format, checkpoint.Seq, checkpoint.StrokeCount,
+		checkpoint.ElementCount, checkpoint.Checksum, checkpoint.State, checkpoint.CreatedAt)
+	if err != nil {
+		log.Println("Error saving checkpoint:", err)
+	}
+	return err
+}
+
+// GetCheckpoint returns the checkpoint of a whiteboard, or nil when it has none
+func GetCheckpoint(whiteboardID int) (*Checkpoint, error) {
+	query := `SELECT whiteboard_id, format, seq, stroke_count, element_count, checksum, state, created_at
+              FROM board_checkpoints WHERE whiteboard_id = ?`
+
+	var checkpoint Checkpoint
+	var createdAtStr string
+	err := db.QueryRow(query, whiteboardID).Scan(&checkpoint.WhiteboardID, &checkpoint.Format, &checkpoint.Seq,
+		&checkpoint.StrokeCount, &checkpoint.ElementCount, &checkpoint.Checksum, &checkpoint.State, &createdAtStr)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Println("Error fetching checkpoint:", err)
+		return nil, err
+	}
+	checkpoint.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing checkpoint created_at: %w", err)
+	}
+	return &checkpoint, nil
+}
+
+// DeleteCheckpoint removes the checkpoint of a whiteboard, if it has one
+func DeleteCheckpoint(whiteboardID int) error {
+	_, err := db.Exec(`DELETE FROM board_checkpoints WHERE whiteboard_id = ?`, whiteboardID)
+	if err != nil {
+		log.Println("Error deleting checkpoint:", err)
+	}
+	return err
+}
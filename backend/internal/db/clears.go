@@ -0,0 +1,241 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	// ErrClearNotFound is returned when a clear doesn't exist on the whiteboard
+	ErrClearNotFound = errors.New("clear not found")
+	// ErrClearUndone is returned when a clear was already undone
+	ErrClearUndone = errors.New("clear was already undone")
+	// ErrUndoWindowClosed is returned when the time to undo a clear is over
+	ErrUndoWindowClosed = errors.New("the clear can no longer be undone")
+)
+
+// Clear is a recorded clear of a whiteboard. The strokes and elements it removed are
+// tombstoned with its ID until it is undone.
+type Clear struct {
+	ID           int        `json:"id"`
+	WhiteboardID int        `json:"whiteboardID"`
+	ClearedBy    int        `json:"clearedBy,omitempty"` // 0 when the user is unknown
+	VersionID    int        `json:"versionID,omitempty"` // the snapshot taken before the clear, 0 for an empty board
+	StrokeCount  int        `json:"strokeCount"`
+	ElementCount int        `json:"elementCount"`
+	Groups       []Group    `json:"-"` // the groups the clear removed
+	CreatedAt    time.Time  `json:"created_at"`
+	UndoUntil    time.Time  `json:"undoUntil"`
+	UndoneAt     *time.Time `json:"undoneAt,omitempty"`
+	UndoneBy     int        `json:"undoneBy,omitempty"`
+}
+
+// ClearWhiteboardContent records a clear, marks every stroke and element of its whiteboard as
+// deleted with the clear's ID, so it can be undone, and removes the board's groups, which the
+// clear keeps. It runs in one transaction with the board locked, and sets the clear's ID,
+// counts and groups. It returns the IDs of the items it cleared.
+func ClearWhiteboardContent(cleared *Clear, journals ...Journal) (strokeIDs, elementIDs []int, err error) {
+	err = withLog(cleared.WhiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		if err := lockWhiteboard(tx, cleared.WhiteboardID); err != nil {
+			return Change{}, err
+		}
+		for _, table := range []struct {
+			name string
+			ids  *[]int
+		}{{"strokes", &strokeIDs}, {"elements", &elementIDs}} {
+			*table.ids, err = selectIDsForUpdate(tx, `SELECT id FROM `+table.name+` WHERE whiteboard_id = ? AND deleted = false FOR UPDATE`,
+				cleared.WhiteboardID)
+			if err != nil {
+				return Change{}, err
+			}
+		}
+		// Read with the items locked, so no group can form around them anymore
+		if cleared.Groups, err = getGroups(tx, cleared.WhiteboardID); err != nil {
+			return Change{}, err
+		}
+		groups, err := json.Marshal(cleared.Groups)
+		if err != nil {
+			return Change{}, fmt.Errorf("marshaling cleared groups: %w", err)
+		}
+
+		cleared.StrokeCount, cleared.ElementCount = len(strokeIDs), len(elementIDs)
+		query := `INSERT INTO board_clears (whiteboard_id, cleared_by, version_id, stroke_count, element_count, removed_groups, created_at, undo_until)
+                  VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		result, err := tx.Exec(query, cleared.WhiteboardID, nullableID(cleared.ClearedBy), nullableID(cleared.VersionID),
+			cleared.StrokeCount, cleared.ElementCount, groups, cleared.CreatedAt, cleared.UndoUntil)
+		if err != nil {
+			return Change{}, err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return Change{}, err
+		}
+		cleared.ID = int(id)
+
+		for _, table := range []string{"strokes", "elements"} {
+			_, err = tx.Exec(`UPDATE `+table+` SET deleted = true, clear_id = ? WHERE whiteboard_id = ? AND deleted = false`,
+				cleared.ID, cleared.WhiteboardID)
+			if err != nil {
+				return Change{}, err
+			}
+		}
+		if err := clearGroups(tx, cleared.WhiteboardID); err != nil {
+			return Change{}, err
+		}
+		return Change{StrokeIDs: strokeIDs, ElementIDs: elementIDs}, nil
+	})
+	if err != nil {
+		log.Printf("Error clearing content for whiteboard ID %d: %v", cleared.WhiteboardID, err)
+		return nil, nil, err
+	}
+	log.Printf("Successfully cleared %d strokes and %d elements for whiteboard ID %d", len(strokeIDs), len(elementIDs), cleared.WhiteboardID)
+	return strokeIDs, elementIDs, nil
+}
+
+// UndoClear brings back the items a clear tombstoned and marks the clear as undone by userID.
+// Items restored or removed in other ways since keep their state. The groups the clear removed
+// are recreated around the restored items; they are the record of the change. It fails once
+// the clear was undone or its undo window closed before now. The restored items are returned
+// ordered by ID.
+func UndoClear(whiteboardID, clearID, userID int, now time.Time, journals ...Journal) (cleared *Clear, strokes []Stroke, elements []Element, err error) {
+	err = withLog(whiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		locked, err := scanClear(tx.QueryRow(`SELECT `+clearColumns+` FROM board_clears WHERE whiteboard_id = ? AND id = ? FOR UPDATE`,
+			whiteboardID, clearID))
+		if err == sql.ErrNoRows {
+			return Change{}, fmt.Errorf("clear %d: %w", clearID, ErrClearNotFound)
+		}
+		if err != nil {
+			return Change{}, err
+		}
+		if locked.UndoneAt != nil {
+			return Change{}, fmt.Errorf("clear %d: %w", clearID, ErrClearUndone)
+		}
+		if now.After(locked.UndoUntil) {
+			return Change{}, fmt.Errorf("clear %d: %w", clearID, ErrUndoWindowClosed)
+		}
+
+		var strokeIDs, elementIDs []int
+		for _, table := range []struct {
+			name string
+			ids  *[]int
+		}{{"strokes", &strokeIDs}, {"elements", &elementIDs}} {
+			*table.ids, err = selectIDsForUpdate(tx,
+				`SELECT id FROM `+table.name+` WHERE whiteboard_id = ? AND clear_id = ? AND deleted = true FOR UPDATE`, whiteboardID, clearID)
+			if err != nil {
+				return Change{}, err
+			}
+			_, err = tx.Exec(`UPDATE `+table.name+` SET deleted = false, clear_id = NULL WHERE whiteboard_id = ? AND clear_id = ? AND deleted = true`,
+				whiteboardID, clearID)
+			if err != nil {
+				return Change{}, err
+			}
+		}
+		if strokes, err = getStrokesByIDs(tx, whiteboardID, strokeIDs); err != nil {
+			return Change{}, err
+		}
+		if elements, err = getElementsByIDs(tx, whiteboardID, elementIDs); err != nil {
+			return Change{}, err
+		}
+
+		items := map[GroupMember]int{}
+		for _, id := range strokeIDs {
+			items[GroupMember{Kind: ItemStroke, ID: id}] = id
+		}
+		for _, id := range elementIDs {
+			items[GroupMember{Kind: ItemElement, ID: id}] = id
+		}
+		groups, err := recreateGroups(tx, whiteboardID, locked.Groups, items)
+		if err != nil {
+			return Change{}, err
+		}
+
+		if _, err := tx.Exec(`UPDATE board_clears SET undone_at = ?, undone_by = ? WHERE id = ?`, now, nullableID(userID), clearID); err != nil {
+			return Change{}, err
+		}
+		locked.UndoneAt, locked.UndoneBy = &now, userID
+		cleared = &locked
+		return Change{Strokes: strokes, Elements: elements, Record: groups}, nil
+	})
+	if err != nil {
+		log.Printf("Error undoing clear %d of whiteboard ID %d: %v", clearID, whiteboardID, err)
+		return nil, nil, nil, err
+	}
+	return cleared, strokes, elements, nil
+}
+
+// GetClears returns the clears of a whiteboard, newest first
+func GetClears(whiteboardID int) ([]Clear, error) {
+	rows, err := db.Query(`SELECT `+clearColumns+` FROM board_clears WHERE whiteboard_id = ? ORDER BY created_at DESC, id DESC`, whiteboardID)
+	if err != nil {
+		log.Println("Error fetching clears:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	clears := []Clear{}
+	for rows.Next() {
+		cleared, err := scanClear(rows)
+		if err != nil {
+			log.Println("Error scanning clear:", err)
+			return nil, err
+		}
+		clears = append(clears, cleared)
+	}
+	return clears, rows.Err()
+}
+
+const clearColumns = `id, whiteboard_id, cleared_by, version_id, stroke_count, element_count, removed_groups, created_at, undo_until, undone_at, undone_by`
+
+func scanClear(row rowScanner) (Clear, error) {
+	var cleared Clear
+	var clearedBy, versionID, undoneBy sql.NullInt64
+	var groups []byte
+	var createdAtStr, undoUntilStr string
+	var undoneAtStr sql.NullString
+	err := row.Scan(&cleared.ID, &cleared.WhiteboardID, &clearedBy, &versionID, &cleared.StrokeCount, &cleared.ElementCount, &groups,
+		&createdAtStr, &undoUntilStr, &undoneAtStr, &undoneBy)
+	if err != nil {
+		return cleared, err
+	}
+	cleared.ClearedBy, cleared.VersionID, cleared.UndoneBy = int(clearedBy.Int64), int(versionID.Int64), int(undoneBy.Int64)
+
+	if err := json.Unmarshal(groups, &cleared.Groups); err != nil {
+		return cleared, fmt.Errorf("unmarshaling clear %d groups: %w", cleared.ID, err)
+	}
+	if cleared.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr); err != nil {
+		return cleared, fmt.Errorf("parsing clear %d created_at: %w", cleared.ID, err)
+	}
+	if cleared.UndoUntil, err = time.Parse("2006-01-02 15:04:05", undoUntilStr); err != nil {
+		return cleared, fmt.Errorf("parsing clear %d undo_until: %w", cleared.ID, err)
+	}
+	if undoneAtStr.Valid {
+		undoneAt, err := time.Parse("2006-01-02 15:04:05", undoneAtStr.String)
+		if err != nil {
+			return cleared, fmt.Errorf("parsing clear %d undone_at: %w", cleared.ID, err)
+		}
+		cleared.UndoneAt = &undoneAt
+	}
+	return cleared, nil
+}
+
+// selectIDsForUpdate runs a query selecting one ID column and returns the IDs
+func selectIDsForUpdate(tx *sql.Tx, query string, args ...any) ([]int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,560 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Element types supported on a board besides freehand strokes
+const (
+	ElementRectangle = "rectangle"
+	ElementEllipse   = "ellipse"
+	ElementLine      = "line"
+	ElementArrow     = "arrow"
+	ElementPolygon   = "polygon"
+	ElementText      = "text"
+	ElementImage     = "image"
+	ElementSticky    = "sticky"
+	ElementConnector = "connector"
+	// ElementFrame is a named area of the board, e.g. one page of an export. Its name is the
+	// content of its text.
+	ElementFrame = "frame"
+)
+
+// Arrowhead styles for the ends of lines and arrows
+const (
+	ArrowheadNone     = "none"
+	ArrowheadTriangle = "triangle"
+	ArrowheadOpen     = "open"
+)
+
+// ElementStyle holds the stroke and fill styling shared by every element type
+type ElementStyle struct {
+	StrokeColor string  `json:"strokeColor"`
+	StrokeWidth float64 `json:"strokeWidth"`
+	FillColor   string  `json:"fillColor,omitempty"` // empty means no fill
+}
+
+// Horizontal alignments of text elements
+const (
+	AlignLeft   = "left"
+	AlignCenter = "center"
+	AlignRight  = "right"
+)
+
+// TextProps holds the content and typography of a text element
+type TextProps struct {
+	Content    string  `json:"content"`
+	FontFamily string  `json:"fontFamily"`
+	FontSize   float64 `json:"fontSize"`
+	Align      string  `json:"align"`
+	Color      string  `json:"color"`
+	WrapWidth  float64 `json:"wrapWidth,omitempty"` // 0 means lines only break at explicit newlines
+}
+
+// Connector anchors: the middle of a side of the bound element, its center,
+// or the side facing the other end of the connector
+const (
+	AnchorAuto   = "auto"
+	AnchorTop    = "top"
+	AnchorRight  = "right"
+	AnchorBottom = "bottom"
+	AnchorLeft   = "left"
+	AnchorCenter = "center"
+)
+
+// ConnectorEnd is one end of a connector. A bound end follows the element ElementID,
+// attached at Anchor or, when Position is set, at that fraction of the element's box
+// ({0, 0} top-left to {1, 1} bottom-right). A free end stays at Point.
+type ConnectorEnd struct {
+	ElementID int    `json:"elementID,omitempty"`
+	Anchor    string `json:"anchor,omitempty"`
+	Position  *Point `json:"position,omitempty"`
+	Point     *Point `json:"point,omitempty"`
+}
+
+// ConnectorProps holds the two ends of a connector element
+type ConnectorProps struct {
+	Start ConnectorEnd `json:"start"`
+	End   ConnectorEnd `json:"end"`
+}
+
+// ImageProps references the uploaded image shown by an image element.
+// The element's Width and Height are the displayed size, which may differ from the natural size.
+type ImageProps struct {
+	BlobHash      string `json:"blobHash"`
+	MimeType      string `json:"mimeType"`
+	NaturalWidth  int    `json:"naturalWidth"`
+	NaturalHeight int    `json:"naturalHeight"`
+}
+
+// Element is a board item described by its type and geometry instead of a freehand path.
+// Rectangles and ellipses use X/Y/Width/Height (top-left corner and size) and rotate
+// around their center by Rotation degrees. Lines, arrows and polygons use Points
+// in board coordinates. Text elements are positioned like boxes, with their size
+// measured by the server from Text. Image elements are boxes showing a stored blob.
+// Sticky notes are boxes filled with Style.FillColor, with Text wrapped inside them;
+// their author is the owner. Connectors are arrows whose Points the server computes
+// from the elements their ends are bound to.
+type Element struct {
+	ID             int             `json:"id"`
+	WhiteboardID   int             `json:"whiteboardID"`
+	OwnerID        int             `json:"ownerID"`
+	LayerID        int             `json:"layerID"`
+	Type           string          `json:"type"`
+	X              float64         `json:"x"`
+	Y              float64         `json:"y"`
+	Width          float64         `json:"width"`
+	Height         float64         `json:"height"`
+	Rotation       float64         `json:"rotation"`
+	Points         []Point         `json:"points,omitempty"`
+	StartArrowhead string          `json:"startArrowhead,omitempty"`
+	EndArrowhead   string          `json:"endArrowhead,omitempty"`
+	Style          ElementStyle    `json:"style"`
+	Text           *TextProps      `json:"text,omitempty"`
+	Image          *ImageProps     `json:"image,omitempty"`
+	Connector      *ConnectorProps `json:"connector,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Deleted        bool            `json:"deleted"`
+	MinX           float64         `json:"minX"`
+	MaxX           float64         `json:"maxX"`
+	MinY           float64         `json:"minY"`
+	MaxY           float64         `json:"maxY"`
+}
+
+// elementData is the type specific part of an element, stored in the data JSON column
+type elementData struct {
+	Points         []Point         `json:"points,omitempty"`
+	StartArrowhead string          `json:"startArrowhead,omitempty"`
+	EndArrowhead   string          `json:"endArrowhead,omitempty"`
+	Style          ElementStyle    `json:"style"`
+	Text           *TextProps      `json:"text,omitempty"`
+	Image          *ImageProps     `json:"image,omitempty"`
+	Connector      *ConnectorProps `json:"connector,omitempty"`
+}
+
+func (e *Element) marshalData() ([]byte, error) {
+	return json.Marshal(elementData{
+		Points:         e.Points,
+		StartArrowhead: e.StartArrowhead,
+		EndArrowhead:   e.EndArrowhead,
+		Style:          e.Style,
+		Text:           e.Text,
+		Image:          e.Image,
+		Connector:      e.Connector,
+	})
+}
+
+func (e *Element) unmarshalData(data []byte) error {
+	var d elementData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+	e.Points = d.Points
+	e.StartArrowhead = d.StartArrowhead
+	e.EndArrowhead = d.EndArrowhead
+	e.Style = d.Style
+	e.Text = d.Text
+	e.Image = d.Image
+	e.Connector = d.Connector
+	return nil
+}
+
+const elementColumns = `id, whiteboard_id, owner_id, layer_id, type, x, y, width, height, rotation, data, created_at, deleted, minX, maxX, minY, maxY`
+
+// ErrElementNotFound is returned when an element doesn't exist on the whiteboard
+var ErrElementNotFound = errors.New("element not found")
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanElement(row rowScanner) (Element, error) {
+	var element Element
+	var dataStr string      // Temporarily store data as string
+	var createdAtStr string // Temporarily store created_at as string
+	var layerID sql.NullInt64
+
+	err := row.Scan(&element.ID, &element.WhiteboardID, &element.OwnerID, &layerID, &element.Type, &element.X, &element.Y,
+		&element.Width, &element.Height, &element.Rotation, &dataStr, &createdAtStr, &element.Deleted,
+		&element.MinX, &element.MaxX, &element.MinY, &element.MaxY)
+	if err != nil {
+		return element, err
+	}
+
+	element.LayerID = int(layerID.Int64)
+
+	if err := element.unmarshalData([]byte(dataStr)); err != nil {
+		return element, fmt.Errorf("unmarshaling element %d data: %w", element.ID, err)
+	}
+
+	element.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+	if err != nil {
+		return element, fmt.Errorf("parsing element %d created_at: %w", element.ID, err)
+	}
+	return element, nil
+}
+
+// InsertElement inserts an element into the elements table and sets its ID
+func InsertElement(element *Element, journals ...Journal) error {
+	log.Printf("Inserting %s element with WhiteboardID: %v", element.Type, element.WhiteboardID)
+
+	data, err := element.marshalData()
+	if err != nil {
+		log.Println("Error marshaling element data:", err)
+		return err
+	}
+
+	err = withLog(element.WhiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		err := insertElement(tx, element, data)
+		return Change{Elements: []Element{*element}}, err
+	})
+	if err != nil {
+		log.Println("Error inserting element into database:", err)
+		return err
+	}
+	return nil
+}
+
+// insertElement inserts an element with its encoded data and sets its ID
+func insertElement(ex execer, element *Element, data []byte) error {
+	query := `INSERT INTO elements (whiteboard_id, owner_id, layer_id, type, x, y, width, height, rotation, data, created_at, deleted, minX, maxX, minY, maxY)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := ex.Exec(query, element.WhiteboardID, element.OwnerID, nullableID(element.LayerID), element.Type, element.X, element.Y,
+		element.Width, element.Height, element.Rotation, data, element.CreatedAt, element.Deleted,
+		element.MinX, element.MaxX, element.MinY, element.MaxY)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	element.ID = int(id)
+	return nil
+}
+
+// GetElementByID returns a single element of a whiteboard, deleted or not
+func GetElementByID(whiteboardID, elementID int) (*Element, error) {
+	query := `SELECT ` + elementColumns + ` FROM elements WHERE whiteboard_id = ? AND id = ?`
+
+	element, err := scanElement(db.QueryRow(query, whiteboardID, elementID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrElementNotFound
+		}
+		log.Println("Error fetching element:", err)
+		return nil, err
+	}
+	return &element, nil
+}
+
+// UpdateElement stores the geometry, data and bounding box of an existing element.
+// Type, owner and creation time never change. It fails with ErrElementNotFound when the
+// element doesn't exist or was deleted. The connectors follow rerouted in the same
+// transaction are returned.
+func UpdateElement(element *Element, follow Follow, journals ...Journal) ([]Element, error) {
+	data, err := element.marshalData()
+	if err != nil {
+		log.Println("Error marshaling element data:", err)
+		return nil, err
+	}
+
+	query := `UPDATE elements
+              SET layer_id = ?, x = ?, y = ?, width = ?, height = ?, rotation = ?, data = ?, minX = ?, maxX = ?, minY = ?, maxY = ?
+              WHERE whiteboard_id = ? AND id = ? AND deleted = false`
+
+	var followed []Element
+	err = withLog(element.WhiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		if _, err := lockElements(tx, element.WhiteboardID, []int{element.ID}); err != nil {
+			return Change{}, err
+		}
+		_, err := tx.Exec(query, nullableID(element.LayerID), element.X, element.Y, element.Width, element.Height, element.Rotation, data,
+			element.MinX, element.MaxX, element.MinY, element.MaxY, element.WhiteboardID, element.ID)
+		if err != nil {
+			return Change{}, err
+		}
+		followed, err = followElements(tx, element.WhiteboardID, follow)
+		return Change{Elements: append([]Element{*element}, followed...)}, err
+	})
+	if err != nil {
+		log.Println("Error updating element:", err)
+		return nil, err
+	}
+	return followed, nil
+}
+
+// Follow reroutes connectors in the transaction of a write to the elements they are bound to.
+// It is called once the write is done with every non-deleted connector of the board, locked,
+// and a lookup of the non-deleted elements as the transaction sees them. It changes the
+// connectors that must follow in place and returns them; they are stored with the write.
+type Follow func(connectors []Element, lookup func(ids []int) ([]Element, error)) ([]Element, error)
+
+// followElements runs a Follow in the transaction and stores the connectors it returns
+func followElements(tx *sql.Tx, whiteboardID int, follow Follow) ([]Element, error) {
+	if follow == nil {
+		return nil, nil
+	}
+	query := `SELECT ` + elementColumns + `
+			FROM elements
+			WHERE whiteboard_id = ? AND type = ? AND deleted = false
+			ORDER BY id ASC
+			FOR UPDATE`
+	rows, err := tx.Query(query, whiteboardID, ElementConnector)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	connectors := []Element{}
+	for rows.Next() {
+		connector, err := scanElement(rows)
+		if err != nil {
+			return nil, err
+		}
+		connectors = append(connectors, connector)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(connectors) == 0 {
+		return nil, nil
+	}
+
+	followed, err := follow(connectors, func(ids []int) ([]Element, error) {
+		return getElementsByIDs(tx, whiteboardID, ids)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range followed {
+		if err := updateElementGeometry(tx, &followed[i]); err != nil {
+			return nil, err
+		}
+	}
+	return followed, nil
+}
+
+// lockElements selects the given non-deleted elements FOR UPDATE, in the order of ids.
+// It fails with ErrElementNotFound if any of them is missing.
+func lockElements(tx *sql.Tx, whiteboardID int, ids []int) ([]Element, error) {
+	query := `SELECT ` + elementColumns + `
+			FROM elements
+			WHERE whiteboard_id = ? AND deleted = false AND id IN (` + placeholders(len(ids)) + `)
+			FOR UPDATE`
+
+	rows, err := tx.Query(query, idArgs(whiteboardID, ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := map[int]Element{}
+	for rows.Next() {
+		element, err := scanElement(rows)
+		if err != nil {
+			return nil, err
+		}
+		byID[element.ID] = element
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	elements := make([]Element, 0, len(ids))
+	for _, id := range ids {
+		element, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("element %d: %w", id, ErrElementNotFound)
+		}
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+// updateElementGeometry stores an element's geometry, data and bounding box
+func updateElementGeometry(tx *sql.Tx, element *Element) error {
+	data, err := element.marshalData()
+	if err != nil {
+		return err
+	}
+	query := `UPDATE elements
+              SET x = ?, y = ?, width = ?, height = ?, rotation = ?, data = ?, minX = ?, maxX = ?, minY = ?, maxY = ?
+              WHERE id = ?`
+	_, err = tx.Exec(query, element.X, element.Y, element.Width, element.Height, element.Rotation, data,
+		element.MinX, element.MaxX, element.MinY, element.MaxY, element.ID)
+	return err
+}
+
+// GetElementsByWhiteboardID returns the non-deleted elements on the visible layers of a whiteboard,
+// in drawing order: by layer from bottom to top, then by creation time
+func GetElementsByWhiteboardID(whiteboardID int) ([]Element, error) {
+	log.Printf("Fetching elements for WhiteboardID: %v", whiteboardID)
+
+	query := `SELECT ` + qualifyColumns("e", elementColumns) + `
+			FROM elements e LEFT JOIN layers l ON l.id = e.layer_id
+			WHERE e.whiteboard_id = ? AND e.deleted = false AND COALESCE(l.visible, true)
+			ORDER BY COALESCE(l.z_index, 0) ASC, e.created_at ASC, e.id ASC`
+
+	rows, err := db.Query(query, whiteboardID)
+	if err != nil {
+		log.Println("Error fetching elements from database:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	elements := []Element{}
+	for rows.Next() {
+		element, err := scanElement(rows)
+		if err != nil {
+			log.Println("Error scanning element data:", err)
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating element rows:", err)
+		return nil, err
+	}
+
+	return elements, nil
+}
+
+// GetElementsByIDs returns the non-deleted elements of a whiteboard with the given IDs, ordered by ID
+func GetElementsByIDs(whiteboardID int, ids []int) ([]Element, error) {
+	return getElementsByIDs(db, whiteboardID, ids)
+}
+
+func getElementsByIDs(q queryer, whiteboardID int, ids []int) ([]Element, error) {
+	elements := []Element{}
+	if len(ids) == 0 {
+		return elements, nil
+	}
+
+	query := `SELECT ` + elementColumns + `
+			FROM elements
+			WHERE whiteboard_id = ? AND deleted = false AND id IN (` + placeholders(len(ids)) + `)
+			ORDER BY id ASC`
+
+	rows, err := q.Query(query, idArgs(whiteboardID, ids)...)
+	if err != nil {
+		log.Println("Error fetching elements by ID:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		element, err := scanElement(rows)
+		if err != nil {
+			log.Println("Error scanning element data:", err)
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	return elements, rows.Err()
+}
+
+// GetAllElements returns every non-deleted element of a whiteboard, on any layer, ordered by ID
+func GetAllElements(whiteboardID int) ([]Element, error) {
+	return getAllElements(db, whiteboardID)
+}
+
+func getAllElements(q queryer, whiteboardID int) ([]Element, error) {
+	query := `SELECT ` + elementColumns + `
+			FROM elements
+			WHERE whiteboard_id = ? AND deleted = false
+			ORDER BY id ASC`
+
+	rows, err := q.Query(query, whiteboardID)
+	if err != nil {
+		log.Println("Error fetching all elements:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	elements := []Element{}
+	for rows.Next() {
+		element, err := scanElement(rows)
+		if err != nil {
+			log.Println("Error scanning element data:", err)
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	return elements, rows.Err()
+}
+
+// GetElementsByType returns the non-deleted elements of one type on a whiteboard, on any layer, ordered by ID
+func GetElementsByType(whiteboardID int, elementType string) ([]Element, error) {
+	query := `SELECT ` + elementColumns + `
+			FROM elements
+			WHERE whiteboard_id = ? AND type = ? AND deleted = false
+			ORDER BY id ASC`
+
+	rows, err := db.Query(query, whiteboardID, elementType)
+	if err != nil {
+		log.Println("Error fetching elements by type:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	elements := []Element{}
+	for rows.Next() {
+		element, err := scanElement(rows)
+		if err != nil {
+			log.Println("Error scanning element data:", err)
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	return elements, rows.Err()
+}
+
+// MarkElementsDeleted marks the given elements of a whiteboard as deleted and returns the
+// connectors follow rerouted in the same transaction
+func MarkElementsDeleted(whiteboardID int, ids []int, follow Follow, journals ...Journal) ([]Element, error) {
+	return DeleteContent(whiteboardID, nil, ids, follow, journals...)
+}
+
+// idArgs returns the query arguments for "whiteboard_id = ? AND id IN (...)"
+func idArgs(whiteboardID int, ids []int) []any {
+	args := make([]any, 0, len(ids)+1)
+	args = append(args, whiteboardID)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return args
+}
+
+// qualifyColumns prefixes every column of a comma separated list with a table alias
+func qualifyColumns(alias, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, part := range parts {
+		parts[i] = alias + "." + strings.TrimSpace(part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// nullableID stores 0 as NULL for optional foreign keys
+func nullableID(id int) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// placeholders returns "?, ?, ?" with n question marks for IN clauses
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
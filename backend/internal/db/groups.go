@@ -0,0 +1,341 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Kinds of board items that can be members of a group
+const (
+	ItemStroke  = "stroke"
+	ItemElement = "element"
+	ItemGroup   = "group"
+)
+
+var (
+	// ErrGroupNotFound is returned when a group doesn't exist on the whiteboard
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrAlreadyGrouped is returned when grouping an item that already belongs to a group
+	ErrAlreadyGrouped = errors.New("item already belongs to a group")
+)
+
+// GroupMember references a stroke, element or nested group
+type GroupMember struct {
+	Kind string `json:"kind"`
+	ID   int    `json:"id"`
+}
+
+// Group lets several board items be selected and transformed as one. Each item belongs
+// to at most one group; groups can be members of other groups. The bounding box covers
+// every member and is kept up to date by the services package.
+type Group struct {
+	ID           int           `json:"id"`
+	WhiteboardID int           `json:"whiteboardID"`
+	ParentID     int           `json:"parentID,omitempty"` // the group this group is nested in, 0 for top-level groups
+	Members      []GroupMember `json:"members"`
+	CreatedAt    time.Time     `json:"created_at"`
+	MinX         float64       `json:"minX"`
+	MaxX         float64       `json:"maxX"`
+	MinY         float64       `json:"minY"`
+	MaxY         float64       `json:"maxY"`
+}
+
+// itemTables maps member kinds to the table holding the items
+var itemTables = map[string]string{
+	ItemStroke:  "strokes",
+	ItemElement: "elements",
+	ItemGroup:   "board_groups",
+}
+
+// InsertGroup creates a group of existing items and sets its ID. It fails with ErrAlreadyGrouped
+// when a member is already part of another group, and with ErrStrokeNotFound, ErrElementNotFound
+// or ErrGroupNotFound when a member doesn't exist on the whiteboard.
+func InsertGroup(group *Group, journals ...Journal) error {
+	return withLog(group.WhiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		return Change{}, insertGroup(tx, group)
+	})
+}
+
+func insertGroup(tx *sql.Tx, group *Group) error {
+	for _, m := range group.Members {
+		if err := checkMember(tx, group.WhiteboardID, m); err != nil {
+			return err
+		}
+	}
+
+	query := `INSERT INTO board_groups (whiteboard_id, created_at, minX, maxX, minY, maxY) VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(query, group.WhiteboardID, group.CreatedAt, group.MinX, group.MaxX, group.MinY, group.MaxY)
+	if err != nil {
+		log.Println("Error inserting group:", err)
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	group.ID = int(id)
+
+	for _, m := range group.Members {
+		_, err := tx.Exec(`INSERT INTO group_members (group_id, member_kind, member_id) VALUES (?, ?, ?)`, group.ID, m.Kind, m.ID)
+		if err != nil {
+			log.Println("Error inserting group member:", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// recreateGroups inserts groups removed from a whiteboard again, with new IDs, and returns
+// them. items maps the stroke and element members to the IDs the items have now; members
+// missing from it are left out, and so are groups left without members. Nested groups are
+// inserted before the groups containing them; only a cycle in the stored groups leaves some
+// never ready, and those are dropped.
+func recreateGroups(tx *sql.Tx, whiteboardID int, groups []Group, items map[GroupMember]int) ([]Group, error) {
+	created := []Group{}
+	newIDs := map[int]int{}
+	processed := map[int]bool{}
+	pending := groups
+	for len(pending) > 0 {
+		var next []Group
+		for _, g := range pending {
+			ready := true
+			for _, m := range g.Members {
+				if m.Kind == ItemGroup && !processed[m.ID] {
+					ready = false
+				}
+			}
+			if !ready {
+				next = append(next, g)
+				continue
+			}
+			processed[g.ID] = true
+
+			group := Group{WhiteboardID: whiteboardID, CreatedAt: g.CreatedAt, MinX: g.MinX, MaxX: g.MaxX, MinY: g.MinY, MaxY: g.MaxY}
+			for _, m := range g.Members {
+				id, ok := items[m]
+				if m.Kind == ItemGroup {
+					id, ok = newIDs[m.ID]
+				}
+				if ok {
+					group.Members = append(group.Members, GroupMember{Kind: m.Kind, ID: id})
+				}
+			}
+			if len(group.Members) == 0 {
+				continue
+			}
+			if err := insertGroup(tx, &group); err != nil {
+				return nil, fmt.Errorf("recreating group %d: %w", g.ID, err)
+			}
+			newIDs[g.ID] = group.ID
+			created = append(created, group)
+		}
+		if len(next) == len(pending) {
+			break
+		}
+		pending = next
+	}
+	return created, nil
+}
+
+// checkMember makes sure the item exists on the board and isn't grouped yet,
+// locking its membership row so a concurrent InsertGroup can't take it
+func checkMember(tx *sql.Tx, whiteboardID int, m GroupMember) error {
+	table, ok := itemTables[m.Kind]
+	if !ok {
+		return fmt.Errorf("unknown group member kind %q", m.Kind)
+	}
+	query := `SELECT COUNT(*) FROM ` + table + ` WHERE whiteboard_id = ? AND id = ?`
+	if m.Kind != ItemGroup {
+		query += ` AND deleted = false`
+	}
+	var count int
+	if err := tx.QueryRow(query, whiteboardID, m.ID).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		notFound := map[string]error{ItemStroke: ErrStrokeNotFound, ItemElement: ErrElementNotFound, ItemGroup: ErrGroupNotFound}[m.Kind]
+		return fmt.Errorf("%s %d: %w", m.Kind, m.ID, notFound)
+	}
+
+	var groupID int
+	err := tx.QueryRow(`SELECT group_id FROM group_members WHERE member_kind = ? AND member_id = ? FOR UPDATE`, m.Kind, m.ID).Scan(&groupID)
+	if err == nil {
+		return fmt.Errorf("%s %d is in group %d: %w", m.Kind, m.ID, groupID, ErrAlreadyGrouped)
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	return nil
+}
+
+// GetGroupsByWhiteboardID returns every group of a whiteboard with its members, ordered by ID.
+// Deleted strokes and elements are left out of the member lists.
+func GetGroupsByWhiteboardID(whiteboardID int) ([]Group, error) {
+	return getGroups(db, whiteboardID)
+}
+
+func getGroups(q queryer, whiteboardID int) ([]Group, error) {
+	rows, err := q.Query(`SELECT id, whiteboard_id, created_at, minX, maxX, minY, maxY
+			FROM board_groups WHERE whiteboard_id = ? ORDER BY id ASC`, whiteboardID)
+	if err != nil {
+		log.Println("Error fetching groups:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []Group{}
+	index := map[int]int{}
+	for rows.Next() {
+		var group Group
+		var createdAtStr string
+		if err := rows.Scan(&group.ID, &group.WhiteboardID, &createdAtStr, &group.MinX, &group.MaxX, &group.MinY, &group.MaxY); err != nil {
+			log.Println("Error scanning group:", err)
+			return nil, err
+		}
+		group.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing group %d created_at: %w", group.ID, err)
+		}
+		group.Members = []GroupMember{}
+		index[group.ID] = len(groups)
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	memberRows, err := q.Query(`SELECT gm.group_id, gm.member_kind, gm.member_id
+			FROM group_members gm
+			JOIN board_groups g ON g.id = gm.group_id
+			WHERE g.whiteboard_id = ?
+			  AND (gm.member_kind <> 'stroke' OR EXISTS (SELECT 1 FROM strokes s WHERE s.id = gm.member_id AND s.deleted = false))
+			  AND (gm.member_kind <> 'element' OR EXISTS (SELECT 1 FROM elements e WHERE e.id = gm.member_id AND e.deleted = false))
+			ORDER BY gm.group_id, gm.member_kind, gm.member_id`, whiteboardID)
+	if err != nil {
+		log.Println("Error fetching group members:", err)
+		return nil, err
+	}
+	defer memberRows.Close()
+
+	for memberRows.Next() {
+		var groupID int
+		var m GroupMember
+		if err := memberRows.Scan(&groupID, &m.Kind, &m.ID); err != nil {
+			log.Println("Error scanning group member:", err)
+			return nil, err
+		}
+		i, ok := index[groupID]
+		if !ok {
+			continue
+		}
+		groups[i].Members = append(groups[i].Members, m)
+		if m.Kind == ItemGroup {
+			if child, ok := index[m.ID]; ok {
+				groups[child].ParentID = groupID
+			}
+		}
+	}
+	return groups, memberRows.Err()
+}
+
+// DeleteGroup ungroups a group: the group is removed and its members become members of
+// the group it was nested in, or top-level items if it wasn't nested
+func DeleteGroup(whiteboardID, groupID int, journals ...Journal) error {
+	return withLog(whiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		var found int
+		err := tx.QueryRow(`SELECT id FROM board_groups WHERE whiteboard_id = ? AND id = ? FOR UPDATE`, whiteboardID, groupID).Scan(&found)
+		if err == sql.ErrNoRows {
+			return Change{}, fmt.Errorf("group %d: %w", groupID, ErrGroupNotFound)
+		}
+		if err != nil {
+			return Change{}, err
+		}
+
+		var parentID int
+		err = tx.QueryRow(`SELECT group_id FROM group_members WHERE member_kind = ? AND member_id = ?`, ItemGroup, groupID).Scan(&parentID)
+		if err != nil && err != sql.ErrNoRows {
+			return Change{}, err
+		}
+
+		if parentID != 0 {
+			_, err = tx.Exec(`UPDATE group_members SET group_id = ? WHERE group_id = ?`, parentID, groupID)
+		} else {
+			_, err = tx.Exec(`DELETE FROM group_members WHERE group_id = ?`, groupID)
+		}
+		if err != nil {
+			return Change{}, err
+		}
+		if _, err := tx.Exec(`DELETE FROM group_members WHERE member_kind = ? AND member_id = ?`, ItemGroup, groupID); err != nil {
+			return Change{}, err
+		}
+		_, err = tx.Exec(`DELETE FROM board_groups WHERE id = ?`, groupID)
+		return Change{}, err
+	})
+}
+
+// DeleteGroupsByIDs removes groups along with their memberships, leaving their members ungrouped
+func DeleteGroupsByIDs(whiteboardID int, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return withTx(func(tx *sql.Tx) error {
+		args := idArgs(whiteboardID, ids)
+		query := `DELETE gm FROM group_members gm JOIN board_groups g ON g.id = gm.group_id
+                  WHERE g.whiteboard_id = ? AND g.id IN (` + placeholders(len(ids)) + `)`
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+		query = `DELETE gm FROM group_members gm JOIN board_groups g ON g.id = gm.member_id
+                 WHERE gm.member_kind = 'group' AND g.whiteboard_id = ? AND g.id IN (` + placeholders(len(ids)) + `)`
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+		query = `DELETE FROM board_groups WHERE whiteboard_id = ? AND id IN (` + placeholders(len(ids)) + `)`
+		_, err := tx.Exec(query, args...)
+		return err
+	})
+}
+
+// RemoveGroupMembers takes deleted items out of the groups they belonged to
+func RemoveGroupMembers(whiteboardID int, kind string, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query := `DELETE gm FROM group_members gm JOIN board_groups g ON g.id = gm.group_id
+              WHERE g.whiteboard_id = ? AND gm.member_kind = ? AND gm.member_id IN (` + placeholders(len(ids)) + `)`
+	args := []any{whiteboardID, kind}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		log.Println("Error removing group members:", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateGroupBounds stores the bounding box of each group
+func UpdateGroupBounds(groups []Group) error {
+	if len(groups) == 0 {
+		return nil
+	}
+	return withTx(func(tx *sql.Tx) error {
+		for _, g := range groups {
+			_, err := tx.Exec(`UPDATE board_groups SET minX = ?, maxX = ?, minY = ?, maxY = ? WHERE id = ?`, g.MinX, g.MaxX, g.MinY, g.MaxY, g.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// clearGroups removes every group of a whiteboard
+func clearGroups(ex execer, whiteboardID int) error {
+	// Memberships go with their groups through the foreign key
+	_, err := ex.Exec(`DELETE FROM board_groups WHERE whiteboard_id = ?`, whiteboardID)
+	return err
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// ImportedLayer is a layer of imported content and the layer of the board it goes to
+type ImportedLayer struct {
+	SourceID int   // the layer ID the imported strokes and elements carry
+	Layer    Layer // a layer of the board when it has an ID, otherwise a layer to add on top
+	Replace  bool  // store the name, visibility and lock flag of Layer on the existing layer
+}
+
+// ContentImport is content merged into a whiteboard by ImportContent
+type ContentImport struct {
+	Blobs    []Blob
+	Layers   []ImportedLayer // bottom to top
+	Strokes  []Stroke
+	Elements []Element
+	Groups   []Group // members and nested groups name the items by their imported IDs
+
+	StrokeIDs  map[int]int // set by ImportContent: imported ID to new ID
+	ElementIDs map[int]int
+}
+
+// ImportContent merges imported content into the whiteboard whiteboardID in one transaction:
+// it records the blobs, adds and updates the layers, inserts the strokes and elements on their
+// layers and recreates the groups around them. Items on a layer missing from Layers go to the
+// default layer. Content can't go to a locked layer of the board unless the import replaces
+// that layer. prepare, when set, is called with each element right before it is inserted, as
+// in InsertContent. The layers, items and groups get their new IDs, and the import is the
+// record of the change.
+func ImportContent(whiteboardID int, imported *ContentImport, prepare func(*Element) error, journals ...Journal) error {
+	err := withLog(whiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		// Layers are added on top, which needs the board locked
+		if err := lockWhiteboard(tx, whiteboardID); err != nil {
+			return Change{}, err
+		}
+		for i := range imported.Blobs {
+			if err := insertBlob(tx, &imported.Blobs[i]); err != nil {
+				return Change{}, err
+			}
+		}
+		layerIDs, err := importLayers(tx, whiteboardID, imported.Layers)
+		if err != nil {
+			return Change{}, err
+		}
+
+		layerOf := func(sourceID int) (int, error) {
+			if id, ok := layerIDs[sourceID]; ok {
+				return id, nil
+			}
+			layer, err := defaultLayer(tx, whiteboardID)
+			if err != nil {
+				return 0, err
+			}
+			if layer.Locked && !replaced(imported.Layers, layer.ID) {
+				return 0, fmt.Errorf("%w: %s", ErrLayerLocked, layer.Name)
+			}
+			layerIDs[sourceID] = layer.ID
+			return layer.ID, nil
+		}
+		strokeIDs := make([]int, len(imported.Strokes))
+		for i := range imported.Strokes {
+			s := &imported.Strokes[i]
+			strokeIDs[i] = s.ID
+			if s.LayerID, err = layerOf(s.LayerID); err != nil {
+				return Change{}, err
+			}
+		}
+		elementIDs := make([]int, len(imported.Elements))
+		for i := range imported.Elements {
+			e := &imported.Elements[i]
+			elementIDs[i] = e.ID
+			if e.LayerID, err = layerOf(e.LayerID); err != nil {
+				return Change{}, err
+			}
+		}
+		if err := insertContent(tx, imported.Strokes, imported.Elements, prepare); err != nil {
+			return Change{}, err
+		}
+
+		imported.StrokeIDs, imported.ElementIDs = map[int]int{}, map[int]int{}
+		items := map[GroupMember]int{}
+		for i, id := range strokeIDs {
+			imported.StrokeIDs[id] = imported.Strokes[i].ID
+			items[GroupMember{Kind: ItemStroke, ID: id}] = imported.Strokes[i].ID
+		}
+		for i, id := range elementIDs {
+			imported.ElementIDs[id] = imported.Elements[i].ID
+			items[GroupMember{Kind: ItemElement, ID: id}] = imported.Elements[i].ID
+		}
+		if imported.Groups, err = recreateGroups(tx, whiteboardID, imported.Groups, items); err != nil {
+			return Change{}, err
+		}
+		return Change{Strokes: imported.Strokes, Elements: imported.Elements, Record: imported}, nil
+	})
+	if err != nil {
+		log.Printf("Error importing content into whiteboard ID %d: %v", whiteboardID, err)
+	}
+	return err
+}
+
+// importLayers adds and updates the layers of an import and maps their source IDs to the
+// layers of the board. Existing layers are locked, and must be unlocked unless replaced.
+func importLayers(tx *sql.Tx, whiteboardID int, layers []ImportedLayer) (map[int]int, error) {
+	ids := map[int]int{}
+	for i := range layers {
+		layer := &layers[i].Layer
+		layer.WhiteboardID = whiteboardID
+		if layer.ID == 0 {
+			if err := insertLayer(tx, layer); err != nil {
+				return nil, err
+			}
+			ids[layers[i].SourceID] = layer.ID
+			continue
+		}
+
+		var name string
+		var locked bool
+		err := tx.QueryRow(`SELECT name, locked FROM layers WHERE whiteboard_id = ? AND id = ? FOR UPDATE`, whiteboardID, layer.ID).
+			Scan(&name, &locked)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: layer %d", ErrLayerNotFound, layer.ID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if layers[i].Replace {
+			_, err := tx.Exec(`UPDATE layers SET name = ?, visible = ?, locked = ? WHERE whiteboard_id = ? AND id = ?`,
+				layer.Name, layer.Visible, layer.Locked, whiteboardID, layer.ID)
+			if err != nil {
+				return nil, err
+			}
+		} else if locked {
+			return nil, fmt.Errorf("%w: %s", ErrLayerLocked, name)
+		}
+		ids[layers[i].SourceID] = layer.ID
+	}
+	return ids, nil
+}
+
+func replaced(layers []ImportedLayer, layerID int) bool {
+	for _, l := range layers {
+		if l.Replace && l.Layer.ID == layerID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,340 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DefaultLayerName is the name of the layer every whiteboard starts with
+const DefaultLayerName = "Layer 1"
+
+var (
+	// ErrLayerNotFound is returned when a layer doesn't exist on the whiteboard
+	ErrLayerNotFound = errors.New("layer not found")
+	// ErrLastLayer is returned when deleting the only layer of a whiteboard
+	ErrLastLayer = errors.New("a whiteboard needs at least one layer")
+	// ErrLayerLocked is returned when changing content on a locked layer
+	ErrLayerLocked = errors.New("layer is locked")
+)
+
+// Layer groups the content of a whiteboard. Layers are drawn from the lowest ZIndex up;
+// hidden layers are left out of stroke queries and locked layers can't be edited.
+type Layer struct {
+	ID           int       `json:"id"`
+	WhiteboardID int       `json:"whiteboardID"`
+	Name         string    `json:"name"`
+	ZIndex       int       `json:"zIndex"`
+	Visible      bool      `json:"visible"`
+	Locked       bool      `json:"locked"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+const layerColumns = `id, whiteboard_id, name, z_index, visible, locked, created_at`
+
+func scanLayer(row rowScanner) (Layer, error) {
+	var layer Layer
+	var createdAtStr string
+
+	err := row.Scan(&layer.ID, &layer.WhiteboardID, &layer.Name, &layer.ZIndex, &layer.Visible, &layer.Locked, &createdAtStr)
+	if err != nil {
+		return layer, err
+	}
+	layer.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+	if err != nil {
+		return layer, fmt.Errorf("parsing layer %d created_at: %w", layer.ID, err)
+	}
+	return layer, nil
+}
+
+// InsertLayer adds a layer on top of the existing layers of its whiteboard and sets its ID and ZIndex
+func InsertLayer(layer *Layer, journals ...Journal) error {
+	return withLog(layer.WhiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		// Lock the board so two new layers don't get the same z-index
+		if err := lockWhiteboard(tx, layer.WhiteboardID); err != nil {
+			return Change{}, err
+		}
+		return Change{}, insertLayer(tx, layer)
+	})
+}
+
+// insertLayer adds a layer on top of its board's layers. The board must be locked.
+func insertLayer(tx *sql.Tx, layer *Layer) error {
+	var top sql.NullInt64
+	err := tx.QueryRow(`SELECT MAX(z_index) FROM layers WHERE whiteboard_id = ?`, layer.WhiteboardID).Scan(&top)
+	if err != nil {
+		log.Println("Error reading top layer:", err)
+		return err
+	}
+	layer.ZIndex = 0
+	if top.Valid {
+		layer.ZIndex = int(top.Int64) + 1
+	}
+
+	query := `INSERT INTO layers (whiteboard_id, name, z_index, visible, locked, created_at)
+              VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(query, layer.WhiteboardID, layer.Name, layer.ZIndex, layer.Visible, layer.Locked, layer.CreatedAt)
+	if err != nil {
+		log.Println("Error inserting layer:", err)
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	layer.ID = int(id)
+	return nil
+}
+
+// GetLayersByWhiteboardID returns the layers of a whiteboard from bottom to top
+func GetLayersByWhiteboardID(whiteboardID int) ([]Layer, error) {
+	query := `SELECT ` + layerColumns + ` FROM layers WHERE whiteboard_id = ? ORDER BY z_index ASC, id ASC`
+
+	rows, err := db.Query(query, whiteboardID)
+	if err != nil {
+		log.Println("Error fetching layers:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	layers := []Layer{}
+	for rows.Next() {
+		layer, err := scanLayer(rows)
+		if err != nil {
+			log.Println("Error scanning layer:", err)
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	return layers, rows.Err()
+}
+
+// GetLayerByID returns a layer of a whiteboard, or ErrLayerNotFound
+func GetLayerByID(whiteboardID, layerID int) (*Layer, error) {
+	query := `SELECT ` + layerColumns + ` FROM layers WHERE whiteboard_id = ? AND id = ?`
+
+	layer, err := scanLayer(db.QueryRow(query, whiteboardID, layerID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrLayerNotFound
+		}
+		log.Println("Error fetching layer:", err)
+		return nil, err
+	}
+	return &layer, nil
+}
+
+// UpdateLayer stores the name, visibility and lock flag of a layer
+func UpdateLayer(layer *Layer, journals ...Journal) error {
+	query := `UPDATE layers SET name = ?, visible = ?, locked = ? WHERE whiteboard_id = ? AND id = ?`
+
+	err := withLog(layer.WhiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		_, err := tx.Exec(query, layer.Name, layer.Visible, layer.Locked, layer.WhiteboardID, layer.ID)
+		return Change{}, err
+	})
+	if err != nil {
+		log.Println("Error updating layer:", err)
+		return err
+	}
+	return nil
+}
+
+// ReorderLayers sets the z-order of a whiteboard's layers. layerIDs lists every layer
+// of the board from bottom to top.
+func ReorderLayers(whiteboardID int, layerIDs []int, journals ...Journal) error {
+	return withLog(whiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		return Change{}, reorderLayers(tx, whiteboardID, layerIDs)
+	})
+}
+
+func reorderLayers(tx *sql.Tx, whiteboardID int, layerIDs []int) error {
+	rows, err := tx.Query(`SELECT id FROM layers WHERE whiteboard_id = ? FOR UPDATE`, whiteboardID)
+	if err != nil {
+		return err
+	}
+	existing := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(layerIDs) != len(existing) {
+		return fmt.Errorf("%w: the new order must list all %d layers", ErrLayerNotFound, len(existing))
+	}
+	seen := map[int]bool{}
+	for _, id := range layerIDs {
+		if !existing[id] || seen[id] {
+			return fmt.Errorf("%w: layer %d", ErrLayerNotFound, id)
+		}
+		seen[id] = true
+	}
+
+	for z, id := range layerIDs {
+		if _, err := tx.Exec(`UPDATE layers SET z_index = ? WHERE id = ?`, z, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteLayer removes a layer. Its strokes and elements move to the layer moveTo, or are
+// marked as deleted when moveTo is 0. Neither layer may be locked. Deleted content is
+// returned by ID, along with the connectors that followed: following, when set, gives the
+// Follow for the deleted elements, which runs in the same transaction as in DeleteContent.
+func DeleteLayer(whiteboardID, layerID, moveTo int, following func(elementIDs ...int) Follow,
+	journals ...Journal) (strokeIDs, elementIDs []int, followed []Element, err error) {
+	err = withLog(whiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		if err := deleteLayer(tx, whiteboardID, layerID, moveTo, &strokeIDs, &elementIDs); err != nil {
+			return Change{}, err
+		}
+		if len(elementIDs) > 0 && following != nil {
+			var err error
+			if followed, err = followElements(tx, whiteboardID, following(elementIDs...)); err != nil {
+				return Change{}, err
+			}
+		}
+		return Change{StrokeIDs: strokeIDs, ElementIDs: elementIDs, Elements: followed}, nil
+	})
+	if err != nil {
+		log.Printf("Error deleting layer %d of whiteboard ID %d: %v", layerID, whiteboardID, err)
+		return nil, nil, nil, err
+	}
+	return strokeIDs, elementIDs, followed, nil
+}
+
+// deleteLayer removes a layer, setting the IDs of the strokes and elements it deleted
+func deleteLayer(tx *sql.Tx, whiteboardID, layerID, moveTo int, strokeIDs, elementIDs *[]int) error {
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM layers WHERE whiteboard_id = ? FOR UPDATE`, whiteboardID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count <= 1 {
+		return ErrLastLayer
+	}
+
+	for _, id := range []int{layerID, moveTo} {
+		if id == 0 {
+			continue
+		}
+		var name string
+		var locked bool
+		err := tx.QueryRow(`SELECT name, locked FROM layers WHERE whiteboard_id = ? AND id = ?`, whiteboardID, id).Scan(&name, &locked)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: layer %d", ErrLayerNotFound, id)
+		}
+		if err != nil {
+			return err
+		}
+		if locked {
+			return fmt.Errorf("%w: %s", ErrLayerLocked, name)
+		}
+	}
+
+	for _, table := range []struct {
+		name string
+		ids  *[]int
+	}{{"strokes", strokeIDs}, {"elements", elementIDs}} {
+		query := `UPDATE ` + table.name + ` SET deleted = true WHERE whiteboard_id = ? AND layer_id = ?`
+		args := []any{whiteboardID, layerID}
+		if moveTo != 0 {
+			query = `UPDATE ` + table.name + ` SET layer_id = ? WHERE whiteboard_id = ? AND layer_id = ?`
+			args = []any{moveTo, whiteboardID, layerID}
+		} else {
+			*table.ids, err = selectIDsForUpdate(tx,
+				`SELECT id FROM `+table.name+` WHERE whiteboard_id = ? AND layer_id = ? AND deleted = false FOR UPDATE`, whiteboardID, layerID)
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM layers WHERE whiteboard_id = ? AND id = ?`, whiteboardID, layerID)
+	return err
+}
+
+// DefaultLayerID returns the layer new content goes to when no layer is given: the first
+// layer created on the board. Boards from before layers existed get a default layer here.
+func DefaultLayerID(whiteboardID int) (int, error) {
+	const query = `SELECT id FROM layers WHERE whiteboard_id = ? ORDER BY id ASC LIMIT 1`
+	var id int
+	err := db.QueryRow(query, whiteboardID).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		log.Println("Error fetching default layer:", err)
+		return 0, err
+	}
+
+	// Look again with the board locked, so concurrent callers create only one layer
+	err = withTx(func(tx *sql.Tx) error {
+		if err := lockWhiteboard(tx, whiteboardID); err != nil {
+			return err
+		}
+		layer, err := defaultLayer(tx, whiteboardID)
+		id = layer.ID
+		return err
+	})
+	if err != nil {
+		log.Println("Error creating default layer:", err)
+		return 0, err
+	}
+	return id, nil
+}
+
+// defaultLayer locks and returns the default layer of a board, creating it when the board has
+// no layers. The board must be locked.
+func defaultLayer(tx *sql.Tx, whiteboardID int) (Layer, error) {
+	query := `SELECT ` + layerColumns + ` FROM layers WHERE whiteboard_id = ? ORDER BY id ASC LIMIT 1 FOR UPDATE`
+	layer, err := scanLayer(tx.QueryRow(query, whiteboardID))
+	if err != sql.ErrNoRows {
+		return layer, err
+	}
+	layer = Layer{WhiteboardID: whiteboardID, Name: DefaultLayerName, Visible: true, CreatedAt: time.Now()}
+	return layer, insertLayer(tx, &layer)
+}
+
+// GetItemLayers returns the layer of each of the given strokes or elements, deleted or not.
+// kind is ItemStroke or ItemElement; items without a layer map to 0.
+func GetItemLayers(whiteboardID int, kind string, ids []int) (map[int]int, error) {
+	layers := map[int]int{}
+	if len(ids) == 0 {
+		return layers, nil
+	}
+	table, ok := itemTables[kind]
+	if !ok || kind == ItemGroup {
+		return nil, fmt.Errorf("items of kind %q have no layer", kind)
+	}
+
+	query := `SELECT id, layer_id FROM ` + table + ` WHERE whiteboard_id = ? AND id IN (` + placeholders(len(ids)) + `)`
+	rows, err := db.Query(query, idArgs(whiteboardID, ids)...)
+	if err != nil {
+		log.Println("Error fetching item layers:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var layerID sql.NullInt64
+		if err := rows.Scan(&id, &layerID); err != nil {
+			return nil, err
+		}
+		layers[id] = int(layerID.Int64)
+	}
+	return layers, rows.Err()
+}
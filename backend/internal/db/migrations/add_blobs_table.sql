@@ -0,0 +1,8 @@
+CREATE TABLE blobs (
+    hash CHAR(64) PRIMARY KEY,                   -- Hex SHA-256 of the content, also the key in the blob store
+    mime_type VARCHAR(64) NOT NULL,              -- image/png, image/jpeg, image/gif
+    size BIGINT NOT NULL,                        -- Size in bytes
+    width INT,                                   -- Pixel dimensions of images
+    height INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,14 @@
+-- The materialized content of each active whiteboard as of a point in its operation log,
+-- so loading a board reads one row and the entries after it instead of every stroke. This
+-- replaces the current_state column the first schema planned on the whiteboards table.
+CREATE TABLE board_checkpoints (
+    whiteboard_id INT PRIMARY KEY,               -- One checkpoint per board, replaced in place
+    format INT NOT NULL,                         -- Encoding of state, checkpoints of other formats are rebuilt
+    seq INT NOT NULL DEFAULT 0,                  -- The last operation log entry the checkpoint includes
+    stroke_count INT NOT NULL DEFAULT 0,
+    element_count INT NOT NULL DEFAULT 0,
+    checksum CHAR(64) NOT NULL,                  -- SHA-256 of state, in hex
+    state MEDIUMBLOB NOT NULL,                   -- gzip-compressed JSON of the board's strokes and elements
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (whiteboard_id) REFERENCES whiteboards(id) ON DELETE CASCADE
+);
@@ -0,0 +1,24 @@
+-- Clearing a board is a recorded operation: the cleared strokes and elements are tombstoned
+-- with the clear's ID, so anyone with edit rights can bring them back for a while
+CREATE TABLE board_clears (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    whiteboard_id INT NOT NULL,                  -- Foreign key linking to the whiteboard
+    cleared_by INT,                              -- Who cleared the board, NULL when unknown
+    version_id INT,                              -- The automatic snapshot taken before the clear
+    stroke_count INT NOT NULL DEFAULT 0,
+    element_count INT NOT NULL DEFAULT 0,
+    removed_groups JSON NOT NULL,                -- The groups the clear removed, recreated on undo
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    undo_until TIMESTAMP NOT NULL,               -- The end of the undo window
+    undone_at TIMESTAMP NULL,
+    undone_by INT,
+    FOREIGN KEY (whiteboard_id) REFERENCES whiteboards(id) ON DELETE CASCADE,
+    FOREIGN KEY (cleared_by) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (version_id) REFERENCES board_versions(id) ON DELETE SET NULL,
+    FOREIGN KEY (undone_by) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_board_clears_board (whiteboard_id, created_at)
+);
+
+-- The clear that tombstoned an item, NULL for items erased any other way
+ALTER TABLE strokes ADD COLUMN clear_id INT NULL, ADD INDEX idx_strokes_clear (clear_id);
+ALTER TABLE elements ADD COLUMN clear_id INT NULL, ADD INDEX idx_elements_clear (clear_id);
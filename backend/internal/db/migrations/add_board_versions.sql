@@ -0,0 +1,17 @@
+-- Named snapshots of a whiteboard's content, taken on request or automatically before
+-- destructive operations such as clearing the board
+CREATE TABLE board_versions (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    whiteboard_id INT NOT NULL,                  -- Foreign key linking to the whiteboard
+    name VARCHAR(255) NOT NULL,
+    author_id INT,                               -- Who took the snapshot, NULL when unknown
+    automatic BOOLEAN NOT NULL DEFAULT false,    -- Taken by the server rather than a user
+    seq INT NOT NULL DEFAULT 0,                  -- The last operation log entry the snapshot includes
+    stroke_count INT NOT NULL DEFAULT 0,
+    element_count INT NOT NULL DEFAULT 0,
+    content JSON NOT NULL,                       -- The board's strokes, elements and groups
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (whiteboard_id) REFERENCES whiteboards(id) ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_board_versions_board (whiteboard_id, created_at)
+);
@@ -0,0 +1,19 @@
+-- Per-board canvas limits and the box around the board's content, used for zoom-to-fit
+ALTER TABLE whiteboards ADD COLUMN canvas JSON NULL,      -- mode, bounds, maxExtent, maxPointsPerStroke, maxStrokeWidth
+    ADD COLUMN content_minX DOUBLE NULL,                  -- NULL while the board is empty
+    ADD COLUMN content_maxX DOUBLE NULL,
+    ADD COLUMN content_minY DOUBLE NULL,
+    ADD COLUMN content_maxY DOUBLE NULL;
+
+-- Existing boards start with the box around their current content
+UPDATE whiteboards w
+JOIN (
+    SELECT whiteboard_id, MIN(minX) AS minX, MAX(maxX) AS maxX, MIN(minY) AS minY, MAX(maxY) AS maxY
+    FROM (
+        SELECT whiteboard_id, minX, maxX, minY, maxY FROM strokes WHERE deleted = false
+        UNION ALL
+        SELECT whiteboard_id, minX, maxX, minY, maxY FROM elements WHERE deleted = false
+    ) items
+    GROUP BY whiteboard_id
+) b ON b.whiteboard_id = w.id
+SET w.content_minX = b.minX, w.content_maxX = b.maxX, w.content_minY = b.minY, w.content_maxY = b.maxY;
@@ -0,0 +1,27 @@
+CREATE TABLE elements (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    whiteboard_id INT,                           -- Foreign key linking to the whiteboard
+    owner_id INT,                                -- Who created this element
+    type VARCHAR(32) NOT NULL,                   -- rectangle, ellipse, line, arrow, polygon
+    x DOUBLE,                                    -- Top-left corner for box shaped elements
+    y DOUBLE,
+    width DOUBLE,
+    height DOUBLE,
+    rotation DOUBLE DEFAULT 0,                   -- Rotation in degrees around the element's center
+    data JSON,                                   -- Type specific data (points, arrowheads, style)
+    -- example of data for an arrow
+    -- {
+    --     "points": [{ "x": 10, "y": 15 }, { "x": 120, "y": 80 }],
+    --     "endArrowhead": "triangle",
+    --     "style": { "strokeColor": "#000000", "strokeWidth": 2 }
+    -- }
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted BOOLEAN DEFAULT false,
+    minX DOUBLE,                                 -- Bounding box of the element's true outline
+    maxX DOUBLE,
+    minY DOUBLE,
+    maxY DOUBLE,
+    FOREIGN KEY (whiteboard_id) REFERENCES whiteboards(id) ON DELETE CASCADE,
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_elements_board_bbox (whiteboard_id, deleted, minX, maxX, minY, maxY)
+);
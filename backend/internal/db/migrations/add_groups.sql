@@ -0,0 +1,20 @@
+-- GROUPS is a reserved word in MySQL 8, hence board_groups
+CREATE TABLE board_groups (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    whiteboard_id INT NOT NULL,                  -- Foreign key linking to the whiteboard
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    minX DOUBLE,                                 -- Bounding box of every member
+    maxX DOUBLE,
+    minY DOUBLE,
+    maxY DOUBLE,
+    FOREIGN KEY (whiteboard_id) REFERENCES whiteboards(id) ON DELETE CASCADE
+);
+
+CREATE TABLE group_members (
+    group_id INT NOT NULL,
+    member_kind ENUM('stroke', 'element', 'group') NOT NULL,
+    member_id INT NOT NULL,                      -- ID in strokes, elements or board_groups depending on member_kind
+    PRIMARY KEY (member_kind, member_id),        -- An item belongs to at most one group
+    FOREIGN KEY (group_id) REFERENCES board_groups(id) ON DELETE CASCADE,
+    INDEX idx_group_members_group (group_id)
+);
@@ -0,0 +1,23 @@
+CREATE TABLE layers (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    whiteboard_id INT NOT NULL,                  -- Foreign key linking to the whiteboard
+    name VARCHAR(255) NOT NULL,
+    z_index INT NOT NULL,                        -- Drawing order, lowest first
+    visible BOOLEAN DEFAULT true,                -- Hidden layers are left out of stroke queries
+    locked BOOLEAN DEFAULT false,                -- Locked layers can't be drawn on, erased or transformed
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (whiteboard_id) REFERENCES whiteboards(id) ON DELETE CASCADE,
+    INDEX idx_layers_board_z (whiteboard_id, z_index)
+);
+
+-- Every existing whiteboard gets a default layer holding its current content
+INSERT INTO layers (whiteboard_id, name, z_index, visible, locked)
+SELECT id, 'Layer 1', 0, true, false FROM whiteboards;
+
+ALTER TABLE strokes ADD COLUMN layer_id INT NULL AFTER owner_id,
+    ADD FOREIGN KEY (layer_id) REFERENCES layers(id) ON DELETE SET NULL;
+ALTER TABLE elements ADD COLUMN layer_id INT NULL AFTER owner_id,
+    ADD FOREIGN KEY (layer_id) REFERENCES layers(id) ON DELETE SET NULL;
+
+UPDATE strokes s JOIN layers l ON l.whiteboard_id = s.whiteboard_id SET s.layer_id = l.id;
+UPDATE elements e JOIN layers l ON l.whiteboard_id = e.whiteboard_id SET e.layer_id = l.id;
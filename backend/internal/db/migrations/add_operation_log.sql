@@ -0,0 +1,15 @@
+-- Append-only log of every change made to a whiteboard. Rows are never updated or deleted
+-- while the board exists; replaying a board's entries in seq order rebuilds its content.
+CREATE TABLE operation_log (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    whiteboard_id INT NOT NULL,                  -- Foreign key linking to the whiteboard
+    seq INT NOT NULL,                            -- Position in the board's log, starting at 1
+    actor_id INT,                                -- Who made the change, NULL when unknown
+    op_type VARCHAR(64) NOT NULL,                -- stroke_added, strokes_deleted, board_cleared, ...
+    payload JSON NOT NULL,                       -- The state the change produced, see services/oplog_service.go
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (whiteboard_id) REFERENCES whiteboards(id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL,
+    UNIQUE INDEX idx_operation_log_board_seq (whiteboard_id, seq),
+    INDEX idx_operation_log_board_time (whiteboard_id, created_at)
+);
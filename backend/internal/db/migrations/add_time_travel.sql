@@ -0,0 +1,5 @@
+-- Millisecond timestamps in the operation log, so the board can be shown as of any instant
+ALTER TABLE operation_log MODIFY created_at TIMESTAMP(3) DEFAULT CURRENT_TIMESTAMP(3);
+
+-- Time travel starts from the latest version before the requested point in the log
+ALTER TABLE board_versions ADD INDEX idx_board_versions_board_seq (whiteboard_id, seq);
@@ -0,0 +1,24 @@
+CREATE TABLE vote_sessions (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    whiteboard_id INT NOT NULL,                  -- Foreign key linking to the whiteboard
+    votes_per_user INT NOT NULL,                 -- How many votes each participant can cast
+    started_by INT,                              -- Who opened the session
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    ended_at TIMESTAMP NULL,                     -- NULL while voting is open
+    FOREIGN KEY (whiteboard_id) REFERENCES whiteboards(id) ON DELETE CASCADE,
+    FOREIGN KEY (started_by) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_vote_sessions_board (whiteboard_id, ended_at)
+);
+
+-- One row per vote, a user may put several votes on the same sticky note
+CREATE TABLE votes (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    session_id INT NOT NULL,
+    element_id INT NOT NULL,                     -- The sticky note voted on
+    user_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES vote_sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (element_id) REFERENCES elements(id) ON DELETE CASCADE,
+    INDEX idx_votes_session_user (session_id, user_id),
+    INDEX idx_votes_session_element (session_id, element_id)
+);
@@ -0,0 +1,255 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// LogBaseline is the type of the first entry of every operation log: the content the
+// board had when logging started
+const LogBaseline = "baseline"
+
+// LogEntry is one change in a whiteboard's append-only operation log
+type LogEntry struct {
+	Seq          int             `json:"seq"` // position in the board's log, starting at 1
+	WhiteboardID int             `json:"whiteboardID"`
+	ActorID      int             `json:"actorID,omitempty"` // 0 when the actor is unknown
+	Type         string          `json:"type"`
+	Payload      json.RawMessage `json:"payload"`
+	CreatedAt    time.Time       `json:"createdAt"`
+}
+
+// Change is what a write stored, handed to its journals to build their entries from
+type Change struct {
+	// The strokes and elements added, updated or restored, as they are now and with their IDs
+	Strokes  []Stroke
+	Elements []Element
+	// The IDs of the strokes and elements deleted
+	StrokeIDs  []int
+	ElementIDs []int
+	// Record is the row other than content the write created or changed, like a vote session
+	Record any
+}
+
+// Journal returns the log entries of a write once it stored its change. Only Type, ActorID
+// and Payload of the entries are used; no entries logs nothing.
+type Journal func(change Change) ([]LogEntry, error)
+
+// logBaseline builds the payload of a board's LogBaseline entry, see SetLogBaseline
+var logBaseline func(whiteboardID int) (json.RawMessage, error)
+
+// SetLogBaseline sets how the content of a board is logged when its log starts. fn is
+// called before the first logged change and reads the board's committed content.
+func SetLogBaseline(fn func(whiteboardID int) (json.RawMessage, error)) {
+	logBaseline = fn
+}
+
+// logCommitted is told about the entries of each committed logged write, see SetLogCommitted
+var logCommitted func(whiteboardID, entries int)
+
+// SetLogCommitted sets what is told how many entries a logged write appended to a board's
+// log. fn is called once the write committed, never for writes that rolled back.
+func SetLogCommitted(fn func(whiteboardID, entries int)) {
+	logCommitted = fn
+}
+
+// withLog runs fn in a transaction like withTx and appends the entries of the journals to
+// the board's log in the same transaction, so the log holds exactly the committed changes,
+// in the order they were committed. With journals the board row is locked before fn runs,
+// which serializes the board's logged writes; without any it is a plain withTx.
+func withLog(whiteboardID int, journals []Journal, fn func(tx *sql.Tx) (Change, error)) error {
+	if len(journals) == 0 {
+		return withTx(func(tx *sql.Tx) error {
+			_, err := fn(tx)
+			return err
+		})
+	}
+	appended := 0
+	err := withTx(func(tx *sql.Tx) error {
+		if err := lockWhiteboard(tx, whiteboardID); err != nil {
+			return err
+		}
+		// Nothing of the board changed yet when its log is empty, so the baseline is the content before fn
+		now := time.Now()
+		seq, err := startLog(tx, whiteboardID, now)
+		if err != nil {
+			return err
+		}
+
+		change, err := fn(tx)
+		if err != nil {
+			return err
+		}
+		for _, journal := range journals {
+			entries, err := journal(change)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				seq++
+				entry.WhiteboardID, entry.CreatedAt = whiteboardID, now
+				if err := insertLogEntry(tx, &entry, seq); err != nil {
+					return err
+				}
+				appended++
+			}
+		}
+		return nil
+	})
+	if err == nil && appended > 0 && logCommitted != nil {
+		logCommitted(whiteboardID, appended)
+	}
+	return err
+}
+
+// StartLog gives a board whose log is still empty its baseline entry. It takes the board lock
+// like a logged write, so a write committing meanwhile is logged after the baseline, never
+// before it.
+func StartLog(whiteboardID int) error {
+	return withTx(func(tx *sql.Tx) error {
+		if err := lockWhiteboard(tx, whiteboardID); err != nil {
+			return err
+		}
+		_, err := startLog(tx, whiteboardID, time.Now())
+		return err
+	})
+}
+
+// startLog returns the sequence number of the last entry of a board's log, appending the
+// baseline first when the log is empty. The board must be locked.
+func startLog(tx *sql.Tx, whiteboardID int, now time.Time) (int, error) {
+	var last sql.NullInt64
+	if err := tx.QueryRow(`SELECT MAX(seq) FROM operation_log WHERE whiteboard_id = ?`, whiteboardID).Scan(&last); err != nil {
+		return 0, err
+	}
+	if last.Valid || logBaseline == nil {
+		return int(last.Int64), nil
+	}
+	payload, err := logBaseline(whiteboardID)
+	if err != nil {
+		return 0, fmt.Errorf("building the log baseline: %w", err)
+	}
+	first := LogEntry{WhiteboardID: whiteboardID, Type: LogBaseline, Payload: payload, CreatedAt: now}
+	if err := insertLogEntry(tx, &first, 1); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+func insertLogEntry(tx *sql.Tx, entry *LogEntry, seq int) error {
+	query := `INSERT INTO operation_log (whiteboard_id, seq, actor_id, op_type, payload, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := tx.Exec(query, entry.WhiteboardID, seq, nullableID(entry.ActorID), entry.Type, []byte(entry.Payload), entry.CreatedAt)
+	if err != nil {
+		log.Println("Error appending to the operation log:", err)
+		return err
+	}
+	entry.Seq = seq
+	return nil
+}
+
+// GetLogEntries returns up to limit entries of a whiteboard's log with a seq above afterSeq,
+// in order. A limit of 0 returns every remaining entry.
+func GetLogEntries(whiteboardID, afterSeq, limit int) ([]LogEntry, error) {
+	query := `SELECT seq, whiteboard_id, actor_id, op_type, payload, created_at
+              FROM operation_log WHERE whiteboard_id = ? AND seq > ? ORDER BY seq ASC`
+	args := []any{whiteboardID, afterSeq}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching the operation log:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []LogEntry{}
+	for rows.Next() {
+		var entry LogEntry
+		var actorID sql.NullInt64
+		var payload []byte
+		var createdAtStr string
+		if err := rows.Scan(&entry.Seq, &entry.WhiteboardID, &actorID, &entry.Type, &payload, &createdAtStr); err != nil {
+			log.Println("Error scanning log entry:", err)
+			return nil, err
+		}
+		entry.ActorID = int(actorID.Int64)
+		entry.Payload = payload
+		entry.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing log entry %d created_at: %w", entry.Seq, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// LastLogSeq returns the sequence number of the last entry of a whiteboard's log, 0 for an empty log
+func LastLogSeq(whiteboardID int) (int, error) {
+	var last sql.NullInt64
+	err := db.QueryRow(`SELECT MAX(seq) FROM operation_log WHERE whiteboard_id = ?`, whiteboardID).Scan(&last)
+	if err != nil {
+		log.Println("Error fetching the last log entry:", err)
+		return 0, err
+	}
+	return int(last.Int64), nil
+}
+
+// ReadBoardContent returns the non-deleted strokes, elements and groups of a whiteboard and
+// the sequence number of the last entry of its log, all read from one consistent snapshot.
+// Logged writes append to the log in their own transaction, so the content is exactly what
+// the log up to that entry describes.
+func ReadBoardContent(whiteboardID int) (seq int, content *VersionContent, err error) {
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return 0, nil, err
+	}
+	// Nothing is written, so the transaction is only ever rolled back
+	defer tx.Rollback()
+
+	// The first read takes the snapshot every later read of the transaction sees
+	var last sql.NullInt64
+	if err := tx.QueryRow(`SELECT MAX(seq) FROM operation_log WHERE whiteboard_id = ?`, whiteboardID).Scan(&last); err != nil {
+		log.Println("Error fetching the last log entry:", err)
+		return 0, nil, err
+	}
+	content = &VersionContent{}
+	if content.Strokes, err = getAllStrokes(tx, whiteboardID); err != nil {
+		return 0, nil, err
+	}
+	if content.Elements, err = getAllElements(tx, whiteboardID); err != nil {
+		return 0, nil, err
+	}
+	if content.Groups, err = getGroups(tx, whiteboardID); err != nil {
+		return 0, nil, err
+	}
+	return int(last.Int64), content, nil
+}
+
+// LogSeqAt returns the sequence number of the last log entry of a whiteboard made at or
+// before t, 0 when there is none, and the time of the board's first entry. ok is false
+// when the board has no log at all.
+func LogSeqAt(whiteboardID int, t time.Time) (seq int, first time.Time, ok bool, err error) {
+	var last sql.NullInt64
+	var firstStr sql.NullString
+	query := `SELECT (SELECT MAX(seq) FROM operation_log WHERE whiteboard_id = ? AND created_at <= ?),
+                     (SELECT MIN(created_at) FROM operation_log WHERE whiteboard_id = ?)`
+	err = db.QueryRow(query, whiteboardID, t, whiteboardID).Scan(&last, &firstStr)
+	if err != nil {
+		log.Println("Error finding the log entry at a time:", err)
+		return 0, first, false, err
+	}
+	if !firstStr.Valid {
+		return 0, first, false, nil
+	}
+	first, err = time.Parse("2006-01-02 15:04:05", firstStr.String)
+	if err != nil {
+		return 0, first, false, fmt.Errorf("parsing the first log entry time: %w", err)
+	}
+	return int(last.Int64), first, true, nil
+}
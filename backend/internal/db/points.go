@@ -0,0 +1,127 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Point is one sample of a stroke or element outline. Pen input may also carry
+// pressure, tilt and timing; a zero value means the client didn't record it,
+// so older clients sending only x and y keep working.
+type Point struct {
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Pressure float64 `json:"pressure,omitempty"` // 0..1
+	TiltX    float64 `json:"tiltX,omitempty"`    // degrees, -90..90
+	TiltY    float64 `json:"tiltY,omitempty"`    // degrees, -90..90
+	T        int     `json:"t,omitempty"`        // milliseconds since the stroke started
+}
+
+// compactPath is how stroke paths are stored: one array per channel instead of an
+// object per point. Optional channels are left out when no point uses them and
+// timestamps are stored as deltas, which keeps long pen strokes small.
+type compactPath struct {
+	Version  int       `json:"v"`
+	X        []float64 `json:"x"`
+	Y        []float64 `json:"y"`
+	Pressure []float64 `json:"p,omitempty"`
+	TiltX    []float64 `json:"tx,omitempty"`
+	TiltY    []float64 `json:"ty,omitempty"`
+	T        []int     `json:"t,omitempty"`
+}
+
+const compactPathVersion = 1
+
+// roundTo rounds v to the given number of decimals
+func roundTo(v float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(v*scale) / scale
+}
+
+// encodePath serializes a path for the path column
+func encodePath(points []Point) ([]byte, error) {
+	c := compactPath{
+		Version: compactPathVersion,
+		X:       make([]float64, len(points)),
+		Y:       make([]float64, len(points)),
+	}
+	var hasPressure, hasTilt, hasTime bool
+	for i, p := range points {
+		c.X[i], c.Y[i] = p.X, p.Y
+		hasPressure = hasPressure || p.Pressure != 0
+		hasTilt = hasTilt || p.TiltX != 0 || p.TiltY != 0
+		hasTime = hasTime || p.T != 0
+	}
+
+	if hasPressure {
+		c.Pressure = make([]float64, len(points))
+		for i, p := range points {
+			c.Pressure[i] = roundTo(p.Pressure, 3)
+		}
+	}
+	if hasTilt {
+		c.TiltX = make([]float64, len(points))
+		c.TiltY = make([]float64, len(points))
+		for i, p := range points {
+			c.TiltX[i], c.TiltY[i] = roundTo(p.TiltX, 1), roundTo(p.TiltY, 1)
+		}
+	}
+	if hasTime {
+		c.T = make([]int, len(points))
+		previous := 0
+		for i, p := range points {
+			c.T[i] = p.T - previous
+			previous = p.T
+		}
+	}
+	return json.Marshal(c)
+}
+
+// decodePath reads a path column, accepting both the compact format and
+// the array of {"x", "y"} objects older rows were stored as
+func decodePath(data []byte) ([]Point, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] == '[' {
+		var points []Point
+		if len(data) == 0 {
+			return points, nil
+		}
+		err := json.Unmarshal(data, &points)
+		return points, err
+	}
+
+	var c compactPath
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.Version != compactPathVersion {
+		return nil, fmt.Errorf("unknown path format version %d", c.Version)
+	}
+	n := len(c.X)
+	if len(c.Y) != n || (c.Pressure != nil && len(c.Pressure) != n) ||
+		(c.TiltX != nil && len(c.TiltX) != n) || (c.TiltY != nil && len(c.TiltY) != n) || (c.T != nil && len(c.T) != n) {
+		return nil, fmt.Errorf("path channels have different lengths")
+	}
+
+	points := make([]Point, n)
+	t := 0
+	for i := range points {
+		points[i].X, points[i].Y = c.X[i], c.Y[i]
+		if c.Pressure != nil {
+			points[i].Pressure = c.Pressure[i]
+		}
+		if c.TiltX != nil {
+			points[i].TiltX = c.TiltX[i]
+		}
+		if c.TiltY != nil {
+			points[i].TiltY = c.TiltY[i]
+		}
+		if c.T != nil {
+			t += c.T[i]
+			points[i].T = t
+		}
+	}
+	return points, nil
+}
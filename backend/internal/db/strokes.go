@@ -1,49 +1,87 @@
 package db
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 )
 
-type Point struct {
-	X float64 `json:"x"`
-	Y float64 `json:"y"`
+type Stroke struct {
+	ID           int     `json:"id"`
+	WhiteboardID int     `json:"whiteboardID"` // Use camel case to match the frontend
+	OwnerID      int     `json:"ownerID"`
+	LayerID      int     `json:"layerID"`
+	Path         []Point `json:"path"`
+	Color        string  `json:"color"`
+	Width        float64 `json:"width"`
+	StrokeStyle
+	CreatedAt time.Time `json:"created_at"`
+	Deleted   bool      `json:"deleted"`
+	MinX      float64   `json:"minX"`
+	MaxX      float64   `json:"maxX"`
+	MinY      float64   `json:"minY"`
+	MaxY      float64   `json:"maxY"`
 }
 
-type Stroke struct {
-	ID           int       `json:"id"`
-	WhiteboardID int       `json:"whiteboardID"` // Use camel case to match the frontend
-	OwnerID      int       `json:"ownerID"`
-	Path         []Point   `json:"path"`
-	Color        string    `json:"color"`
-	Width        int       `json:"width"`
-	CreatedAt    time.Time `json:"created_at"`
-	Deleted      bool      `json:"deleted"`
-	MinX         float64   `json:"minX"`
-	MaxX         float64   `json:"maxX"`
-	MinY         float64   `json:"minY"`
-	MaxY         float64   `json:"maxY"`
+// Stroke line caps and joins, named as in SVG and the canvas API
+const (
+	CapButt   = "butt"
+	CapRound  = "round"
+	CapSquare = "square"
+
+	JoinMiter = "miter"
+	JoinRound = "round"
+	JoinBevel = "bevel"
+)
+
+// Stroke blend modes. Highlighter strokes multiply with what's under them.
+const (
+	BlendNormal      = "normal"
+	BlendHighlighter = "highlighter"
+)
+
+// StrokeStyle holds the styling of a stroke beyond its color and width.
+// It is stored as JSON in the style column.
+type StrokeStyle struct {
+	Opacity  float64   `json:"opacity"`        // 0..1
+	Dash     []float64 `json:"dash,omitempty"` // alternating dash and gap lengths, solid when empty
+	LineCap  string    `json:"lineCap"`
+	LineJoin string    `json:"lineJoin"`
+	Fill     string    `json:"fill,omitempty"` // fills the area enclosed by the path when set
+	Blend    string    `json:"blend"`
+}
+
+// DefaultStrokeStyle is the style of strokes stored before styles existed
+func DefaultStrokeStyle() StrokeStyle {
+	return StrokeStyle{Opacity: 1, LineCap: CapRound, LineJoin: JoinRound, Blend: BlendNormal}
 }
 
 // InsertStroke inserts a stroke into the strokes table and logs the process
-func InsertStroke(stroke *Stroke) error {
+func InsertStroke(stroke *Stroke, journals ...Journal) error {
 	log.Println("Inserting new stroke:", stroke)
 	log.Printf("Inserting stroke with WhiteboardID: %v", stroke.WhiteboardID)
 
-	// Convert the Path to JSON
-	pathJSON, err := json.Marshal(stroke.Path)
+	// Convert the Path to its stored form
+	pathJSON, err := encodePath(stroke.Path)
 	if err != nil {
 		log.Println("Error marshaling stroke path:", err)
 		return err
 	}
 
-	query := `INSERT INTO strokes (whiteboard_id, owner_id, path, color, width, created_at, deleted, minX, maxX, minY, maxY)
-              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-	result, err := db.Exec(query, stroke.WhiteboardID, stroke.OwnerID, pathJSON, stroke.Color, stroke.Width, stroke.CreatedAt,
-		stroke.Deleted, stroke.MinX, stroke.MaxX, stroke.MinY, stroke.MaxY)
+	styleJSON, err := json.Marshal(stroke.StrokeStyle)
+	if err != nil {
+		log.Println("Error marshaling stroke style:", err)
+		return err
+	}
 
+	var result sql.Result
+	err = withLog(stroke.WhiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		result, err = insertStroke(tx, stroke, pathJSON, styleJSON)
+		return Change{Strokes: []Stroke{*stroke}}, err
+	})
 	if err != nil {
 		log.Println("Error inserting stroke into database:", err)
 		return err
@@ -53,14 +91,82 @@ func InsertStroke(stroke *Stroke) error {
 	return nil
 }
 
+// execer and queryer are satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// insertStroke inserts a stroke with its encoded path and style and sets its ID
+func insertStroke(ex execer, stroke *Stroke, pathJSON, styleJSON []byte) (sql.Result, error) {
+	query := `INSERT INTO strokes (whiteboard_id, owner_id, layer_id, path, color, width, style, created_at, deleted, minX, maxX, minY, maxY)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := ex.Exec(query, stroke.WhiteboardID, stroke.OwnerID, nullableID(stroke.LayerID), pathJSON, stroke.Color, stroke.Width, styleJSON, stroke.CreatedAt,
+		stroke.Deleted, stroke.MinX, stroke.MaxX, stroke.MinY, stroke.MaxY)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	stroke.ID = int(id)
+	return result, nil
+}
+
+const strokeColumns = `id, whiteboard_id, owner_id, layer_id, path, color, width, style, created_at, minX, maxX, minY, maxY, deleted`
+
+func scanStroke(row rowScanner) (Stroke, error) {
+	var stroke Stroke
+	var pathStr string      // Temporarily store path as string
+	var createdAtStr string // Temporarily store created_at as string
+	var layerID sql.NullInt64
+	var styleStr sql.NullString
+
+	// Scan into appropriate types
+	err := row.Scan(&stroke.ID, &stroke.WhiteboardID, &stroke.OwnerID, &layerID, &pathStr, &stroke.Color, &stroke.Width, &styleStr, &createdAtStr, &stroke.MinX, &stroke.MaxX, &stroke.MinY, &stroke.MaxY, &stroke.Deleted)
+	if err != nil {
+		return stroke, err
+	}
+
+	stroke.LayerID = int(layerID.Int64)
+
+	// Parse path JSON
+	stroke.Path, err = decodePath([]byte(pathStr))
+	if err != nil {
+		return stroke, fmt.Errorf("unmarshaling stroke %d path: %w", stroke.ID, err)
+	}
+
+	stroke.StrokeStyle = DefaultStrokeStyle()
+	if styleStr.Valid && styleStr.String != "" {
+		if err := json.Unmarshal([]byte(styleStr.String), &stroke.StrokeStyle); err != nil {
+			return stroke, fmt.Errorf("unmarshaling stroke %d style: %w", stroke.ID, err)
+		}
+	}
+
+	// Parse created_at to time.Time
+	stroke.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+	if err != nil {
+		return stroke, fmt.Errorf("parsing stroke %d created_at: %w", stroke.ID, err)
+	}
+	return stroke, nil
+}
+
+// GetStrokesByWhiteboardID returns the non-deleted strokes on the visible layers of a whiteboard,
+// in drawing order: by layer from bottom to top, then by creation time
 func GetStrokesByWhiteboardID(whiteboardID int) ([]Stroke, error) {
 	log.Printf("Fetching strokes for WhiteboardID: %v", whiteboardID)
 
 	var strokes []Stroke
-	query := `SELECT id, whiteboard_id, owner_id, path, color, width, created_at, minX, maxX, minY, maxY, deleted
-			FROM strokes
-			WHERE whiteboard_id = ? AND deleted = false
-			ORDER BY created_at ASC`
+	query := `SELECT ` + qualifyColumns("s", strokeColumns) + `
+			FROM strokes s LEFT JOIN layers l ON l.id = s.layer_id
+			WHERE s.whiteboard_id = ? AND s.deleted = false AND COALESCE(l.visible, true)
+			ORDER BY COALESCE(l.z_index, 0) ASC, s.created_at ASC, s.id ASC`
 
 	rows, err := db.Query(query, whiteboardID)
 	if err != nil {
@@ -71,29 +177,11 @@ func GetStrokesByWhiteboardID(whiteboardID int) ([]Stroke, error) {
 
 	log.Printf("Processing rows for WhiteboardID: %v", whiteboardID)
 	for rows.Next() {
-		var stroke Stroke
-		var pathStr string      // Temporarily store path as string
-		var createdAtStr string // Temporarily store created_at as string
-
-		// Scan into appropriate types
-		if err := rows.Scan(&stroke.ID, &stroke.WhiteboardID, &stroke.OwnerID, &pathStr, &stroke.Color, &stroke.Width, &createdAtStr, &stroke.MinX, &stroke.MaxX, &stroke.MinY, &stroke.MaxY, &stroke.Deleted); err != nil {
-			log.Println("Error scanning stroke data:", err)
-			return nil, err
-		}
-
-		// Parse path JSON
-		if err := json.Unmarshal([]byte(pathStr), &stroke.Path); err != nil {
-			log.Println("Error unmarshaling stroke path:", err)
-			return nil, err
-		}
-
-		// Parse created_at to time.Time
-		stroke.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+		stroke, err := scanStroke(rows)
 		if err != nil {
-			log.Println("Error parsing created_at:", err)
+			log.Println("Error scanning stroke data:", err)
 			return nil, err
 		}
-
 		strokes = append(strokes, stroke)
 	}
 
@@ -121,3 +209,361 @@ func MarkStrokesDeletedByBoundingBox(whiteboardID int, minX, maxX, minY, maxY fl
 	log.Printf("Successfully marked strokes as deleted, result: %v", result)
 	return nil
 }
+
+// ErrStrokeNotFound is returned when a stroke doesn't exist on the whiteboard or was deleted
+var ErrStrokeNotFound = errors.New("stroke not found")
+
+// withTx runs fn inside a transaction, committing when it returns nil and rolling back otherwise
+func withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockStrokes selects the given non-deleted strokes FOR UPDATE, in the order of ids.
+// It fails with ErrStrokeNotFound if any of them is missing.
+func lockStrokes(tx *sql.Tx, whiteboardID int, ids []int) ([]Stroke, error) {
+	query := `SELECT ` + strokeColumns + `
+			FROM strokes
+			WHERE whiteboard_id = ? AND deleted = false AND id IN (` + placeholders(len(ids)) + `)
+			FOR UPDATE`
+
+	rows, err := tx.Query(query, idArgs(whiteboardID, ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := map[int]Stroke{}
+	for rows.Next() {
+		stroke, err := scanStroke(rows)
+		if err != nil {
+			return nil, err
+		}
+		byID[stroke.ID] = stroke
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	strokes := make([]Stroke, 0, len(ids))
+	for _, id := range ids {
+		stroke, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("stroke %d: %w", id, ErrStrokeNotFound)
+		}
+		strokes = append(strokes, stroke)
+	}
+	return strokes, nil
+}
+
+// updateStrokeGeometry stores a stroke's path and bounding box
+func updateStrokeGeometry(tx *sql.Tx, stroke *Stroke) error {
+	pathJSON, err := encodePath(stroke.Path)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE strokes SET path = ?, minX = ?, maxX = ?, minY = ?, maxY = ? WHERE id = ?`
+	_, err = tx.Exec(query, pathJSON, stroke.MinX, stroke.MaxX, stroke.MinY, stroke.MaxY, stroke.ID)
+	return err
+}
+
+// UpdateStrokesGeometry rewrites the path and bounding box of several strokes in one transaction.
+// update is called with each locked stroke and changes it in place. If any stroke is missing,
+// already deleted, or update fails, nothing is written. The updated strokes are returned.
+func UpdateStrokesGeometry(whiteboardID int, ids []int, update func(*Stroke) error, journals ...Journal) ([]Stroke, error) {
+	strokes, _, err := UpdateContentGeometry(whiteboardID, ids, nil, update, nil, nil, journals...)
+	return strokes, err
+}
+
+// UpdateContentGeometry is UpdateStrokesGeometry for strokes and elements together:
+// updateStroke and updateElement change each locked item in place, and either every
+// item is written or none is. The connectors follow reroutes come after the elements.
+func UpdateContentGeometry(whiteboardID int, strokeIDs, elementIDs []int,
+	updateStroke func(*Stroke) error, updateElement func(*Element) error, follow Follow, journals ...Journal) ([]Stroke, []Element, error) {
+	strokes, elements := []Stroke{}, []Element{}
+	if len(strokeIDs) == 0 && len(elementIDs) == 0 {
+		return strokes, elements, nil
+	}
+
+	err := withLog(whiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		var err error
+		if len(strokeIDs) > 0 {
+			strokes, err = lockStrokes(tx, whiteboardID, strokeIDs)
+			if err != nil {
+				return Change{}, err
+			}
+		}
+		if len(elementIDs) > 0 {
+			elements, err = lockElements(tx, whiteboardID, elementIDs)
+			if err != nil {
+				return Change{}, err
+			}
+		}
+		for i := range strokes {
+			if err := updateStroke(&strokes[i]); err != nil {
+				return Change{}, err
+			}
+			if err := updateStrokeGeometry(tx, &strokes[i]); err != nil {
+				return Change{}, err
+			}
+		}
+		for i := range elements {
+			if err := updateElement(&elements[i]); err != nil {
+				return Change{}, err
+			}
+			if err := updateElementGeometry(tx, &elements[i]); err != nil {
+				return Change{}, err
+			}
+		}
+		followed, err := followElements(tx, whiteboardID, follow)
+		if err != nil {
+			return Change{}, err
+		}
+		elements = append(elements, followed...)
+		return Change{Strokes: strokes, Elements: elements}, nil
+	})
+	if err != nil {
+		log.Printf("Error updating geometry of %d strokes and %d elements on WhiteboardID %v: %v", len(strokeIDs), len(elementIDs), whiteboardID, err)
+		return nil, nil, err
+	}
+	return strokes, elements, nil
+}
+
+// InsertContent adds strokes and elements in one transaction to the whiteboard whiteboardID
+// and sets their IDs. Either every item is inserted or none is. prepare, when set, is called
+// with each element right before it is inserted, when the items before it already have
+// their IDs, and can still change it.
+func InsertContent(whiteboardID int, strokes []Stroke, elements []Element, prepare func(*Element) error, journals ...Journal) error {
+	err := withLog(whiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		return Change{Strokes: strokes, Elements: elements}, insertContent(tx, strokes, elements, prepare)
+	})
+	if err != nil {
+		log.Println("Error inserting content:", err)
+	}
+	return err
+}
+
+func insertContent(tx *sql.Tx, strokes []Stroke, elements []Element, prepare func(*Element) error) error {
+	for i := range strokes {
+		pathJSON, err := encodePath(strokes[i].Path)
+		if err != nil {
+			return err
+		}
+		styleJSON, err := json.Marshal(strokes[i].StrokeStyle)
+		if err != nil {
+			return err
+		}
+		if _, err := insertStroke(tx, &strokes[i], pathJSON, styleJSON); err != nil {
+			return err
+		}
+	}
+	for i := range elements {
+		if prepare != nil {
+			if err := prepare(&elements[i]); err != nil {
+				return err
+			}
+		}
+		data, err := elements[i].marshalData()
+		if err != nil {
+			return err
+		}
+		if err := insertElement(tx, &elements[i], data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetStrokesByIDs returns the non-deleted strokes of a whiteboard with the given IDs, ordered by ID
+func GetStrokesByIDs(whiteboardID int, ids []int) ([]Stroke, error) {
+	return getStrokesByIDs(db, whiteboardID, ids)
+}
+
+func getStrokesByIDs(q queryer, whiteboardID int, ids []int) ([]Stroke, error) {
+	strokes := []Stroke{}
+	if len(ids) == 0 {
+		return strokes, nil
+	}
+
+	query := `SELECT ` + strokeColumns + `
+			FROM strokes
+			WHERE whiteboard_id = ? AND deleted = false AND id IN (` + placeholders(len(ids)) + `)
+			ORDER BY id ASC`
+
+	rows, err := q.Query(query, idArgs(whiteboardID, ids)...)
+	if err != nil {
+		log.Println("Error fetching strokes by ID:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		stroke, err := scanStroke(rows)
+		if err != nil {
+			log.Println("Error scanning stroke data:", err)
+			return nil, err
+		}
+		strokes = append(strokes, stroke)
+	}
+	return strokes, rows.Err()
+}
+
+// GetAllStrokes returns every non-deleted stroke of a whiteboard, on any layer, ordered by ID
+func GetAllStrokes(whiteboardID int) ([]Stroke, error) {
+	return getAllStrokes(db, whiteboardID)
+}
+
+func getAllStrokes(q queryer, whiteboardID int) ([]Stroke, error) {
+	query := `SELECT ` + strokeColumns + `
+			FROM strokes
+			WHERE whiteboard_id = ? AND deleted = false
+			ORDER BY id ASC`
+
+	rows, err := q.Query(query, whiteboardID)
+	if err != nil {
+		log.Println("Error fetching all strokes:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	strokes := []Stroke{}
+	for rows.Next() {
+		stroke, err := scanStroke(rows)
+		if err != nil {
+			log.Println("Error scanning stroke data:", err)
+			return nil, err
+		}
+		strokes = append(strokes, stroke)
+	}
+	return strokes, rows.Err()
+}
+
+// MarkStrokesDeletedByIDs marks the given strokes of a whiteboard as deleted
+func MarkStrokesDeletedByIDs(whiteboardID int, ids []int, journals ...Journal) error {
+	_, err := DeleteContent(whiteboardID, ids, nil, nil, journals...)
+	return err
+}
+
+// DeleteContent is MarkStrokesDeletedByIDs and MarkElementsDeleted in one transaction.
+// It returns the connectors follow rerouted.
+func DeleteContent(whiteboardID int, strokeIDs, elementIDs []int, follow Follow, journals ...Journal) ([]Element, error) {
+	if len(strokeIDs) == 0 && len(elementIDs) == 0 {
+		return nil, nil
+	}
+	var followed []Element
+	err := withLog(whiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		if err := markDeleted(tx, "strokes", whiteboardID, strokeIDs); err != nil {
+			return Change{}, err
+		}
+		if err := markDeleted(tx, "elements", whiteboardID, elementIDs); err != nil {
+			return Change{}, err
+		}
+		var err error
+		if len(elementIDs) > 0 {
+			followed, err = followElements(tx, whiteboardID, follow)
+		}
+		return Change{StrokeIDs: strokeIDs, ElementIDs: elementIDs, Elements: followed}, err
+	})
+	if err != nil {
+		log.Printf("Error deleting %d strokes and %d elements on WhiteboardID %v: %v", len(strokeIDs), len(elementIDs), whiteboardID, err)
+		return nil, err
+	}
+	return followed, nil
+}
+
+// RestoreContent brings back deleted strokes and elements of a whiteboard in one transaction
+// and returns them, ordered by ID
+func RestoreContent(whiteboardID int, strokeIDs, elementIDs []int, journals ...Journal) ([]Stroke, []Element, error) {
+	strokes, elements := []Stroke{}, []Element{}
+	if len(strokeIDs) == 0 && len(elementIDs) == 0 {
+		return strokes, elements, nil
+	}
+	err := withLog(whiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		var err error
+		if len(strokeIDs) > 0 {
+			if err := restoreDeleted(tx, "strokes", whiteboardID, strokeIDs); err != nil {
+				return Change{}, err
+			}
+			if strokes, err = getStrokesByIDs(tx, whiteboardID, strokeIDs); err != nil {
+				return Change{}, err
+			}
+		}
+		if len(elementIDs) > 0 {
+			if err := restoreDeleted(tx, "elements", whiteboardID, elementIDs); err != nil {
+				return Change{}, err
+			}
+			if elements, err = getElementsByIDs(tx, whiteboardID, elementIDs); err != nil {
+				return Change{}, err
+			}
+		}
+		return Change{Strokes: strokes, Elements: elements}, nil
+	})
+	if err != nil {
+		log.Printf("Error restoring %d strokes and %d elements on WhiteboardID %v: %v", len(strokeIDs), len(elementIDs), whiteboardID, err)
+		return nil, nil, err
+	}
+	return strokes, elements, nil
+}
+
+// markDeleted marks rows of the strokes or elements table as deleted
+func markDeleted(tx *sql.Tx, table string, whiteboardID int, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query := `UPDATE ` + table + ` SET deleted = true
+              WHERE whiteboard_id = ? AND id IN (` + placeholders(len(ids)) + `)`
+	_, err := tx.Exec(query, idArgs(whiteboardID, ids)...)
+	return err
+}
+
+// restoreDeleted brings back deleted rows of the strokes or elements table, dropping the
+// clear that removed them
+func restoreDeleted(tx *sql.Tx, table string, whiteboardID int, ids []int) error {
+	query := `UPDATE ` + table + ` SET deleted = false, clear_id = NULL
+              WHERE whiteboard_id = ? AND id IN (` + placeholders(len(ids)) + `)`
+	_, err := tx.Exec(query, idArgs(whiteboardID, ids)...)
+	return err
+}
+
+// ItemBounds is the bounding box of a stroke or element, without its path or data
+type ItemBounds struct {
+	Kind string // "stroke" or "element"
+	ID   int
+	MinX float64
+	MaxX float64
+	MinY float64
+	MaxY float64
+}
+
+// GetItemBoundsByWhiteboardID returns the bounding boxes of every non-deleted stroke and
+// element of a whiteboard. It reads only the box columns, which is what the spatial index needs.
+func GetItemBoundsByWhiteboardID(whiteboardID int) ([]ItemBounds, error) {
+	query := `SELECT 'stroke', id, minX, maxX, minY, maxY FROM strokes WHERE whiteboard_id = ? AND deleted = false
+			UNION ALL
+			SELECT 'element', id, minX, maxX, minY, maxY FROM elements WHERE whiteboard_id = ? AND deleted = false`
+
+	rows, err := db.Query(query, whiteboardID, whiteboardID)
+	if err != nil {
+		log.Println("Error fetching item bounds:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []ItemBounds
+	for rows.Next() {
+		var item ItemBounds
+		if err := rows.Scan(&item.Kind, &item.ID, &item.MinX, &item.MaxX, &item.MinY, &item.MaxY); err != nil {
+			log.Println("Error scanning item bounds:", err)
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
@@ -1 +1,35 @@
 package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// User roles, the values of users.role
+const (
+	RoleAdmin  = "Admin"
+	RoleEditor = "Editor"
+	RoleViewer = "Viewer"
+)
+
+// ErrUserNotFound is returned when a user doesn't exist
+var ErrUserNotFound = errors.New("user not found")
+
+// GetUserRole returns the role of a user. Users without a role are viewers.
+func GetUserRole(userID int) (string, error) {
+	var role sql.NullString
+	err := db.QueryRow(`SELECT role FROM users WHERE id = ?`, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("user %d: %w", userID, ErrUserNotFound)
+	}
+	if err != nil {
+		log.Println("Error fetching user role:", err)
+		return "", err
+	}
+	if !role.Valid {
+		return RoleViewer, nil
+	}
+	return role.String, nil
+}
@@ -0,0 +1,347 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// ErrVersionNotFound is returned when a version doesn't exist on the whiteboard
+var ErrVersionNotFound = errors.New("version not found")
+
+// Version is a named snapshot of a whiteboard's content
+type Version struct {
+	ID           int             `json:"id"`
+	WhiteboardID int             `json:"whiteboardID"`
+	Name         string          `json:"name"`
+	AuthorID     int             `json:"authorID,omitempty"` // 0 when the author is unknown
+	AuthorName   string          `json:"authorName,omitempty"`
+	Automatic    bool            `json:"automatic"`
+	Seq          int             `json:"seq"` // the last operation log entry the snapshot includes
+	StrokeCount  int             `json:"strokeCount"`
+	ElementCount int             `json:"elementCount"`
+	CreatedAt    time.Time       `json:"created_at"`
+	Content      *VersionContent `json:"content,omitempty"` // only set when a single version is read
+}
+
+// VersionContent is what a version holds: every non-deleted stroke and element, and the groups
+type VersionContent struct {
+	Strokes  []Stroke  `json:"strokes"`
+	Elements []Element `json:"elements"`
+	Groups   []Group   `json:"groups"`
+}
+
+// InsertVersion stores a version with its content and sets its ID
+func InsertVersion(version *Version, journals ...Journal) error {
+	return withLog(version.WhiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		return Change{}, insertVersion(tx, version)
+	})
+}
+
+func insertVersion(ex execer, version *Version) error {
+	content, err := json.Marshal(version.Content)
+	if err != nil {
+		log.Println("Error marshaling version content:", err)
+		return err
+	}
+
+	query := `INSERT INTO board_versions (whiteboard_id, name, author_id, automatic, seq, stroke_count, element_count, content, created_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := ex.Exec(query, version.WhiteboardID, version.Name, nullableID(version.AuthorID), version.Automatic, version.Seq,
+		version.StrokeCount, version.ElementCount, content, version.CreatedAt)
+	if err != nil {
+		log.Println("Error inserting version:", err)
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Println("Error reading inserted version ID:", err)
+		return err
+	}
+	version.ID = int(id)
+	return nil
+}
+
+const versionColumns = `v.id, v.whiteboard_id, v.name, v.author_id, COALESCE(u.name, ''), v.automatic, v.seq, v.stroke_count, v.element_count, v.created_at`
+
+func scanVersion(row rowScanner, extra ...any) (Version, error) {
+	var version Version
+	var authorID sql.NullInt64
+	var createdAtStr string
+	dest := []any{&version.ID, &version.WhiteboardID, &version.Name, &authorID, &version.AuthorName, &version.Automatic,
+		&version.Seq, &version.StrokeCount, &version.ElementCount, &createdAtStr}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return version, err
+	}
+	version.AuthorID = int(authorID.Int64)
+
+	var err error
+	version.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+	if err != nil {
+		return version, fmt.Errorf("parsing version %d created_at: %w", version.ID, err)
+	}
+	return version, nil
+}
+
+// GetVersions returns the versions of a whiteboard without their content, newest first
+func GetVersions(whiteboardID int) ([]Version, error) {
+	query := `SELECT ` + versionColumns + `
+			FROM board_versions v LEFT JOIN users u ON u.id = v.author_id
+			WHERE v.whiteboard_id = ?
+			ORDER BY v.created_at DESC, v.id DESC`
+
+	rows, err := db.Query(query, whiteboardID)
+	if err != nil {
+		log.Println("Error fetching versions:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []Version{}
+	for rows.Next() {
+		version, err := scanVersion(rows)
+		if err != nil {
+			log.Println("Error scanning version:", err)
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+// GetVersion returns a version of a whiteboard along with its content
+func GetVersion(whiteboardID, versionID int) (*Version, error) {
+	query := `SELECT ` + versionColumns + `, v.content
+			FROM board_versions v LEFT JOIN users u ON u.id = v.author_id
+			WHERE v.whiteboard_id = ? AND v.id = ?`
+
+	var content []byte
+	version, err := scanVersion(db.QueryRow(query, whiteboardID, versionID), &content)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("version %d: %w", versionID, ErrVersionNotFound)
+	}
+	if err != nil {
+		log.Println("Error fetching version:", err)
+		return nil, err
+	}
+
+	version.Content = &VersionContent{}
+	if err := json.Unmarshal(content, version.Content); err != nil {
+		return nil, fmt.Errorf("unmarshaling version %d content: %w", version.ID, err)
+	}
+	return &version, nil
+}
+
+// GetLatestVersionAt returns the most recent version of a whiteboard that includes the log up
+// to at most the entry seq, without its content, or nil when there is none
+func GetLatestVersionAt(whiteboardID, seq int) (*Version, error) {
+	query := `SELECT ` + versionColumns + `
+			FROM board_versions v LEFT JOIN users u ON u.id = v.author_id
+			WHERE v.whiteboard_id = ? AND v.seq <= ?
+			ORDER BY v.seq DESC, v.id DESC LIMIT 1`
+
+	version, err := scanVersion(db.QueryRow(query, whiteboardID, seq))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Println("Error fetching the latest version:", err)
+		return nil, err
+	}
+	return &version, nil
+}
+
+// RestoreVersion makes the content of a version the whole content of its whiteboard, in one
+// transaction. The content it replaces is saved as backup first, read once the board is locked,
+// with the log position it includes. Then the strokes and elements are written like
+// replaceWhiteboardContent does, prepare being called with each element, and the version's
+// groups are recreated for the items as written. It returns the recreated groups, which are
+// the record of the change.
+func RestoreVersion(backup *Version, content *VersionContent, prepare func(*Element) error, journals ...Journal) ([]Group, error) {
+	whiteboardID := backup.WhiteboardID
+	var groups []Group
+	err := withLog(whiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		if err := lockWhiteboard(tx, whiteboardID); err != nil {
+			return Change{}, err
+		}
+		current := &VersionContent{}
+		var last sql.NullInt64
+		err := tx.QueryRow(`SELECT MAX(seq) FROM operation_log WHERE whiteboard_id = ?`, whiteboardID).Scan(&last)
+		if err != nil {
+			return Change{}, err
+		}
+		if current.Strokes, err = getAllStrokes(tx, whiteboardID); err != nil {
+			return Change{}, err
+		}
+		if current.Elements, err = getAllElements(tx, whiteboardID); err != nil {
+			return Change{}, err
+		}
+		if current.Groups, err = getGroups(tx, whiteboardID); err != nil {
+			return Change{}, err
+		}
+		backup.Seq, backup.Content = int(last.Int64), current
+		backup.StrokeCount, backup.ElementCount = len(current.Strokes), len(current.Elements)
+		if err := insertVersion(tx, backup); err != nil {
+			return Change{}, err
+		}
+
+		// Items that have to be inserted again get new IDs; their group memberships follow them
+		items := map[GroupMember]int{}
+		oldStrokeIDs := make([]int, len(content.Strokes))
+		for i := range content.Strokes {
+			oldStrokeIDs[i] = content.Strokes[i].ID
+		}
+		oldElementIDs := make([]int, len(content.Elements))
+		for i := range content.Elements {
+			oldElementIDs[i] = content.Elements[i].ID
+		}
+		removedStrokeIDs, removedElementIDs, err := replaceWhiteboardContent(tx, whiteboardID, content.Strokes, content.Elements, prepare)
+		if err != nil {
+			return Change{}, err
+		}
+		for i, id := range oldStrokeIDs {
+			items[GroupMember{Kind: ItemStroke, ID: id}] = content.Strokes[i].ID
+		}
+		for i, id := range oldElementIDs {
+			items[GroupMember{Kind: ItemElement, ID: id}] = content.Elements[i].ID
+		}
+
+		if err := clearGroups(tx, whiteboardID); err != nil {
+			return Change{}, err
+		}
+		if groups, err = recreateGroups(tx, whiteboardID, content.Groups, items); err != nil {
+			return Change{}, err
+		}
+		return Change{Strokes: content.Strokes, Elements: content.Elements, StrokeIDs: removedStrokeIDs, ElementIDs: removedElementIDs,
+			Record: groups}, nil
+	})
+	if err != nil {
+		log.Printf("Error restoring a version of whiteboard ID %d: %v", whiteboardID, err)
+		return nil, err
+	}
+	return groups, nil
+}
+
+func replaceWhiteboardContent(tx *sql.Tx, whiteboardID int, strokes []Stroke, elements []Element,
+	prepare func(*Element) error) (removedStrokeIDs, removedElementIDs []int, err error) {
+	existingStrokes, err := lockBoardItems(tx, "strokes", whiteboardID)
+	if err != nil {
+		return nil, nil, err
+	}
+	existingElements, err := lockBoardItems(tx, "elements", whiteboardID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kept := map[int]bool{}
+	for i := range strokes {
+		s := &strokes[i]
+		s.WhiteboardID, s.Deleted = whiteboardID, false
+		pathJSON, err := encodePath(s.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		styleJSON, err := json.Marshal(s.StrokeStyle)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := existingStrokes[s.ID]; !ok {
+			if _, err := insertStroke(tx, s, pathJSON, styleJSON); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		kept[s.ID] = true
+		query := `UPDATE strokes
+                      SET owner_id = ?, layer_id = ?, path = ?, color = ?, width = ?, style = ?, deleted = false, clear_id = NULL, minX = ?, maxX = ?, minY = ?, maxY = ?
+                      WHERE whiteboard_id = ? AND id = ?`
+		_, err = tx.Exec(query, s.OwnerID, nullableID(s.LayerID), pathJSON, s.Color, s.Width, styleJSON,
+			s.MinX, s.MaxX, s.MinY, s.MaxY, whiteboardID, s.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for id, deleted := range existingStrokes {
+		if !kept[id] && !deleted {
+			removedStrokeIDs = append(removedStrokeIDs, id)
+		}
+	}
+
+	kept = map[int]bool{}
+	for i := range elements {
+		e := &elements[i]
+		e.WhiteboardID, e.Deleted = whiteboardID, false
+		if prepare != nil {
+			if err := prepare(e); err != nil {
+				return nil, nil, err
+			}
+		}
+		data, err := e.marshalData()
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := existingElements[e.ID]; !ok {
+			if err := insertElement(tx, e, data); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		kept[e.ID] = true
+		query := `UPDATE elements
+                      SET owner_id = ?, layer_id = ?, type = ?, x = ?, y = ?, width = ?, height = ?, rotation = ?, data = ?, deleted = false, clear_id = NULL,
+                          minX = ?, maxX = ?, minY = ?, maxY = ?
+                      WHERE whiteboard_id = ? AND id = ?`
+		_, err = tx.Exec(query, e.OwnerID, nullableID(e.LayerID), e.Type, e.X, e.Y, e.Width, e.Height, e.Rotation, data,
+			e.MinX, e.MaxX, e.MinY, e.MaxY, whiteboardID, e.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for id, deleted := range existingElements {
+		if !kept[id] && !deleted {
+			removedElementIDs = append(removedElementIDs, id)
+		}
+	}
+
+	slices.Sort(removedStrokeIDs)
+	slices.Sort(removedElementIDs)
+	for _, removed := range []struct {
+		table string
+		ids   []int
+	}{{"strokes", removedStrokeIDs}, {"elements", removedElementIDs}} {
+		if len(removed.ids) == 0 {
+			continue
+		}
+		query := `UPDATE ` + removed.table + ` SET deleted = true WHERE whiteboard_id = ? AND id IN (` + placeholders(len(removed.ids)) + `)`
+		if _, err := tx.Exec(query, idArgs(whiteboardID, removed.ids)...); err != nil {
+			return nil, nil, err
+		}
+	}
+	return removedStrokeIDs, removedElementIDs, nil
+}
+
+// lockBoardItems locks every row of a whiteboard in the strokes or elements table
+// and returns their deleted flags by ID
+func lockBoardItems(tx *sql.Tx, table string, whiteboardID int) (map[int]bool, error) {
+	rows, err := tx.Query(`SELECT id, deleted FROM `+table+` WHERE whiteboard_id = ? FOR UPDATE`, whiteboardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := map[int]bool{}
+	for rows.Next() {
+		var id int
+		var deleted bool
+		if err := rows.Scan(&id, &deleted); err != nil {
+			return nil, err
+		}
+		items[id] = deleted
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,259 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	// ErrNoVoteSession is returned when voting on a board without an open vote session
+	ErrNoVoteSession = errors.New("no vote session is open")
+	// ErrVoteSessionOpen is returned when starting a vote session while another one is open
+	ErrVoteSessionOpen = errors.New("a vote session is already open")
+	// ErrVoteLimit is returned when a user has no votes left in the session
+	ErrVoteLimit = errors.New("no votes left")
+	// ErrNoVote is returned when retracting a vote the user didn't cast
+	ErrNoVote = errors.New("no vote to retract")
+)
+
+// VoteSession is a round of dot voting on the sticky notes of a whiteboard.
+// Every participant gets VotesPerUser votes and may put several on the same note.
+type VoteSession struct {
+	ID           int        `json:"id"`
+	WhiteboardID int        `json:"whiteboardID"`
+	VotesPerUser int        `json:"votesPerUser"`
+	StartedBy    int        `json:"startedBy"`
+	StartedAt    time.Time  `json:"startedAt"`
+	EndedAt      *time.Time `json:"endedAt,omitempty"` // nil while the session is open
+}
+
+// VoteTally is the number of votes a sticky note got in a session
+type VoteTally struct {
+	StickyID int `json:"stickyID"`
+	Votes    int `json:"votes"`
+}
+
+const voteSessionColumns = `id, whiteboard_id, votes_per_user, started_by, started_at, ended_at`
+
+func scanVoteSession(row rowScanner) (*VoteSession, error) {
+	var session VoteSession
+	var startedAtStr string
+	var endedAtStr sql.NullString
+	var startedBy sql.NullInt64
+
+	err := row.Scan(&session.ID, &session.WhiteboardID, &session.VotesPerUser, &startedBy, &startedAtStr, &endedAtStr)
+	if err != nil {
+		return nil, err
+	}
+	session.StartedBy = int(startedBy.Int64)
+	session.StartedAt, err = time.Parse("2006-01-02 15:04:05", startedAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing vote session %d started_at: %w", session.ID, err)
+	}
+	if endedAtStr.Valid {
+		endedAt, err := time.Parse("2006-01-02 15:04:05", endedAtStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("parsing vote session %d ended_at: %w", session.ID, err)
+		}
+		session.EndedAt = &endedAt
+	}
+	return &session, nil
+}
+
+// InsertVoteSession opens a vote session and sets its ID.
+// It fails with ErrVoteSessionOpen when the board already has an open session. The board
+// row is locked while checking, so two sessions can't be opened at once.
+func InsertVoteSession(session *VoteSession, journals ...Journal) error {
+	return withLog(session.WhiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		return Change{Record: session}, insertVoteSession(tx, session)
+	})
+}
+
+func insertVoteSession(tx *sql.Tx, session *VoteSession) error {
+	if err := lockWhiteboard(tx, session.WhiteboardID); err != nil {
+		return err
+	}
+	var open int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM vote_sessions WHERE whiteboard_id = ? AND ended_at IS NULL`,
+		session.WhiteboardID).Scan(&open)
+	if err != nil {
+		return err
+	}
+	if open > 0 {
+		return ErrVoteSessionOpen
+	}
+
+	query := `INSERT INTO vote_sessions (whiteboard_id, votes_per_user, started_by, started_at) VALUES (?, ?, ?, ?)`
+	result, err := tx.Exec(query, session.WhiteboardID, session.VotesPerUser, nullableID(session.StartedBy), session.StartedAt)
+	if err != nil {
+		log.Println("Error inserting vote session:", err)
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	session.ID = int(id)
+	return nil
+}
+
+// GetLatestVoteSession returns the open vote session of a whiteboard, or the last one to
+// end when none is open. It returns ErrNoVoteSession when the board never had one.
+func GetLatestVoteSession(whiteboardID int) (*VoteSession, error) {
+	query := `SELECT ` + voteSessionColumns + ` FROM vote_sessions WHERE whiteboard_id = ?
+              ORDER BY ended_at IS NULL DESC, id DESC LIMIT 1`
+	session, err := scanVoteSession(db.QueryRow(query, whiteboardID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNoVoteSession
+	}
+	if err != nil {
+		log.Println("Error fetching vote session:", err)
+		return nil, err
+	}
+	return session, nil
+}
+
+// EndVoteSession closes the open vote session of a whiteboard and returns it
+func EndVoteSession(whiteboardID int, endedAt time.Time, journals ...Journal) (*VoteSession, error) {
+	var session *VoteSession
+	err := withLog(whiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		var err error
+		session, err = lockOpenVoteSession(tx, whiteboardID)
+		if err != nil {
+			return Change{}, err
+		}
+		_, err = tx.Exec(`UPDATE vote_sessions SET ended_at = ? WHERE id = ?`, endedAt, session.ID)
+		session.EndedAt = &endedAt
+		return Change{Record: session}, err
+	})
+	return session, err
+}
+
+func lockOpenVoteSession(tx *sql.Tx, whiteboardID int) (*VoteSession, error) {
+	query := `SELECT ` + voteSessionColumns + ` FROM vote_sessions
+              WHERE whiteboard_id = ? AND ended_at IS NULL FOR UPDATE`
+	session, err := scanVoteSession(tx.QueryRow(query, whiteboardID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNoVoteSession
+	}
+	return session, err
+}
+
+// CastVote adds a user's vote on a sticky note in the open vote session of its whiteboard.
+// The session row is locked while counting, so concurrent votes can't exceed the limit.
+// It returns the session.
+func CastVote(whiteboardID, stickyID, userID int, journals ...Journal) (*VoteSession, error) {
+	var session *VoteSession
+	err := withLog(whiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		var err error
+		session, err = lockOpenVoteSession(tx, whiteboardID)
+		if err != nil {
+			return Change{}, err
+		}
+		return Change{Record: session}, castVote(tx, session, stickyID, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func castVote(tx *sql.Tx, session *VoteSession, stickyID, userID int) error {
+	var found int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM elements WHERE whiteboard_id = ? AND id = ? AND type = ? AND deleted = false`,
+		session.WhiteboardID, stickyID, ElementSticky).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found == 0 {
+		return fmt.Errorf("sticky note %d: %w", stickyID, ErrElementNotFound)
+	}
+
+	used, err := countVotes(tx, session.ID, userID)
+	if err != nil {
+		return err
+	}
+	if used >= session.VotesPerUser {
+		return ErrVoteLimit
+	}
+
+	_, err = tx.Exec(`INSERT INTO votes (session_id, element_id, user_id, created_at) VALUES (?, ?, ?, ?)`,
+		session.ID, stickyID, userID, time.Now())
+	return err
+}
+
+// RetractVote takes back one of the user's votes on a sticky note in the open session.
+// It returns the session.
+func RetractVote(whiteboardID, stickyID, userID int, journals ...Journal) (*VoteSession, error) {
+	var session *VoteSession
+	err := withLog(whiteboardID, journals, func(tx *sql.Tx) (Change, error) {
+		var err error
+		session, err = lockOpenVoteSession(tx, whiteboardID)
+		if err != nil {
+			return Change{}, err
+		}
+		return Change{Record: session}, retractVote(tx, session, stickyID, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func retractVote(tx *sql.Tx, session *VoteSession, stickyID, userID int) error {
+	result, err := tx.Exec(`DELETE FROM votes WHERE session_id = ? AND element_id = ? AND user_id = ? LIMIT 1`,
+		session.ID, stickyID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNoVote
+	}
+	return nil
+}
+
+func countVotes(tx *sql.Tx, sessionID, userID int) (int, error) {
+	var used int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM votes WHERE session_id = ? AND user_id = ?`, sessionID, userID).Scan(&used)
+	return used, err
+}
+
+// CountUserVotes returns how many votes a user cast in a session
+func CountUserVotes(sessionID, userID int) (int, error) {
+	var used int
+	err := db.QueryRow(`SELECT COUNT(*) FROM votes WHERE session_id = ? AND user_id = ?`, sessionID, userID).Scan(&used)
+	if err != nil {
+		log.Println("Error counting votes:", err)
+	}
+	return used, err
+}
+
+// GetVoteTallies returns the votes per sticky note of a session, most voted first.
+// Votes on notes deleted since are left out.
+func GetVoteTallies(sessionID int) ([]VoteTally, error) {
+	query := `SELECT v.element_id, COUNT(*) AS votes
+              FROM votes v
+              JOIN elements e ON e.id = v.element_id
+              WHERE v.session_id = ? AND e.deleted = false
+              GROUP BY v.element_id
+              ORDER BY votes DESC, v.element_id ASC`
+	rows, err := db.Query(query, sessionID)
+	if err != nil {
+		log.Println("Error fetching vote tallies:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	tallies := []VoteTally{}
+	for rows.Next() {
+		var tally VoteTally
+		if err := rows.Scan(&tally.StickyID, &tally.Votes); err != nil {
+			return nil, err
+		}
+		tallies = append(tallies, tally)
+	}
+	return tallies, rows.Err()
+}
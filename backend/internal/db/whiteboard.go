@@ -19,6 +19,8 @@ type Whiteboard struct {
 	OwnerID   int       `json:"owner"`
 	CreatedAt time.Time `json:"created"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// ContentBounds is the box around everything on the board, for zoom-to-fit. nil while the board is empty.
+	ContentBounds *Bounds `json:"contentBounds"`
 	// CurrentState string    `json:"data"` // Store JSON as a string
 	//  for example: whiteboard.CurrentState = `{"strokes": [...], "shapes": [...]}`
 }
@@ -39,30 +41,40 @@ func InsertWhiteboard(board *Whiteboard) error {
 	          VALUES (?, ?, ?, ?)`
 
 	// Insert the whiteboard data into the database
-	_, err := db.Exec(query, board.Name, board.OwnerID, board.CreatedAt, board.UpdatedAt)
+	result, err := db.Exec(query, board.Name, board.OwnerID, board.CreatedAt, board.UpdatedAt)
 	if err != nil {
 		log.Println("Error inserting whiteboard:", err)
 		return err
 	}
 
-	return nil
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Println("Error reading inserted whiteboard ID:", err)
+		return err
+	}
+	board.ID = int(id)
+
+	// Every whiteboard starts with one layer to draw on
+	layer := Layer{WhiteboardID: board.ID, Name: DefaultLayerName, Visible: true, CreatedAt: board.CreatedAt}
+	return InsertLayer(&layer)
 }
 
 func GetWhiteboardById(id int) (*Whiteboard, error) {
 	var whiteboard Whiteboard
 	var createdAt, updatedAt []byte // Scan the timestamps as byte slices (strings) first
+	var minX, maxX, minY, maxY sql.NullFloat64
 
 	database := GetDB()
 
-	query := `SELECT id, name, owner_id, created_at, updated_at
+	query := `SELECT id, name, owner_id, created_at, updated_at, content_minX, content_maxX, content_minY, content_maxY
 			 FROM whiteboards WHERE id = ?`
 
 	row := database.QueryRow(query, id)
-	err := row.Scan(&whiteboard.ID, &whiteboard.Name, &whiteboard.OwnerID, &createdAt, &updatedAt)
+	err := row.Scan(&whiteboard.ID, &whiteboard.Name, &whiteboard.OwnerID, &createdAt, &updatedAt, &minX, &maxX, &minY, &maxY)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("whiteboard ID: %d was not found in the database", whiteboard.ID)
+			return nil, fmt.Errorf("whiteboard ID: %d: %w", id, ErrWhiteboardNotFound)
 		}
 		log.Println("Error on running SQL query: ", err)
 		return nil, err
@@ -80,19 +92,22 @@ func GetWhiteboardById(id int) (*Whiteboard, error) {
 		log.Println("Error parsing updated_at:", err)
 		return nil, err
 	}
+	whiteboard.ContentBounds = nullableBounds(minX, maxX, minY, maxY)
 
 	return &whiteboard, nil
 }
 
-func UpdateWhiteboard(id int, whiteboard *Whiteboard) error {
-	database := GetDB()
+func UpdateWhiteboard(id int, whiteboard *Whiteboard, journals ...Journal) error {
 	whiteboard.UpdatedAt = time.Now()
 
 	query := `UPDATE whiteboards 
               SET name = ?, updated_at = ?
               WHERE id = ?`
 
-	_, err := database.Exec(query, whiteboard.Name, whiteboard.UpdatedAt, id)
+	err := withLog(id, journals, func(tx *sql.Tx) (Change, error) {
+		_, err := tx.Exec(query, whiteboard.Name, whiteboard.UpdatedAt, id)
+		return Change{}, err
+	})
 	if err != nil {
 		log.Println("Error updating whiteboard:", err)
 		return err
@@ -114,13 +129,13 @@ func DeleteWhiteboard(id int) error {
 	return nil
 }
 
-func ClearStrokesByWhiteboardID(whiteboardID int) error {
-	query := `DELETE FROM strokes WHERE whiteboard_id = ?`
-	_, err := db.Exec(query, whiteboardID)
-	if err != nil {
-		log.Printf("Error clearing strokes for whiteboard ID %d: %v", whiteboardID, err)
-		return err
+// lockWhiteboard locks the row of a whiteboard until the transaction ends. Writers that must
+// not interleave on one board, like log appends or creating its default layer, take it first.
+func lockWhiteboard(tx *sql.Tx, id int) error {
+	var boardID int
+	err := tx.QueryRow(`SELECT id FROM whiteboards WHERE id = ? FOR UPDATE`, id).Scan(&boardID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("whiteboard %d: %w", id, ErrWhiteboardNotFound)
 	}
-	log.Printf("Successfully cleared strokes for whiteboard ID %d", whiteboardID)
-	return nil
+	return err
 }
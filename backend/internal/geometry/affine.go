@@ -0,0 +1,211 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+	"sketchive/internal/db"
+)
+
+// Affine is a 2D affine transform in the same order as SVG's matrix(a b c d e f):
+//
+//	x' = A*x + C*y + E
+//	y' = B*x + D*y + F
+type Affine struct {
+	A, B, C, D, E, F float64
+}
+
+// Identity returns the transform that leaves points unchanged
+func Identity() Affine {
+	return Affine{A: 1, D: 1}
+}
+
+// Translation returns a transform moving points by dx, dy
+func Translation(dx, dy float64) Affine {
+	return Affine{A: 1, D: 1, E: dx, F: dy}
+}
+
+// Scaling returns a transform scaling points by sx, sy around the origin
+func Scaling(sx, sy float64) Affine {
+	return Affine{A: sx, D: sy}
+}
+
+// Rotation returns a transform rotating points by the given degrees around the origin,
+// clockwise on screen like RotatePoint
+func Rotation(degrees float64) Affine {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	return Affine{A: cos, B: sin, C: -sin, D: cos}
+}
+
+// Then returns the transform applying m first and n second
+func (m Affine) Then(n Affine) Affine {
+	return Affine{
+		A: n.A*m.A + n.C*m.B,
+		B: n.B*m.A + n.D*m.B,
+		C: n.A*m.C + n.C*m.D,
+		D: n.B*m.C + n.D*m.D,
+		E: n.A*m.E + n.C*m.F + n.E,
+		F: n.B*m.E + n.D*m.F + n.F,
+	}
+}
+
+// Around returns m applied with origin as its fixed point instead of (0, 0)
+func (m Affine) Around(origin db.Point) Affine {
+	return Translation(-origin.X, -origin.Y).Then(m).Then(Translation(origin.X, origin.Y))
+}
+
+// Apply transforms a point, keeping any extra data carried by the point
+func (m Affine) Apply(p db.Point) db.Point {
+	x, y := p.X, p.Y
+	p.X = m.A*x + m.C*y + m.E
+	p.Y = m.B*x + m.D*y + m.F
+	return p
+}
+
+// Determinant returns the area scale factor of the transform; negative values mirror
+func (m Affine) Determinant() float64 {
+	return m.A*m.D - m.B*m.C
+}
+
+// Invert returns the inverse transform
+func (m Affine) Invert() (Affine, error) {
+	det := m.Determinant()
+	if det == 0 || math.IsNaN(det) || math.IsInf(det, 0) {
+		return Affine{}, fmt.Errorf("transform can't be inverted")
+	}
+	return Affine{
+		A: m.D / det,
+		B: -m.B / det,
+		C: -m.C / det,
+		D: m.A / det,
+		E: (m.C*m.F - m.D*m.E) / det,
+		F: (m.B*m.E - m.A*m.F) / det,
+	}, nil
+}
+
+// IsFinite reports whether every coefficient is a finite number
+func (m Affine) IsFinite() bool {
+	for _, v := range []float64{m.A, m.B, m.C, m.D, m.E, m.F} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// RotationDegrees returns the rotation part of the transform
+func (m Affine) RotationDegrees() float64 {
+	return math.Atan2(m.B, m.A) * 180 / math.Pi
+}
+
+// ScaleFactors returns how much the transform stretches the x and y axes
+func (m Affine) ScaleFactors() (float64, float64) {
+	sx := math.Hypot(m.A, m.B)
+	if sx == 0 {
+		return 0, 0
+	}
+	return sx, m.Determinant() / sx
+}
+
+// Transform describes a move, rotation and scale the way clients send it:
+// scale and rotate around the origin point, then translate.
+// A raw Matrix, when given, is used instead of the other fields.
+type Transform struct {
+	TranslateX float64     `json:"translateX"`
+	TranslateY float64     `json:"translateY"`
+	Rotation   float64     `json:"rotation"` // degrees
+	ScaleX     float64     `json:"scaleX"`   // 0 means 1
+	ScaleY     float64     `json:"scaleY"`   // 0 means 1
+	OriginX    float64     `json:"originX"`
+	OriginY    float64     `json:"originY"`
+	Matrix     *[6]float64 `json:"matrix,omitempty"` // [a, b, c, d, e, f]
+}
+
+// Affine turns the transform into a matrix, rejecting transforms that would
+// produce invalid coordinates or flatten strokes onto a line
+func (t Transform) Affine() (Affine, error) {
+	var m Affine
+	if t.Matrix != nil {
+		m = Affine{A: t.Matrix[0], B: t.Matrix[1], C: t.Matrix[2], D: t.Matrix[3], E: t.Matrix[4], F: t.Matrix[5]}
+	} else {
+		sx, sy := t.ScaleX, t.ScaleY
+		if sx == 0 {
+			sx = 1
+		}
+		if sy == 0 {
+			sy = 1
+		}
+		origin := db.Point{X: t.OriginX, Y: t.OriginY}
+		m = Scaling(sx, sy).Then(Rotation(t.Rotation)).Around(origin).Then(Translation(t.TranslateX, t.TranslateY))
+	}
+
+	if !m.IsFinite() {
+		return Affine{}, fmt.Errorf("transform contains non-finite numbers")
+	}
+	if math.Abs(m.Determinant()) < 1e-9 {
+		return Affine{}, fmt.Errorf("transform collapses content to a line or point")
+	}
+	return m, nil
+}
+
+// TransformPoints applies m to every point, returning a new slice
+func TransformPoints(points []db.Point, m Affine) []db.Point {
+	out := make([]db.Point, len(points))
+	for i, p := range points {
+		out[i] = m.Apply(p)
+	}
+	return out
+}
+
+// CanMirror reports whether a mirroring transform can be applied to the element. Points
+// mirror exactly and rectangles, ellipses and frames look the same flipped, but images and
+// the text of text elements and stickies would come out reversed.
+func CanMirror(e *db.Element) bool {
+	switch e.Type {
+	case db.ElementText, db.ElementImage, db.ElementSticky:
+		return false
+	}
+	return true
+}
+
+// TransformElement applies m to an element in place and recomputes its bounding box.
+// Point based elements transform their points exactly. Box shaped elements can't skew,
+// so they move with their center, turn by the transform's rotation and stretch by its
+// scale factors. A mirroring transform turns them the other way, which flips the box
+// within its own frame; callers check CanMirror first. Frames stay upright. Text keeps its
+// proportions: the font scales with the vertical factor and the text is measured again.
+func TransformElement(e *db.Element, m Affine) error {
+	switch e.Type {
+	case db.ElementLine, db.ElementArrow, db.ElementPolygon, db.ElementConnector:
+		e.Points = TransformPoints(e.Points, m)
+		MoveConnectorEnds(e, m)
+		SyncElementBox(e)
+	default:
+		center := m.Apply(boxRect(e).Center())
+		sx, sy := m.ScaleFactors()
+		sx, sy = math.Abs(sx), math.Abs(sy)
+		if e.Type != db.ElementFrame {
+			if m.Determinant() < 0 {
+				e.Rotation = math.Mod(m.RotationDegrees()-e.Rotation, 360)
+			} else {
+				e.Rotation = math.Mod(e.Rotation+m.RotationDegrees(), 360)
+			}
+		}
+		if e.Type == db.ElementText && e.Text != nil {
+			e.Text.FontSize *= sy
+			e.Text.WrapWidth *= sx
+			MeasureTextElement(e)
+		} else {
+			e.Width *= sx
+			e.Height *= sy
+			SyncStickyText(e)
+		}
+		e.X, e.Y = center.X-e.Width/2, center.Y-e.Height/2
+	}
+
+	bounds, err := ElementBounds(e)
+	if err != nil {
+		return fmt.Errorf("element %d: %w", e.ID, err)
+	}
+	e.MinX, e.MaxX, e.MinY, e.MaxY = bounds.MinX, bounds.MaxX, bounds.MinY, bounds.MaxY
+	return nil
+}
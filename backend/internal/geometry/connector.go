@@ -0,0 +1,206 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+	"sketchive/internal/db"
+)
+
+// ElementLookup returns the current state of an element a connector may be bound to
+type ElementLookup func(id int) (*db.Element, bool)
+
+// BoundElementIDs returns the IDs of the elements a connector's ends are attached to
+func BoundElementIDs(e *db.Element) []int {
+	if e.Type != db.ElementConnector || e.Connector == nil {
+		return nil
+	}
+	var ids []int
+	for _, end := range []db.ConnectorEnd{e.Connector.Start, e.Connector.End} {
+		if end.ElementID != 0 {
+			ids = append(ids, end.ElementID)
+		}
+	}
+	return ids
+}
+
+// IsBoundTo reports whether either end of the connector is attached to one of the elements
+func IsBoundTo(e *db.Element, ids map[int]bool) bool {
+	for _, id := range BoundElementIDs(e) {
+		if ids[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// anchorBox returns the unrotated box a connector attaches to and the box's rotation.
+// Point based elements use the box around their points.
+func anchorBox(e *db.Element) (Rect, float64) {
+	switch e.Type {
+	case db.ElementLine, db.ElementArrow, db.ElementPolygon, db.ElementConnector:
+		box, err := PointsBounds(e.Points)
+		if err == nil {
+			return box, 0
+		}
+	}
+	return boxRect(e), e.Rotation
+}
+
+// anchorPoint returns where a connector end attaches to target. toward is the other end
+// of the connector, used to pick the facing side for automatic anchors.
+func anchorPoint(end db.ConnectorEnd, target *db.Element, toward db.Point) db.Point {
+	box, rotation := anchorBox(target)
+	center := box.Center()
+	if end.Position != nil {
+		p := db.Point{
+			X: box.MinX + end.Position.X*(box.MaxX-box.MinX),
+			Y: box.MinY + end.Position.Y*(box.MaxY-box.MinY),
+		}
+		return RotatePoint(p, center, rotation)
+	}
+
+	sides := map[string]db.Point{
+		db.AnchorTop:    {X: center.X, Y: box.MinY},
+		db.AnchorRight:  {X: box.MaxX, Y: center.Y},
+		db.AnchorBottom: {X: center.X, Y: box.MaxY},
+		db.AnchorLeft:   {X: box.MinX, Y: center.Y},
+	}
+	switch end.Anchor {
+	case db.AnchorCenter:
+		return center
+	case db.AnchorTop, db.AnchorRight, db.AnchorBottom, db.AnchorLeft:
+		return RotatePoint(sides[end.Anchor], center, rotation)
+	}
+
+	// Automatic: the side midpoint closest to the other end, checked in a fixed order
+	// so ties always resolve the same way
+	best, bestDistance := center, math.Inf(1)
+	for _, side := range []string{db.AnchorTop, db.AnchorRight, db.AnchorBottom, db.AnchorLeft} {
+		p := RotatePoint(sides[side], center, rotation)
+		if d := math.Hypot(p.X-toward.X, p.Y-toward.Y); d < bestDistance {
+			best, bestDistance = p, d
+		}
+	}
+	return best
+}
+
+// endReference is the point the other end aims at when choosing an automatic anchor:
+// the center of a bound element or the position of a free end
+func endReference(end db.ConnectorEnd, lookup ElementLookup, fallback db.Point) db.Point {
+	if end.ElementID != 0 {
+		if target, ok := lookup(end.ElementID); ok {
+			box, _ := anchorBox(target)
+			return box.Center()
+		}
+	}
+	if end.Point != nil {
+		return *end.Point
+	}
+	return fallback
+}
+
+// RouteConnector sets a connector's points from the current position of the elements
+// its ends are bound to, and recomputes its bounding box. It fails when a bound element
+// can't be found.
+func RouteConnector(e *db.Element, lookup ElementLookup) error {
+	if e.Connector == nil {
+		return fmt.Errorf("connector needs a start and an end")
+	}
+	var previousStart, previousEnd db.Point
+	if len(e.Points) >= 2 {
+		previousStart, previousEnd = e.Points[0], e.Points[len(e.Points)-1]
+	}
+	startRef := endReference(e.Connector.Start, lookup, previousStart)
+	endRef := endReference(e.Connector.End, lookup, previousEnd)
+
+	points := make([]db.Point, 2)
+	for i, end := range []db.ConnectorEnd{e.Connector.Start, e.Connector.End} {
+		toward := endRef
+		if i == 1 {
+			toward = startRef
+		}
+		switch {
+		case end.ElementID != 0:
+			target, ok := lookup(end.ElementID)
+			if !ok {
+				return fmt.Errorf("element %d: %w", end.ElementID, db.ErrElementNotFound)
+			}
+			points[i] = anchorPoint(end, target, toward)
+		case end.Point != nil:
+			points[i] = *end.Point
+		default:
+			return fmt.Errorf("connector ends need an elementID or a point")
+		}
+	}
+	e.Points = points
+	SyncElementBox(e)
+
+	bounds, err := ElementBounds(e)
+	if err != nil {
+		return fmt.Errorf("connector %d: %w", e.ID, err)
+	}
+	e.MinX, e.MaxX, e.MinY, e.MaxY = bounds.MinX, bounds.MaxX, bounds.MinY, bounds.MaxY
+	return nil
+}
+
+// DetachConnector unbinds the ends of a connector attached to deleted elements, leaving
+// them as free ends where they currently are. It reports whether anything changed.
+func DetachConnector(e *db.Element, deleted map[int]bool) bool {
+	if e.Connector == nil || len(e.Points) < 2 {
+		return false
+	}
+	changed := false
+	ends := []*db.ConnectorEnd{&e.Connector.Start, &e.Connector.End}
+	positions := []db.Point{e.Points[0], e.Points[len(e.Points)-1]}
+	for i, end := range ends {
+		if end.ElementID != 0 && deleted[end.ElementID] {
+			p := positions[i]
+			*end = db.ConnectorEnd{Point: &p}
+			changed = true
+		}
+	}
+	return changed
+}
+
+// MoveConnectorEnds applies m to the free ends of a connector, for when the connector
+// itself is transformed. Bound ends follow their elements instead.
+func MoveConnectorEnds(e *db.Element, m Affine) {
+	if e.Connector == nil {
+		return
+	}
+	for _, end := range []*db.ConnectorEnd{&e.Connector.Start, &e.Connector.End} {
+		if end.ElementID == 0 && end.Point != nil {
+			p := m.Apply(*end.Point)
+			end.Point = &p
+		}
+	}
+}
+
+func validateConnector(e *db.Element) error {
+	if e.Connector == nil {
+		return fmt.Errorf("connector needs a start and an end")
+	}
+	for _, end := range []db.ConnectorEnd{e.Connector.Start, e.Connector.End} {
+		if (end.ElementID != 0) == (end.Point != nil) {
+			return fmt.Errorf("each connector end needs either an elementID or a point")
+		}
+		if end.ElementID != 0 && end.ElementID == e.ID {
+			return fmt.Errorf("a connector can't be bound to itself")
+		}
+		switch end.Anchor {
+		case "", db.AnchorAuto, db.AnchorTop, db.AnchorRight, db.AnchorBottom, db.AnchorLeft, db.AnchorCenter:
+		default:
+			return fmt.Errorf("unknown anchor %q", end.Anchor)
+		}
+		// Written so NaN fails the check too
+		if p := end.Position; p != nil && !(p.X >= 0 && p.X <= 1 && p.Y >= 0 && p.Y <= 1) {
+			return fmt.Errorf("anchor positions must be between 0 and 1")
+		}
+		if end.Point != nil {
+			if err := checkPoints([]db.Point{*end.Point}); err != nil {
+				return fmt.Errorf("connector end: %w", err)
+			}
+		}
+	}
+	return nil
+}
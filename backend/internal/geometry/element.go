@@ -0,0 +1,275 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+	"sketchive/internal/db"
+	"strings"
+)
+
+// ellipseSegments is how many straight segments approximate an ellipse outline
+const ellipseSegments = 64
+
+// ArrowheadSize returns the length of an arrowhead drawn with the given stroke width
+func ArrowheadSize(strokeWidth float64) float64 {
+	return math.Max(10, strokeWidth*4)
+}
+
+// Arrowhead returns the outline of an arrowhead whose tip is at tip, pointing away from from.
+// The outline is the two barbs and the tip: barb, tip, barb.
+func Arrowhead(tip, from db.Point, strokeWidth float64) []db.Point {
+	size := ArrowheadSize(strokeWidth)
+	angle := math.Atan2(tip.Y-from.Y, tip.X-from.X)
+	spread := math.Pi / 6
+	return []db.Point{
+		{X: tip.X - size*math.Cos(angle-spread), Y: tip.Y - size*math.Sin(angle-spread)},
+		tip,
+		{X: tip.X - size*math.Cos(angle+spread), Y: tip.Y - size*math.Sin(angle+spread)},
+	}
+}
+
+// boxRect returns the unrotated box of a box shaped element
+func boxRect(e *db.Element) Rect {
+	return Rect{MinX: e.X, MaxX: e.X + e.Width, MinY: e.Y, MaxY: e.Y + e.Height}
+}
+
+// ElementOutline returns the outline of an element in board coordinates and whether the outline is closed.
+// Arrowheads are not part of the outline, see ElementArrowheads.
+func ElementOutline(e *db.Element) ([]db.Point, bool) {
+	switch e.Type {
+	case db.ElementRectangle, db.ElementText, db.ElementImage, db.ElementSticky, db.ElementFrame:
+		box := boxRect(e)
+		center := box.Center()
+		corners := box.Corners()
+		for i := range corners {
+			corners[i] = RotatePoint(corners[i], center, e.Rotation)
+		}
+		return corners, true
+	case db.ElementEllipse:
+		box := boxRect(e)
+		center := box.Center()
+		rx, ry := e.Width/2, e.Height/2
+		points := make([]db.Point, ellipseSegments)
+		for i := range points {
+			t := 2 * math.Pi * float64(i) / ellipseSegments
+			p := db.Point{X: center.X + rx*math.Cos(t), Y: center.Y + ry*math.Sin(t)}
+			points[i] = RotatePoint(p, center, e.Rotation)
+		}
+		return points, true
+	case db.ElementPolygon:
+		return e.Points, true
+	default:
+		return e.Points, false
+	}
+}
+
+// ElementArrowheads returns the outlines of the arrowheads drawn at the ends of a line or arrow
+func ElementArrowheads(e *db.Element) [][]db.Point {
+	if len(e.Points) < 2 {
+		return nil
+	}
+	var heads [][]db.Point
+	n := len(e.Points)
+	if e.EndArrowhead != "" && e.EndArrowhead != db.ArrowheadNone {
+		heads = append(heads, Arrowhead(e.Points[n-1], e.Points[n-2], e.Style.StrokeWidth))
+	}
+	if e.StartArrowhead != "" && e.StartArrowhead != db.ArrowheadNone {
+		heads = append(heads, Arrowhead(e.Points[0], e.Points[1], e.Style.StrokeWidth))
+	}
+	return heads
+}
+
+// ElementBounds returns the bounding box of the element's outline, including its stroke width and arrowheads
+func ElementBounds(e *db.Element) (Rect, error) {
+	var bounds Rect
+	switch e.Type {
+	case db.ElementEllipse:
+		// Exact extent of a rotated ellipse instead of the box around its sampled outline
+		center := boxRect(e).Center()
+		rx, ry := e.Width/2, e.Height/2
+		sin, cos := math.Sincos(e.Rotation * math.Pi / 180)
+		halfW := math.Sqrt(rx*rx*cos*cos + ry*ry*sin*sin)
+		halfH := math.Sqrt(rx*rx*sin*sin + ry*ry*cos*cos)
+		bounds = Rect{MinX: center.X - halfW, MaxX: center.X + halfW, MinY: center.Y - halfH, MaxY: center.Y + halfH}
+	default:
+		outline, _ := ElementOutline(e)
+		var err error
+		bounds, err = PointsBounds(outline)
+		if err != nil {
+			return Rect{}, err
+		}
+	}
+
+	for _, head := range ElementArrowheads(e) {
+		headBounds, _ := PointsBounds(head)
+		bounds = bounds.Union(headBounds)
+	}
+	return bounds.Expand(e.Style.StrokeWidth / 2), nil
+}
+
+// ElementIntersectsRect reports whether the element's true outline touches r.
+// Filled closed shapes are also hit when r lies inside them.
+func ElementIntersectsRect(e *db.Element, r Rect) bool {
+	outline, closed := ElementOutline(e)
+	if PolylineNearRect(outline, closed, e.Style.StrokeWidth, r) {
+		return true
+	}
+	for _, head := range ElementArrowheads(e) {
+		if PolylineNearRect(head, false, e.Style.StrokeWidth, r) {
+			return true
+		}
+	}
+	if closed && isSolid(e) && PointInPolygon(r.Center(), outline) {
+		return true
+	}
+	return false
+}
+
+// isSolid reports whether the inside of a closed element counts as part of it for hit testing
+func isSolid(e *db.Element) bool {
+	return e.Type == db.ElementText || e.Type == db.ElementImage || e.Type == db.ElementSticky || e.Style.FillColor != ""
+}
+
+// MeasureTextElement sets the size of a text element from its laid out content.
+// Wrapped text is as wide as its wrap width, unwrapped text as wide as its longest line.
+func MeasureTextElement(e *db.Element) {
+	if e.Type != db.ElementText || e.Text == nil {
+		return
+	}
+	t := e.Text
+	layout := LayoutText(t.Content, FontForFamily(t.FontFamily), t.FontSize, t.WrapWidth)
+	e.Width = layout.Width
+	if t.WrapWidth > 0 {
+		e.Width = t.WrapWidth
+	}
+	e.Height = layout.Height
+}
+
+// StickyPadding is the space between the edge of a sticky note and its text
+const StickyPadding = 12
+
+// SyncStickyText wraps a sticky note's text to the width of the note
+func SyncStickyText(e *db.Element) {
+	if e.Type != db.ElementSticky || e.Text == nil {
+		return
+	}
+	e.Text.WrapWidth = math.Max(e.Width-2*StickyPadding, 1)
+}
+
+// SyncElementBox sets X/Y/Width/Height of point based elements to the box around their points,
+// so that every element type can be positioned and listed the same way
+func SyncElementBox(e *db.Element) {
+	if len(e.Points) == 0 {
+		return
+	}
+	switch e.Type {
+	case db.ElementLine, db.ElementArrow, db.ElementPolygon, db.ElementConnector:
+		box, _ := PointsBounds(e.Points)
+		e.X, e.Y = box.MinX, box.MinY
+		e.Width, e.Height = box.MaxX-box.MinX, box.MaxY-box.MinY
+		e.Rotation = 0
+	}
+}
+
+// ValidateElement checks that an element has the geometry its type needs
+func ValidateElement(e *db.Element) error {
+	for _, field := range []struct {
+		name  string
+		value float64
+	}{{"x", e.X}, {"y", e.Y}, {"width", e.Width}, {"height", e.Height}, {"rotation", e.Rotation}, {"stroke width", e.Style.StrokeWidth}} {
+		if err := CheckCoordinate(field.name, field.value); err != nil {
+			return err
+		}
+	}
+	if err := checkPoints(e.Points); err != nil {
+		return err
+	}
+
+	switch e.Type {
+	case db.ElementRectangle, db.ElementEllipse:
+		if e.Width <= 0 || e.Height <= 0 {
+			return fmt.Errorf("%s needs a positive width and height", e.Type)
+		}
+	case db.ElementLine, db.ElementArrow:
+		if len(e.Points) < 2 {
+			return fmt.Errorf("%s needs at least 2 points", e.Type)
+		}
+	case db.ElementPolygon:
+		if len(e.Points) < 3 {
+			return fmt.Errorf("polygon needs at least 3 points")
+		}
+	case db.ElementConnector:
+		if err := validateConnector(e); err != nil {
+			return err
+		}
+	case db.ElementText:
+		if err := validateText(e.Text); err != nil {
+			return err
+		}
+	case db.ElementSticky:
+		if e.Width <= 0 || e.Height <= 0 {
+			return fmt.Errorf("sticky note needs a positive width and height")
+		}
+		// A sticky note may be blank, but its text still needs a valid style
+		if e.Text != nil {
+			if err := validateTextStyle(e.Text); err != nil {
+				return err
+			}
+		}
+	case db.ElementFrame:
+		if e.Width <= 0 || e.Height <= 0 {
+			return fmt.Errorf("frame needs a positive width and height")
+		}
+		if e.Rotation != 0 {
+			return fmt.Errorf("frames can't be rotated")
+		}
+		if e.Text != nil {
+			if err := validateTextStyle(e.Text); err != nil {
+				return err
+			}
+		}
+	case db.ElementImage:
+		if e.Image == nil || e.Image.BlobHash == "" {
+			return fmt.Errorf("image needs an uploaded blob")
+		}
+		if e.Width <= 0 || e.Height <= 0 {
+			return fmt.Errorf("image needs a positive width and height")
+		}
+	default:
+		return fmt.Errorf("unknown element type %q", e.Type)
+	}
+
+	for _, head := range []string{e.StartArrowhead, e.EndArrowhead} {
+		switch head {
+		case "", db.ArrowheadNone, db.ArrowheadTriangle, db.ArrowheadOpen:
+		default:
+			return fmt.Errorf("unknown arrowhead %q", head)
+		}
+	}
+	if e.Style.StrokeWidth < 0 {
+		return fmt.Errorf("stroke width can't be negative")
+	}
+	return nil
+}
+
+func validateText(t *db.TextProps) error {
+	if t == nil || strings.TrimSpace(t.Content) == "" {
+		return fmt.Errorf("text needs some content")
+	}
+	return validateTextStyle(t)
+}
+
+func validateTextStyle(t *db.TextProps) error {
+	if t.FontSize <= 0 {
+		return fmt.Errorf("font size must be positive")
+	}
+	if t.WrapWidth < 0 {
+		return fmt.Errorf("wrap width can't be negative")
+	}
+	switch t.Align {
+	case db.AlignLeft, db.AlignCenter, db.AlignRight:
+	default:
+		return fmt.Errorf("unknown text alignment %q", t.Align)
+	}
+	return nil
+}
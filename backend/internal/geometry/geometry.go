@@ -0,0 +1,191 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+	"sketchive/internal/db"
+)
+
+// MaxCoordinate is the largest magnitude accepted for any coordinate or size, whatever the
+// board's canvas settings. It keeps bounding boxes, transforms and exports well within
+// float64 precision.
+const MaxCoordinate = 1e9
+
+// CheckCoordinate fails when v is NaN, infinite or beyond MaxCoordinate. what names the
+// value in the error, like "x of point 3".
+func CheckCoordinate(what string, v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("%s must be a finite number", what)
+	}
+	if math.Abs(v) > MaxCoordinate {
+		return fmt.Errorf("%s is out of range, coordinates must be within ±%g", what, float64(MaxCoordinate))
+	}
+	return nil
+}
+
+// Rect is an axis aligned box, using the same minX/maxX/minY/maxY layout as the strokes table
+type Rect struct {
+	MinX float64 `json:"minX"`
+	MaxX float64 `json:"maxX"`
+	MinY float64 `json:"minY"`
+	MaxY float64 `json:"maxY"`
+}
+
+// Intersects reports whether the two boxes overlap (touching edges count)
+func (r Rect) Intersects(o Rect) bool {
+	return r.MinX <= o.MaxX && r.MaxX >= o.MinX && r.MinY <= o.MaxY && r.MaxY >= o.MinY
+}
+
+// Contains reports whether o lies completely inside r
+func (r Rect) Contains(o Rect) bool {
+	return o.MinX >= r.MinX && o.MaxX <= r.MaxX && o.MinY >= r.MinY && o.MaxY <= r.MaxY
+}
+
+// ContainsPoint reports whether p lies inside r or on its edge
+func (r Rect) ContainsPoint(p db.Point) bool {
+	return p.X >= r.MinX && p.X <= r.MaxX && p.Y >= r.MinY && p.Y <= r.MaxY
+}
+
+// Union returns the smallest box containing both r and o
+func (r Rect) Union(o Rect) Rect {
+	return Rect{
+		MinX: math.Min(r.MinX, o.MinX),
+		MaxX: math.Max(r.MaxX, o.MaxX),
+		MinY: math.Min(r.MinY, o.MinY),
+		MaxY: math.Max(r.MaxY, o.MaxY),
+	}
+}
+
+// Expand grows the box by d on every side
+func (r Rect) Expand(d float64) Rect {
+	return Rect{MinX: r.MinX - d, MaxX: r.MaxX + d, MinY: r.MinY - d, MaxY: r.MaxY + d}
+}
+
+// Center returns the middle of the box
+func (r Rect) Center() db.Point {
+	return db.Point{X: (r.MinX + r.MaxX) / 2, Y: (r.MinY + r.MaxY) / 2}
+}
+
+// Corners returns the four corners of the box in clockwise order, starting top-left
+func (r Rect) Corners() []db.Point {
+	return []db.Point{
+		{X: r.MinX, Y: r.MinY},
+		{X: r.MaxX, Y: r.MinY},
+		{X: r.MaxX, Y: r.MaxY},
+		{X: r.MinX, Y: r.MaxY},
+	}
+}
+
+// PointsBounds returns the bounding box of a list of points
+func PointsBounds(points []db.Point) (Rect, error) {
+	if len(points) == 0 {
+		return Rect{}, fmt.Errorf("points slice is empty, cannot calculate bounding box")
+	}
+	r := Rect{MinX: points[0].X, MaxX: points[0].X, MinY: points[0].Y, MaxY: points[0].Y}
+	for _, p := range points[1:] {
+		r.MinX = math.Min(r.MinX, p.X)
+		r.MaxX = math.Max(r.MaxX, p.X)
+		r.MinY = math.Min(r.MinY, p.Y)
+		r.MaxY = math.Max(r.MaxY, p.Y)
+	}
+	return r, nil
+}
+
+// RotatePoint rotates p around c by the given angle in degrees (clockwise on screen, where y grows downwards)
+func RotatePoint(p, c db.Point, degrees float64) db.Point {
+	if degrees == 0 {
+		return p
+	}
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	dx, dy := p.X-c.X, p.Y-c.Y
+	return db.Point{X: c.X + dx*cos - dy*sin, Y: c.Y + dx*sin + dy*cos}
+}
+
+// DistanceToSegment returns the distance from p to the segment a-b
+func DistanceToSegment(p, a, b db.Point) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	lengthSq := dx*dx + dy*dy
+	if lengthSq == 0 {
+		return math.Hypot(p.X-a.X, p.Y-a.Y)
+	}
+	t := ((p.X-a.X)*dx + (p.Y-a.Y)*dy) / lengthSq
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p.X-(a.X+t*dx), p.Y-(a.Y+t*dy))
+}
+
+// orientation returns >0 when a, b, c turn counter clockwise, <0 for clockwise and 0 when collinear
+func orientation(a, b, c db.Point) float64 {
+	return (b.X-a.X)*(c.Y-a.Y) - (b.Y-a.Y)*(c.X-a.X)
+}
+
+func onSegment(a, b, p db.Point) bool {
+	return math.Min(a.X, b.X) <= p.X && p.X <= math.Max(a.X, b.X) &&
+		math.Min(a.Y, b.Y) <= p.Y && p.Y <= math.Max(a.Y, b.Y)
+}
+
+// SegmentsIntersect reports whether segment a-b touches or crosses segment c-d
+func SegmentsIntersect(a, b, c, d db.Point) bool {
+	o1 := orientation(a, b, c)
+	o2 := orientation(a, b, d)
+	o3 := orientation(c, d, a)
+	o4 := orientation(c, d, b)
+
+	if ((o1 > 0 && o2 < 0) || (o1 < 0 && o2 > 0)) && ((o3 > 0 && o4 < 0) || (o3 < 0 && o4 > 0)) {
+		return true
+	}
+	switch {
+	case o1 == 0 && onSegment(a, b, c):
+		return true
+	case o2 == 0 && onSegment(a, b, d):
+		return true
+	case o3 == 0 && onSegment(c, d, a):
+		return true
+	case o4 == 0 && onSegment(c, d, b):
+		return true
+	}
+	return false
+}
+
+// SegmentIntersectsRect reports whether any part of segment a-b lies inside r
+func SegmentIntersectsRect(a, b db.Point, r Rect) bool {
+	if r.ContainsPoint(a) || r.ContainsPoint(b) {
+		return true
+	}
+	corners := r.Corners()
+	for i := range corners {
+		if SegmentsIntersect(a, b, corners[i], corners[(i+1)%len(corners)]) {
+			return true
+		}
+	}
+	return false
+}
+
+// PointInPolygon reports whether p lies inside the closed polygon using the even-odd rule
+func PointInPolygon(p db.Point, polygon []db.Point) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Y > p.Y) != (b.Y > p.Y) && p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// PolylineNearRect reports whether a polyline drawn with the given width touches r.
+// When closed is true the last point is joined back to the first one.
+func PolylineNearRect(points []db.Point, closed bool, width float64, r Rect) bool {
+	expanded := r.Expand(width / 2)
+	if len(points) == 1 {
+		return expanded.ContainsPoint(points[0])
+	}
+	for i := 0; i+1 < len(points); i++ {
+		if SegmentIntersectsRect(points[i], points[i+1], expanded) {
+			return true
+		}
+	}
+	if closed && len(points) > 2 {
+		return SegmentIntersectsRect(points[len(points)-1], points[0], expanded)
+	}
+	return false
+}
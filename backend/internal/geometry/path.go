@@ -0,0 +1,46 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+	"sketchive/internal/db"
+)
+
+// ValidatePath checks that a stroke's points are finite coordinates within range, and the
+// optional pen data they carry: pressure within 0..1, tilt within -90..90 degrees and
+// timestamps that never go back
+func ValidatePath(points []db.Point) error {
+	if len(points) == 0 {
+		return fmt.Errorf("a stroke needs at least one point")
+	}
+	if err := checkPoints(points); err != nil {
+		return err
+	}
+	previous := 0
+	for i, p := range points {
+		if math.IsNaN(p.Pressure) || p.Pressure < 0 || p.Pressure > 1 {
+			return fmt.Errorf("point %d: pressure must be between 0 and 1", i)
+		}
+		if math.IsNaN(p.TiltX) || math.IsNaN(p.TiltY) || math.Abs(p.TiltX) > 90 || math.Abs(p.TiltY) > 90 {
+			return fmt.Errorf("point %d: tilt must be between -90 and 90 degrees", i)
+		}
+		if p.T < previous {
+			return fmt.Errorf("point %d: timestamps must not decrease", i)
+		}
+		previous = p.T
+	}
+	return nil
+}
+
+// checkPoints runs CheckCoordinate on both coordinates of every point
+func checkPoints(points []db.Point) error {
+	for i, p := range points {
+		if err := CheckCoordinate(fmt.Sprintf("x of point %d", i), p.X); err != nil {
+			return err
+		}
+		if err := CheckCoordinate(fmt.Sprintf("y of point %d", i), p.Y); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package geometry
+
+import (
+	"fmt"
+	"sketchive/internal/db"
+)
+
+// Selection modes
+const (
+	// SelectContain selects items lying completely inside the selection area
+	SelectContain = "contain"
+	// SelectIntersect selects items touching the selection area
+	SelectIntersect = "intersect"
+)
+
+// Selection is a closed area (a rectangle or a lasso) used to pick board items
+type Selection struct {
+	polygon []db.Point
+	bounds  Rect
+}
+
+// RectSelection selects with an axis aligned rectangle
+func RectSelection(r Rect) (Selection, error) {
+	if r.MinX > r.MaxX || r.MinY > r.MaxY {
+		return Selection{}, fmt.Errorf("selection rectangle has min greater than max")
+	}
+	return Selection{polygon: r.Corners(), bounds: r}, nil
+}
+
+// LassoSelection selects with a closed polygon; the last point joins back to the first
+func LassoSelection(points []db.Point) (Selection, error) {
+	if len(points) < 3 {
+		return Selection{}, fmt.Errorf("lasso needs at least 3 points")
+	}
+	bounds, _ := PointsBounds(points)
+	return Selection{polygon: points, bounds: bounds}, nil
+}
+
+// Bounds returns the box around the selection, used to prefilter candidates by their stored bounding boxes
+func (s Selection) Bounds() Rect {
+	return s.bounds
+}
+
+// crossesBoundary reports whether segment a-b touches any edge of the selection
+func (s Selection) crossesBoundary(a, b db.Point) bool {
+	n := len(s.polygon)
+	for i := range s.polygon {
+		if SegmentsIntersect(a, b, s.polygon[i], s.polygon[(i+1)%n]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Selection) containsPoint(p db.Point) bool {
+	return s.bounds.ContainsPoint(p) && PointInPolygon(p, s.polygon)
+}
+
+// segments calls fn for every segment of a polyline, including the closing one when closed is true
+func segments(points []db.Point, closed bool, fn func(a, b db.Point) bool) bool {
+	for i := 0; i+1 < len(points); i++ {
+		if fn(points[i], points[i+1]) {
+			return true
+		}
+	}
+	if closed && len(points) > 2 {
+		return fn(points[len(points)-1], points[0])
+	}
+	return false
+}
+
+// ContainsPolyline reports whether the whole polyline lies inside the selection.
+// Every point must be inside and no segment may leave the area, which matters for concave lassos.
+func (s Selection) ContainsPolyline(points []db.Point, closed bool) bool {
+	if len(points) == 0 {
+		return false
+	}
+	for _, p := range points {
+		if !s.containsPoint(p) {
+			return false
+		}
+	}
+	return !segments(points, closed, s.crossesBoundary)
+}
+
+// IntersectsPolyline reports whether the polyline touches the selection. When solid is true
+// the polyline is a filled closed shape, which is also hit when the selection lies inside it.
+func (s Selection) IntersectsPolyline(points []db.Point, closed, solid bool) bool {
+	for _, p := range points {
+		if s.containsPoint(p) {
+			return true
+		}
+	}
+	if segments(points, closed, s.crossesBoundary) {
+		return true
+	}
+	return solid && closed && len(points) > 2 && PointInPolygon(s.polygon[0], points)
+}
+
+// MatchesStroke reports whether a freehand stroke is selected in the given mode
+func (s Selection) MatchesStroke(stroke *db.Stroke, mode string) bool {
+	if mode == SelectContain {
+		return s.ContainsPolyline(stroke.Path, false)
+	}
+	return s.IntersectsPolyline(stroke.Path, false, false)
+}
+
+// MatchesElement reports whether an element, arrowheads included, is selected in the given mode
+func (s Selection) MatchesElement(e *db.Element, mode string) bool {
+	outline, closed := ElementOutline(e)
+	heads := ElementArrowheads(e)
+	if mode == SelectContain {
+		if !s.ContainsPolyline(outline, closed) {
+			return false
+		}
+		for _, head := range heads {
+			if !s.ContainsPolyline(head, false) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if s.IntersectsPolyline(outline, closed, isSolid(e)) {
+		return true
+	}
+	for _, head := range heads {
+		if s.IntersectsPolyline(head, false, false) {
+			return true
+		}
+	}
+	return false
+}
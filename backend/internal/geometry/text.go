@@ -0,0 +1,172 @@
+package geometry
+
+import (
+	"strings"
+	"unicode"
+)
+
+// LineHeight is the line spacing of text elements, relative to the font size
+const LineHeight = 1.2
+
+// Advance widths of printable ASCII (32..126) in 1/1000 em, taken from the AFM files of the
+// standard PostScript fonts. They are close enough to Arial, Times New Roman and Courier
+// New for bounding boxes, and let the server measure text without a browser.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var timesWidths = [95]int{
+	250, 333, 408, 500, 500, 833, 778, 180, 333, 333, 500, 564, 250, 333, 250, 278,
+	500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 278, 278, 564, 564, 564, 444,
+	921, 722, 667, 667, 722, 611, 556, 722, 722, 333, 389, 722, 611, 889, 722, 722,
+	556, 722, 667, 556, 611, 722, 722, 944, 722, 722, 611, 333, 278, 333, 469, 500,
+	333, 444, 500, 444, 500, 444, 333, 500, 500, 278, 278, 500, 278, 778, 500, 500,
+	500, 500, 333, 389, 278, 500, 500, 722, 500, 500, 444, 480, 200, 480, 541,
+}
+
+// Font identifies one of the metric sets used for text measurement
+type Font int
+
+const (
+	FontSans Font = iota
+	FontSerif
+	FontMono
+)
+
+// FontForFamily maps a CSS font family list onto the closest metric set
+func FontForFamily(family string) Font {
+	f := strings.ToLower(family)
+	switch {
+	case strings.Contains(f, "mono"), strings.Contains(f, "courier"), strings.Contains(f, "code"):
+		return FontMono
+	case strings.Contains(f, "sans"):
+		return FontSans
+	case strings.Contains(f, "serif"), strings.Contains(f, "times"), strings.Contains(f, "georgia"):
+		return FontSerif
+	default:
+		return FontSans
+	}
+}
+
+// runeWidth returns the advance width of r in 1/1000 em
+func (f Font) runeWidth(r rune) int {
+	if f == FontMono {
+		if isWide(r) {
+			return 1200
+		}
+		return 600
+	}
+	if r >= 32 && r <= 126 {
+		if f == FontSerif {
+			return timesWidths[r-32]
+		}
+		return helveticaWidths[r-32]
+	}
+	switch {
+	case r == '\t':
+		return 4 * f.runeWidth(' ')
+	case isWide(r):
+		return 1000
+	case unicode.Is(unicode.Mn, r):
+		return 0 // combining marks sit on the previous character
+	case f == FontSerif:
+		return 500
+	default:
+		return 556
+	}
+}
+
+// isWide reports whether r is a full width (CJK, emoji) character
+func isWide(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r) || (r >= 0x1F300 && r <= 0x1FAFF) || (r >= 0xFF00 && r <= 0xFF60)
+}
+
+// TextWidth returns the width of a single line of text at the given font size
+func TextWidth(s string, font Font, size float64) float64 {
+	total := 0
+	for _, r := range s {
+		total += font.runeWidth(r)
+	}
+	return float64(total) * size / 1000
+}
+
+// TextLayout is the result of laying out a block of text
+type TextLayout struct {
+	Lines  []string
+	Width  float64 // width of the widest line
+	Height float64
+}
+
+// LayoutText splits text into lines, honoring explicit line breaks and wrapping words
+// at wrapWidth when it is greater than zero. Words longer than wrapWidth are broken.
+func LayoutText(text string, font Font, size, wrapWidth float64) TextLayout {
+	var layout TextLayout
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if wrapWidth <= 0 {
+			layout.Lines = append(layout.Lines, paragraph)
+			continue
+		}
+		layout.Lines = append(layout.Lines, wrapParagraph(paragraph, font, size, wrapWidth)...)
+	}
+
+	for _, line := range layout.Lines {
+		if width := TextWidth(line, font, size); width > layout.Width {
+			layout.Width = width
+		}
+	}
+	layout.Height = float64(len(layout.Lines)) * size * LineHeight
+	return layout
+}
+
+func wrapParagraph(paragraph string, font Font, size, wrapWidth float64) []string {
+	words := strings.Fields(paragraph)
+	if len(words) == 0 {
+		return []string{""}
+	}
+
+	var lines []string
+	line := ""
+	for _, word := range words {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if TextWidth(candidate, font, size) <= wrapWidth {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+			line = ""
+		}
+		// The word alone is too wide, break it between characters
+		for TextWidth(word, font, size) > wrapWidth {
+			cut := breakWord(word, font, size, wrapWidth)
+			lines = append(lines, word[:cut])
+			word = word[cut:]
+		}
+		line = word
+	}
+	return append(lines, line)
+}
+
+// breakWord returns the byte offset of the longest prefix of word that fits in wrapWidth (at least one rune)
+func breakWord(word string, font Font, size, wrapWidth float64) int {
+	width := 0.0
+	for i, r := range word {
+		width += float64(font.runeWidth(r)) * size / 1000
+		if width > wrapWidth {
+			if i == 0 {
+				return len(string(r))
+			}
+			return i
+		}
+	}
+	return len(word)
+}
@@ -0,0 +1,548 @@
+package render
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"sketchive/internal/style"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pdfFonts are the standard PDF fonts text is set in. Their widths are the metric sets of
+// geometry.Font, so text lays out in a PDF as it does on the server.
+var pdfFonts = []string{"Helvetica", "Helvetica-Bold", "Times-Roman", "Courier"}
+
+// pdfAscent is the distance from the top of a line of text to its baseline, relative to the font size
+const pdfAscent = 0.8
+
+func fontResource(font geometry.Font, bold bool) string {
+	switch {
+	case font == geometry.FontSerif:
+		return "F3"
+	case font == geometry.FontMono:
+		return "F4"
+	case bold:
+		return "F2"
+	}
+	return "F1"
+}
+
+// pdfState is a graphics state for transparency and blending, shared by the pages
+type pdfState struct {
+	strokeAlpha, fillAlpha float64
+	multiply               bool
+}
+
+// pdfImage is the picture of an image element, embedded once however often it is drawn
+type pdfImage struct {
+	width, height int
+	rgb, alpha    []byte // alpha is nil when the picture is opaque
+}
+
+// PDF writes board content as a PDF document, drawing strokes and shapes as vector paths.
+// Text uses the standard Helvetica, Times and Courier fonts. Streams are compressed and
+// objects always come in the same order, so the same content gives the same bytes.
+type PDF struct {
+	// LoadImage returns the picture of an image element. Images it can't provide, or all of
+	// them when it is nil, are drawn as gray placeholders.
+	LoadImage func(image *db.ImageProps) (image.Image, error)
+
+	title      string
+	created    time.Time
+	pages      []*PDFPage
+	states     []pdfState
+	images     []pdfImage
+	imageIndex map[string]int // blob hash to index in images, -1 when it can't be loaded
+}
+
+// NewPDF starts a document with the given title and creation time
+func NewPDF(title string, created time.Time) *PDF {
+	return &PDF{title: title, created: created, imageIndex: map[string]int{}}
+}
+
+// PDFPage is a page of a PDF, measured in points from its top left corner
+type PDFPage struct {
+	doc           *PDF
+	width, height float64
+	buf           bytes.Buffer
+}
+
+// AddPage adds a page of width by height points
+func (p *PDF) AddPage(width, height float64) *PDFPage {
+	page := &PDFPage{doc: p, width: width, height: height}
+	// Flip the y axis so that page and board coordinates both grow downwards
+	fmt.Fprintf(&page.buf, "1 0 0 -1 0 %s cm\n", pdfNum(height))
+	p.pages = append(p.pages, page)
+	return page
+}
+
+// Text writes a line of text with its baseline starting at x, y
+func (pg *PDFPage) Text(x, y, size float64, font geometry.Font, bold bool, c style.Color, text string) {
+	pg.setColors(nil, &c, 1, false)
+	// The text matrix flips the y axis back, or the glyphs would be upside down
+	fmt.Fprintf(&pg.buf, "BT /%s %s Tf 1 0 0 -1 %s %s Tm %s Tj ET\n",
+		fontResource(font, bold), pdfNum(size), pdfNum(x), pdfNum(y), pdfString(text))
+}
+
+// BeginBoard starts drawing the board area view with its top left corner at x, y on the page,
+// scale points per board unit. The drawing is clipped to the area and, when background is
+// set, drawn over that color. EndBoard ends it.
+func (pg *PDFPage) BeginBoard(view geometry.Rect, x, y, scale float64, background *style.Color) {
+	w, h := (view.MaxX-view.MinX)*scale, (view.MaxY-view.MinY)*scale
+	fmt.Fprintf(&pg.buf, "q\n%s %s %s %s re W n\n", pdfNum(x), pdfNum(y), pdfNum(w), pdfNum(h))
+	if background != nil {
+		pg.buf.WriteString("q\n")
+		pg.setColors(nil, background, 1, false)
+		fmt.Fprintf(&pg.buf, "%s %s %s %s re f\nQ\n", pdfNum(x), pdfNum(y), pdfNum(w), pdfNum(h))
+	}
+	fmt.Fprintf(&pg.buf, "%s 0 0 %s %s %s cm\n", pdfNum(scale), pdfNum(scale),
+		pdfNum(x-view.MinX*scale), pdfNum(y-view.MinY*scale))
+	// The SVG default, which the browser draws with
+	pg.buf.WriteString("4 M\n")
+}
+
+// EndBoard ends the drawing started by BeginBoard
+func (pg *PDFPage) EndBoard() {
+	pg.buf.WriteString("Q\n")
+}
+
+// Stroke draws a freehand stroke like SVG.Stroke does: strokes with pressure or timing as
+// filled outlines, the others as paths of the stroke's width with its caps, joins and dashes
+func (pg *PDFPage) Stroke(stroke *db.Stroke) {
+	if len(stroke.Path) == 0 {
+		return
+	}
+	opacity := stroke.Opacity
+	if opacity == 0 {
+		opacity = 1
+	}
+	multiply := stroke.Blend == db.BlendHighlighter
+	c, ok := parseColor(stroke.Color)
+	if !ok {
+		c = style.Black
+	}
+
+	pg.buf.WriteString("q\n")
+	defer pg.buf.WriteString("Q\n")
+	if HasVariableWidth(stroke.Path) && stroke.Fill == "" {
+		pg.setColors(nil, &c, opacity, multiply)
+		pg.path(StrokeOutline(stroke.Path, StrokeWidths(stroke.Path, stroke.Width)), true)
+		pg.buf.WriteString("f\n")
+		return
+	}
+
+	fill, hasFill := parseColor(stroke.Fill)
+	if hasFill {
+		pg.setColors(&c, &fill, opacity, multiply)
+	} else {
+		pg.setColors(&c, nil, opacity, multiply)
+	}
+	fmt.Fprintf(&pg.buf, "%s w %d J %d j\n", pdfNum(stroke.Width),
+		lineCapCode(orDefault(stroke.LineCap, db.CapRound)), lineJoinCode(orDefault(stroke.LineJoin, db.JoinRound)))
+	pg.dash(stroke.Dash)
+	pg.path(stroke.Path, false)
+	if hasFill {
+		pg.buf.WriteString("B\n")
+	} else {
+		pg.buf.WriteString("S\n")
+	}
+}
+
+// Element draws a shape, line, text, sticky note, frame, image or connector like SVG.Element does
+func (pg *PDFPage) Element(e *db.Element) {
+	strokeColor, hasStroke := parseColor(e.Style.StrokeColor)
+	hasStroke = hasStroke && e.Style.StrokeWidth > 0
+	fillColor, hasFill := parseColor(e.Style.FillColor)
+	var strokePaint, fillPaint *style.Color
+	if hasStroke {
+		strokePaint = &strokeColor
+	}
+	if hasFill {
+		fillPaint = &fillColor
+	}
+	// paint fills and outlines the current path with the element's colors
+	paint := func(closed bool) {
+		switch {
+		case hasFill && hasStroke:
+			pg.buf.WriteString("B\n")
+		case hasFill:
+			pg.buf.WriteString("f\n")
+		case hasStroke && closed:
+			pg.buf.WriteString("s\n")
+		case hasStroke:
+			pg.buf.WriteString("S\n")
+		default:
+			pg.buf.WriteString("n\n")
+		}
+	}
+
+	pg.buf.WriteString("q\n")
+	defer pg.buf.WriteString("Q\n")
+	if e.Rotation != 0 {
+		sin, cos := math.Sincos(e.Rotation * math.Pi / 180)
+		cx, cy := e.X+e.Width/2, e.Y+e.Height/2
+		fmt.Fprintf(&pg.buf, "%s %s %s %s %s %s cm\n", pdfNum(cos), pdfNum(sin), pdfNum(-sin), pdfNum(cos),
+			pdfNum(cx-cx*cos+cy*sin), pdfNum(cy-cx*sin-cy*cos))
+	}
+	pg.setColors(strokePaint, fillPaint, 1, false)
+	fmt.Fprintf(&pg.buf, "%s w\n", pdfNum(e.Style.StrokeWidth))
+
+	switch e.Type {
+	case db.ElementRectangle, db.ElementSticky, db.ElementFrame:
+		fmt.Fprintf(&pg.buf, "0 j %s %s %s %s re\n", pdfNum(e.X), pdfNum(e.Y), pdfNum(e.Width), pdfNum(e.Height))
+		paint(true)
+		if e.Type == db.ElementSticky {
+			pg.text(e, geometry.StickyPadding)
+		}
+	case db.ElementEllipse:
+		pg.ellipse(e.X+e.Width/2, e.Y+e.Height/2, e.Width/2, e.Height/2)
+		paint(true)
+	case db.ElementPolygon:
+		pg.buf.WriteString("1 j\n")
+		pg.path(e.Points, true)
+		paint(true)
+	case db.ElementLine, db.ElementArrow, db.ElementConnector:
+		if !hasStroke {
+			return
+		}
+		pg.buf.WriteString("1 J 1 j\n")
+		pg.path(e.Points, false)
+		pg.buf.WriteString("S\n")
+		heads := ElementArrowheadStyles(e)
+		for i, head := range geometry.ElementArrowheads(e) {
+			if heads[i] == db.ArrowheadTriangle {
+				pg.setColors(nil, &strokeColor, 1, false)
+				pg.path(head, true)
+				pg.buf.WriteString("b\n")
+				continue
+			}
+			pg.path(head, false)
+			pg.buf.WriteString("S\n")
+		}
+	case db.ElementText:
+		pg.text(e, 0)
+	case db.ElementImage:
+		if e.Image != nil {
+			pg.image(e)
+		}
+	}
+}
+
+// text writes the laid out text of a text element or sticky note, inset by padding
+func (pg *PDFPage) text(e *db.Element, padding float64) {
+	t := e.Text
+	if t == nil || t.Content == "" {
+		return
+	}
+	c, ok := parseColor(t.Color)
+	if !ok {
+		c = style.Black
+	}
+	font := geometry.FontForFamily(t.FontFamily)
+	for i, line := range TextLines(e) {
+		x := e.X + padding
+		switch t.Align {
+		case db.AlignCenter:
+			x = e.X + e.Width/2 - geometry.TextWidth(line, font, t.FontSize)/2
+		case db.AlignRight:
+			x = e.X + e.Width - padding - geometry.TextWidth(line, font, t.FontSize)
+		}
+		baseline := e.Y + padding + float64(i)*t.FontSize*geometry.LineHeight + t.FontSize*pdfAscent
+		pg.Text(x, baseline, t.FontSize, font, false, c, line)
+	}
+}
+
+// image draws the picture of an image element stretched over its box
+func (pg *PDFPage) image(e *db.Element) {
+	name, ok := pg.doc.image(e.Image)
+	if !ok {
+		pg.setColors(nil, &placeholderColor, 1, false)
+		fmt.Fprintf(&pg.buf, "%s %s %s %s re f\n", pdfNum(e.X), pdfNum(e.Y), pdfNum(e.Width), pdfNum(e.Height))
+		return
+	}
+	// Images fill the unit square from the bottom up, so they are flipped into the box
+	fmt.Fprintf(&pg.buf, "%s 0 0 %s %s %s cm /%s Do\n", pdfNum(e.Width), pdfNum(-e.Height), pdfNum(e.X), pdfNum(e.Y+e.Height), name)
+}
+
+// path writes points as a path, closing it when closed is set
+func (pg *PDFPage) path(points []db.Point, closed bool) {
+	for i, p := range points {
+		op := "l"
+		if i == 0 {
+			op = "m"
+		}
+		fmt.Fprintf(&pg.buf, "%s %s %s\n", pdfNum(p.X), pdfNum(p.Y), op)
+	}
+	if len(points) == 1 {
+		// A lone point still shows as a dot with round caps
+		fmt.Fprintf(&pg.buf, "%s %s l\n", pdfNum(points[0].X), pdfNum(points[0].Y))
+	}
+	if closed {
+		pg.buf.WriteString("h\n")
+	}
+}
+
+// ellipse writes an axis aligned ellipse as four Bézier curves
+func (pg *PDFPage) ellipse(cx, cy, rx, ry float64) {
+	const k = 0.5522847498 // control point distance for a quarter circle
+	kx, ky := rx*k, ry*k
+	fmt.Fprintf(&pg.buf, "%s %s m\n", pdfNum(cx+rx), pdfNum(cy))
+	for _, c := range [][6]float64{
+		{cx + rx, cy + ky, cx + kx, cy + ry, cx, cy + ry},
+		{cx - kx, cy + ry, cx - rx, cy + ky, cx - rx, cy},
+		{cx - rx, cy - ky, cx - kx, cy - ry, cx, cy - ry},
+		{cx + kx, cy - ry, cx + rx, cy - ky, cx + rx, cy},
+	} {
+		fmt.Fprintf(&pg.buf, "%s %s %s %s %s %s c\n", pdfNum(c[0]), pdfNum(c[1]), pdfNum(c[2]), pdfNum(c[3]), pdfNum(c[4]), pdfNum(c[5]))
+	}
+	pg.buf.WriteString("h\n")
+}
+
+// dash sets the dash pattern; a pattern without any length leaves lines solid
+func (pg *PDFPage) dash(dash []float64) {
+	total := 0.0
+	for _, d := range dash {
+		total += d
+	}
+	if total <= 0 {
+		return
+	}
+	parts := make([]string, len(dash))
+	for i, d := range dash {
+		parts[i] = pdfNum(d)
+	}
+	fmt.Fprintf(&pg.buf, "[%s] 0 d\n", strings.Join(parts, " "))
+}
+
+// setColors sets the stroke and fill colors that aren't nil, along with the transparency of
+// both and whether they multiply what is underneath
+func (pg *PDFPage) setColors(stroke, fill *style.Color, opacity float64, multiply bool) {
+	state := pdfState{strokeAlpha: opacity, fillAlpha: opacity, multiply: multiply}
+	if stroke != nil {
+		fmt.Fprintf(&pg.buf, "%s RG\n", pdfRGB(*stroke))
+		state.strokeAlpha *= stroke.Alpha()
+	}
+	if fill != nil {
+		fmt.Fprintf(&pg.buf, "%s rg\n", pdfRGB(*fill))
+		state.fillAlpha *= fill.Alpha()
+	}
+	if state != (pdfState{strokeAlpha: 1, fillAlpha: 1}) {
+		fmt.Fprintf(&pg.buf, "/GS%d gs\n", pg.doc.state(state))
+	}
+}
+
+// state returns the index of a graphics state, adding it on first use
+func (p *PDF) state(s pdfState) int {
+	s.strokeAlpha = math.Round(s.strokeAlpha*1000) / 1000
+	s.fillAlpha = math.Round(s.fillAlpha*1000) / 1000
+	for i, existing := range p.states {
+		if existing == s {
+			return i
+		}
+	}
+	p.states = append(p.states, s)
+	return len(p.states) - 1
+}
+
+// image returns the resource name of the picture of an image element, loading it on first
+// use, and false when it can't be loaded
+func (p *PDF) image(props *db.ImageProps) (string, bool) {
+	index, seen := p.imageIndex[props.BlobHash]
+	if !seen {
+		index = -1
+		if p.LoadImage != nil {
+			if img, err := p.LoadImage(props); err == nil && img != nil {
+				p.images = append(p.images, rgbImage(img))
+				index = len(p.images) - 1
+			}
+		}
+		p.imageIndex[props.BlobHash] = index
+	}
+	if index < 0 {
+		return "", false
+	}
+	return "Im" + strconv.Itoa(index), true
+}
+
+// rgbImage splits a picture into straight RGB samples and, unless it is opaque, alpha samples
+func rgbImage(img image.Image) pdfImage {
+	b := img.Bounds()
+	out := pdfImage{width: b.Dx(), height: b.Dy(), rgb: make([]byte, 0, 3*b.Dx()*b.Dy())}
+	alpha := make([]byte, 0, b.Dx()*b.Dy())
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			out.rgb = append(out.rgb, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			opaque = opaque && c.A == 255
+		}
+	}
+	if !opaque {
+		out.alpha = alpha
+	}
+	return out
+}
+
+// Bytes assembles the document and returns it
+func (p *PDF) Bytes() []byte {
+	var objects [][]byte
+	add := func(body []byte) int {
+		objects = append(objects, body)
+		return len(objects)
+	}
+	// The catalog, page tree, shared resources and document information come first
+	const catalog, pageTree, resources, info = 1, 2, 3, 4
+	for range 4 {
+		add(nil)
+	}
+
+	var fonts strings.Builder
+	for i, name := range pdfFonts {
+		id := add([]byte(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name)))
+		fmt.Fprintf(&fonts, " /F%d %d 0 R", i+1, id)
+	}
+	var states strings.Builder
+	for i, s := range p.states {
+		fmt.Fprintf(&states, " /GS%d << /Type /ExtGState /CA %s /ca %s", i, pdfNum(s.strokeAlpha), pdfNum(s.fillAlpha))
+		if s.multiply {
+			states.WriteString(" /BM /Multiply")
+		}
+		states.WriteString(" >>")
+	}
+	var images strings.Builder
+	for i, img := range p.images {
+		mask := ""
+		if img.alpha != nil {
+			id := add(pdfStream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8",
+				img.width, img.height), img.alpha))
+			mask = fmt.Sprintf(" /SMask %d 0 R", id)
+		}
+		id := add(pdfStream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8%s",
+			img.width, img.height, mask), img.rgb))
+		fmt.Fprintf(&images, " /Im%d %d 0 R", i, id)
+	}
+
+	var kids []string
+	for _, page := range p.pages {
+		content := add(pdfStream("", page.buf.Bytes()))
+		id := add([]byte(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources %d 0 R /Contents %d 0 R >>",
+			pageTree, pdfNum(page.width), pdfNum(page.height), resources, content)))
+		kids = append(kids, fmt.Sprintf("%d 0 R", id))
+	}
+
+	objects[catalog-1] = []byte(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pageTree))
+	objects[pageTree-1] = []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	objects[resources-1] = []byte(fmt.Sprintf("<< /ProcSet [/PDF /Text /ImageC /ImageB] /Font <<%s >> /ExtGState <<%s >> /XObject <<%s >> >>",
+		fonts.String(), states.String(), images.String()))
+	objects[info-1] = []byte(fmt.Sprintf("<< /Title %s /Producer (Sketchive) /CreationDate (D:%s) >>",
+		pdfString(p.title), p.created.UTC().Format("20060102150405Z")))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, body := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n", i+1)
+		out.Write(body)
+		out.WriteString("\nendobj\n")
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, catalog, info, xref)
+	return out.Bytes()
+}
+
+// pdfStream returns a compressed stream object with the given dictionary entries
+func pdfStream(entries string, data []byte) []byte {
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write(data)
+	w.Close()
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "<< %s /Length %d /Filter /FlateDecode >>\nstream\n", strings.TrimSpace(entries), compressed.Len())
+	out.Write(compressed.Bytes())
+	out.WriteString("\nendstream")
+	return out.Bytes()
+}
+
+// winAnsi maps the characters outside Latin-1 that the standard fonts' encoding has
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94,
+	'•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// pdfString returns text as a PDF string literal in the standard fonts' encoding, with
+// characters the fonts don't have replaced by question marks
+func pdfString(text string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range text {
+		var c byte
+		switch code, ok := winAnsi[r]; {
+		case ok:
+			c = code
+		case r == '\t':
+			c = ' '
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			c = byte(r)
+		default:
+			c = '?'
+		}
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c >= 0x80:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+func pdfRGB(c style.Color) string {
+	return pdfNum(float64(c.R)/255) + " " + pdfNum(float64(c.G)/255) + " " + pdfNum(float64(c.B)/255)
+}
+
+// pdfNum prints a number rounded to 1/10000, without trailing zeros. Scales and colors need
+// more precision than the coordinates printed by num.
+func pdfNum(v float64) string {
+	v = math.Round(v*10000) / 10000
+	if v == 0 {
+		v = 0 // no negative zero
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func lineCapCode(lineCap string) int {
+	switch lineCap {
+	case db.CapButt:
+		return 0
+	case db.CapSquare:
+		return 2
+	}
+	return 1
+}
+
+func lineJoinCode(lineJoin string) int {
+	switch lineJoin {
+	case db.JoinMiter:
+		return 0
+	case db.JoinBevel:
+		return 2
+	}
+	return 1
+}
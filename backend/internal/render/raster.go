@@ -0,0 +1,608 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"sketchive/internal/style"
+	"slices"
+	"strings"
+)
+
+const (
+	// subsamples is how many times each pixel row is sampled; edges along a row are exact
+	subsamples = 4
+	// svgMiterLimit is the SVG default limit on miter length relative to the half width
+	svgMiterLimit = 4
+	// textBarWeight is the thickness of the bars text is drawn as, relative to the font size
+	textBarWeight = 0.45
+	// minDashPixels is the shortest dash drawn, so zero length dashes still show their caps
+	minDashPixels = 0.5
+	// maxDashPieces caps the dashes of one line; finer patterns are drawn solid
+	maxDashPieces = 10000
+)
+
+// placeholderColor fills image elements whose picture can't be loaded
+var placeholderColor = style.Color{R: 0xe0, G: 0xe0, B: 0xe0, A: 255}
+
+// Raster draws board content onto an RGBA image without a browser. Shapes are filled with
+// the nonzero rule and anti-aliased by sampling every pixel row several times with exact
+// coverage along the row. The result only depends on the content, so the same board always
+// gives the same pixels.
+type Raster struct {
+	img   *image.RGBA
+	view  geometry.Rect
+	scale float64 // pixels per board unit
+	// LoadImage returns the picture of an image element. Images it can't provide, or all of
+	// them when it is nil, are drawn as gray placeholders.
+	LoadImage func(image *db.ImageProps) (image.Image, error)
+	scratch   []float32
+}
+
+// NewRaster starts a width by height pixel image of the board area view, scaled by the same
+// factor on both axes and aligned to the top left. A nil background leaves it transparent.
+func NewRaster(view geometry.Rect, width, height int, background *style.Color) *Raster {
+	r := &Raster{img: image.NewRGBA(image.Rect(0, 0, width, height)), view: view}
+	r.scale = math.Min(float64(width)/(view.MaxX-view.MinX), float64(height)/(view.MaxY-view.MinY))
+	if background != nil {
+		c := color.NRGBA{R: background.R, G: background.G, B: background.B, A: background.A}
+		draw.Draw(r.img, r.img.Bounds(), &image.Uniform{C: c}, image.Point{}, draw.Src)
+	}
+	return r
+}
+
+// Image returns what was drawn so far
+func (r *Raster) Image() *image.RGBA {
+	return r.img
+}
+
+// Stroke draws a freehand stroke like SVG.Stroke does: strokes with pressure or timing as
+// filled outlines, the others as lines of the stroke's width with its caps, joins and dashes
+func (r *Raster) Stroke(stroke *db.Stroke) {
+	if len(stroke.Path) == 0 {
+		return
+	}
+	opacity := stroke.Opacity
+	if opacity == 0 {
+		opacity = 1
+	}
+	multiply := stroke.Blend == db.BlendHighlighter
+
+	if fill, ok := parseColor(stroke.Fill); ok && len(stroke.Path) > 2 {
+		r.fill([][]db.Point{r.toPixels(stroke.Path)}, fill, opacity, multiply)
+	}
+	c, ok := parseColor(stroke.Color)
+	if !ok {
+		c = style.Black
+	}
+
+	var shapes [][]db.Point
+	if HasVariableWidth(stroke.Path) && stroke.Fill == "" {
+		shapes = [][]db.Point{r.toPixels(StrokeOutline(stroke.Path, StrokeWidths(stroke.Path, stroke.Width)))}
+	} else {
+		pieces := [][]db.Point{r.toPixels(stroke.Path)}
+		if len(stroke.Dash) > 0 {
+			dash := make([]float64, len(stroke.Dash))
+			for i, d := range stroke.Dash {
+				dash[i] = d * r.scale
+			}
+			pieces = dashPieces(pieces[0], dash)
+		}
+		for _, piece := range pieces {
+			shapes = append(shapes, lineShapes(piece, stroke.Width*r.scale,
+				orDefault(stroke.LineCap, db.CapRound), orDefault(stroke.LineJoin, db.JoinRound), false)...)
+		}
+	}
+	r.fill(shapes, c, opacity, multiply)
+}
+
+// Element draws a shape, line, text, sticky note, image or connector like SVG.Element does.
+// There are no fonts on the server, so each line of text is drawn as a bar of its measured width.
+func (r *Raster) Element(e *db.Element) {
+	strokeColor, hasStroke := parseColor(e.Style.StrokeColor)
+	hasStroke = hasStroke && e.Style.StrokeWidth > 0
+	fillColor, hasFill := parseColor(e.Style.FillColor)
+	center := db.Point{X: e.X + e.Width/2, Y: e.Y + e.Height/2}
+	rotated := func(points []db.Point) []db.Point {
+		out := make([]db.Point, len(points))
+		for i, p := range points {
+			out[i] = geometry.RotatePoint(p, center, e.Rotation)
+		}
+		return out
+	}
+	outline := func(points []db.Point, closed bool, join string) {
+		if hasStroke {
+			r.fill(lineShapes(r.toPixels(points), e.Style.StrokeWidth*r.scale, db.CapRound, join, closed), strokeColor, 1, false)
+		}
+	}
+	box := geometry.Rect{MinX: e.X, MinY: e.Y, MaxX: e.X + e.Width, MaxY: e.Y + e.Height}
+
+	switch e.Type {
+	case db.ElementRectangle, db.ElementSticky, db.ElementFrame:
+		corners := rotated(box.Corners())
+		if hasFill {
+			r.fill([][]db.Point{r.toPixels(corners)}, fillColor, 1, false)
+		}
+		outline(corners, true, db.JoinMiter)
+		if e.Type == db.ElementSticky {
+			r.text(e, geometry.StickyPadding)
+		}
+	case db.ElementEllipse:
+		points := rotated(r.ellipse(center, e.Width/2, e.Height/2))
+		if hasFill {
+			r.fill([][]db.Point{r.toPixels(points)}, fillColor, 1, false)
+		}
+		outline(points, true, db.JoinRound)
+	case db.ElementPolygon:
+		if hasFill && len(e.Points) > 2 {
+			r.fill([][]db.Point{r.toPixels(e.Points)}, fillColor, 1, false)
+		}
+		outline(e.Points, true, db.JoinRound)
+	case db.ElementLine, db.ElementArrow, db.ElementConnector:
+		outline(e.Points, false, db.JoinRound)
+		heads := ElementArrowheadStyles(e)
+		for i, head := range geometry.ElementArrowheads(e) {
+			if heads[i] == db.ArrowheadTriangle {
+				if hasStroke {
+					r.fill([][]db.Point{r.toPixels(head)}, strokeColor, 1, false)
+				}
+				outline(head, true, db.JoinRound)
+				continue
+			}
+			outline(head, false, db.JoinRound)
+		}
+	case db.ElementText:
+		r.text(e, 0)
+	case db.ElementImage:
+		if e.Image != nil {
+			r.image(e, rotated(box.Corners()))
+		}
+	}
+}
+
+// text draws the lines of a text element or sticky note, inset by padding, as bars
+func (r *Raster) text(e *db.Element, padding float64) {
+	t := e.Text
+	if t == nil || t.Content == "" {
+		return
+	}
+	c, ok := parseColor(t.Color)
+	if !ok {
+		c = style.Black
+	}
+	font := geometry.FontForFamily(t.FontFamily)
+	center := db.Point{X: e.X + e.Width/2, Y: e.Y + e.Height/2}
+
+	var shapes [][]db.Point
+	for i, line := range TextLines(e) {
+		width := geometry.TextWidth(strings.TrimRight(line, " "), font, t.FontSize)
+		if width == 0 {
+			continue
+		}
+		x := e.X + padding
+		switch t.Align {
+		case db.AlignCenter:
+			x = e.X + e.Width/2 - width/2
+		case db.AlignRight:
+			x = e.X + e.Width - padding - width
+		}
+		y := e.Y + padding + (float64(i)+0.6)*t.FontSize*geometry.LineHeight
+		bar := []db.Point{
+			geometry.RotatePoint(db.Point{X: x, Y: y}, center, e.Rotation),
+			geometry.RotatePoint(db.Point{X: x + width, Y: y}, center, e.Rotation),
+		}
+		shapes = append(shapes, lineShapes(r.toPixels(bar), t.FontSize*textBarWeight*r.scale, db.CapButt, db.JoinRound, false)...)
+	}
+	r.fill(shapes, c, 0.6, false)
+}
+
+// image draws the picture of an image element stretched over its rotated box corners
+func (r *Raster) image(e *db.Element, corners []db.Point) {
+	m := r.cover([][]db.Point{r.toPixels(corners)})
+	if m == nil {
+		return
+	}
+	var src image.Image
+	if r.LoadImage != nil {
+		src, _ = r.LoadImage(e.Image)
+	}
+	if src == nil || e.Width <= 0 || e.Height <= 0 {
+		r.paint(m, func(int, int) style.Color { return placeholderColor }, 1, false)
+		return
+	}
+
+	bounds := src.Bounds()
+	center := db.Point{X: e.X + e.Width/2, Y: e.Y + e.Height/2}
+	r.paint(m, func(x, y int) style.Color {
+		p := db.Point{X: r.view.MinX + (float64(x)+0.5)/r.scale, Y: r.view.MinY + (float64(y)+0.5)/r.scale}
+		p = geometry.RotatePoint(p, center, -e.Rotation)
+		u := (p.X - e.X) / e.Width * float64(bounds.Dx())
+		v := (p.Y - e.Y) / e.Height * float64(bounds.Dy())
+		return sampleBilinear(src, u, v)
+	}, 1, false)
+}
+
+// ellipse returns the outline of an axis aligned ellipse, with more vertices when it's larger on screen
+func (r *Raster) ellipse(center db.Point, rx, ry float64) []db.Point {
+	segments := int(math.Max(16, math.Min(128, math.Max(rx, ry)*r.scale*2)))
+	points := make([]db.Point, segments)
+	for i := range points {
+		a := 2 * math.Pi * float64(i) / float64(segments)
+		points[i] = db.Point{X: center.X + rx*math.Cos(a), Y: center.Y + ry*math.Sin(a)}
+	}
+	return points
+}
+
+func (r *Raster) toPixels(points []db.Point) []db.Point {
+	out := make([]db.Point, len(points))
+	for i, p := range points {
+		out[i] = db.Point{X: (p.X - r.view.MinX) * r.scale, Y: (p.Y - r.view.MinY) * r.scale}
+	}
+	return out
+}
+
+// fill paints the union of the pixel space polygons in one color. Overlapping polygons of the
+// same item are painted once, so translucent strokes don't darken where their pieces meet.
+func (r *Raster) fill(polygons [][]db.Point, c style.Color, opacity float64, multiply bool) {
+	if m := r.cover(polygons); m != nil {
+		r.paint(m, func(int, int) style.Color { return c }, opacity, multiply)
+	}
+}
+
+// coverage holds how much of each pixel in a box of the image a shape covers, from 0 to 1
+type coverage struct {
+	x0, y0, w, h int
+	cov          []float32
+}
+
+// cover returns the coverage of the union of the polygons, or nil when they miss the image
+func (r *Raster) cover(polygons [][]db.Point) *coverage {
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, poly := range polygons {
+		for _, p := range poly {
+			minX, maxX = math.Min(minX, p.X), math.Max(maxX, p.X)
+			minY, maxY = math.Min(minY, p.Y), math.Max(maxY, p.Y)
+		}
+	}
+	bounds := r.img.Bounds()
+	x0, y0 := max(int(math.Floor(minX)), 0), max(int(math.Floor(minY)), 0)
+	x1, y1 := min(int(math.Ceil(maxX)), bounds.Dx()), min(int(math.Ceil(maxY)), bounds.Dy())
+	if math.IsInf(minX, 0) || x0 >= x1 || y0 >= y1 {
+		return nil
+	}
+	m := &coverage{x0: x0, y0: y0, w: x1 - x0, h: y1 - y0}
+	m.cov = make([]float32, m.w*m.h)
+	for _, poly := range polygons {
+		r.addPolygon(m, poly)
+	}
+	return m
+}
+
+type crossing struct {
+	x   float64
+	dir int
+}
+
+// addPolygon rasterizes one polygon with the nonzero rule and merges it into the coverage,
+// keeping the larger value where they overlap
+func (r *Raster) addPolygon(m *coverage, poly []db.Point) {
+	if len(poly) < 3 {
+		return
+	}
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range poly {
+		minX, maxX = math.Min(minX, p.X), math.Max(maxX, p.X)
+		minY, maxY = math.Min(minY, p.Y), math.Max(maxY, p.Y)
+	}
+	x0, y0 := max(int(math.Floor(minX)), m.x0), max(int(math.Floor(minY)), m.y0)
+	x1, y1 := min(int(math.Ceil(maxX)), m.x0+m.w), min(int(math.Ceil(maxY)), m.y0+m.h)
+	if x0 >= x1 || y0 >= y1 {
+		return
+	}
+	w := x1 - x0
+	if cap(r.scratch) < w {
+		r.scratch = make([]float32, w)
+	}
+	row := r.scratch[:w]
+
+	var xs []crossing
+	for y := y0; y < y1; y++ {
+		clear(row)
+		for s := 0; s < subsamples; s++ {
+			sy := float64(y) + (float64(s)+0.5)/subsamples
+			xs = xs[:0]
+			for i := range poly {
+				a, b := poly[i], poly[(i+1)%len(poly)]
+				dir := 1
+				if a.Y > b.Y {
+					a, b, dir = b, a, -1
+				}
+				if a.Y == b.Y || sy < a.Y || sy >= b.Y {
+					continue
+				}
+				xs = append(xs, crossing{x: a.X + (sy-a.Y)*(b.X-a.X)/(b.Y-a.Y), dir: dir})
+			}
+			slices.SortFunc(xs, func(a, b crossing) int { return cmpFloat(a.x, b.x) })
+			winding, start := 0, 0.0
+			for _, c := range xs {
+				if winding == 0 {
+					start = c.x
+				}
+				winding += c.dir
+				if winding == 0 {
+					addSpan(row, start-float64(x0), c.x-float64(x0), 1.0/subsamples)
+				}
+			}
+		}
+		line := m.cov[(y-m.y0)*m.w+(x0-m.x0):][:w]
+		for i, v := range row {
+			line[i] = max(line[i], min(v, 1))
+		}
+	}
+}
+
+// addSpan adds weight times the covered fraction of each pixel between x0 and x1
+func addSpan(row []float32, x0, x1 float64, weight float32) {
+	x0, x1 = math.Max(x0, 0), math.Min(x1, float64(len(row)))
+	if x1 <= x0 {
+		return
+	}
+	i0, i1 := int(x0), int(x1)
+	if i0 == i1 {
+		row[i0] += weight * float32(x1-x0)
+		return
+	}
+	row[i0] += weight * float32(float64(i0+1)-x0)
+	for i := i0 + 1; i < i1; i++ {
+		row[i] += weight
+	}
+	if i1 < len(row) {
+		row[i1] += weight * float32(x1-float64(i1))
+	}
+}
+
+// paint composites a color over the covered pixels. With multiply, the color multiplies
+// what is underneath, like the highlighter's mix-blend-mode in the browser.
+func (r *Raster) paint(m *coverage, shade func(x, y int) style.Color, opacity float64, multiply bool) {
+	for y := m.y0; y < m.y0+m.h; y++ {
+		for x := m.x0; x < m.x0+m.w; x++ {
+			cov := float64(m.cov[(y-m.y0)*m.w+(x-m.x0)])
+			if cov <= 0 {
+				continue
+			}
+			c := shade(x, y)
+			a := cov * c.Alpha() * opacity
+			if a <= 0 {
+				continue
+			}
+			pix := r.img.Pix[r.img.PixOffset(x, y):][:4]
+			backdrop := float64(pix[3]) / 255
+			for k, channel := range [3]uint8{c.R, c.G, c.B} {
+				source := float64(channel) / 255
+				under := float64(pix[k]) / 255 // premultiplied
+				blended := source
+				if multiply && backdrop > 0 {
+					blended = source * under / backdrop
+				}
+				out := a*(1-backdrop)*source + a*backdrop*blended + (1-a)*under
+				pix[k] = uint8(math.Round(math.Min(out, 1) * 255))
+			}
+			pix[3] = uint8(math.Round((a + backdrop*(1-a)) * 255))
+		}
+	}
+}
+
+// lineShapes returns the polygons covering a pixel space polyline of the given width:
+// a quad per segment, and the joins and caps
+func lineShapes(path []db.Point, width float64, lineCap, lineJoin string, closed bool) [][]db.Point {
+	points := make([]db.Point, 0, len(path))
+	for _, p := range path {
+		if n := len(points); n > 0 && math.Abs(points[n-1].X-p.X) < 1e-9 && math.Abs(points[n-1].Y-p.Y) < 1e-9 {
+			continue
+		}
+		points = append(points, p)
+	}
+	if closed && len(points) > 2 && points[0] == points[len(points)-1] {
+		points = points[:len(points)-1]
+	}
+	hw := width / 2
+	if len(points) == 0 || hw <= 0 {
+		return nil
+	}
+	if len(points) == 1 {
+		switch lineCap {
+		case db.CapRound:
+			return [][]db.Point{Circle(points[0], hw)}
+		case db.CapSquare:
+			p := points[0]
+			return [][]db.Point{{{X: p.X - hw, Y: p.Y - hw}, {X: p.X + hw, Y: p.Y - hw}, {X: p.X + hw, Y: p.Y + hw}, {X: p.X - hw, Y: p.Y + hw}}}
+		}
+		return nil
+	}
+	closed = closed && len(points) > 2
+
+	n := len(points)
+	segments := n - 1
+	if closed {
+		segments = n
+	}
+	var shapes [][]db.Point
+	dir := func(i int) (float64, float64) {
+		a, b := points[i%n], points[(i+1)%n]
+		return unit(b.X-a.X, b.Y-a.Y)
+	}
+	for i := 0; i < segments; i++ {
+		a, b := points[i], points[(i+1)%n]
+		dx, dy := dir(i)
+		nx, ny := -dy*hw, dx*hw
+		shapes = append(shapes, []db.Point{{X: a.X + nx, Y: a.Y + ny}, {X: b.X + nx, Y: b.Y + ny}, {X: b.X - nx, Y: b.Y - ny}, {X: a.X - nx, Y: a.Y - ny}})
+	}
+
+	for i := 0; i < n; i++ {
+		if !closed && (i == 0 || i == n-1) {
+			continue
+		}
+		inX, inY := dir(i - 1 + n)
+		outX, outY := dir(i)
+		if join := joinShape(points[i], inX, inY, outX, outY, hw, lineJoin); join != nil {
+			shapes = append(shapes, join)
+		}
+	}
+
+	if !closed {
+		startX, startY := dir(0)
+		endX, endY := dir(n - 2)
+		for _, c := range []struct {
+			p      db.Point
+			dx, dy float64
+		}{{points[0], -startX, -startY}, {points[n-1], endX, endY}} {
+			switch lineCap {
+			case db.CapRound:
+				shapes = append(shapes, Circle(c.p, hw))
+			case db.CapSquare:
+				nx, ny := -c.dy*hw, c.dx*hw
+				ex, ey := c.dx*hw, c.dy*hw
+				shapes = append(shapes, []db.Point{{X: c.p.X + nx, Y: c.p.Y + ny}, {X: c.p.X + nx + ex, Y: c.p.Y + ny + ey},
+					{X: c.p.X - nx + ex, Y: c.p.Y - ny + ey}, {X: c.p.X - nx, Y: c.p.Y - ny}})
+			}
+		}
+	}
+	return shapes
+}
+
+// joinShape returns the polygon filling the outside of the corner at p between a segment
+// arriving in direction in and one leaving in direction out, or nil when none is needed
+func joinShape(p db.Point, inX, inY, outX, outY, hw float64, lineJoin string) []db.Point {
+	if lineJoin == db.JoinRound {
+		return Circle(p, hw)
+	}
+	cross := inX*outY - inY*outX
+	if math.Abs(cross) < 1e-12 {
+		return nil
+	}
+	// The outer side of the corner is opposite to the direction the path turns
+	side := 1.0
+	if cross > 0 {
+		side = -1
+	}
+	n1x, n1y := -inY*side, inX*side
+	n2x, n2y := -outY*side, outX*side
+	p1 := db.Point{X: p.X + n1x*hw, Y: p.Y + n1y*hw}
+	p2 := db.Point{X: p.X + n2x*hw, Y: p.Y + n2y*hw}
+	if lineJoin == db.JoinMiter {
+		mx, my := unit(n1x+n2x, n1y+n2y)
+		if cos := mx*n1x + my*n1y; cos > 1.0/svgMiterLimit {
+			length := hw / cos
+			return []db.Point{p, p1, {X: p.X + mx*length, Y: p.Y + my*length}, p2}
+		}
+	}
+	return []db.Point{p, p1, p2}
+}
+
+// dashPieces splits a polyline into its dashes, with lengths in pixels. Like SVG, an odd list
+// of lengths is repeated to make it even, and a list without any length leaves the line solid.
+// Dashes are at least minDashPixels long, and a pattern that would cut the line into more
+// than maxDashPieces dashes leaves it solid too.
+func dashPieces(path []db.Point, dash []float64) [][]db.Point {
+	if len(dash)%2 == 1 {
+		dash = append(slices.Clone(dash), dash...)
+	} else {
+		dash = slices.Clone(dash)
+	}
+	total := 0.0
+	for i := range dash {
+		if i%2 == 0 {
+			dash[i] = math.Max(dash[i], minDashPixels)
+		}
+		total += dash[i]
+	}
+	if len(dash) == 0 || len(path) < 2 || pathLength(path)/total*float64(len(dash)/2) > maxDashPieces {
+		return [][]db.Point{path}
+	}
+
+	var pieces [][]db.Point
+	index, left, on := 0, dash[0], true
+	current := []db.Point{path[0]}
+	for i := 1; i < len(path); i++ {
+		a, b := path[i-1], path[i]
+		length := math.Hypot(b.X-a.X, b.Y-a.Y)
+		pos := 0.0
+		for length-pos > left {
+			pos += left
+			t := pos / length
+			p := db.Point{X: a.X + (b.X-a.X)*t, Y: a.Y + (b.Y-a.Y)*t}
+			if on {
+				pieces = append(pieces, append(current, p))
+			}
+			current = []db.Point{p}
+			on = !on
+			index = (index + 1) % len(dash)
+			left = dash[index]
+		}
+		left -= length - pos
+		current = append(current, b)
+	}
+	if on && len(current) > 1 {
+		pieces = append(pieces, current)
+	}
+	return pieces
+}
+
+// pathLength returns the length of a polyline
+func pathLength(path []db.Point) float64 {
+	length := 0.0
+	for i := 1; i < len(path); i++ {
+		length += math.Hypot(path[i].X-path[i-1].X, path[i].Y-path[i-1].Y)
+	}
+	return length
+}
+
+// sampleBilinear returns the color of img at the continuous pixel position (u, v),
+// blending the four nearest pixels and clamping at the edges
+func sampleBilinear(img image.Image, u, v float64) style.Color {
+	b := img.Bounds()
+	u, v = u-0.5, v-0.5
+	x0, y0 := int(math.Floor(u)), int(math.Floor(v))
+	fx, fy := u-float64(x0), v-float64(y0)
+	var sum [4]float64
+	for _, s := range []struct {
+		dx, dy int
+		w      float64
+	}{{0, 0, (1 - fx) * (1 - fy)}, {1, 0, fx * (1 - fy)}, {0, 1, (1 - fx) * fy}, {1, 1, fx * fy}} {
+		x := min(max(x0+s.dx, 0), b.Dx()-1) + b.Min.X
+		y := min(max(y0+s.dy, 0), b.Dy()-1) + b.Min.Y
+		// Premultiplied, so transparent pixels don't bleed their color
+		cr, cg, cb, ca := img.At(x, y).RGBA()
+		sum[0] += s.w * float64(cr)
+		sum[1] += s.w * float64(cg)
+		sum[2] += s.w * float64(cb)
+		sum[3] += s.w * float64(ca)
+	}
+	if sum[3] == 0 {
+		return style.Color{}
+	}
+	straight := func(v float64) uint8 { return uint8(math.Round(math.Min(v/sum[3], 1) * 255)) }
+	return style.Color{R: straight(sum[0]), G: straight(sum[1]), B: straight(sum[2]), A: uint8(math.Round(sum[3] / 0xffff * 255))}
+}
+
+// parseColor reads a color, reporting false for empty, "none" and invalid values
+func parseColor(value string) (style.Color, bool) {
+	if value == "" || value == "none" || value == "transparent" {
+		return style.Color{}, false
+	}
+	c, err := style.ParseColor(value)
+	return c, err == nil
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
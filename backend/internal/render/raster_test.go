@@ -0,0 +1,82 @@
+package render
+
+import (
+	"math"
+	"testing"
+
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+)
+
+func TestDashPieces(t *testing.T) {
+	line := []db.Point{{X: 0, Y: 0}, {X: 20, Y: 0}, {X: 20, Y: 20}}
+	pieces := dashPieces(line, []float64{6, 2})
+	// 40 pixels of 6 on, 2 off: dashes start every 8 pixels, the third turns the corner
+	if len(pieces) != 5 {
+		t.Fatalf("got %d dashes, want 5", len(pieces))
+	}
+	for i, piece := range pieces {
+		if l := pathLength(piece); math.Abs(l-6) > 1e-9 {
+			t.Errorf("dash %d is %v long, want 6", i, l)
+		}
+	}
+	if len(pieces[2]) != 3 {
+		t.Errorf("the dash around the corner has %d points, want 3", len(pieces[2]))
+	}
+}
+
+func TestDashPiecesOddPattern(t *testing.T) {
+	// [5] means 5 on, 5 off
+	pieces := dashPieces([]db.Point{{X: 0, Y: 0}, {X: 30, Y: 0}}, []float64{5})
+	if len(pieces) != 3 {
+		t.Fatalf("got %d dashes, want 3", len(pieces))
+	}
+	if pieces[1][0].X != 10 {
+		t.Errorf("second dash starts at %v, want 10", pieces[1][0].X)
+	}
+}
+
+func TestDashPiecesZeroLength(t *testing.T) {
+	pieces := dashPieces([]db.Point{{X: 0, Y: 0}, {X: 20, Y: 0}}, []float64{0, 5})
+	if len(pieces) != 4 {
+		t.Fatalf("got %d dots, want 4", len(pieces))
+	}
+	for i, piece := range pieces {
+		if l := pathLength(piece); l < minDashPixels-1e-9 {
+			t.Errorf("dot %d is %v long, shorter than %v", i, l, minDashPixels)
+		}
+	}
+}
+
+func TestDashPiecesTooFine(t *testing.T) {
+	line := []db.Point{{X: 0, Y: 0}, {X: 100000, Y: 0}}
+	pieces := dashPieces(line, []float64{0.001, 0.001})
+	if len(pieces) != 1 || len(pieces[0]) != 2 {
+		t.Fatalf("a pattern too fine to cut gave %d pieces, want the solid line", len(pieces))
+	}
+}
+
+func TestRasterStrokeDashed(t *testing.T) {
+	// A dashed line leaves clear gaps, a dotted line of zero length dashes is still drawn
+	for _, c := range []struct {
+		dash    []float64
+		lineCap string
+	}{{[]float64{4, 4}, db.CapButt}, {[]float64{0, 8}, db.CapRound}} {
+		r := NewRaster(geometry.Rect{MaxX: 40, MaxY: 10}, 40, 10, nil)
+		stroke := &db.Stroke{Path: []db.Point{{X: 2, Y: 5}, {X: 38, Y: 5}}, Color: "#000000", Width: 3,
+			StrokeStyle: db.StrokeStyle{Opacity: 1, Dash: c.dash, LineCap: c.lineCap}}
+		r.Stroke(stroke)
+		opaque, clear := 0, 0
+		for x := 2; x < 38; x++ {
+			switch a := r.Image().RGBAAt(x, 5).A; {
+			case a > 192:
+				opaque++
+			case a < 64:
+				clear++
+			}
+		}
+		if opaque == 0 || clear == 0 {
+			t.Errorf("dash %v gives %d opaque and %d clear pixels", c.dash, opaque, clear)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package render turns board content into shapes that the server side renderers
+// (exports, thumbnails) can fill or stroke directly.
+package render
+
+import (
+	"math"
+	"sketchive/internal/db"
+)
+
+const (
+	// minWidthScale is the thinnest a stroke gets, relative to its nominal width,
+	// at the lowest pressure or highest drawing speed
+	minWidthScale = 0.25
+	// defaultPressure is used for points of a pressure stroke that didn't report one,
+	// matching what browsers report for devices without pressure support
+	defaultPressure = 0.5
+	// speedThinning is how much each pixel per millisecond of drawing speed thins a stroke
+	speedThinning = 0.6
+	// widthSmoothing is the weight the previous width keeps when smoothing speed based widths
+	widthSmoothing = 0.7
+	// miterLimit caps how far a join may reach, relative to the half width
+	miterLimit = 2.0
+)
+
+// HasPressure reports whether any point of the path carries pen pressure
+func HasPressure(path []db.Point) bool {
+	for _, p := range path {
+		if p.Pressure != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTiming reports whether the path carries timestamps
+func HasTiming(path []db.Point) bool {
+	return len(path) > 1 && path[len(path)-1].T > path[0].T
+}
+
+// HasVariableWidth reports whether the path should be drawn with a varying width
+// rather than as a plain line of the stroke's width
+func HasVariableWidth(path []db.Point) bool {
+	return HasPressure(path) || HasTiming(path)
+}
+
+// StrokeWidths returns the drawn width at every point of the path. Pressure wins when it was
+// recorded, otherwise timestamps thin the stroke where it was drawn fast. Paths with neither
+// keep the nominal width everywhere.
+func StrokeWidths(path []db.Point, width float64) []float64 {
+	widths := make([]float64, len(path))
+	switch {
+	case HasPressure(path):
+		for i, p := range path {
+			pressure := p.Pressure
+			if pressure == 0 {
+				pressure = defaultPressure
+			}
+			widths[i] = width * (minWidthScale + (1-minWidthScale)*pressure)
+		}
+	case HasTiming(path):
+		scale := 1.0
+		for i, p := range path {
+			if i > 0 {
+				dt := float64(p.T - path[i-1].T)
+				target := scale
+				if dt > 0 {
+					speed := math.Hypot(p.X-path[i-1].X, p.Y-path[i-1].Y) / dt
+					target = math.Max(minWidthScale, 1/(1+speedThinning*speed))
+				}
+				scale = widthSmoothing*scale + (1-widthSmoothing)*target
+			}
+			widths[i] = width * scale
+		}
+	default:
+		for i := range widths {
+			widths[i] = width
+		}
+	}
+	return widths
+}
+
+// StrokeOutline returns the outline of a variable width stroke as a closed polygon with
+// round caps, to be filled with the stroke's color. widths holds the width at each point,
+// as returned by StrokeWidths.
+func StrokeOutline(path []db.Point, widths []float64) []db.Point {
+	points, radii := dedupe(path, widths)
+	if len(points) == 0 {
+		return nil
+	}
+	if len(points) == 1 {
+		return Circle(points[0], radii[0])
+	}
+
+	n := len(points)
+	left := make([]db.Point, n)
+	right := make([]db.Point, n)
+	for i := range points {
+		nx, ny := joinNormal(points, i)
+		r := radii[i]
+		left[i] = db.Point{X: points[i].X + nx*r, Y: points[i].Y + ny*r}
+		right[i] = db.Point{X: points[i].X - nx*r, Y: points[i].Y - ny*r}
+	}
+
+	outline := make([]db.Point, 0, 2*n+32)
+	outline = append(outline, left...)
+	// End cap sweeps from the left side around the end point to the right side
+	outline = append(outline, arc(points[n-1], radii[n-1], angleOf(left[n-1], points[n-1]), -math.Pi)...)
+	for i := n - 1; i >= 0; i-- {
+		outline = append(outline, right[i])
+	}
+	outline = append(outline, arc(points[0], radii[0], angleOf(right[0], points[0]), -math.Pi)...)
+	return outline
+}
+
+// Circle approximates a circle as a polygon, with more vertices for larger radii
+func Circle(center db.Point, radius float64) []db.Point {
+	return arc(center, radius, 0, 2*math.Pi)
+}
+
+// dedupe drops consecutive repeated points, which have no direction to offset along
+func dedupe(path []db.Point, widths []float64) ([]db.Point, []float64) {
+	points := make([]db.Point, 0, len(path))
+	radii := make([]float64, 0, len(path))
+	for i, p := range path {
+		r := widths[i] / 2
+		if len(points) > 0 {
+			last := points[len(points)-1]
+			if math.Abs(last.X-p.X) < 1e-9 && math.Abs(last.Y-p.Y) < 1e-9 {
+				radii[len(radii)-1] = math.Max(radii[len(radii)-1], r)
+				continue
+			}
+		}
+		points = append(points, p)
+		radii = append(radii, r)
+	}
+	return points, radii
+}
+
+// joinNormal returns the offset direction at point i: the unit normal of the segment at
+// the ends, and the miter direction between the two segments elsewhere, lengthened so the
+// offset sides stay parallel to the segments up to miterLimit
+func joinNormal(points []db.Point, i int) (float64, float64) {
+	var inX, inY, outX, outY float64
+	if i > 0 {
+		inX, inY = unit(points[i].X-points[i-1].X, points[i].Y-points[i-1].Y)
+	}
+	if i < len(points)-1 {
+		outX, outY = unit(points[i+1].X-points[i].X, points[i+1].Y-points[i].Y)
+	}
+	if i == 0 {
+		inX, inY = outX, outY
+	}
+	if i == len(points)-1 {
+		outX, outY = inX, inY
+	}
+
+	// Normals point to the left of the drawing direction
+	n1x, n1y := -inY, inX
+	n2x, n2y := -outY, outX
+	mx, my := unit(n1x+n2x, n1y+n2y)
+	if mx == 0 && my == 0 {
+		// The stroke doubles back on itself
+		return n1x, n1y
+	}
+	cos := mx*n1x + my*n1y
+	length := miterLimit
+	if cos > 1/miterLimit {
+		length = 1 / cos
+	}
+	return mx * length, my * length
+}
+
+// arc returns points on a circle around center, starting at angle start and sweeping by sweep radians
+func arc(center db.Point, radius, start, sweep float64) []db.Point {
+	segments := int(math.Ceil(math.Abs(sweep) / (2 * math.Pi) * math.Max(16, math.Min(64, radius*2))))
+	points := make([]db.Point, 0, segments+1)
+	for s := 0; s <= segments; s++ {
+		a := start + sweep*float64(s)/float64(segments)
+		points = append(points, db.Point{X: center.X + radius*math.Cos(a), Y: center.Y + radius*math.Sin(a)})
+	}
+	return points
+}
+
+func angleOf(p, center db.Point) float64 {
+	return math.Atan2(p.Y-center.Y, p.X-center.X)
+}
+
+func unit(x, y float64) (float64, float64) {
+	length := math.Hypot(x, y)
+	if length == 0 {
+		return 0, 0
+	}
+	return x / length, y / length
+}
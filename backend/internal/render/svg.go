@@ -0,0 +1,375 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"strconv"
+	"strings"
+)
+
+// Highlight replaces the colors of an item, e.g. to mark additions and removals in a visual diff
+type Highlight struct {
+	Color   string
+	Opacity float64 // 0 keeps the item's own opacity
+	Dashed  bool
+}
+
+// highlightDash is the dash pattern of a dashed highlight, which replaces the item's own
+var highlightDash = []float64{6, 4}
+
+// SVG writes board content as an SVG document. Numbers are rounded to a fixed precision and
+// attributes always come in the same order, so the same content gives the same bytes.
+type SVG struct {
+	buf bytes.Buffer
+	// ImageHref returns the link for the picture of an image element, by default the blob route
+	ImageHref func(image *db.ImageProps) string
+}
+
+// NewSVG starts a document showing the board area view at width by height pixels.
+// A non-empty background fills the whole document.
+func NewSVG(view geometry.Rect, width, height float64, background string) *SVG {
+	s := &SVG{ImageHref: func(image *db.ImageProps) string { return "/blobs/" + image.BlobHash }}
+	fmt.Fprintf(&s.buf, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%s" height="%s" viewBox="%s %s %s %s">`+"\n",
+		num(width), num(height), num(view.MinX), num(view.MinY), num(view.MaxX-view.MinX), num(view.MaxY-view.MinY))
+	if background != "" {
+		fmt.Fprintf(&s.buf, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`+"\n",
+			num(view.MinX), num(view.MinY), num(view.MaxX-view.MinX), num(view.MaxY-view.MinY), attr(background))
+	}
+	return s
+}
+
+// BeginGroup opens a <g> element with the given id, closed by EndGroup
+func (s *SVG) BeginGroup(id string) {
+	fmt.Fprintf(&s.buf, `<g id="%s">`+"\n", attr(id))
+}
+
+// EndGroup closes the last group opened with BeginGroup
+func (s *SVG) EndGroup() {
+	s.buf.WriteString("</g>\n")
+}
+
+// Bytes closes the document and returns it
+func (s *SVG) Bytes() []byte {
+	s.buf.WriteString("</svg>\n")
+	return s.buf.Bytes()
+}
+
+// Stroke draws a freehand stroke. Strokes with pressure or timing are filled outlines,
+// the others are paths of the stroke's width.
+func (s *SVG) Stroke(stroke *db.Stroke, h *Highlight) {
+	if len(stroke.Path) == 0 {
+		return
+	}
+	color, opacity := stroke.Color, stroke.Opacity
+	if opacity == 0 {
+		opacity = 1
+	}
+	fill, dash := stroke.Fill, stroke.Dash
+	if h != nil {
+		color = h.Color
+		if h.Dashed {
+			dash = highlightDash
+		}
+		if fill != "" {
+			fill = h.Color
+		}
+		if h.Opacity != 0 {
+			opacity = h.Opacity
+		}
+	}
+
+	var a attrs
+	a.add("data-stroke", strconv.Itoa(stroke.ID))
+	if HasVariableWidth(stroke.Path) && fill == "" {
+		a.add("d", pathData(StrokeOutline(stroke.Path, StrokeWidths(stroke.Path, stroke.Width)), true))
+		a.add("fill", color)
+	} else {
+		a.add("d", pathData(stroke.Path, false))
+		a.add("fill", none(fill))
+		a.add("stroke", color)
+		a.add("stroke-width", num(stroke.Width))
+		a.add("stroke-linecap", orDefault(stroke.LineCap, db.CapRound))
+		a.add("stroke-linejoin", orDefault(stroke.LineJoin, db.JoinRound))
+		if len(dash) > 0 {
+			a.add("stroke-dasharray", numList(dash))
+		}
+	}
+	if opacity != 1 {
+		a.add("opacity", num(opacity))
+	}
+	if stroke.Blend == db.BlendHighlighter {
+		a.add("style", "mix-blend-mode:multiply")
+	}
+	s.tag("path", a)
+}
+
+// Element draws a shape, line, text, sticky note, image or connector
+func (s *SVG) Element(e *db.Element, h *Highlight) {
+	strokeColor, fill := e.Style.StrokeColor, e.Style.FillColor
+	textColor := ""
+	if e.Text != nil {
+		textColor = e.Text.Color
+	}
+	if h != nil {
+		strokeColor, textColor = h.Color, h.Color
+		if fill != "" || e.Type == db.ElementSticky {
+			fill = h.Color
+		}
+	}
+	var group attrs
+	group.add("data-element", strconv.Itoa(e.ID))
+	if h != nil && h.Opacity != 0 {
+		group.add("opacity", num(h.Opacity))
+	}
+	s.open("g", group)
+	defer s.buf.WriteString("</g>\n")
+
+	line := func(a *attrs) {
+		a.add("stroke", none(strokeColor))
+		a.add("stroke-width", num(e.Style.StrokeWidth))
+		if h != nil && h.Dashed {
+			a.add("stroke-dasharray", numList(highlightDash))
+		}
+	}
+	rotate := func(a *attrs) {
+		if e.Rotation != 0 {
+			c := db.Point{X: e.X + e.Width/2, Y: e.Y + e.Height/2}
+			a.add("transform", fmt.Sprintf("rotate(%s %s %s)", num(e.Rotation), num(c.X), num(c.Y)))
+		}
+	}
+
+	switch e.Type {
+	case db.ElementRectangle, db.ElementSticky, db.ElementFrame:
+		var a attrs
+		a.add("x", num(e.X))
+		a.add("y", num(e.Y))
+		a.add("width", num(e.Width))
+		a.add("height", num(e.Height))
+		a.add("fill", none(fill))
+		line(&a)
+		rotate(&a)
+		s.tag("rect", a)
+		if e.Type == db.ElementSticky {
+			s.text(e, textColor, geometry.StickyPadding)
+		}
+	case db.ElementEllipse:
+		var a attrs
+		a.add("cx", num(e.X+e.Width/2))
+		a.add("cy", num(e.Y+e.Height/2))
+		a.add("rx", num(e.Width/2))
+		a.add("ry", num(e.Height/2))
+		a.add("fill", none(fill))
+		line(&a)
+		rotate(&a)
+		s.tag("ellipse", a)
+	case db.ElementPolygon:
+		var a attrs
+		a.add("points", pointList(e.Points))
+		a.add("fill", none(fill))
+		line(&a)
+		a.add("stroke-linejoin", db.JoinRound)
+		s.tag("polygon", a)
+	case db.ElementLine, db.ElementArrow, db.ElementConnector:
+		var a attrs
+		a.add("points", pointList(e.Points))
+		a.add("fill", "none")
+		line(&a)
+		a.add("stroke-linecap", db.CapRound)
+		a.add("stroke-linejoin", db.JoinRound)
+		s.tag("polyline", a)
+		heads := ElementArrowheadStyles(e)
+		for i, head := range geometry.ElementArrowheads(e) {
+			var a attrs
+			if heads[i] == db.ArrowheadTriangle {
+				a.add("points", pointList(head))
+				a.add("fill", none(strokeColor))
+				line(&a)
+				a.add("stroke-linejoin", db.JoinRound)
+				s.tag("polygon", a)
+				continue
+			}
+			a.add("points", pointList(head))
+			a.add("fill", "none")
+			line(&a)
+			a.add("stroke-linecap", db.CapRound)
+			a.add("stroke-linejoin", db.JoinRound)
+			s.tag("polyline", a)
+		}
+	case db.ElementText:
+		s.text(e, textColor, 0)
+	case db.ElementImage:
+		if e.Image == nil {
+			return
+		}
+		var a attrs
+		a.add("x", num(e.X))
+		a.add("y", num(e.Y))
+		a.add("width", num(e.Width))
+		a.add("height", num(e.Height))
+		a.add("preserveAspectRatio", "none")
+		a.add("xlink:href", s.ImageHref(e.Image))
+		rotate(&a)
+		s.tag("image", a)
+		if h != nil {
+			var frame attrs
+			frame.add("x", num(e.X))
+			frame.add("y", num(e.Y))
+			frame.add("width", num(e.Width))
+			frame.add("height", num(e.Height))
+			frame.add("fill", "none")
+			frame.add("stroke", h.Color)
+			frame.add("stroke-width", num(math.Max(e.Style.StrokeWidth, 2)))
+			rotate(&frame)
+			s.tag("rect", frame)
+		}
+	}
+}
+
+// ElementArrowheadStyles returns the style of each arrowhead returned by geometry.ElementArrowheads,
+// in the same order: the end arrowhead first, then the start one
+func ElementArrowheadStyles(e *db.Element) []string {
+	var styles []string
+	if e.EndArrowhead != "" && e.EndArrowhead != db.ArrowheadNone {
+		styles = append(styles, e.EndArrowhead)
+	}
+	if e.StartArrowhead != "" && e.StartArrowhead != db.ArrowheadNone {
+		styles = append(styles, e.StartArrowhead)
+	}
+	return styles
+}
+
+// text writes the laid out text of a text element or sticky note, inset by padding
+func (s *SVG) text(e *db.Element, color string, padding float64) {
+	t := e.Text
+	if t == nil || t.Content == "" {
+		return
+	}
+	layout := TextLines(e)
+	x, anchor := e.X+padding, "start"
+	switch t.Align {
+	case db.AlignCenter:
+		x, anchor = e.X+e.Width/2, "middle"
+	case db.AlignRight:
+		x, anchor = e.X+e.Width-padding, "end"
+	}
+
+	var a attrs
+	a.add("x", num(x))
+	a.add("y", num(e.Y+padding))
+	a.add("font-family", t.FontFamily)
+	a.add("font-size", num(t.FontSize))
+	a.add("fill", orDefault(color, "#000000"))
+	a.add("text-anchor", anchor)
+	a.add("dominant-baseline", "text-before-edge")
+	if e.Rotation != 0 {
+		a.add("transform", fmt.Sprintf("rotate(%s %s %s)", num(e.Rotation), num(e.X+e.Width/2), num(e.Y+e.Height/2)))
+	}
+	s.open("text", a)
+	for i, line := range layout {
+		var span attrs
+		span.add("x", num(x))
+		if i > 0 {
+			span.add("dy", num(t.FontSize*geometry.LineHeight))
+		}
+		s.open("tspan", span)
+		s.buf.WriteString(html.EscapeString(line))
+		s.buf.WriteString("</tspan>")
+	}
+	s.buf.WriteString("</text>\n")
+}
+
+// TextLines returns the lines of a text element or sticky note as the server lays them out
+func TextLines(e *db.Element) []string {
+	t := e.Text
+	if t == nil {
+		return nil
+	}
+	return geometry.LayoutText(t.Content, geometry.FontForFamily(t.FontFamily), t.FontSize, t.WrapWidth).Lines
+}
+
+// attrs is an ordered list of attributes
+type attrs []string
+
+func (a *attrs) add(name, value string) {
+	*a = append(*a, name+`="`+attr(value)+`"`)
+}
+
+func (s *SVG) tag(name string, a attrs) {
+	s.buf.WriteString("<" + name + " " + strings.Join(a, " ") + "/>\n")
+}
+
+func (s *SVG) open(name string, a attrs) {
+	if len(a) == 0 {
+		s.buf.WriteString("<" + name + ">")
+	} else {
+		s.buf.WriteString("<" + name + " " + strings.Join(a, " ") + ">")
+	}
+	if name == "g" {
+		s.buf.WriteString("\n")
+	}
+}
+
+func attr(value string) string {
+	return html.EscapeString(value)
+}
+
+func none(color string) string {
+	return orDefault(color, "none")
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// num prints a coordinate rounded to 1/100 of a unit, without trailing zeros
+func num(v float64) string {
+	v = math.Round(v*100) / 100
+	if v == 0 {
+		v = 0 // no negative zero
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func numList(values []float64) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = num(v)
+	}
+	return strings.Join(parts, " ")
+}
+
+func pointList(points []db.Point) string {
+	parts := make([]string, len(points))
+	for i, p := range points {
+		parts[i] = num(p.X) + "," + num(p.Y)
+	}
+	return strings.Join(parts, " ")
+}
+
+// pathData turns points into SVG path commands, closing the path when closed is set
+func pathData(points []db.Point, closed bool) string {
+	var b strings.Builder
+	for i, p := range points {
+		if i == 0 {
+			b.WriteString("M")
+		} else {
+			b.WriteString(" L")
+		}
+		b.WriteString(num(p.X) + " " + num(p.Y))
+	}
+	if len(points) == 1 {
+		// A lone point still shows as a dot with round caps
+		b.WriteString(" L" + num(points[0].X) + " " + num(points[0].Y))
+	}
+	if closed {
+		b.WriteString(" Z")
+	}
+	return b.String()
+}
@@ -0,0 +1,38 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+)
+
+func TestSVGHighlightReplacesDash(t *testing.T) {
+	svg := NewSVG(geometry.Rect{MaxX: 100, MaxY: 100}, 100, 100, "")
+	stroke := &db.Stroke{ID: 1, Path: []db.Point{{X: 10, Y: 10}, {X: 90, Y: 90}}, Color: "#000000", Width: 2,
+		StrokeStyle: db.StrokeStyle{Opacity: 1, Dash: []float64{1, 3}}}
+	svg.Stroke(stroke, &Highlight{Color: "#ff0000", Dashed: true})
+	out := string(svg.Bytes())
+
+	if n := strings.Count(out, "stroke-dasharray"); n != 1 {
+		t.Fatalf("stroke has %d dash arrays:\n%s", n, out)
+	}
+	if !strings.Contains(out, `stroke-dasharray="6 4"`) {
+		t.Errorf("highlight dash is missing:\n%s", out)
+	}
+}
+
+func TestSVGDeterministic(t *testing.T) {
+	draw := func() []byte {
+		svg := NewSVG(geometry.Rect{MinX: -10, MinY: -10, MaxX: 90, MaxY: 90}, 200, 200, "#ffffff")
+		svg.Stroke(&db.Stroke{ID: 1, Path: []db.Point{{X: 0, Y: 0, Pressure: 0.3}, {X: 1.0 / 3, Y: 50, Pressure: 0.8}},
+			Color: "#123456", Width: 4, StrokeStyle: db.DefaultStrokeStyle()}, nil)
+		svg.Element(&db.Element{ID: 2, Type: db.ElementRectangle, X: 10, Y: 10, Width: 20, Height: 20, Rotation: 30,
+			Style: db.ElementStyle{StrokeColor: "#000000", StrokeWidth: 1}}, nil)
+		return svg.Bytes()
+	}
+	if a, b := draw(), draw(); string(a) != string(b) {
+		t.Errorf("the same content gave different documents:\n%s\n%s", a, b)
+	}
+}
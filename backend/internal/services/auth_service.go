@@ -1 +1,22 @@
 package services
+
+import (
+	"fmt"
+	"sketchive/internal/db"
+)
+
+// requireEditor checks that a user may change boards they don't own: admins and editors can,
+// viewers can't
+func requireEditor(userID int) error {
+	if userID == 0 {
+		return fmt.Errorf("%w: a userID is needed", ErrForbidden)
+	}
+	role, err := db.GetUserRole(userID)
+	if err != nil {
+		return err
+	}
+	if role != db.RoleAdmin && role != db.RoleEditor {
+		return fmt.Errorf("%w: user %d is a %s, editing needs an editor or admin", ErrForbidden, userID, role)
+	}
+	return nil
+}
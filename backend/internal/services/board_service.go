@@ -0,0 +1,223 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+)
+
+// maxBatchSize caps how many items a single board operation may touch
+const maxBatchSize = 10000
+
+// ErrInvalid marks errors caused by a bad request rather than a server failure
+var ErrInvalid = errors.New("invalid request")
+
+// ErrForbidden is returned when the user's role doesn't allow the operation
+var ErrForbidden = errors.New("not allowed")
+
+func invalidf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+}
+
+// Event is a board change sent to every connected WebSocket client
+type Event struct {
+	Type          string         `json:"type"`
+	WhiteboardID  int            `json:"whiteboardID"`
+	UserID        int            `json:"userID"`
+	Strokes       []db.Stroke    `json:"strokes,omitempty"`
+	Elements      []db.Element   `json:"elements,omitempty"`
+	Groups        []db.Group     `json:"groups,omitempty"`
+	GroupID       int            `json:"groupID,omitempty"`
+	ElementIDs    []int          `json:"elementIDs,omitempty"`
+	Votes         *VoteResults   `json:"votes,omitempty"`
+	Canvas        *Canvas        `json:"canvas,omitempty"`
+	ContentBounds *db.Bounds     `json:"contentBounds,omitempty"`
+	History       *HistoryResult `json:"history,omitempty"`
+	Version       *db.Version    `json:"version,omitempty"`
+	Clear         *db.Clear      `json:"clear,omitempty"`
+}
+
+// Board event types
+const (
+	EventStrokesTransformed = "strokes_transformed"
+	EventContentTransformed = "content_transformed"
+)
+
+// broadcaster delivers messages to the connected clients, set in main.go
+var broadcaster func(message []byte)
+
+func SetBroadcaster(fn func(message []byte)) {
+	broadcaster = fn
+}
+
+// Broadcast sends an event to every connected client. It is a no-op when no broadcaster is set.
+func Broadcast(event Event) {
+	if broadcaster == nil {
+		return
+	}
+	message, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Error marshaling board event:", err)
+		return
+	}
+	broadcaster(message)
+}
+
+// uniqueIDs returns ids without duplicates, keeping the first occurrence order
+func uniqueIDs(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	unique := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// applyToStroke transforms a stroke's path in place and recomputes its bounding box
+func applyToStroke(stroke *db.Stroke, m geometry.Affine) error {
+	stroke.Path = geometry.TransformPoints(stroke.Path, m)
+	bounds, err := geometry.PointsBounds(stroke.Path)
+	if err != nil {
+		return fmt.Errorf("stroke %d: %w", stroke.ID, err)
+	}
+	stroke.MinX, stroke.MaxX, stroke.MinY, stroke.MaxY = bounds.MinX, bounds.MaxX, bounds.MinY, bounds.MaxY
+	return nil
+}
+
+// TransformResult holds the items changed by a transform
+type TransformResult struct {
+	Strokes  []db.Stroke  `json:"strokes"`
+	Elements []db.Element `json:"elements"`
+	Groups   []db.Group   `json:"groups"`
+}
+
+// TransformStrokes moves, rotates and scales a set of strokes atomically: either every stroke
+// is rewritten or none is. Strokes that belong to a group bring the rest of the group along.
+// The result is broadcast so every client sees the same geometry.
+func TransformStrokes(whiteboardID, userID int, strokeIDs []int, t geometry.Transform) ([]db.Stroke, error) {
+	if len(uniqueIDs(strokeIDs)) == 0 {
+		return nil, invalidf("no strokes to transform")
+	}
+	result, err := transformContent(whiteboardID, userID, ContentIDs{StrokeIDs: strokeIDs}, t)
+	if err != nil {
+		return nil, err
+	}
+	Broadcast(Event{Type: EventStrokesTransformed, WhiteboardID: whiteboardID, UserID: userID,
+		Strokes: result.Strokes, Elements: result.Elements, Groups: result.Groups})
+	return result.Strokes, nil
+}
+
+// TransformContent is TransformStrokes for any mix of strokes, elements and groups.
+// Groups, and every group an item belongs to, are transformed as a whole.
+func TransformContent(whiteboardID, userID int, ids ContentIDs, t geometry.Transform) (TransformResult, error) {
+	result, err := transformContent(whiteboardID, userID, ids, t)
+	if err != nil {
+		return result, err
+	}
+	Broadcast(Event{Type: EventContentTransformed, WhiteboardID: whiteboardID, UserID: userID,
+		Strokes: result.Strokes, Elements: result.Elements, Groups: result.Groups})
+	return result, nil
+}
+
+func transformContent(whiteboardID, userID int, ids ContentIDs, t geometry.Transform) (TransformResult, error) {
+	var result TransformResult
+	m, err := t.Affine()
+	if err != nil {
+		return result, invalidf("%v", err)
+	}
+
+	groups, err := loadGroups(whiteboardID)
+	if err != nil {
+		return result, err
+	}
+	content, _, err := groups.expand(ids)
+	if err != nil {
+		return result, err
+	}
+	if len(content.StrokeIDs) == 0 && len(content.ElementIDs) == 0 {
+		return result, invalidf("nothing to transform")
+	}
+	if len(content.StrokeIDs)+len(content.ElementIDs) > maxBatchSize {
+		return result, invalidf("can't transform more than %d items at once", maxBatchSize)
+	}
+
+	layers, err := loadLayers(whiteboardID)
+	if err != nil {
+		return result, err
+	}
+
+	plan, err := planConnectors(whiteboardID, content.ElementIDs)
+	if err != nil {
+		return result, err
+	}
+	canvas, err := GetCanvas(whiteboardID)
+	if err != nil {
+		return result, err
+	}
+
+	// The geometry before the transform, so the user can undo it
+	strokesBefore := map[int]strokeGeometry{}
+	elementsBefore := map[int]elementGeometry{}
+	result.Strokes, result.Elements, err = db.UpdateContentGeometry(whiteboardID, content.StrokeIDs, plan.elementIDs,
+		func(stroke *db.Stroke) error {
+			if !layers.editable(stroke.LayerID) {
+				return fmt.Errorf("%w: stroke %d is on a hidden or locked layer", ErrLocked, stroke.ID)
+			}
+			strokesBefore[stroke.ID] = strokeGeometryOf(stroke)
+			if err := applyToStroke(stroke, m); err != nil {
+				return err
+			}
+			return canvas.checkRect(fmt.Sprintf("stroke %d", stroke.ID), StrokeBounds(stroke))
+		},
+		func(element *db.Element) error {
+			elementsBefore[element.ID] = elementGeometryOf(element)
+			// Connectors outside the selection only follow the elements they are bound to
+			if plan.following[element.ID] {
+				return plan.route(element)
+			}
+			if !layers.editable(element.LayerID) {
+				return fmt.Errorf("%w: element %d is on a hidden or locked layer", ErrLocked, element.ID)
+			}
+			if m.Determinant() < 0 && !geometry.CanMirror(element) {
+				return invalidf("%s %d can't be mirrored", element.Type, element.ID)
+			}
+			if err := geometry.TransformElement(element, m); err != nil {
+				return err
+			}
+			if err := canvas.checkRect(fmt.Sprintf("%s %d", element.Type, element.ID), ElementBounds(element)); err != nil {
+				return err
+			}
+			if element.Type == db.ElementConnector {
+				return plan.route(element)
+			}
+			plan.moved[element.ID] = element
+			return nil
+		},
+		nil, LogStrokes(whiteboardID, userID, LogStrokesUpdated), LogElements(whiteboardID, userID, LogElementsUpdated))
+	if err != nil {
+		return result, err
+	}
+
+	IndexStrokes(whiteboardID, result.Strokes...)
+	IndexElements(whiteboardID, result.Elements...)
+	recordTransform(whiteboardID, userID, strokesBefore, elementsBefore, result.Strokes, result.Elements)
+
+	changed := ContentIDs{StrokeIDs: content.StrokeIDs, ElementIDs: plan.elementIDs}.members()
+	result.Groups, _, err = refreshGroups(whiteboardID, changed)
+	if err != nil {
+		return result, fmt.Errorf("refreshing groups: %w", err)
+	}
+	if result.Groups == nil {
+		result.Groups = []db.Group{}
+	}
+
+	log.Printf("User %d transformed %d strokes and %d elements on whiteboard ID %d\n",
+		userID, len(result.Strokes), len(result.Elements), whiteboardID)
+	return result, nil
+}
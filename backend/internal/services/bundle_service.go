@@ -0,0 +1,609 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"image"
+	_ "image/gif" // register decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"sketchive/internal/blob"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"sketchive/internal/style"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BundleFormat names the archive format of board bundles in their manifest
+const BundleFormat = "sketchive-board-bundle"
+
+// BundleSchemaVersion is the version of the bundle layout this server writes. Bundles with
+// a newer version are rejected, so a change to the layout must come with a new version.
+const BundleSchemaVersion = 1
+
+// Files of a bundle archive. Blobs are stored as blobs/<hash>.
+const (
+	bundleManifestFile = "manifest.json"
+	bundleBoardFile    = "board.json"
+	bundleStrokesFile  = "strokes.json"
+	bundleElementsFile = "elements.json"
+	bundleBlobDir      = "blobs/"
+)
+
+// Limits on an imported bundle
+const (
+	maxBundleUncompressedSize = 1 << 30 // all files together
+	maxBundleJSONSize         = 256 << 20
+	maxBundleBlobSize         = 10 << 20 // as large as an uploaded image
+	maxBundleBlobs            = 1000
+)
+
+// EventBundleImported is broadcast when a bundle was merged into a board
+const EventBundleImported = "bundle_imported"
+
+// BundleManifest describes a bundle archive: its format and schema version, where it came
+// from, and what it holds
+type BundleManifest struct {
+	Format        string    `json:"format"`
+	SchemaVersion int       `json:"schemaVersion"`
+	ExportedAt    time.Time `json:"exportedAt"`
+	WhiteboardID  int       `json:"whiteboardID"` // the board on the server it was exported from
+	StrokeCount   int       `json:"strokeCount"`
+	ElementCount  int       `json:"elementCount"`
+	Blobs         []db.Blob `json:"blobs"`
+}
+
+// BundleBoard is the board of a bundle besides its strokes and elements
+type BundleBoard struct {
+	Name      string            `json:"name"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Canvas    db.CanvasSettings `json:"canvas"`
+	Layers    []db.Layer        `json:"layers"` // bottom to top
+	Groups    []db.Group        `json:"groups"`
+}
+
+// ImportOptions says where a bundle is imported
+type ImportOptions struct {
+	UserID       int    // who imports the bundle, the owner of the new board and of everything imported
+	WhiteboardID int    // the board to merge the bundle into, 0 to create a new board
+	Name         string // the name of a new board, the bundle's board name when empty
+}
+
+// ImportResult is what importing a bundle created. The ID maps go from the IDs in the
+// bundle to the IDs of the imported items.
+type ImportResult struct {
+	Whiteboard *db.Whiteboard `json:"whiteboard"`
+	Created    bool           `json:"created"` // whether the bundle became a new board
+	Strokes    []db.Stroke    `json:"strokes"`
+	Elements   []db.Element   `json:"elements"`
+	Groups     []db.Group     `json:"groups"`
+	StrokeIDs  map[int]int    `json:"strokeIDs"`
+	ElementIDs map[int]int    `json:"elementIDs"`
+}
+
+// ExportBundle writes a whiteboard as a bundle archive: a zip with a manifest, the board
+// with its canvas, layers and groups, every stroke and element on any layer, and the blobs
+// of its images read from store. Undo history, versions and votes stay behind.
+func ExportBundle(whiteboardID int, w io.Writer, store blob.Store, now time.Time) error {
+	board, err := db.GetWhiteboardById(whiteboardID)
+	if err != nil {
+		return err
+	}
+	strokes, err := db.GetAllStrokes(whiteboardID)
+	if err != nil {
+		return err
+	}
+	elements, err := db.GetAllElements(whiteboardID)
+	if err != nil {
+		return err
+	}
+	bundle := BundleBoard{Name: board.Name, CreatedAt: board.CreatedAt, UpdatedAt: board.UpdatedAt}
+	if bundle.Canvas, err = db.GetCanvasSettings(whiteboardID); err != nil {
+		return err
+	}
+	if bundle.Layers, err = db.GetLayersByWhiteboardID(whiteboardID); err != nil {
+		return err
+	}
+	if bundle.Groups, err = db.GetGroupsByWhiteboardID(whiteboardID); err != nil {
+		return err
+	}
+
+	manifest := BundleManifest{Format: BundleFormat, SchemaVersion: BundleSchemaVersion, ExportedAt: now.UTC(),
+		WhiteboardID: whiteboardID, StrokeCount: len(strokes), ElementCount: len(elements), Blobs: []db.Blob{}}
+	var hashes []string
+	for _, e := range elements {
+		if e.Type == db.ElementImage && e.Image != nil && !slices.Contains(hashes, e.Image.BlobHash) {
+			hashes = append(hashes, e.Image.BlobHash)
+		}
+	}
+	slices.Sort(hashes)
+	for _, hash := range hashes {
+		b, err := db.GetBlobByHash(hash)
+		if err != nil {
+			return fmt.Errorf("blob %s: %w", hash, err)
+		}
+		manifest.Blobs = append(manifest.Blobs, *b)
+	}
+
+	archive := zip.NewWriter(w)
+	for _, file := range []struct {
+		name    string
+		content any
+	}{{bundleManifestFile, manifest}, {bundleBoardFile, bundle}, {bundleStrokesFile, strokes}, {bundleElementsFile, elements}} {
+		content, err := json.MarshalIndent(file.content, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeBundleFile(archive, file.name, now, bytes.NewReader(content)); err != nil {
+			return err
+		}
+	}
+	for _, b := range manifest.Blobs {
+		if store == nil {
+			return errors.New("no blob store is configured")
+		}
+		content, err := store.Open(b.Hash)
+		if err != nil {
+			return fmt.Errorf("blob %s: %w", b.Hash, err)
+		}
+		err = writeBundleFile(archive, bundleBlobDir+b.Hash, now, content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	log.Printf("Exported whiteboard ID %d as a bundle with %d strokes, %d elements and %d blobs\n",
+		whiteboardID, len(strokes), len(elements), len(manifest.Blobs))
+	return nil
+}
+
+func writeBundleFile(archive *zip.Writer, name string, modified time.Time, content io.Reader) error {
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, content)
+	return err
+}
+
+// bundleContent is everything read from a bundle archive
+type bundleContent struct {
+	manifest BundleManifest
+	board    BundleBoard
+	strokes  []db.Stroke
+	elements []db.Element
+	blobs    map[string]*zip.File // by hash, checked but not read into memory
+}
+
+// ImportBundle reads a bundle archive of the given size and adds its content as a new board,
+// or merges it into an existing one. The user may do so before the archive is read, and
+// everything in the bundle is checked before anything is written: its size, format and schema
+// version, the geometry of every item against the canvas it lands on, and the hash of every
+// blob. Items and groups get new IDs, connectors stay bound to the same elements, and the
+// importing user owns everything imported. When merging, layers are matched by name and
+// layers the board doesn't have are added on top, in the same transaction as the content.
+func ImportBundle(r io.ReaderAt, size int64, store blob.Store, options ImportOptions) (ImportResult, error) {
+	result := ImportResult{StrokeIDs: map[int]int{}, ElementIDs: map[int]int{}}
+
+	// The canvas the content must fit: the bundle's own for a new board
+	var canvas Canvas
+	var err error
+	if options.WhiteboardID == 0 {
+		if _, err := db.GetUserRole(options.UserID); err != nil {
+			return result, fmt.Errorf("user %d: %w", options.UserID, err)
+		}
+	} else {
+		if err := requireEditor(options.UserID); err != nil {
+			return result, err
+		}
+		if result.Whiteboard, err = db.GetWhiteboardById(options.WhiteboardID); err != nil {
+			return result, err
+		}
+		if canvas, err = GetCanvas(options.WhiteboardID); err != nil {
+			return result, err
+		}
+	}
+
+	bundle, err := readBundle(r, size)
+	if err != nil {
+		return result, err
+	}
+	if len(bundle.blobs) > 0 && store == nil {
+		return result, errors.New("no blob store is configured")
+	}
+	if options.WhiteboardID == 0 {
+		canvas = withDefaults(bundle.board.Canvas)
+		if err := canvas.validate(); err != nil {
+			return result, invalidf("bundle canvas: %v", err)
+		}
+	}
+	if err := checkBundleContent(bundle, canvas); err != nil {
+		return result, err
+	}
+
+	if options.WhiteboardID == 0 {
+		now := time.Now()
+		board := &db.Whiteboard{Name: cmp.Or(strings.TrimSpace(options.Name), bundle.board.Name, "Untitled"),
+			OwnerID: options.UserID, CreatedAt: now, UpdatedAt: now}
+		if err := db.InsertWhiteboard(board); err != nil {
+			return result, err
+		}
+		result.Whiteboard, result.Created = board, true
+		if err := db.UpdateCanvasSettings(board.ID, canvas.CanvasSettings); err != nil {
+			removeImportedBoard(board.ID)
+			return result, err
+		}
+	}
+	whiteboardID := result.Whiteboard.ID
+
+	if err := importContent(bundle, store, options.UserID, &result); err != nil {
+		if result.Created {
+			removeImportedBoard(whiteboardID)
+		}
+		return result, err
+	}
+
+	IndexStrokes(whiteboardID, result.Strokes...)
+	IndexElements(whiteboardID, result.Elements...)
+	RefreshContentBounds(whiteboardID)
+	content := ContentIDs{StrokeIDs: idsOfStrokes(result.Strokes), ElementIDs: idsOfElements(result.Elements)}
+	if len(result.Groups) > 0 {
+		if result.Groups, err = recreatedGroups(whiteboardID, content); err != nil {
+			return result, err
+		}
+	}
+	if result.Groups == nil {
+		result.Groups = []db.Group{}
+	}
+
+	if !result.Created {
+		RecordAdd(whiteboardID, options.UserID, content)
+		Broadcast(Event{Type: EventBundleImported, WhiteboardID: whiteboardID, UserID: options.UserID,
+			Strokes: result.Strokes, Elements: result.Elements, Groups: result.Groups})
+	}
+	log.Printf("User %d imported a bundle of whiteboard ID %d into whiteboard ID %d: %d strokes, %d elements and %d groups\n",
+		options.UserID, bundle.manifest.WhiteboardID, whiteboardID, len(result.Strokes), len(result.Elements), len(result.Groups))
+	return result, nil
+}
+
+// readBundle reads and decodes the files of a bundle archive, checking its format and version,
+// its size and the blobs it lists. Blobs are streamed through their checks, not kept.
+func readBundle(r io.ReaderAt, size int64) (*bundleContent, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, invalidf("the bundle is not a zip archive: %v", err)
+	}
+	files := map[string]*zip.File{}
+	var declared uint64
+	for _, f := range archive.File {
+		files[f.Name] = f
+		declared += f.UncompressedSize64
+	}
+	// The sizes in the archive are only claims; the reads below hold the files to them as well
+	if declared > maxBundleUncompressedSize {
+		return nil, invalidf("the bundle is larger than %d bytes uncompressed", maxBundleUncompressedSize)
+	}
+	budget := int64(maxBundleUncompressedSize)
+
+	bundle := &bundleContent{blobs: map[string]*zip.File{}}
+	if err := readBundleJSON(files, bundleManifestFile, &bundle.manifest, &budget); err != nil {
+		return nil, err
+	}
+	m := bundle.manifest
+	if m.Format != BundleFormat {
+		return nil, invalidf("the archive is not a board bundle")
+	}
+	if m.SchemaVersion < 1 || m.SchemaVersion > BundleSchemaVersion {
+		return nil, invalidf("bundle schema version %d is not supported, this server reads versions 1 to %d",
+			m.SchemaVersion, BundleSchemaVersion)
+	}
+	if len(m.Blobs) > maxBundleBlobs {
+		return nil, invalidf("the bundle holds %d blobs, at most %d can be imported", len(m.Blobs), maxBundleBlobs)
+	}
+	for _, file := range []struct {
+		name   string
+		target any
+	}{{bundleBoardFile, &bundle.board}, {bundleStrokesFile, &bundle.strokes}, {bundleElementsFile, &bundle.elements}} {
+		if err := readBundleJSON(files, file.name, file.target, &budget); err != nil {
+			return nil, err
+		}
+	}
+	if len(bundle.strokes) != m.StrokeCount || len(bundle.elements) != m.ElementCount {
+		return nil, invalidf("the bundle holds %d strokes and %d elements, its manifest lists %d and %d",
+			len(bundle.strokes), len(bundle.elements), m.StrokeCount, m.ElementCount)
+	}
+
+	for i, b := range m.Blobs {
+		f, ok := files[bundleBlobDir+b.Hash]
+		if !ok {
+			return nil, invalidf("blob %s is missing from the bundle", b.Hash)
+		}
+		content, err := openBundleBlob(f, b.Hash, min(maxBundleBlobSize, budget))
+		if err != nil {
+			return nil, err
+		}
+		config, format, err := image.DecodeConfig(content)
+		if err == nil {
+			_, err = io.Copy(io.Discard, content)
+		}
+		content.Close()
+		if err != nil {
+			if errors.Is(err, ErrInvalid) {
+				return nil, err
+			}
+			return nil, invalidf("blob %s is not an image: %v", b.Hash, err)
+		}
+		budget -= content.size
+		bundle.manifest.Blobs[i] = db.Blob{Hash: b.Hash, MimeType: "image/" + format, Size: content.size, Width: config.Width, Height: config.Height}
+		bundle.blobs[b.Hash] = f
+	}
+	return bundle, nil
+}
+
+func readBundleJSON(files map[string]*zip.File, name string, target any, budget *int64) error {
+	f, ok := files[name]
+	if !ok {
+		return invalidf("the bundle has no %s", name)
+	}
+	content, err := readBundleFile(f, min(maxBundleJSONSize, *budget))
+	if err != nil {
+		return err
+	}
+	*budget -= int64(len(content))
+	if err := json.Unmarshal(content, target); err != nil {
+		return invalidf("%s: %v", name, err)
+	}
+	return nil
+}
+
+// readBundleFile reads a file of the archive, failing when it is larger than limit
+func readBundleFile(f *zip.File, limit int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, invalidf("%s: %v", f.Name, err)
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, invalidf("%s: %v", f.Name, err)
+	}
+	if int64(len(content)) > limit {
+		return nil, invalidf("%s is larger than %d bytes", f.Name, limit)
+	}
+	return content, nil
+}
+
+// bundleBlob streams a blob out of a bundle archive. Reading it fails once it grows larger
+// than its limit, and at its end when its content doesn't match its hash.
+type bundleBlob struct {
+	io.ReadCloser
+	name  string
+	key   string
+	sum   hash.Hash
+	size  int64
+	limit int64
+}
+
+func openBundleBlob(f *zip.File, key string, limit int64) (*bundleBlob, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, invalidf("%s: %v", f.Name, err)
+	}
+	return &bundleBlob{ReadCloser: rc, name: f.Name, key: key, sum: sha256.New(), limit: limit}, nil
+}
+
+func (b *bundleBlob) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.sum.Write(p[:n])
+	b.size += int64(n)
+	if b.size > b.limit {
+		return n, invalidf("%s is larger than %d bytes", b.name, b.limit)
+	}
+	if err == io.EOF && hex.EncodeToString(b.sum.Sum(nil)) != b.key {
+		return n, invalidf("blob %s doesn't match its hash", b.key)
+	}
+	return n, err
+}
+
+// checkBundleContent validates the items of a bundle and the images among them as if they
+// were drawn on a board with the given canvas, normalizing them and setting their bounds.
+// Items and groups are named by ID within the bundle, so each ID may appear once per kind.
+func checkBundleContent(bundle *bundleContent, canvas Canvas) error {
+	for _, kind := range []struct {
+		name string
+		ids  []int
+	}{
+		{db.ItemStroke, idsOfStrokes(bundle.strokes)},
+		{db.ItemElement, idsOfElements(bundle.elements)},
+		{db.ItemGroup, idsOfGroups(bundle.board.Groups)},
+	} {
+		seen := map[int]bool{}
+		for _, id := range kind.ids {
+			if seen[id] {
+				return invalidf("the bundle holds %s %d more than once", kind.name, id)
+			}
+			seen[id] = true
+		}
+	}
+
+	for i := range bundle.strokes {
+		s := &bundle.strokes[i]
+		if err := geometry.ValidatePath(s.Path); err != nil {
+			return invalidf("stroke %d: %v", s.ID, err)
+		}
+		if err := style.NormalizeStroke(s); err != nil {
+			return invalidf("stroke %d: %v", s.ID, err)
+		}
+		bounds, err := geometry.PointsBounds(s.Path)
+		if err != nil {
+			return invalidf("stroke %d: %v", s.ID, err)
+		}
+		s.MinX, s.MaxX, s.MinY, s.MaxY = bounds.MinX, bounds.MaxX, bounds.MinY, bounds.MaxY
+		if err := canvas.checkStroke(s); err != nil {
+			return fmt.Errorf("stroke %d: %w", s.ID, err)
+		}
+	}
+
+	for i := range bundle.elements {
+		e := &bundle.elements[i]
+		if e.Type == db.ElementImage && e.Image != nil {
+			j := slices.IndexFunc(bundle.manifest.Blobs, func(b db.Blob) bool { return b.Hash == e.Image.BlobHash })
+			if j < 0 {
+				return invalidf("element %d shows blob %s, which the bundle doesn't hold", e.ID, e.Image.BlobHash)
+			}
+			b := bundle.manifest.Blobs[j]
+			e.Image = &db.ImageProps{BlobHash: b.Hash, MimeType: b.MimeType, NaturalWidth: b.Width, NaturalHeight: b.Height}
+		}
+		if e.Type == db.ElementSticky {
+			if err := PrepareSticky(e); err != nil {
+				return fmt.Errorf("element %d: %w", e.ID, err)
+			}
+		}
+		if err := geometry.ValidateElement(e); err != nil {
+			return invalidf("element %d: %v", e.ID, err)
+		}
+		geometry.SyncElementBox(e)
+		geometry.MeasureTextElement(e)
+		bounds, err := geometry.ElementBounds(e)
+		if err != nil {
+			return invalidf("element %d: %v", e.ID, err)
+		}
+		e.MinX, e.MaxX, e.MinY, e.MaxY = bounds.MinX, bounds.MaxX, bounds.MinY, bounds.MaxY
+		if err := canvas.checkElement(e); err != nil {
+			return fmt.Errorf("element %d: %w", e.ID, err)
+		}
+	}
+	return nil
+}
+
+// importContent streams the blobs of a checked bundle to the store, then merges its layers,
+// strokes, elements and groups into the board of the result in one transaction, filling in
+// the result's items, groups and ID maps. A blob stored for an import that fails is left in
+// the store, like an upload nothing uses.
+func importContent(bundle *bundleContent, store blob.Store, userID int, result *ImportResult) error {
+	whiteboardID := result.Whiteboard.ID
+	now := time.Now()
+	imported := &db.ContentImport{Groups: bundle.board.Groups}
+	for _, b := range bundle.manifest.Blobs {
+		content, err := openBundleBlob(bundle.blobs[b.Hash], b.Hash, b.Size)
+		if err != nil {
+			return err
+		}
+		err = store.Put(b.Hash, content)
+		content.Close()
+		if err != nil {
+			return fmt.Errorf("storing blob %s: %w", b.Hash, err)
+		}
+		b.CreatedAt = now
+		imported.Blobs = append(imported.Blobs, b)
+	}
+
+	var err error
+	if imported.Layers, err = importLayers(whiteboardID, bundle.board.Layers, result.Created); err != nil {
+		return err
+	}
+	imported.Strokes = slices.Clone(bundle.strokes)
+	for i := range imported.Strokes {
+		s := &imported.Strokes[i]
+		s.WhiteboardID, s.OwnerID, s.Deleted = whiteboardID, userID, false
+		if s.CreatedAt.IsZero() {
+			s.CreatedAt = now
+		}
+	}
+	// Connectors go last, so the elements they are bound to have their new IDs
+	imported.Elements = slices.Clone(bundle.elements)
+	connectorsLast(imported.Elements)
+	bundleIDs := make([]int, len(imported.Elements))
+	for i := range imported.Elements {
+		e := &imported.Elements[i]
+		bundleIDs[i] = e.ID
+		e.WhiteboardID, e.OwnerID, e.Deleted = whiteboardID, userID, false
+		if e.CreatedAt.IsZero() {
+			e.CreatedAt = now
+		}
+	}
+
+	// The layers without an ID are added on top of the board's
+	var added []*db.Layer
+	for i := range imported.Layers {
+		if imported.Layers[i].Layer.ID == 0 {
+			added = append(added, &imported.Layers[i].Layer)
+		}
+	}
+	layersCreated := func(change db.Change) ([]db.LogEntry, error) {
+		var entries []db.LogEntry
+		for _, layer := range added {
+			logged, err := LogOperation(whiteboardID, userID, LogLayerCreated, layer)(change)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, logged...)
+		}
+		return entries, nil
+	}
+	err = db.ImportContent(whiteboardID, imported, rebindConnectors(imported.Elements, bundleIDs, result.ElementIDs),
+		layersCreated, LogStrokes(whiteboardID, userID, LogStrokeAdded), LogElements(whiteboardID, userID, LogElementAdded),
+		LogGroupsCreated(whiteboardID, userID),
+		LogOperation(whiteboardID, userID, LogBundleImported, map[string]any{
+			"sourceWhiteboardID": bundle.manifest.WhiteboardID, "schemaVersion": bundle.manifest.SchemaVersion,
+			"strokeCount": len(imported.Strokes), "elementCount": len(imported.Elements)}))
+	if err != nil {
+		return err
+	}
+	result.Strokes, result.Elements, result.Groups = imported.Strokes, imported.Elements, imported.Groups
+	result.StrokeIDs, result.ElementIDs = imported.StrokeIDs, imported.ElementIDs
+	return nil
+}
+
+// importLayers maps the layers of a bundle to layers of the board, bottom to top. A new
+// board takes the bundle's first layer as its default layer; otherwise layers are matched by
+// name, and the others are added on top. Content can't be imported into a locked layer, which
+// db.ImportContent checks in its transaction.
+func importLayers(whiteboardID int, layers []db.Layer, created bool) ([]db.ImportedLayer, error) {
+	existing, err := db.GetLayersByWhiteboardID(whiteboardID)
+	if err != nil {
+		return nil, err
+	}
+	var imported []db.ImportedLayer
+	slices.SortStableFunc(layers, func(a, b db.Layer) int { return cmp.Compare(a.ZIndex, b.ZIndex) })
+	for i, layer := range layers {
+		if created && i == 0 && len(existing) > 0 {
+			first := existing[0]
+			first.Name, first.Visible, first.Locked = cmp.Or(layer.Name, first.Name), layer.Visible, layer.Locked
+			imported = append(imported, db.ImportedLayer{SourceID: layer.ID, Layer: first, Replace: true})
+			continue
+		}
+		if !created {
+			if i := slices.IndexFunc(existing, func(l db.Layer) bool { return l.Name == layer.Name }); i >= 0 {
+				imported = append(imported, db.ImportedLayer{SourceID: layer.ID, Layer: existing[i]})
+				continue
+			}
+		}
+		added := db.Layer{Name: cmp.Or(layer.Name, db.DefaultLayerName), Visible: layer.Visible, Locked: layer.Locked,
+			CreatedAt: time.Now()}
+		imported = append(imported, db.ImportedLayer{SourceID: layer.ID, Layer: added})
+	}
+	return imported, nil
+}
+
+// removeImportedBoard deletes a board created by an import that failed halfway
+func removeImportedBoard(whiteboardID int) {
+	if err := db.DeleteWhiteboard(whiteboardID); err != nil {
+		log.Printf("Error removing whiteboard ID %d after a failed import: %v", whiteboardID, err)
+	}
+}
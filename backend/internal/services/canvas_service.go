@@ -0,0 +1,344 @@
+package services
+
+import (
+	"log"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"sketchive/internal/style"
+	"sync"
+	"time"
+)
+
+// Canvas defaults and the limits board settings can't go beyond
+const (
+	// DefaultMaxExtent is how far from the origin content of an infinite canvas may reach
+	DefaultMaxExtent = 1e7
+	// DefaultMaxPointsPerStroke caps the points of a single stroke
+	DefaultMaxPointsPerStroke = 10000
+	// maxPointsPerStroke is the highest per-board limit on points per stroke
+	maxPointsPerStroke = 100000
+)
+
+// Canvas event types
+const (
+	EventCanvasUpdated        = "canvas_updated"
+	EventContentBoundsUpdated = "content_bounds_updated"
+)
+
+// Canvas is the effective canvas of a board: its stored settings with the defaults filled in
+type Canvas struct {
+	db.CanvasSettings
+}
+
+// Area returns the box content must stay inside
+func (c Canvas) Area() geometry.Rect {
+	if c.Mode == db.CanvasBounded && c.Bounds != nil {
+		return geometry.Rect{MinX: c.Bounds.MinX, MaxX: c.Bounds.MaxX, MinY: c.Bounds.MinY, MaxY: c.Bounds.MaxY}
+	}
+	return geometry.Rect{MinX: -c.MaxExtent, MaxX: c.MaxExtent, MinY: -c.MaxExtent, MaxY: c.MaxExtent}
+}
+
+// checkRect fails with ErrInvalid when the bounding box r of an item leaves the canvas
+func (c Canvas) checkRect(what string, r geometry.Rect) error {
+	if c.Area().Contains(r) {
+		return nil
+	}
+	if c.Mode == db.CanvasBounded {
+		area := c.Area()
+		return invalidf("%s extends beyond the canvas, which spans x %g..%g and y %g..%g",
+			what, area.MinX, area.MaxX, area.MinY, area.MaxY)
+	}
+	return invalidf("%s extends beyond the canvas, coordinates must be within ±%g", what, c.MaxExtent)
+}
+
+// withDefaults fills in the server defaults for settings left zero
+func withDefaults(settings db.CanvasSettings) Canvas {
+	if settings.Mode == "" {
+		settings.Mode = db.CanvasInfinite
+	}
+	if settings.MaxExtent == 0 {
+		settings.MaxExtent = DefaultMaxExtent
+	}
+	if settings.MaxPointsPerStroke == 0 {
+		settings.MaxPointsPerStroke = DefaultMaxPointsPerStroke
+	}
+	if settings.MaxStrokeWidth == 0 {
+		settings.MaxStrokeWidth = style.MaxStrokeWidth
+	}
+	return Canvas{settings}
+}
+
+// validate checks settings from a client against the hard limits
+func (c Canvas) validate() error {
+	switch c.Mode {
+	case db.CanvasInfinite:
+		if c.Bounds != nil {
+			return invalidf("an infinite canvas has no bounds")
+		}
+	case db.CanvasBounded:
+		if c.Bounds == nil {
+			return invalidf("a bounded canvas needs bounds")
+		}
+		b := c.Bounds
+		for _, v := range []struct {
+			name  string
+			value float64
+		}{{"minX", b.MinX}, {"maxX", b.MaxX}, {"minY", b.MinY}, {"maxY", b.MaxY}} {
+			if err := geometry.CheckCoordinate("canvas "+v.name, v.value); err != nil {
+				return invalidf("%v", err)
+			}
+		}
+		if b.MinX >= b.MaxX || b.MinY >= b.MaxY {
+			return invalidf("canvas bounds need min less than max")
+		}
+	default:
+		return invalidf("unknown canvas mode %q", c.Mode)
+	}
+	if !(c.MaxExtent > 0 && c.MaxExtent <= geometry.MaxCoordinate) {
+		return invalidf("maxExtent must be between 0 and %g", float64(geometry.MaxCoordinate))
+	}
+	if c.MaxPointsPerStroke < 1 || c.MaxPointsPerStroke > maxPointsPerStroke {
+		return invalidf("maxPointsPerStroke must be between 1 and %d", maxPointsPerStroke)
+	}
+	if !(c.MaxStrokeWidth > 0 && c.MaxStrokeWidth <= style.MaxStrokeWidth) {
+		return invalidf("maxStrokeWidth must be between 0 and %d", style.MaxStrokeWidth)
+	}
+	return nil
+}
+
+// GetCanvas returns the canvas settings of a board with the defaults filled in
+func GetCanvas(whiteboardID int) (Canvas, error) {
+	settings, err := db.GetCanvasSettings(whiteboardID)
+	if err != nil {
+		return Canvas{}, err
+	}
+	return withDefaults(settings), nil
+}
+
+// UpdateCanvas replaces the canvas settings of a board. Settings that would leave
+// existing content outside the canvas are rejected.
+func UpdateCanvas(whiteboardID, userID int, settings db.CanvasSettings) (Canvas, error) {
+	canvas := withDefaults(settings)
+	if err := canvas.validate(); err != nil {
+		return canvas, err
+	}
+
+	content, err := ContentBounds(whiteboardID)
+	if err != nil {
+		return canvas, err
+	}
+	if content != nil {
+		r := geometry.Rect{MinX: content.MinX, MaxX: content.MaxX, MinY: content.MinY, MaxY: content.MaxY}
+		if err := canvas.checkRect("existing content", r); err != nil {
+			return canvas, err
+		}
+	}
+
+	err = db.UpdateCanvasSettings(whiteboardID, canvas.CanvasSettings, LogOperation(whiteboardID, userID, LogCanvasUpdated, canvas.CanvasSettings))
+	if err != nil {
+		return canvas, err
+	}
+	log.Printf("User %d changed the canvas of whiteboard ID %d to %+v\n", userID, whiteboardID, canvas.CanvasSettings)
+	Broadcast(Event{Type: EventCanvasUpdated, WhiteboardID: whiteboardID, UserID: userID, Canvas: &canvas})
+	return canvas, nil
+}
+
+// ValidateStroke checks a new stroke against the limits of its board: the number of points,
+// the stroke width, and that the stroke stays on the canvas. The stroke's bounding box
+// must already be set.
+func ValidateStroke(stroke *db.Stroke) error {
+	canvas, err := GetCanvas(stroke.WhiteboardID)
+	if err != nil {
+		return err
+	}
+	return canvas.checkStroke(stroke)
+}
+
+// ValidateElementPlacement checks that an element stays on the canvas of its board.
+// The element's bounding box must already be set.
+func ValidateElementPlacement(e *db.Element) error {
+	canvas, err := GetCanvas(e.WhiteboardID)
+	if err != nil {
+		return err
+	}
+	return canvas.checkElement(e)
+}
+
+func (c Canvas) checkStroke(stroke *db.Stroke) error {
+	if len(stroke.Path) > c.MaxPointsPerStroke {
+		return invalidf("a stroke can't have more than %d points on this board", c.MaxPointsPerStroke)
+	}
+	if stroke.Width > c.MaxStrokeWidth {
+		return invalidf("stroke width can't be more than %g on this board", c.MaxStrokeWidth)
+	}
+	return c.checkRect("stroke", StrokeBounds(stroke))
+}
+
+func (c Canvas) checkElement(e *db.Element) error {
+	if e.Style.StrokeWidth > c.MaxStrokeWidth {
+		return invalidf("stroke width can't be more than %g on this board", c.MaxStrokeWidth)
+	}
+	return c.checkRect(e.Type, ElementBounds(e))
+}
+
+// contentBoundsDelay is how long changes to a board's content are collected before its
+// bounds are stored and broadcast, so a burst of edits writes and broadcasts once
+const contentBoundsDelay = 200 * time.Millisecond
+
+// boardBounds tracks the content bounds of one board. mu guards the fields; write is held
+// while new bounds are computed, stored and broadcast, so a board's updates go out in order
+// without blocking other boards or the changes that schedule them.
+type boardBounds struct {
+	mu        sync.Mutex
+	stored    *db.Bounds // the bounds last stored, when known
+	known     bool
+	added     []geometry.Rect // boxes of content added since, for boards without a loaded index
+	full      bool            // content was removed or replaced, so the bounds may have shrunk
+	scheduled bool
+	write     sync.Mutex
+}
+
+// contentBounds holds the bounds state of the boards changed since the server started
+var contentBounds = struct {
+	sync.Mutex
+	byBoard map[int]*boardBounds
+}{byBoard: map[int]*boardBounds{}}
+
+func boundsOf(whiteboardID int) *boardBounds {
+	contentBounds.Lock()
+	defer contentBounds.Unlock()
+	b := contentBounds.byBoard[whiteboardID]
+	if b == nil {
+		b = &boardBounds{}
+		contentBounds.byBoard[whiteboardID] = b
+	}
+	return b
+}
+
+// ContentBounds returns the box around everything on a board, nil for an empty board
+func ContentBounds(whiteboardID int) (*db.Bounds, error) {
+	r, ok, err := boardIndex.Bounds(whiteboardID)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &db.Bounds{MinX: r.MinX, MaxX: r.MaxX, MinY: r.MinY, MaxY: r.MaxY}, nil
+}
+
+// RefreshContentBounds schedules storing the content bounds of a board after content was
+// removed or replaced. Clients are told when they changed.
+func RefreshContentBounds(whiteboardID int) {
+	scheduleContentBounds(whiteboardID, nil, true)
+}
+
+// contentAdded schedules growing the content bounds of a board around added or moved content
+func contentAdded(whiteboardID int, added []geometry.Rect) {
+	scheduleContentBounds(whiteboardID, added, false)
+}
+
+func scheduleContentBounds(whiteboardID int, added []geometry.Rect, full bool) {
+	b := boundsOf(whiteboardID)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.full = b.full || full
+	if !b.full {
+		b.added = append(b.added, added...)
+	}
+	if !b.scheduled {
+		b.scheduled = true
+		time.AfterFunc(contentBoundsDelay, func() { storeContentBounds(whiteboardID, b) })
+	}
+}
+
+// storeContentBounds computes the bounds of a board from the changes collected, stores them
+// and broadcasts them when they changed. Errors are logged since the changes already happened.
+func storeContentBounds(whiteboardID int, b *boardBounds) {
+	b.write.Lock()
+	defer b.write.Unlock()
+
+	b.mu.Lock()
+	previous, known, added, full := b.stored, b.known, b.added, b.full
+	b.added, b.full, b.scheduled = nil, false, false
+	b.mu.Unlock()
+
+	bounds, err := collectedBounds(whiteboardID, previous, known, added, full)
+	if err != nil {
+		log.Printf("Error computing content bounds of whiteboard ID %d: %v", whiteboardID, err)
+		b.forget()
+		return
+	}
+	if known && sameBounds(previous, bounds) {
+		return
+	}
+	if err := db.UpdateContentBounds(whiteboardID, bounds); err != nil {
+		log.Printf("Error storing content bounds of whiteboard ID %d: %v", whiteboardID, err)
+		b.forget()
+		return
+	}
+	b.mu.Lock()
+	b.stored, b.known = bounds, true
+	b.mu.Unlock()
+	Broadcast(Event{Type: EventContentBoundsUpdated, WhiteboardID: whiteboardID, ContentBounds: bounds})
+}
+
+// collectedBounds returns the new content bounds of a board. A loaded index knows them.
+// Otherwise added or moved content only grows the previous bounds, which saves loading the
+// index for a board nobody looks at; the box still covers everything and is exact again once
+// the index is loaded. Removed content needs the index.
+func collectedBounds(whiteboardID int, previous *db.Bounds, known bool, added []geometry.Rect, full bool) (*db.Bounds, error) {
+	if r, ok, loaded := boardIndex.LoadedBounds(whiteboardID); loaded {
+		if !ok {
+			return nil, nil
+		}
+		return &db.Bounds{MinX: r.MinX, MaxX: r.MaxX, MinY: r.MinY, MaxY: r.MaxY}, nil
+	}
+	if full {
+		return ContentBounds(whiteboardID)
+	}
+	if !known {
+		board, err := db.GetWhiteboardById(whiteboardID)
+		if err != nil {
+			return nil, err
+		}
+		previous = board.ContentBounds
+	}
+	var r geometry.Rect
+	ok := previous != nil
+	if ok {
+		r = geometry.Rect{MinX: previous.MinX, MaxX: previous.MaxX, MinY: previous.MinY, MaxY: previous.MaxY}
+	}
+	for _, a := range added {
+		if ok {
+			r = r.Union(a)
+		} else {
+			r, ok = a, true
+		}
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &db.Bounds{MinX: r.MinX, MaxX: r.MaxX, MinY: r.MinY, MaxY: r.MaxY}, nil
+}
+
+// forget makes the next update recompute the bounds from the index and store them
+func (b *boardBounds) forget() {
+	b.mu.Lock()
+	b.known, b.stored, b.full = false, nil, true
+	b.mu.Unlock()
+}
+
+// forgetContentBounds drops what is known about the bounds of a board, e.g. once it's cleared or deleted
+func forgetContentBounds(whiteboardID int) {
+	contentBounds.Lock()
+	b := contentBounds.byBoard[whiteboardID]
+	contentBounds.Unlock()
+	if b != nil {
+		b.forget()
+	}
+}
+
+func sameBounds(a, b *db.Bounds) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
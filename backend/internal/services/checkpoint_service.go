@@ -0,0 +1,298 @@
+package services
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sketchive/internal/db"
+	"slices"
+	"sync"
+	"time"
+)
+
+// CheckpointFormat is the encoding of the checkpoints this server writes: gzip-compressed
+// JSON of checkpointState. Checkpoints in any other format are rebuilt when a board loads.
+const CheckpointFormat = 1
+
+// Checkpointing defaults: a board is checkpointed after this many logged operations, or
+// after the interval when it has changed less than that since its last checkpoint
+const (
+	DefaultCheckpointOps      = 200
+	DefaultCheckpointInterval = 30 * time.Second
+)
+
+type checkpointState struct {
+	Strokes  []db.Stroke  `json:"strokes"`
+	Elements []db.Element `json:"elements"`
+}
+
+// checkpointer counts the operations logged on each board since its last checkpoint.
+// Boards reaching the threshold are sent to due; the rest wait for the next tick.
+var checkpointer = struct {
+	sync.Mutex
+	ops     int
+	pending map[int]int
+	due     chan int
+}{pending: map[int]int{}}
+
+// StartCheckpointer checkpoints changed boards in the background, each after ops logged
+// operations or once per interval, whichever comes first
+func StartCheckpointer(ops int, interval time.Duration) {
+	checkpointer.Lock()
+	checkpointer.ops = ops
+	checkpointer.due = make(chan int, 64)
+	due := checkpointer.due
+	checkpointer.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case whiteboardID := <-due:
+				if err := CheckpointBoard(whiteboardID); err != nil {
+					log.Printf("Error checkpointing whiteboard ID %d: %v\n", whiteboardID, err)
+				}
+			case <-ticker.C:
+				checkpointer.Lock()
+				boards := make([]int, 0, len(checkpointer.pending))
+				for whiteboardID := range checkpointer.pending {
+					boards = append(boards, whiteboardID)
+				}
+				checkpointer.Unlock()
+				for _, whiteboardID := range boards {
+					if err := CheckpointBoard(whiteboardID); err != nil {
+						log.Printf("Error checkpointing whiteboard ID %d: %v\n", whiteboardID, err)
+					}
+				}
+			}
+		}
+	}()
+	log.Printf("Checkpointing boards every %d operations or %s\n", ops, interval)
+}
+
+// noteLogged counts the operations a committed write logged towards the next checkpoint of its board
+func noteLogged(whiteboardID, entries int) {
+	checkpointer.Lock()
+	defer checkpointer.Unlock()
+	if checkpointer.due == nil {
+		return
+	}
+	before := checkpointer.pending[whiteboardID]
+	checkpointer.pending[whiteboardID] += entries
+	if before < checkpointer.ops && checkpointer.pending[whiteboardID] >= checkpointer.ops {
+		select {
+		case checkpointer.due <- whiteboardID:
+		default:
+			// The worker is busy; the board is picked up on the next tick
+		}
+	}
+}
+
+// CheckpointBoard brings the checkpoint of a board up to the end of its operation log
+func CheckpointBoard(whiteboardID int) error {
+	checkpointer.Lock()
+	delete(checkpointer.pending, whiteboardID)
+	checkpointer.Unlock()
+
+	checkpoint, state, err := loadCheckpoint(whiteboardID)
+	if errors.Is(err, db.ErrWhiteboardNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if checkpoint != nil && checkpoint.Seq == state.Seq {
+		return nil
+	}
+	return saveCheckpoint(whiteboardID, state)
+}
+
+// LoadBoardContent returns the visible strokes and elements of a board, in drawing order:
+// by layer, then by creation. It starts from the board's checkpoint and replays the log
+// entries after it, so only the changes since the last checkpoint are read one by one.
+// The log is written in the same transaction as the tables, so every write to the strokes
+// and elements tables must go through a journaled db function to show up here.
+func LoadBoardContent(whiteboardID int) ([]db.Stroke, []db.Element, error) {
+	_, state, err := loadCheckpoint(whiteboardID)
+	if err != nil {
+		return nil, nil, err
+	}
+	layers, err := loadLayers(whiteboardID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	strokes := []db.Stroke{}
+	for _, stroke := range state.Strokes {
+		if layers.visible(stroke.LayerID) {
+			strokes = append(strokes, stroke)
+		}
+	}
+	slices.SortFunc(strokes, func(a, b db.Stroke) int {
+		return cmp.Or(cmp.Compare(layers[a.LayerID].ZIndex, layers[b.LayerID].ZIndex),
+			a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	elements := []db.Element{}
+	for _, element := range state.Elements {
+		if layers.visible(element.LayerID) {
+			elements = append(elements, element)
+		}
+	}
+	slices.SortFunc(elements, func(a, b db.Element) int {
+		return cmp.Or(cmp.Compare(layers[a.LayerID].ZIndex, layers[b.LayerID].ZIndex),
+			a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return strokes, elements, nil
+}
+
+// loadCheckpoint returns the stored checkpoint of a board and the board's current state:
+// the checkpoint with the log entries after it applied. A missing, corrupt or outdated
+// checkpoint is rebuilt from the strokes and elements tables, and nil is returned for it.
+func loadCheckpoint(whiteboardID int) (*db.Checkpoint, *BoardState, error) {
+	checkpoint, err := db.GetCheckpoint(whiteboardID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if checkpoint != nil {
+		state, err := replayCheckpoint(checkpoint)
+		if err == nil {
+			return checkpoint, state, nil
+		}
+		log.Printf("Rebuilding the checkpoint of whiteboard ID %d: %v\n", whiteboardID, err)
+	}
+
+	state, err := rebuildState(whiteboardID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := saveCheckpoint(whiteboardID, state); err != nil {
+		return nil, nil, err
+	}
+	return nil, state, nil
+}
+
+// replayCheckpoint validates and decodes a checkpoint, then applies the log entries after it
+func replayCheckpoint(checkpoint *db.Checkpoint) (*BoardState, error) {
+	if checkpoint.Format != CheckpointFormat {
+		return nil, fmt.Errorf("checkpoint format %d, expected %d", checkpoint.Format, CheckpointFormat)
+	}
+	sum := sha256.Sum256(checkpoint.State)
+	if hex.EncodeToString(sum[:]) != checkpoint.Checksum {
+		return nil, errors.New("checkpoint checksum mismatch")
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(checkpoint.State))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing checkpoint: %w", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing checkpoint: %w", err)
+	}
+	var content checkpointState
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, fmt.Errorf("decoding checkpoint: %w", err)
+	}
+	if len(content.Strokes) != checkpoint.StrokeCount || len(content.Elements) != checkpoint.ElementCount {
+		return nil, fmt.Errorf("checkpoint holds %d strokes and %d elements, expected %d and %d",
+			len(content.Strokes), len(content.Elements), checkpoint.StrokeCount, checkpoint.ElementCount)
+	}
+
+	state := NewBoardState()
+	state.Seq = checkpoint.Seq
+	for _, stroke := range content.Strokes {
+		state.Strokes[stroke.ID] = stroke
+	}
+	for _, element := range content.Elements {
+		state.Elements[element.ID] = element
+	}
+
+	entries, err := db.GetLogEntries(checkpoint.WhiteboardID, checkpoint.Seq, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 && entries[0].Seq != checkpoint.Seq+1 {
+		return nil, fmt.Errorf("checkpoint ends at log entry %d, but the next entry is %d", checkpoint.Seq, entries[0].Seq)
+	}
+	if len(entries) == 0 {
+		// A checkpoint past the end of the log was written for another log, or by mistake
+		last, err := db.LastLogSeq(checkpoint.WhiteboardID)
+		if err != nil {
+			return nil, err
+		}
+		if last != checkpoint.Seq {
+			return nil, fmt.Errorf("checkpoint ends at log entry %d, but the log ends at %d", checkpoint.Seq, last)
+		}
+	}
+	for _, entry := range entries {
+		if err := state.Apply(entry); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// rebuildState reads the content of a board from the strokes and elements tables, along with
+// the log position, in one consistent read. Every content write appends to the log in its own
+// transaction, so the tables at that position are exactly what replaying the log up to it gives.
+func rebuildState(whiteboardID int) (*BoardState, error) {
+	if _, err := db.GetWhiteboardById(whiteboardID); err != nil {
+		return nil, err
+	}
+	state := NewBoardState()
+	seq, content, err := db.ReadBoardContent(whiteboardID)
+	if err != nil {
+		return nil, err
+	}
+	state.Seq = seq
+	strokes, elements := content.Strokes, content.Elements
+	for _, stroke := range strokes {
+		state.Strokes[stroke.ID] = stroke
+	}
+	for _, element := range elements {
+		state.Elements[element.ID] = element
+	}
+	return state, nil
+}
+
+// saveCheckpoint encodes a board state and stores it as the board's checkpoint
+func saveCheckpoint(whiteboardID int, state *BoardState) error {
+	content := checkpointState{Strokes: state.StrokeList(), Elements: state.ElementList()}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return fmt.Errorf("encoding checkpoint: %w", err)
+	}
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(data); err != nil {
+		return fmt.Errorf("compressing checkpoint: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("compressing checkpoint: %w", err)
+	}
+	sum := sha256.Sum256(compressed.Bytes())
+
+	checkpoint := db.Checkpoint{
+		WhiteboardID: whiteboardID,
+		Format:       CheckpointFormat,
+		Seq:          state.Seq,
+		StrokeCount:  len(content.Strokes),
+		ElementCount: len(content.Elements),
+		Checksum:     hex.EncodeToString(sum[:]),
+		State:        compressed.Bytes(),
+		CreatedAt:    time.Now(),
+	}
+	if err := db.SaveCheckpoint(&checkpoint); err != nil {
+		return err
+	}
+	log.Printf("Checkpointed whiteboard ID %d at log entry %d (%d strokes, %d elements, %d bytes)\n",
+		whiteboardID, checkpoint.Seq, checkpoint.StrokeCount, checkpoint.ElementCount, len(checkpoint.State))
+	return nil
+}
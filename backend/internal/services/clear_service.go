@@ -0,0 +1,110 @@
+package services
+
+import (
+	"log"
+	"sketchive/internal/db"
+	"sync/atomic"
+	"time"
+)
+
+// Clear event types
+const (
+	EventBoardCleared = "board_cleared"
+	EventClearUndone  = "clear_undone"
+)
+
+// DefaultClearUndoWindow is how long a clear can be undone unless SetClearUndoWindow changes it
+const DefaultClearUndoWindow = 10 * time.Minute
+
+var clearUndoWindow atomic.Int64
+
+func init() {
+	clearUndoWindow.Store(int64(DefaultClearUndoWindow))
+}
+
+// SetClearUndoWindow sets how long after a clear anyone with edit rights can undo it
+func SetClearUndoWindow(window time.Duration) {
+	clearUndoWindow.Store(int64(window))
+}
+
+// ClearUndoResult is what undoing a clear brought back
+type ClearUndoResult struct {
+	Clear    db.Clear     `json:"clear"`
+	Strokes  []db.Stroke  `json:"strokes"`
+	Elements []db.Element `json:"elements"`
+	Groups   []db.Group   `json:"groups"`
+}
+
+// ClearBoard removes everything from a whiteboard and records the clear. The strokes and
+// elements are only tombstoned, so anyone with edit rights can undo the clear within the
+// undo window, and the user who cleared can also undo it from their history. The board is
+// saved as a version first.
+func ClearBoard(whiteboardID, userID int) (db.Clear, error) {
+	now := time.Now()
+	cleared := db.Clear{WhiteboardID: whiteboardID, ClearedBy: userID, CreatedAt: now,
+		UndoUntil: now.Add(time.Duration(clearUndoWindow.Load()))}
+
+	version, err := AutoSnapshot(whiteboardID, userID, "Before clear")
+	if err != nil {
+		return cleared, err
+	}
+	if version != nil {
+		cleared.VersionID = version.ID
+	}
+	logCleared := func(change db.Change) ([]db.LogEntry, error) {
+		payload := LogPayload{StrokeIDs: change.StrokeIDs, ElementIDs: change.ElementIDs}
+		return LogOperation(whiteboardID, userID, LogBoardCleared, payload)(change)
+	}
+	strokeIDs, elementIDs, err := db.ClearWhiteboardContent(&cleared, logCleared)
+	if err != nil {
+		return cleared, err
+	}
+	ForgetBoard(whiteboardID)
+	RefreshContentBounds(whiteboardID)
+
+	record(&Operation{Kind: OperationClear, WhiteboardID: whiteboardID, UserID: userID,
+		StrokeIDs: strokeIDs, ElementIDs: elementIDs, clearID: cleared.ID})
+	Broadcast(Event{Type: EventBoardCleared, WhiteboardID: whiteboardID, UserID: userID, Clear: &cleared})
+	return cleared, nil
+}
+
+// UndoClear brings back what a clear removed, along with its groups, and tells the connected
+// clients. Any admin or editor can undo a clear until its undo window closes.
+func UndoClear(whiteboardID, clearID, userID int) (ClearUndoResult, error) {
+	var result ClearUndoResult
+	if err := requireEditor(userID); err != nil {
+		return result, err
+	}
+	cleared, strokes, elements, err := db.UndoClear(whiteboardID, clearID, userID, time.Now(),
+		LogStrokes(whiteboardID, userID, LogStrokesRestored), LogElements(whiteboardID, userID, LogElementsRestored),
+		LogOperation(whiteboardID, userID, LogClearUndone, map[string]int{"clearID": clearID}), LogGroupsCreated(whiteboardID, userID))
+	if err != nil {
+		return result, err
+	}
+	result.Clear, result.Strokes, result.Elements = *cleared, strokes, elements
+
+	IndexStrokes(whiteboardID, result.Strokes...)
+	IndexElements(whiteboardID, result.Elements...)
+	RefreshContentBounds(whiteboardID)
+	restored := ContentIDs{StrokeIDs: idsOfStrokes(strokes), ElementIDs: idsOfElements(elements)}
+	if result.Groups, err = recreatedGroups(whiteboardID, restored); err != nil {
+		return result, err
+	}
+	if result.Groups == nil {
+		result.Groups = []db.Group{}
+	}
+
+	log.Printf("User %d undid clear %d of whiteboard ID %d, bringing back %d strokes and %d elements\n",
+		userID, clearID, whiteboardID, len(result.Strokes), len(result.Elements))
+	Broadcast(Event{Type: EventClearUndone, WhiteboardID: whiteboardID, UserID: userID, Clear: &result.Clear,
+		Strokes: result.Strokes, Elements: result.Elements, Groups: result.Groups})
+	return result, nil
+}
+
+// GetClears lists the clears of a whiteboard, newest first
+func GetClears(whiteboardID int) ([]db.Clear, error) {
+	if _, err := db.GetWhiteboardById(whiteboardID); err != nil {
+		return nil, err
+	}
+	return db.GetClears(whiteboardID)
+}
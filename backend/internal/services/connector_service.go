@@ -0,0 +1,246 @@
+package services
+
+import (
+	"cmp"
+	"fmt"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"slices"
+)
+
+// EventConnectorsUpdated is broadcast when connectors follow elements changed through the
+// REST API, which has no event of its own for them
+const EventConnectorsUpdated = "connectors_updated"
+
+// elementsByID is an element lookup for routing connectors
+type elementsByID map[int]*db.Element
+
+func (m elementsByID) lookup(id int) (*db.Element, bool) {
+	e, ok := m[id]
+	return e, ok
+}
+
+// loadBoundElements returns the current state of the elements the connectors are bound to
+func loadBoundElements(whiteboardID int, connectors []db.Element) (elementsByID, error) {
+	var ids []int
+	for i := range connectors {
+		ids = append(ids, geometry.BoundElementIDs(&connectors[i])...)
+	}
+	elements, err := db.GetElementsByIDs(whiteboardID, uniqueIDs(ids))
+	if err != nil {
+		return nil, err
+	}
+	byID := make(elementsByID, len(elements))
+	for i := range elements {
+		byID[elements[i].ID] = &elements[i]
+	}
+	return byID, nil
+}
+
+// routeConnector recomputes a connector from the elements in lookup. Ends bound to
+// elements that no longer exist are detached where they are instead of failing.
+func routeConnector(e *db.Element, lookup geometry.ElementLookup) error {
+	missing := map[int]bool{}
+	for _, id := range geometry.BoundElementIDs(e) {
+		if _, ok := lookup(id); !ok {
+			missing[id] = true
+		}
+	}
+	geometry.DetachConnector(e, missing)
+	return geometry.RouteConnector(e, lookup)
+}
+
+// PrepareConnector checks the elements a new or edited connector is bound to and computes its points
+func PrepareConnector(e *db.Element) error {
+	bound, err := loadBoundElements(e.WhiteboardID, []db.Element{*e})
+	if err != nil {
+		return err
+	}
+	for _, id := range geometry.BoundElementIDs(e) {
+		target, ok := bound[id]
+		if !ok {
+			return invalidf("element %d doesn't exist on whiteboard %d", id, e.WhiteboardID)
+		}
+		if target.Type == db.ElementConnector {
+			return invalidf("connectors can't be bound to other connectors")
+		}
+	}
+	if err := geometry.RouteConnector(e, bound.lookup); err != nil {
+		return invalidf("%v", err)
+	}
+	return nil
+}
+
+// connectorPlan orders a transform so connectors are routed after the elements they are bound to
+// have moved, and pulls in the connectors bound to moved elements that aren't transformed themselves
+type connectorPlan struct {
+	elementIDs []int
+	following  map[int]bool
+	moved      elementsByID
+	current    elementsByID
+}
+
+func planConnectors(whiteboardID int, elementIDs []int) (*connectorPlan, error) {
+	plan := &connectorPlan{following: map[int]bool{}, moved: elementsByID{}}
+	connectors, err := db.GetElementsByType(whiteboardID, db.ElementConnector)
+	if err != nil {
+		return nil, err
+	}
+	if len(connectors) == 0 {
+		plan.elementIDs = elementIDs
+		return plan, nil
+	}
+
+	selected := make(map[int]bool, len(elementIDs))
+	for _, id := range elementIDs {
+		selected[id] = true
+	}
+	isConnector := make(map[int]bool, len(connectors))
+	var affected []db.Element
+	for i := range connectors {
+		c := &connectors[i]
+		isConnector[c.ID] = true
+		if selected[c.ID] || geometry.IsBoundTo(c, selected) {
+			affected = append(affected, *c)
+		}
+	}
+
+	var inSelection, following []int
+	for _, id := range elementIDs {
+		if isConnector[id] {
+			inSelection = append(inSelection, id)
+		} else {
+			plan.elementIDs = append(plan.elementIDs, id)
+		}
+	}
+	for _, c := range affected {
+		if !selected[c.ID] {
+			following = append(following, c.ID)
+			plan.following[c.ID] = true
+		}
+	}
+	plan.elementIDs = append(append(plan.elementIDs, inSelection...), following...)
+
+	plan.current, err = loadBoundElements(whiteboardID, affected)
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// lookup prefers the transformed state of an element over the stored one
+func (p *connectorPlan) lookup(id int) (*db.Element, bool) {
+	if e, ok := p.moved[id]; ok {
+		return e, true
+	}
+	return p.current.lookup(id)
+}
+
+func (p *connectorPlan) route(e *db.Element) error {
+	if len(geometry.BoundElementIDs(e)) == 0 {
+		return nil
+	}
+	return routeConnector(e, p.lookup)
+}
+
+// Following returns the db.Follow that reroutes the connectors bound to the elements, in the
+// transaction that changes or deletes them. Ends bound to deleted elements are detached where
+// they are. Connectors among the elements are left as the write made them.
+func Following(elementIDs ...int) db.Follow {
+	changed := make(map[int]bool, len(elementIDs))
+	for _, id := range elementIDs {
+		changed[id] = true
+	}
+	return func(connectors []db.Element, lookup func(ids []int) ([]db.Element, error)) ([]db.Element, error) {
+		var bound []db.Element
+		var ids []int
+		for i := range connectors {
+			if !changed[connectors[i].ID] && geometry.IsBoundTo(&connectors[i], changed) {
+				bound = append(bound, connectors[i])
+				ids = append(ids, geometry.BoundElementIDs(&connectors[i])...)
+			}
+		}
+		if len(bound) == 0 {
+			return nil, nil
+		}
+		elements, err := lookup(uniqueIDs(ids))
+		if err != nil {
+			return nil, err
+		}
+		current := make(elementsByID, len(elements))
+		for i := range elements {
+			current[elements[i].ID] = &elements[i]
+		}
+		for i := range bound {
+			if err := routeConnector(&bound[i], current.lookup); err != nil {
+				return nil, fmt.Errorf("connector %d: %w", bound[i].ID, err)
+			}
+		}
+		return bound, nil
+	}
+}
+
+// connectorsFollowed indexes the connectors that followed a write to their elements and
+// updates the groups they belong to
+func connectorsFollowed(whiteboardID, userID int, connectors []db.Element) error {
+	if len(connectors) == 0 {
+		return nil
+	}
+	IndexElements(whiteboardID, connectors...)
+	_, err := contentChanged(whiteboardID, userID, db.ItemElement, idsOfElements(connectors), false)
+	return err
+}
+
+// ConnectorsUpdated broadcasts the connectors that followed a write with no event of its own
+func ConnectorsUpdated(whiteboardID, userID int, connectors []db.Element) {
+	if len(connectors) > 0 {
+		Broadcast(Event{Type: EventConnectorsUpdated, WhiteboardID: whiteboardID, UserID: userID, Elements: connectors})
+	}
+}
+
+// connectorsLast orders elements so connectors come after the elements they may be bound to
+func connectorsLast(elements []db.Element) {
+	slices.SortStableFunc(elements, func(a, b db.Element) int {
+		return cmp.Compare(connectorOrder(a.Type), connectorOrder(b.Type))
+	})
+}
+
+func connectorOrder(elementType string) int {
+	if elementType == db.ElementConnector {
+		return 1
+	}
+	return 0
+}
+
+// rebindConnectors returns the prepare function of db.ImportContent or db.RestoreVersion that
+// binds the connectors among elements to the new IDs of their elements. elements must be ordered
+// with connectors last and oldIDs holds their IDs before the write; newIDs gets the old ID to
+// new ID of every element as it is written. Ends bound to elements that aren't written are
+// detached where they are.
+func rebindConnectors(elements []db.Element, oldIDs []int, newIDs map[int]int) func(*db.Element) error {
+	// Elements are written in order, so when one is prepared every element before it has its new ID
+	written := 0
+	return func(e *db.Element) error {
+		for ; written < len(elements) && &elements[written] != e; written++ {
+			newIDs[oldIDs[written]] = elements[written].ID
+		}
+		if e.Type != db.ElementConnector || e.Connector == nil {
+			return nil
+		}
+		for i, end := range []*db.ConnectorEnd{&e.Connector.Start, &e.Connector.End} {
+			if end.ElementID == 0 {
+				continue
+			}
+			if id, ok := newIDs[end.ElementID]; ok {
+				end.ElementID = id
+				continue
+			}
+			point := e.Points[0]
+			if i == 1 {
+				point = e.Points[len(e.Points)-1]
+			}
+			*end = db.ConnectorEnd{Point: &point}
+		}
+		return nil
+	}
+}
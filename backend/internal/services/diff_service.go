@@ -0,0 +1,357 @@
+package services
+
+import (
+	"encoding/json"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"sketchive/internal/render"
+	"slices"
+	"time"
+)
+
+// Colors of the visual diff
+const (
+	DiffAddedColor     = "#2e7d32"
+	DiffRemovedColor   = "#c62828"
+	DiffModifiedColor  = "#1565c0"
+	DiffUnchangedColor = "#9e9e9e"
+)
+
+// diffPadding is the margin around the content of a visual diff
+const diffPadding = 20
+
+// Aspects of an item that a modification can touch
+const (
+	ChangeGeometry = "geometry"
+	ChangeStyle    = "style"
+	ChangeLayer    = "layer"
+	ChangeContent  = "content"
+)
+
+// DiffPoint names one side of a diff: a version, a point in time, or the board as it
+// is now when neither is set
+type DiffPoint struct {
+	VersionID int        `json:"versionID,omitempty"`
+	AsOf      *time.Time `json:"asOf,omitempty"`
+	Seq       int        `json:"seq"` // the operation log entry this side corresponds to
+}
+
+// DiffItem is a stroke or element that differs between the two sides
+type DiffItem struct {
+	Kind     string   `json:"kind"` // stroke or element
+	ID       int      `json:"id"`
+	Type     string   `json:"type"`              // "stroke" or the element type
+	AuthorID int      `json:"authorID"`          // who made the change, 0 when unknown
+	Changes  []string `json:"changes,omitempty"` // what a modification touched
+	Before   any      `json:"before,omitempty"`  // the item on the "from" side
+	After    any      `json:"after,omitempty"`   // the item on the "to" side
+}
+
+// AuthorDiff counts the changes of one author
+type AuthorDiff struct {
+	AuthorID int `json:"authorID"`
+	Added    int `json:"added"`
+	Removed  int `json:"removed"`
+	Modified int `json:"modified"`
+}
+
+// DiffSummary counts the changes of a diff, in total and per author
+type DiffSummary struct {
+	Added     int          `json:"added"`
+	Removed   int          `json:"removed"`
+	Modified  int          `json:"modified"`
+	Unchanged int          `json:"unchanged"`
+	Authors   []AuthorDiff `json:"authors"`
+}
+
+// BoardDiff lists what changed on a whiteboard between two points
+type BoardDiff struct {
+	WhiteboardID int         `json:"whiteboardID"`
+	From         DiffPoint   `json:"from"`
+	To           DiffPoint   `json:"to"`
+	Added        []DiffItem  `json:"added"`
+	Removed      []DiffItem  `json:"removed"`
+	Modified     []DiffItem  `json:"modified"`
+	Summary      DiffSummary `json:"summary"`
+
+	unchanged []DiffItem
+}
+
+// boardSide is the content of one side of a diff
+type boardSide struct {
+	strokes  map[int]db.Stroke
+	elements map[int]db.Element
+}
+
+// DiffBoard compares the content of a whiteboard at two points
+func DiffBoard(whiteboardID int, from, to DiffPoint) (*BoardDiff, error) {
+	diff := &BoardDiff{WhiteboardID: whiteboardID, Added: []DiffItem{}, Removed: []DiffItem{}, Modified: []DiffItem{}}
+	if _, err := db.GetWhiteboardById(whiteboardID); err != nil {
+		return nil, err
+	}
+	before, err := loadSide(whiteboardID, &from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := loadSide(whiteboardID, &to)
+	if err != nil {
+		return nil, err
+	}
+	diff.From, diff.To = from, to
+
+	authors, err := changeAuthors(whiteboardID, min(from.Seq, to.Seq), max(from.Seq, to.Seq))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range unionKeys(before.strokes, after.strokes) {
+		b, inBefore := before.strokes[id]
+		a, inAfter := after.strokes[id]
+		item := DiffItem{Kind: db.ItemStroke, ID: id, Type: db.ItemStroke, AuthorID: authors[db.GroupMember{Kind: db.ItemStroke, ID: id}]}
+		switch {
+		case !inBefore:
+			item.After = &a
+			if item.AuthorID == 0 {
+				item.AuthorID = a.OwnerID
+			}
+			diff.Added = append(diff.Added, item)
+		case !inAfter:
+			item.Before = &b
+			diff.Removed = append(diff.Removed, item)
+		default:
+			item.Before, item.After = &b, &a
+			if item.Changes = strokeChanges(&b, &a); len(item.Changes) > 0 {
+				diff.Modified = append(diff.Modified, item)
+			} else {
+				diff.unchanged = append(diff.unchanged, item)
+			}
+		}
+	}
+	for _, id := range unionKeys(before.elements, after.elements) {
+		b, inBefore := before.elements[id]
+		a, inAfter := after.elements[id]
+		item := DiffItem{Kind: db.ItemElement, ID: id, AuthorID: authors[db.GroupMember{Kind: db.ItemElement, ID: id}]}
+		switch {
+		case !inBefore:
+			item.Type, item.After = a.Type, &a
+			if item.AuthorID == 0 {
+				item.AuthorID = a.OwnerID
+			}
+			diff.Added = append(diff.Added, item)
+		case !inAfter:
+			item.Type, item.Before = b.Type, &b
+			diff.Removed = append(diff.Removed, item)
+		default:
+			item.Type, item.Before, item.After = a.Type, &b, &a
+			if item.Changes = elementChanges(&b, &a); len(item.Changes) > 0 {
+				diff.Modified = append(diff.Modified, item)
+			} else {
+				diff.unchanged = append(diff.unchanged, item)
+			}
+		}
+	}
+
+	diff.Summary = summarize(diff)
+	return diff, nil
+}
+
+// loadSide loads the content of one side of a diff and fills in its log position
+func loadSide(whiteboardID int, point *DiffPoint) (boardSide, error) {
+	side := boardSide{strokes: map[int]db.Stroke{}, elements: map[int]db.Element{}}
+	var strokes []db.Stroke
+	var elements []db.Element
+	switch {
+	case point.VersionID != 0:
+		version, err := db.GetVersion(whiteboardID, point.VersionID)
+		if err != nil {
+			return side, err
+		}
+		point.Seq = version.Seq
+		strokes, elements = version.Content.Strokes, version.Content.Elements
+	case point.AsOf != nil:
+		content, err := ContentAt(whiteboardID, *point.AsOf)
+		if err != nil {
+			return side, err
+		}
+		point.Seq = content.Seq
+		strokes, elements = content.Strokes, content.Elements
+	default:
+		seq, content, err := db.ReadBoardContent(whiteboardID)
+		if err != nil {
+			return side, err
+		}
+		point.Seq = seq
+		strokes, elements = content.Strokes, content.Elements
+	}
+	for _, s := range strokes {
+		side.strokes[s.ID] = s
+	}
+	for _, e := range elements {
+		side.elements[e.ID] = e
+	}
+	return side, nil
+}
+
+// changeAuthors returns, for every item touched by the log entries after fromSeq up to toSeq,
+// the actor of the last entry that touched it
+func changeAuthors(whiteboardID, fromSeq, toSeq int) (map[db.GroupMember]int, error) {
+	authors := map[db.GroupMember]int{}
+	if toSeq <= fromSeq {
+		return authors, nil
+	}
+	entries, err := db.GetLogEntries(whiteboardID, fromSeq, toSeq-fromSeq)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Type == db.LogBaseline || entry.ActorID == 0 || !isContentEntry(entry.Type) {
+			continue
+		}
+		var payload LogPayload
+		if err := json.Unmarshal(entry.Payload, &payload); err != nil {
+			return nil, err
+		}
+		for _, s := range payload.Strokes {
+			authors[db.GroupMember{Kind: db.ItemStroke, ID: s.ID}] = entry.ActorID
+		}
+		for _, e := range payload.Elements {
+			authors[db.GroupMember{Kind: db.ItemElement, ID: e.ID}] = entry.ActorID
+		}
+		for _, id := range payload.StrokeIDs {
+			authors[db.GroupMember{Kind: db.ItemStroke, ID: id}] = entry.ActorID
+		}
+		for _, id := range payload.ElementIDs {
+			authors[db.GroupMember{Kind: db.ItemElement, ID: id}] = entry.ActorID
+		}
+	}
+	return authors, nil
+}
+
+func unionKeys[T any](a, b map[int]T) []int {
+	keys := make([]int, 0, len(a)+len(b))
+	for id := range a {
+		keys = append(keys, id)
+	}
+	for id := range b {
+		if _, ok := a[id]; !ok {
+			keys = append(keys, id)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func strokeChanges(before, after *db.Stroke) []string {
+	var changes []string
+	if !sameJSON(before.Path, after.Path) || StrokeBounds(before) != StrokeBounds(after) {
+		changes = append(changes, ChangeGeometry)
+	}
+	if before.Color != after.Color || before.Width != after.Width || !sameJSON(before.StrokeStyle, after.StrokeStyle) {
+		changes = append(changes, ChangeStyle)
+	}
+	if before.LayerID != after.LayerID {
+		changes = append(changes, ChangeLayer)
+	}
+	return changes
+}
+
+func elementChanges(before, after *db.Element) []string {
+	var changes []string
+	if before.X != after.X || before.Y != after.Y || before.Width != after.Width || before.Height != after.Height ||
+		before.Rotation != after.Rotation || !sameJSON(before.Points, after.Points) || ElementBounds(before) != ElementBounds(after) {
+		changes = append(changes, ChangeGeometry)
+	}
+	if before.Style != after.Style || before.StartArrowhead != after.StartArrowhead || before.EndArrowhead != after.EndArrowhead {
+		changes = append(changes, ChangeStyle)
+	}
+	if before.LayerID != after.LayerID {
+		changes = append(changes, ChangeLayer)
+	}
+	if !sameJSON(before.Text, after.Text) || !sameJSON(before.Image, after.Image) || !sameJSON(before.Connector, after.Connector) {
+		changes = append(changes, ChangeContent)
+	}
+	return changes
+}
+
+func summarize(diff *BoardDiff) DiffSummary {
+	summary := DiffSummary{Added: len(diff.Added), Removed: len(diff.Removed), Modified: len(diff.Modified),
+		Unchanged: len(diff.unchanged), Authors: []AuthorDiff{}}
+	byAuthor := map[int]*AuthorDiff{}
+	count := func(items []DiffItem, field func(*AuthorDiff) *int) {
+		for _, item := range items {
+			a, ok := byAuthor[item.AuthorID]
+			if !ok {
+				a = &AuthorDiff{AuthorID: item.AuthorID}
+				byAuthor[item.AuthorID] = a
+			}
+			*field(a)++
+		}
+	}
+	count(diff.Added, func(a *AuthorDiff) *int { return &a.Added })
+	count(diff.Removed, func(a *AuthorDiff) *int { return &a.Removed })
+	count(diff.Modified, func(a *AuthorDiff) *int { return &a.Modified })
+	for _, a := range byAuthor {
+		summary.Authors = append(summary.Authors, *a)
+	}
+	slices.SortFunc(summary.Authors, func(a, b AuthorDiff) int { return a.AuthorID - b.AuthorID })
+	return summary
+}
+
+// RenderSVG draws the diff: unchanged content faded, removals in red, additions in green,
+// and modified items in blue over a faded outline of where they were before
+func (diff *BoardDiff) RenderSVG() []byte {
+	var view geometry.Rect
+	first := true
+	extend := func(item any) {
+		var r geometry.Rect
+		switch v := item.(type) {
+		case *db.Stroke:
+			r = StrokeBounds(v)
+		case *db.Element:
+			r = ElementBounds(v)
+		default:
+			return
+		}
+		if first {
+			view, first = r, false
+		} else {
+			view = view.Union(r)
+		}
+	}
+	for _, items := range [][]DiffItem{diff.unchanged, diff.Removed, diff.Modified, diff.Added} {
+		for _, item := range items {
+			extend(item.Before)
+			extend(item.After)
+		}
+	}
+	if first {
+		view = geometry.Rect{MaxX: 1, MaxY: 1}
+	}
+	view = view.Expand(diffPadding)
+
+	svg := render.NewSVG(view, view.MaxX-view.MinX, view.MaxY-view.MinY, "#ffffff")
+	draw := func(item any, h *render.Highlight) {
+		switch v := item.(type) {
+		case *db.Stroke:
+			svg.Stroke(v, h)
+		case *db.Element:
+			svg.Element(v, h)
+		}
+	}
+	layer := func(id string, items []DiffItem, side func(DiffItem) any, h *render.Highlight) {
+		svg.BeginGroup(id)
+		for _, item := range items {
+			draw(side(item), h)
+		}
+		svg.EndGroup()
+	}
+	before := func(item DiffItem) any { return item.Before }
+	after := func(item DiffItem) any { return item.After }
+
+	layer("unchanged", diff.unchanged, after, &render.Highlight{Color: DiffUnchangedColor, Opacity: 0.4})
+	layer("modified-before", diff.Modified, before, &render.Highlight{Color: DiffModifiedColor, Opacity: 0.3, Dashed: true})
+	layer("removed", diff.Removed, before, &render.Highlight{Color: DiffRemovedColor, Dashed: true})
+	layer("modified", diff.Modified, after, &render.Highlight{Color: DiffModifiedColor})
+	layer("added", diff.Added, after, &render.Highlight{Color: DiffAddedColor})
+	return svg.Bytes()
+}
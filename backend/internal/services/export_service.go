@@ -0,0 +1,474 @@
+package services
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"sketchive/internal/render"
+	"sketchive/internal/style"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Crop modes of an export
+const (
+	CropContent = "content" // the box around everything visible
+	CropCanvas  = "canvas"  // the drawable area of a bounded canvas, the content on an infinite one
+)
+
+// maxExportPadding caps the margin added around an exported area
+const maxExportPadding = 10000
+
+// Limits on the size of raster exports
+const (
+	maxExportSide   = 16384    // pixels on either side
+	maxExportPixels = 40 << 20 // pixels in all
+)
+
+// ExportOptions says which part of a board an export shows and how
+type ExportOptions struct {
+	Region     *geometry.Rect // the board area to export; nil uses Crop
+	Crop       string         // CropContent or CropCanvas, CropCanvas when empty
+	Background string         // a CSS color filling the export, empty or "transparent" for none
+	Padding    float64        // board units added around the area on every side
+}
+
+// ExportItem is a stroke or an element, in drawing order
+type ExportItem struct {
+	Stroke  *db.Stroke
+	Element *db.Element
+	bounds  geometry.Rect
+}
+
+// BoardExport is the visible content of a board inside the exported area, ready to render
+type BoardExport struct {
+	Whiteboard *db.Whiteboard
+	View       geometry.Rect // the exported board area, padding included
+	Background string        // normalized color, empty for none
+	Items      []ExportItem
+	// content is every visible item of the board, for frame pages reaching past View
+	content []ExportItem
+}
+
+// PrepareExport collects what an export of a board shows: the visible strokes and elements
+// overlapping the exported area, bottom layer first and oldest first within a layer
+func PrepareExport(whiteboardID int, options ExportOptions) (*BoardExport, error) {
+	board, err := db.GetWhiteboardById(whiteboardID)
+	if err != nil {
+		return nil, err
+	}
+	strokes, elements, err := LoadBoardContent(whiteboardID)
+	if err != nil {
+		return nil, err
+	}
+	layers, err := loadLayers(whiteboardID)
+	if err != nil {
+		return nil, err
+	}
+	canvas, err := GetCanvas(whiteboardID)
+	if err != nil {
+		return nil, err
+	}
+	return newExport(board, strokes, elements, layers, canvas, options)
+}
+
+// newExport lays out the export of a board's visible strokes and elements
+func newExport(board *db.Whiteboard, strokes []db.Stroke, elements []db.Element, layers boardLayers,
+	canvas Canvas, options ExportOptions) (*BoardExport, error) {
+	export := &BoardExport{Whiteboard: board}
+	var err error
+
+	if background := strings.TrimSpace(options.Background); background != "" && !strings.EqualFold(background, "transparent") {
+		if export.Background, err = style.NormalizeColor(background); err != nil {
+			return nil, invalidf("background: %v", err)
+		}
+	}
+	if !(options.Padding >= 0 && options.Padding <= maxExportPadding) {
+		return nil, invalidf("padding must be between 0 and %d", maxExportPadding)
+	}
+
+	// Strokes and elements are drawn together, by layer and then by creation
+	type ordered struct {
+		item    ExportItem
+		bounds  geometry.Rect
+		layerZ  int
+		created int64
+		id      int
+	}
+	var all []ordered
+	for i := range strokes {
+		s := &strokes[i]
+		all = append(all, ordered{ExportItem{Stroke: s}, StrokeBounds(s), layers[s.LayerID].ZIndex, s.CreatedAt.UnixNano(), s.ID})
+	}
+	for i := range elements {
+		e := &elements[i]
+		all = append(all, ordered{ExportItem{Element: e}, ElementBounds(e), layers[e.LayerID].ZIndex, e.CreatedAt.UnixNano(), e.ID})
+	}
+	slices.SortStableFunc(all, func(a, b ordered) int {
+		return cmp.Or(cmp.Compare(a.layerZ, b.layerZ), cmp.Compare(a.created, b.created),
+			cmp.Compare(kindOrder(a.item), kindOrder(b.item)), cmp.Compare(a.id, b.id))
+	})
+
+	var view geometry.Rect
+	switch {
+	case options.Region != nil:
+		view = *options.Region
+		if view.MaxX <= view.MinX || view.MaxY <= view.MinY {
+			return nil, invalidf("the export region needs a positive width and height")
+		}
+	case options.Crop == CropContent || options.Crop == CropCanvas || options.Crop == "":
+		if options.Crop != CropContent && canvas.Mode == db.CanvasBounded && canvas.Bounds != nil {
+			view = canvas.Area()
+			break
+		}
+		for i, o := range all {
+			if i == 0 {
+				view = o.bounds
+			} else {
+				view = view.Union(o.bounds)
+			}
+		}
+		// An empty board exports as a blank square
+		if len(all) == 0 {
+			view = geometry.Rect{MaxX: 1, MaxY: 1}
+		}
+	default:
+		return nil, invalidf("crop must be %q or %q", CropContent, CropCanvas)
+	}
+	export.View = view.Expand(options.Padding)
+
+	for _, o := range all {
+		o.item.bounds = o.bounds
+		export.content = append(export.content, o.item)
+		if o.bounds.Intersects(export.View) {
+			export.Items = append(export.Items, o.item)
+		}
+	}
+	return export, nil
+}
+
+func kindOrder(item ExportItem) int {
+	if item.Stroke != nil {
+		return 0
+	}
+	return 1
+}
+
+// RenderSVG draws the export as an SVG document one board unit per pixel. imageHref, when
+// set, gives the link or data URI of each image; by default images link to the blob route.
+// The output only depends on the board content and the options.
+func (export *BoardExport) RenderSVG(imageHref func(image *db.ImageProps) string) []byte {
+	view := export.View
+	svg := render.NewSVG(view, view.MaxX-view.MinX, view.MaxY-view.MinY, export.Background)
+	if imageHref != nil {
+		svg.ImageHref = imageHref
+	}
+	for _, item := range export.Items {
+		if item.Stroke != nil {
+			svg.Stroke(item.Stroke, nil)
+		} else {
+			svg.Element(item.Element, nil)
+		}
+	}
+	return svg.Bytes()
+}
+
+// PNGOptions sets the pixel size of a PNG export. Width and Height, when either is set, fit
+// the exported area into that many pixels; giving both pads the shorter side of the area so
+// the image has exactly that size. Otherwise Scale gives the pixels per board unit, 1 when 0.
+type PNGOptions struct {
+	Scale  float64
+	Width  int
+	Height int
+}
+
+// RenderPNG draws the export as a PNG image. loadImage, when set, returns the picture of each
+// image element; the others are drawn as placeholders. The output only depends on the board
+// content and the options.
+func (export *BoardExport) RenderPNG(options PNGOptions, loadImage func(image *db.ImageProps) (image.Image, error)) ([]byte, error) {
+	view := export.View
+	viewW, viewH := view.MaxX-view.MinX, view.MaxY-view.MinY
+	var width, height int
+	switch {
+	case options.Width < 0 || options.Height < 0:
+		return nil, invalidf("width and height must be positive")
+	case options.Width > 0 && options.Height > 0:
+		width, height = options.Width, options.Height
+		// Center the area in the image by growing its shorter side
+		if scale := math.Min(float64(width)/viewW, float64(height)/viewH); float64(width)/viewW > scale {
+			grow := (float64(width)/scale - viewW) / 2
+			view.MinX, view.MaxX = view.MinX-grow, view.MaxX+grow
+		} else {
+			grow := (float64(height)/scale - viewH) / 2
+			view.MinY, view.MaxY = view.MinY-grow, view.MaxY+grow
+		}
+	case options.Width > 0:
+		width, height = options.Width, int(math.Ceil(float64(options.Width)*viewH/viewW))
+	case options.Height > 0:
+		width, height = int(math.Ceil(float64(options.Height)*viewW/viewH)), options.Height
+	default:
+		scale := options.Scale
+		if scale == 0 {
+			scale = 1
+		}
+		if !(scale > 0) || math.IsInf(scale, 0) {
+			return nil, invalidf("scale must be positive")
+		}
+		w, h := math.Ceil(viewW*scale), math.Ceil(viewH*scale)
+		if w > maxExportSide || h > maxExportSide {
+			return nil, invalidf("the image would be %.0fx%.0f pixels, more than %d on a side", w, h, maxExportSide)
+		}
+		width, height = int(w), int(h)
+	}
+	width, height = max(width, 1), max(height, 1)
+	if width > maxExportSide || height > maxExportSide {
+		return nil, invalidf("the image would be %dx%d pixels, more than %d on a side", width, height, maxExportSide)
+	}
+	if width*height > maxExportPixels {
+		return nil, invalidf("the image would be %dx%d pixels, more than %d in all", width, height, maxExportPixels)
+	}
+
+	var background *style.Color
+	if export.Background != "" {
+		c, err := style.ParseColor(export.Background)
+		if err != nil {
+			return nil, err
+		}
+		background = &c
+	}
+	raster := render.NewRaster(view, width, height, background)
+	raster.LoadImage = loadImage
+	for _, item := range export.Items {
+		if item.Stroke != nil {
+			raster.Stroke(item.Stroke)
+		} else {
+			raster.Element(item.Element)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, raster.Image()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Paging modes of a PDF export
+const (
+	PagingSingle = "single" // the exported area fitted on one page
+	PagingTiles  = "tiles"  // the exported area cut into pages at a fixed scale
+	PagingFrames = "frames" // a page for each frame in the exported area
+)
+
+// Page orientations of a PDF export
+const (
+	OrientationAuto      = "auto" // follows the shape of what a page shows
+	OrientationPortrait  = "portrait"
+	OrientationLandscape = "landscape"
+)
+
+// pageSizes are the paper sizes of PDF exports in points, portrait
+var pageSizes = map[string][2]float64{
+	"a3":      {841.89, 1190.55},
+	"a4":      {595.28, 841.89},
+	"a5":      {419.53, 595.28},
+	"letter":  {612, 792},
+	"legal":   {612, 1008},
+	"tabloid": {792, 1224},
+}
+
+// Layout of PDF export pages, in points
+const (
+	pageMargin     = 36
+	pageHeaderSize = 9
+	pageHeaderGap  = 10
+	maxPDFPages    = 500
+)
+
+// PDFOptions says how a PDF export is laid out on paper
+type PDFOptions struct {
+	PageSize    string  // one of pageSizes, a4 when empty
+	Orientation string  // OrientationAuto when empty
+	Paging      string  // PagingSingle when empty
+	Scale       float64 // points per board unit of PagingTiles, 1 when 0
+	TitlePage   bool    // start with a page naming the board and when it was exported
+}
+
+// pdfPage is what one page of a PDF export shows: the items overlapping its view
+type pdfPage struct {
+	label string
+	view  geometry.Rect
+	items []ExportItem
+}
+
+// RenderPDF draws the export as a PDF document with strokes and shapes as vector paths, on
+// one page, on tiles or on a page per frame. exportedAt is printed on the title page.
+// loadImage, when set, returns the picture of each image element; the others are drawn as
+// placeholders. The output only depends on the board content and the arguments.
+func (export *BoardExport) RenderPDF(options PDFOptions, exportedAt time.Time,
+	loadImage func(image *db.ImageProps) (image.Image, error)) ([]byte, error) {
+	size, ok := pageSizes[strings.ToLower(cmp.Or(options.PageSize, "a4"))]
+	if !ok {
+		return nil, invalidf("unknown page size %q", options.PageSize)
+	}
+	orientation := cmp.Or(options.Orientation, OrientationAuto)
+	switch orientation {
+	case OrientationAuto, OrientationPortrait, OrientationLandscape:
+	default:
+		return nil, invalidf("orientation must be %q, %q or %q", OrientationAuto, OrientationPortrait, OrientationLandscape)
+	}
+	// pageFor returns the paper size of a page showing a w by h area
+	pageFor := func(w, h float64) (float64, float64) {
+		if orientation == OrientationLandscape || orientation == OrientationAuto && w > h {
+			return size[1], size[0]
+		}
+		return size[0], size[1]
+	}
+	// contentArea is the part of a page under its header where the board is drawn
+	contentArea := func(pageW, pageH float64) (x, y, w, h float64) {
+		top := float64(pageMargin + pageHeaderSize + pageHeaderGap)
+		return pageMargin, top, pageW - 2*pageMargin, pageH - top - pageMargin
+	}
+
+	var background *style.Color
+	if export.Background != "" {
+		c, err := style.ParseColor(export.Background)
+		if err != nil {
+			return nil, err
+		}
+		background = &c
+	}
+	title := export.Whiteboard.Name
+	if title == "" {
+		title = fmt.Sprintf("Whiteboard %d", export.Whiteboard.ID)
+	}
+	doc := render.NewPDF(title, exportedAt)
+	doc.LoadImage = loadImage
+
+	var pages []pdfPage
+	view := export.View
+	switch cmp.Or(options.Paging, PagingSingle) {
+	case PagingSingle:
+		pages = []pdfPage{{view: view, items: export.Items}}
+	case PagingFrames:
+		var frames []*db.Element
+		for _, item := range export.Items {
+			if item.Element != nil && item.Element.Type == db.ElementFrame {
+				frames = append(frames, item.Element)
+			}
+		}
+		if len(frames) == 0 {
+			return nil, invalidf("the exported area has no frames")
+		}
+		if len(frames) > maxPDFPages {
+			return nil, invalidf("the export would need %d pages, more than %d", len(frames), maxPDFPages)
+		}
+		slices.SortStableFunc(frames, func(a, b *db.Element) int {
+			return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+		})
+		for i, frame := range frames {
+			label := fmt.Sprintf("Frame %d", i+1)
+			if frame.Text != nil && strings.TrimSpace(frame.Text.Content) != "" {
+				label = strings.TrimSpace(frame.Text.Content)
+			}
+			// A frame shows everything on it, also what lies outside the exported area
+			pages = append(pages, pdfPage{label: label,
+				view:  geometry.Rect{MinX: frame.X, MinY: frame.Y, MaxX: frame.X + frame.Width, MaxY: frame.Y + frame.Height},
+				items: export.content})
+		}
+	case PagingTiles:
+		scale := cmp.Or(options.Scale, 1)
+		if !(scale > 0) || math.IsInf(scale, 0) {
+			return nil, invalidf("scale must be positive")
+		}
+		_, _, areaW, areaH := contentArea(pageFor(view.MaxX-view.MinX, view.MaxY-view.MinY))
+		tileW, tileH := areaW/scale, areaH/scale
+		columns := int(math.Max(1, math.Ceil((view.MaxX-view.MinX)/tileW-1e-9)))
+		rows := int(math.Max(1, math.Ceil((view.MaxY-view.MinY)/tileH-1e-9)))
+		if float64(columns)*float64(rows) > maxPDFPages {
+			return nil, invalidf("the export would need %d by %d pages, more than %d", columns, rows, maxPDFPages)
+		}
+		for row := 0; row < rows; row++ {
+			for column := 0; column < columns; column++ {
+				tile := geometry.Rect{MinX: view.MinX + float64(column)*tileW, MinY: view.MinY + float64(row)*tileH}
+				tile.MaxX, tile.MaxY = math.Min(tile.MinX+tileW, view.MaxX), math.Min(tile.MinY+tileH, view.MaxY)
+				pages = append(pages, pdfPage{label: fmt.Sprintf("Row %d, column %d", row+1, column+1), view: tile, items: export.Items})
+			}
+		}
+	default:
+		return nil, invalidf("paging must be %q, %q or %q", PagingSingle, PagingTiles, PagingFrames)
+	}
+
+	total := len(pages)
+	if options.TitlePage {
+		total++
+		pageW, pageH := pageFor(size[0], size[1])
+		page := doc.AddPage(pageW, pageH)
+		gray := style.Color{R: 0x55, G: 0x55, B: 0x55, A: 255}
+		y := pageH / 3
+		page.Text(pageMargin, y, 28, geometry.FontSans, true, style.Black, title)
+		y += 28
+		for _, line := range []string{
+			"Exported " + exportedAt.UTC().Format("2 January 2006, 15:04 UTC"),
+			"Created " + export.Whiteboard.CreatedAt.UTC().Format("2 January 2006, 15:04 UTC"),
+			"Last updated " + export.Whiteboard.UpdatedAt.UTC().Format("2 January 2006, 15:04 UTC"),
+			fmt.Sprintf("%d pages", total),
+		} {
+			page.Text(pageMargin, y, 12, geometry.FontSans, false, gray, line)
+			y += 12 * geometry.LineHeight
+		}
+	}
+
+	for i, p := range pages {
+		viewW, viewH := p.view.MaxX-p.view.MinX, p.view.MaxY-p.view.MinY
+		var pageW, pageH float64
+		if options.Paging == PagingTiles {
+			pageW, pageH = pageFor(view.MaxX-view.MinX, view.MaxY-view.MinY)
+		} else {
+			pageW, pageH = pageFor(viewW, viewH)
+		}
+		page := doc.AddPage(pageW, pageH)
+
+		// A header with the board name and what the page shows, and the page number on the right
+		gray := style.Color{R: 0x77, G: 0x77, B: 0x77, A: 255}
+		header := title
+		if p.label != "" {
+			header += " – " + p.label
+		}
+		number := fmt.Sprintf("%d / %d", total-len(pages)+i+1, total)
+		baseline := pageMargin + pageHeaderSize*0.8
+		page.Text(pageMargin, baseline, pageHeaderSize, geometry.FontSans, false, gray, header)
+		page.Text(pageW-pageMargin-geometry.TextWidth(number, geometry.FontSans, pageHeaderSize), baseline,
+			pageHeaderSize, geometry.FontSans, false, gray, number)
+
+		x, y, areaW, areaH := contentArea(pageW, pageH)
+		scale := options.Scale
+		if options.Paging == PagingTiles {
+			scale = cmp.Or(scale, 1)
+		} else {
+			// Fit and center what the page shows
+			scale = math.Min(areaW/viewW, areaH/viewH)
+			x += (areaW - viewW*scale) / 2
+			y += (areaH - viewH*scale) / 2
+		}
+		page.BeginBoard(p.view, x, y, scale, background)
+		for _, item := range p.items {
+			if !item.bounds.Intersects(p.view) {
+				continue
+			}
+			if item.Stroke != nil {
+				page.Stroke(item.Stroke)
+			} else {
+				page.Element(item.Element)
+			}
+		}
+		page.EndBoard()
+	}
+	return doc.Bytes(), nil
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenBoard returns a board with solid, dashed, dotted and pressure strokes and a few elements
+func goldenBoard(t *testing.T) ([]db.Stroke, []db.Element, boardLayers) {
+	t.Helper()
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	layers := boardLayers{1: {ID: 1, WhiteboardID: 1, Name: "Layer 1", Visible: true}}
+
+	stroke := func(id int, width float64, color string, dash []float64, lineCap string, path ...db.Point) db.Stroke {
+		s := db.Stroke{ID: id, WhiteboardID: 1, LayerID: 1, Path: path, Color: color, Width: width,
+			StrokeStyle: db.DefaultStrokeStyle(), CreatedAt: created.Add(time.Duration(id) * time.Second)}
+		s.Dash, s.LineCap = dash, lineCap
+		bounds, err := geometry.PointsBounds(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.MinX, s.MaxX, s.MinY, s.MaxY = bounds.MinX, bounds.MaxX, bounds.MinY, bounds.MaxY
+		return s
+	}
+	strokes := []db.Stroke{
+		// A thin diagonal shows the anti-aliasing of edges off the pixel grid
+		stroke(1, 3, "#d32f2f", nil, db.CapRound, db.Point{X: 10, Y: 10}, db.Point{X: 110, Y: 70}),
+		stroke(2, 4, "#1976d2", []float64{12, 6}, db.CapButt,
+			db.Point{X: 10, Y: 90}, db.Point{X: 70, Y: 90}, db.Point{X: 110, Y: 120}),
+		// Zero length dashes with round caps are dots
+		stroke(3, 5, "#388e3c", []float64{0, 10}, db.CapRound, db.Point{X: 10, Y: 140}, db.Point{X: 110, Y: 140}),
+		stroke(4, 6, "#6a1b9a", nil, db.CapRound,
+			db.Point{X: 130, Y: 20, Pressure: 0.2}, db.Point{X: 150, Y: 60, Pressure: 0.9}, db.Point{X: 170, Y: 30, Pressure: 0.5}),
+	}
+
+	element := func(e db.Element) db.Element {
+		e.WhiteboardID, e.LayerID = 1, 1
+		e.CreatedAt = created.Add(time.Duration(10+e.ID) * time.Second)
+		geometry.SyncElementBox(&e)
+		geometry.MeasureTextElement(&e)
+		bounds, err := geometry.ElementBounds(&e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.MinX, e.MaxX, e.MinY, e.MaxY = bounds.MinX, bounds.MaxX, bounds.MinY, bounds.MaxY
+		return e
+	}
+	elements := []db.Element{
+		element(db.Element{ID: 1, Type: db.ElementRectangle, X: 130, Y: 80, Width: 50, Height: 30, Rotation: 15,
+			Style: db.ElementStyle{StrokeColor: "#000000", StrokeWidth: 2, FillColor: "#ffe082"}}),
+		element(db.Element{ID: 2, Type: db.ElementEllipse, X: 130, Y: 120, Width: 40, Height: 25,
+			Style: db.ElementStyle{StrokeColor: "#00796b", StrokeWidth: 3}}),
+		element(db.Element{ID: 3, Type: db.ElementText, X: 190, Y: 20,
+			Style: db.ElementStyle{StrokeColor: "#000000"},
+			Text:  &db.TextProps{Content: "Golden\nfile", FontFamily: "sans-serif", FontSize: 12, Align: db.AlignLeft, Color: "#212121"}}),
+	}
+	return strokes, elements, layers
+}
+
+func goldenExport(t *testing.T, canvas Canvas, options ExportOptions) *BoardExport {
+	t.Helper()
+	strokes, elements, layers := goldenBoard(t)
+	export, err := newExport(&db.Whiteboard{ID: 1, Name: "Golden"}, strokes, elements, layers, canvas, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return export
+}
+
+var boundedCanvas = withDefaults(db.CanvasSettings{Mode: db.CanvasBounded, Bounds: &db.Bounds{MinX: -20, MinY: -20, MaxX: 240, MaxY: 180}})
+
+var exportCases = []struct {
+	name    string
+	canvas  Canvas
+	options ExportOptions
+}{
+	{"content", withDefaults(db.CanvasSettings{}), ExportOptions{Crop: CropContent}},
+	{"padding-background", withDefaults(db.CanvasSettings{}), ExportOptions{Crop: CropContent, Padding: 15, Background: "#fafafa"}},
+	{"region", withDefaults(db.CanvasSettings{}), ExportOptions{Region: &geometry.Rect{MinX: 40, MinY: 60, MaxX: 160, MaxY: 150}, Background: "white"}},
+	{"canvas", boundedCanvas, ExportOptions{Crop: CropCanvas, Background: "transparent"}},
+}
+
+func TestExportSVGGolden(t *testing.T) {
+	for _, c := range exportCases {
+		t.Run(c.name, func(t *testing.T) {
+			got := goldenExport(t, c.canvas, c.options).RenderSVG(nil)
+			if again := goldenExport(t, c.canvas, c.options).RenderSVG(nil); !bytes.Equal(got, again) {
+				t.Fatal("rendering the same board twice gave different SVG")
+			}
+			path := filepath.Join("testdata", "export", c.name+".svg")
+			if *update {
+				writeGolden(t, path, got)
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("SVG differs from %s, run the tests with -update and review the diff:\n%s", path, got)
+			}
+		})
+	}
+}
+
+func TestExportPNGGolden(t *testing.T) {
+	sizes := map[string]PNGOptions{
+		"content":            {Scale: 2},
+		"padding-background": {},
+		"region":             {Width: 240},
+		"canvas":             {Width: 200, Height: 200},
+	}
+	for _, c := range exportCases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := goldenExport(t, c.canvas, c.options).RenderPNG(sizes[c.name], nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", "export", c.name+".png")
+			if *update {
+				writeGolden(t, path, got)
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Compare pixels rather than bytes, the encoder may compress differently
+			gotImg, wantImg := decodePNG(t, got), decodePNG(t, want)
+			if gotImg.Bounds() != wantImg.Bounds() {
+				t.Fatalf("image is %v, %s is %v", gotImg.Bounds(), path, wantImg.Bounds())
+			}
+			b := gotImg.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if gotImg.At(x, y) != wantImg.At(x, y) {
+						t.Fatalf("pixel %d,%d is %v, %s has %v; run the tests with -update and review the images",
+							x, y, gotImg.At(x, y), path, wantImg.At(x, y))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestExportPNGAntiAliased(t *testing.T) {
+	content, err := goldenExport(t, withDefaults(db.CanvasSettings{}), ExportOptions{Crop: CropContent}).RenderPNG(PNGOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := decodePNG(t, content)
+	// The diagonal stroke has partly covered pixels along its edges
+	partial := 0
+	for x := 20; x < 100; x++ {
+		y := int(10 + float64(x-10)*0.6)
+		for dy := -4; dy <= 4; dy++ {
+			if _, _, _, a := img.At(x, y+dy).RGBA(); a > 0 && a < 0xffff {
+				partial++
+			}
+		}
+	}
+	if partial < 80 {
+		t.Errorf("only %d partly covered pixels along the diagonal", partial)
+	}
+}
+
+func TestExportOptionErrors(t *testing.T) {
+	for _, options := range []ExportOptions{
+		{Padding: -1},
+		{Padding: maxExportPadding + 1},
+		{Background: "not a color"},
+		{Crop: "everything"},
+		{Region: &geometry.Rect{MinX: 10, MaxX: 10, MaxY: 5}},
+	} {
+		strokes, elements, layers := goldenBoard(t)
+		if _, err := newExport(&db.Whiteboard{ID: 1}, strokes, elements, layers, withDefaults(db.CanvasSettings{}), options); err == nil {
+			t.Errorf("options %+v were accepted", options)
+		}
+	}
+}
+
+func decodePNG(t *testing.T, content []byte) image.Image {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func writeGolden(t *testing.T, path string, content []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
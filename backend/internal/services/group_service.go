@@ -0,0 +1,351 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sketchive/internal/db"
+	"sketchive/internal/spatial"
+	"time"
+)
+
+// Group event types
+const (
+	EventGroupCreated  = "group_created"
+	EventGroupRemoved  = "group_removed"
+	EventGroupsUpdated = "groups_updated"
+)
+
+// ContentIDs names a set of board items by kind
+type ContentIDs struct {
+	StrokeIDs  []int `json:"strokeIDs"`
+	ElementIDs []int `json:"elementIDs"`
+	GroupIDs   []int `json:"groupIDs"`
+}
+
+func (ids ContentIDs) members() []db.GroupMember {
+	var members []db.GroupMember
+	for _, id := range uniqueIDs(ids.StrokeIDs) {
+		members = append(members, db.GroupMember{Kind: db.ItemStroke, ID: id})
+	}
+	for _, id := range uniqueIDs(ids.ElementIDs) {
+		members = append(members, db.GroupMember{Kind: db.ItemElement, ID: id})
+	}
+	for _, id := range uniqueIDs(ids.GroupIDs) {
+		members = append(members, db.GroupMember{Kind: db.ItemGroup, ID: id})
+	}
+	return members
+}
+
+// boardGroups is the group tree of a whiteboard
+type boardGroups struct {
+	byID   map[int]*db.Group
+	parent map[db.GroupMember]int
+}
+
+func loadGroups(whiteboardID int) (boardGroups, error) {
+	groups, err := db.GetGroupsByWhiteboardID(whiteboardID)
+	if err != nil {
+		return boardGroups{}, err
+	}
+	g := boardGroups{byID: make(map[int]*db.Group, len(groups)), parent: map[db.GroupMember]int{}}
+	for i := range groups {
+		g.byID[groups[i].ID] = &groups[i]
+		for _, m := range groups[i].Members {
+			g.parent[m] = groups[i].ID
+		}
+	}
+	return g, nil
+}
+
+// root returns the top-level group containing the item, or 0 when the item isn't grouped.
+// For a top-level group it returns the group itself.
+func (g boardGroups) root(m db.GroupMember) int {
+	root := 0
+	if m.Kind == db.ItemGroup {
+		root = m.ID
+	}
+	// The depth limit guards against cycles in corrupt data
+	for depth := 0; depth < len(g.byID)+1; depth++ {
+		parent, ok := g.parent[m]
+		if !ok {
+			break
+		}
+		root = parent
+		m = db.GroupMember{Kind: db.ItemGroup, ID: parent}
+	}
+	return root
+}
+
+// ancestors returns the groups containing any of the items, directly or through nesting,
+// ordered from the innermost groups out
+func (g boardGroups) ancestors(members []db.GroupMember) []int {
+	seen := map[int]bool{}
+	var ids []int
+	for _, m := range members {
+		for depth := 0; depth < len(g.byID)+1; depth++ {
+			parent, ok := g.parent[m]
+			if !ok || seen[parent] {
+				break
+			}
+			seen[parent] = true
+			ids = append(ids, parent)
+			m = db.GroupMember{Kind: db.ItemGroup, ID: parent}
+		}
+	}
+	return ids
+}
+
+// collect adds the strokes and elements of a group and its nested groups to ids
+func (g boardGroups) collect(groupID int, ids *ContentIDs, visited map[int]bool) {
+	group, ok := g.byID[groupID]
+	if !ok || visited[groupID] {
+		return
+	}
+	visited[groupID] = true
+	for _, m := range group.Members {
+		switch m.Kind {
+		case db.ItemStroke:
+			ids.StrokeIDs = append(ids.StrokeIDs, m.ID)
+		case db.ItemElement:
+			ids.ElementIDs = append(ids.ElementIDs, m.ID)
+		case db.ItemGroup:
+			g.collect(m.ID, ids, visited)
+		}
+	}
+}
+
+// expand replaces every grouped item by everything in its top-level group, so a group
+// always moves as a whole. It returns the strokes and elements to act on and the IDs
+// of the top-level groups involved.
+func (g boardGroups) expand(ids ContentIDs) (ContentIDs, []int, error) {
+	var expanded ContentIDs
+	roots := []int{}
+	visited := map[int]bool{}
+	for _, m := range ids.members() {
+		if m.Kind == db.ItemGroup {
+			if _, ok := g.byID[m.ID]; !ok {
+				return expanded, nil, fmt.Errorf("group %d: %w", m.ID, db.ErrGroupNotFound)
+			}
+		}
+		root := g.root(m)
+		if root == 0 {
+			switch m.Kind {
+			case db.ItemStroke:
+				expanded.StrokeIDs = append(expanded.StrokeIDs, m.ID)
+			case db.ItemElement:
+				expanded.ElementIDs = append(expanded.ElementIDs, m.ID)
+			}
+			continue
+		}
+		if !visited[root] {
+			roots = append(roots, root)
+		}
+		g.collect(root, &expanded, visited)
+	}
+	expanded.StrokeIDs = uniqueIDs(expanded.StrokeIDs)
+	expanded.ElementIDs = uniqueIDs(expanded.ElementIDs)
+	return expanded, roots, nil
+}
+
+// groupBounds computes the box around every stroke and element of a group from the spatial index
+func groupBounds(whiteboardID int, groups boardGroups, group *db.Group) (bool, error) {
+	var content ContentIDs
+	groups.collect(group.ID, &content, map[int]bool{})
+	keys := append(keysOf(spatial.KindStroke, content.StrokeIDs), keysOf(spatial.KindElement, content.ElementIDs)...)
+	bounds, ok, err := boardIndex.Union(whiteboardID, keys)
+	if err != nil || !ok {
+		return false, err
+	}
+	group.MinX, group.MaxX, group.MinY, group.MaxY = bounds.MinX, bounds.MaxX, bounds.MinY, bounds.MaxY
+	return true, nil
+}
+
+// refreshGroups recomputes the bounding boxes of the groups containing the changed items
+// and removes groups that no longer have any content. It returns the updated groups and
+// the IDs of the removed ones.
+func refreshGroups(whiteboardID int, changed []db.GroupMember) ([]db.Group, []int, error) {
+	groups, err := loadGroups(whiteboardID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var updated []db.Group
+	var emptyIDs []int
+	for _, id := range groups.ancestors(changed) {
+		group := groups.byID[id]
+		ok, err := groupBounds(whiteboardID, groups, group)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			updated = append(updated, *group)
+		} else {
+			emptyIDs = append(emptyIDs, id)
+		}
+	}
+
+	if err := db.UpdateGroupBounds(updated); err != nil {
+		return nil, nil, err
+	}
+	if err := db.DeleteGroupsByIDs(whiteboardID, emptyIDs); err != nil {
+		return nil, nil, err
+	}
+	return updated, emptyIDs, nil
+}
+
+// contentChanged keeps the groups of a whiteboard in step after items moved, changed or were
+// deleted, and tells clients about the new group bounds
+func contentChanged(whiteboardID, userID int, kind string, ids []int, deleted bool) ([]db.Group, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if deleted {
+		if err := db.RemoveGroupMembers(whiteboardID, kind, ids); err != nil {
+			return nil, fmt.Errorf("removing deleted %ss from their groups: %w", kind, err)
+		}
+	}
+
+	changed := make([]db.GroupMember, len(ids))
+	for i, id := range ids {
+		changed[i] = db.GroupMember{Kind: kind, ID: id}
+	}
+	updated, removed, err := refreshGroups(whiteboardID, changed)
+	if err != nil {
+		return nil, fmt.Errorf("refreshing groups: %w", err)
+	}
+
+	if len(updated) > 0 {
+		Broadcast(Event{Type: EventGroupsUpdated, WhiteboardID: whiteboardID, UserID: userID, Groups: updated})
+	}
+	for _, id := range removed {
+		Broadcast(Event{Type: EventGroupRemoved, WhiteboardID: whiteboardID, UserID: userID, GroupID: id})
+	}
+	return updated, nil
+}
+
+// StrokesChanged updates the groups containing strokes that were edited or moved
+func StrokesChanged(whiteboardID, userID int, ids ...int) error {
+	_, err := contentChanged(whiteboardID, userID, db.ItemStroke, ids, false)
+	return err
+}
+
+// ElementsChanged updates the groups containing elements that were edited or moved,
+// and those of the connectors that followed them
+func ElementsChanged(whiteboardID, userID int, followed []db.Element, ids ...int) error {
+	if _, err := contentChanged(whiteboardID, userID, db.ItemElement, ids, false); err != nil {
+		return err
+	}
+	return connectorsFollowed(whiteboardID, userID, followed)
+}
+
+// StrokesDeleted takes deleted strokes out of their groups
+func StrokesDeleted(whiteboardID, userID int, ids ...int) error {
+	_, err := contentChanged(whiteboardID, userID, db.ItemStroke, ids, true)
+	return err
+}
+
+// ElementsDeleted takes deleted elements out of their groups and updates the groups of the
+// connectors that were detached from them
+func ElementsDeleted(whiteboardID, userID int, followed []db.Element, ids ...int) error {
+	if _, err := contentChanged(whiteboardID, userID, db.ItemElement, ids, true); err != nil {
+		return err
+	}
+	return connectorsFollowed(whiteboardID, userID, followed)
+}
+
+// CreateGroup groups strokes, elements and existing groups. Items must not belong to another
+// group yet and must be on editable layers. A group needs at least two members.
+func CreateGroup(whiteboardID, userID int, ids ContentIDs) (db.Group, error) {
+	group := db.Group{WhiteboardID: whiteboardID, Members: ids.members(), CreatedAt: time.Now()}
+	if len(group.Members) < 2 {
+		return group, invalidf("a group needs at least two members")
+	}
+	if len(group.Members) > maxBatchSize {
+		return group, invalidf("can't group more than %d items at once", maxBatchSize)
+	}
+
+	// InsertGroup checks that no member belongs to another group yet, in its transaction.
+	// Every item that ends up in the group must be editable.
+	groups, err := loadGroups(whiteboardID)
+	if err != nil {
+		return group, err
+	}
+	content, _, err := groups.expand(ids)
+	if err != nil {
+		return group, err
+	}
+	if err := ensureEditable(whiteboardID, content); err != nil {
+		return group, err
+	}
+
+	err = db.InsertGroup(&group, LogOperation(whiteboardID, userID, LogGroupCreated, &group))
+	if err != nil {
+		return group, err
+	}
+
+	// Compute the bounds with the new group in the tree
+	groups, err = loadGroups(whiteboardID)
+	if err != nil {
+		return group, err
+	}
+	if g, ok := groups.byID[group.ID]; ok {
+		if _, err := groupBounds(whiteboardID, groups, g); err != nil {
+			return group, err
+		}
+		group = *g
+		if err := db.UpdateGroupBounds([]db.Group{group}); err != nil {
+			return group, err
+		}
+	}
+
+	log.Printf("User %d grouped %d items into group %d on whiteboard ID %d\n", userID, len(group.Members), group.ID, whiteboardID)
+	Broadcast(Event{Type: EventGroupCreated, WhiteboardID: whiteboardID, UserID: userID, Groups: []db.Group{group}})
+	return group, nil
+}
+
+// Ungroup removes a group. Its members stay on the board and move up into the
+// group it was nested in, if any.
+func Ungroup(whiteboardID, userID, groupID int) error {
+	groups, err := loadGroups(whiteboardID)
+	if err != nil {
+		return err
+	}
+	if _, ok := groups.byID[groupID]; !ok {
+		return fmt.Errorf("group %d: %w", groupID, db.ErrGroupNotFound)
+	}
+
+	err = db.DeleteGroup(whiteboardID, groupID, LogOperation(whiteboardID, userID, LogGroupRemoved, map[string]int{"groupID": groupID}))
+	if err != nil {
+		return err
+	}
+	log.Printf("User %d ungrouped group %d on whiteboard ID %d\n", userID, groupID, whiteboardID)
+	Broadcast(Event{Type: EventGroupRemoved, WhiteboardID: whiteboardID, UserID: userID, GroupID: groupID})
+	return nil
+}
+
+// ensureEditable fails with ErrLocked when any of the strokes or elements is on a hidden or locked layer
+func ensureEditable(whiteboardID int, ids ContentIDs) error {
+	layers, err := loadLayers(whiteboardID)
+	if err != nil {
+		return err
+	}
+	strokes, err := db.GetStrokesByIDs(whiteboardID, ids.StrokeIDs)
+	if err != nil {
+		return err
+	}
+	for _, s := range strokes {
+		if !layers.editable(s.LayerID) {
+			return fmt.Errorf("%w: stroke %d is on a hidden or locked layer", ErrLocked, s.ID)
+		}
+	}
+	elements, err := db.GetElementsByIDs(whiteboardID, ids.ElementIDs)
+	if err != nil {
+		return err
+	}
+	for _, e := range elements {
+		if !layers.editable(e.LayerID) {
+			return fmt.Errorf("%w: element %d is on a hidden or locked layer", ErrLocked, e.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,671 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Kinds of operations a user can undo
+const (
+	OperationAdd       = "add"
+	OperationErase     = "erase"
+	OperationTransform = "transform"
+	OperationClear     = "clear"
+)
+
+// Undo and redo event types
+const (
+	EventOperationUndone = "operation_undone"
+	EventOperationRedone = "operation_redone"
+)
+
+// maxHistory is how many operations each user can undo on a board
+const maxHistory = 100
+
+var (
+	// ErrNothingToUndo is returned when a user has no operation left to undo on the board
+	ErrNothingToUndo = errors.New("nothing to undo")
+	// ErrNothingToRedo is returned when a user has no undone operation to redo on the board
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// Operation is a change a user made to a board, kept so the user can undo and redo it. Undo
+// and redo narrow its items to the ones they removed or brought back, so items other users
+// removed in between are never brought back by a later undo or redo.
+type Operation struct {
+	ID           int       `json:"id"`
+	Kind         string    `json:"kind"`
+	WhiteboardID int       `json:"whiteboardID"`
+	UserID       int       `json:"userID"`
+	StrokeIDs    []int     `json:"strokeIDs"`
+	ElementIDs   []int     `json:"elementIDs"`
+	CreatedAt    time.Time `json:"createdAt"`
+
+	// The geometry of transformed items before and after the transform
+	strokesBefore, strokesAfter   map[int]strokeGeometry
+	elementsBefore, elementsAfter map[int]elementGeometry
+	// The recorded clear, and whether this operation undid it
+	clearID     int
+	clearUndone bool
+}
+
+// HistoryResult is what an undo or redo changed on the board
+type HistoryResult struct {
+	Operation         *Operation   `json:"operation"`
+	Strokes           []db.Stroke  `json:"strokes"`  // strokes brought back or moved
+	Elements          []db.Element `json:"elements"` // elements brought back or moved, and the connectors that followed
+	RemovedStrokeIDs  []int        `json:"removedStrokeIDs"`
+	RemovedElementIDs []int        `json:"removedElementIDs"`
+	Groups            []db.Group   `json:"groups"` // groups recreated by undoing a clear
+	// Skipped lists the items left alone because other users changed or removed them since
+	Skipped ContentIDs `json:"skipped"`
+}
+
+// History lists the operations a user can undo and redo on a board, oldest first
+type History struct {
+	Undo []*Operation `json:"undo"`
+	Redo []*Operation `json:"redo"`
+}
+
+// strokeGeometry is the part of a stroke a transform changes
+type strokeGeometry struct {
+	path   []db.Point
+	bounds geometry.Rect
+}
+
+func strokeGeometryOf(s *db.Stroke) strokeGeometry {
+	return strokeGeometry{path: append([]db.Point(nil), s.Path...), bounds: StrokeBounds(s)}
+}
+
+// matches reports whether a stroke still has this geometry, point for point. Two edits can
+// leave the same bounding box, so the box alone can't tell whether someone else moved it.
+func (g strokeGeometry) matches(s *db.Stroke) bool {
+	return StrokeBounds(s) == g.bounds && slices.Equal(s.Path, g.path)
+}
+
+func (g strokeGeometry) apply(s *db.Stroke) {
+	s.Path = append([]db.Point(nil), g.path...)
+	s.MinX, s.MaxX, s.MinY, s.MaxY = g.bounds.MinX, g.bounds.MaxX, g.bounds.MinY, g.bounds.MaxY
+}
+
+// elementGeometry is the part of an element a transform changes. Everything else, like
+// the style or the text, stays as it is, so undoing a move keeps later edits.
+type elementGeometry struct {
+	x, y, width, height, rotation float64
+	points                        []db.Point
+	fontSize, wrapWidth           float64
+	connector                     *db.ConnectorProps
+	bounds                        geometry.Rect
+}
+
+func elementGeometryOf(e *db.Element) elementGeometry {
+	g := elementGeometry{
+		x: e.X, y: e.Y, width: e.Width, height: e.Height, rotation: e.Rotation,
+		points:    append([]db.Point(nil), e.Points...),
+		connector: cloneConnector(e.Connector),
+		bounds:    ElementBounds(e),
+	}
+	if e.Text != nil {
+		g.fontSize, g.wrapWidth = e.Text.FontSize, e.Text.WrapWidth
+	}
+	return g
+}
+
+// matches reports whether an element still has this geometry
+func (g elementGeometry) matches(e *db.Element) bool {
+	current := elementGeometryOf(e)
+	return current.x == g.x && current.y == g.y && current.width == g.width && current.height == g.height &&
+		current.rotation == g.rotation && current.fontSize == g.fontSize && current.wrapWidth == g.wrapWidth &&
+		current.bounds == g.bounds && slices.Equal(current.points, g.points) && sameJSON(current.connector, g.connector)
+}
+
+func (g elementGeometry) apply(e *db.Element) {
+	e.X, e.Y, e.Width, e.Height, e.Rotation = g.x, g.y, g.width, g.height, g.rotation
+	e.Points = append([]db.Point(nil), g.points...)
+	if e.Connector != nil {
+		e.Connector = cloneConnector(g.connector)
+	}
+	if e.Text != nil {
+		e.Text.FontSize, e.Text.WrapWidth = g.fontSize, g.wrapWidth
+	}
+	e.MinX, e.MaxX, e.MinY, e.MaxY = g.bounds.MinX, g.bounds.MaxX, g.bounds.MinY, g.bounds.MaxY
+}
+
+func cloneConnector(c *db.ConnectorProps) *db.ConnectorProps {
+	if c == nil {
+		return nil
+	}
+	clone := *c
+	for _, end := range []*db.ConnectorEnd{&clone.Start, &clone.End} {
+		if end.Position != nil {
+			p := *end.Position
+			end.Position = &p
+		}
+		if end.Point != nil {
+			p := *end.Point
+			end.Point = &p
+		}
+	}
+	return &clone
+}
+
+type historyKey struct {
+	whiteboardID, userID int
+}
+
+type userHistory struct {
+	undo, redo []*Operation
+}
+
+// histories holds the undo and redo stacks of every user on every board. They live in
+// memory only: a restart starts everyone with an empty history.
+var histories = struct {
+	sync.Mutex
+	byUser map[historyKey]*userHistory
+	nextID int
+}{byUser: map[historyKey]*userHistory{}}
+
+// record pushes a new operation on the user's undo stack. A new operation drops
+// whatever the user could redo, like in any editor.
+func record(op *Operation) {
+	if len(op.StrokeIDs) == 0 && len(op.ElementIDs) == 0 {
+		return
+	}
+	histories.Lock()
+	defer histories.Unlock()
+
+	histories.nextID++
+	op.ID = histories.nextID
+	op.CreatedAt = time.Now()
+	key := historyKey{op.WhiteboardID, op.UserID}
+	h, ok := histories.byUser[key]
+	if !ok {
+		h = &userHistory{}
+		histories.byUser[key] = h
+	}
+	h.undo = append(h.undo, op)
+	if len(h.undo) > maxHistory {
+		h.undo = h.undo[len(h.undo)-maxHistory:]
+	}
+	h.redo = nil
+}
+
+// RecordAdd lets the user undo adding strokes and elements
+func RecordAdd(whiteboardID, userID int, ids ContentIDs) {
+	record(&Operation{Kind: OperationAdd, WhiteboardID: whiteboardID, UserID: userID,
+		StrokeIDs: uniqueIDs(ids.StrokeIDs), ElementIDs: uniqueIDs(ids.ElementIDs)})
+}
+
+// RecordErase lets the user undo erasing or deleting strokes and elements
+func RecordErase(whiteboardID, userID int, ids ContentIDs) {
+	record(&Operation{Kind: OperationErase, WhiteboardID: whiteboardID, UserID: userID,
+		StrokeIDs: uniqueIDs(ids.StrokeIDs), ElementIDs: uniqueIDs(ids.ElementIDs)})
+}
+
+// RecordElementEdit lets the user undo moving, resizing or rotating an element with an edit,
+// given the element before and after it. Edits that leave its geometry alone aren't recorded.
+func RecordElementEdit(whiteboardID, userID int, before, after *db.Element) {
+	geometryBefore := elementGeometryOf(before)
+	if geometryBefore.matches(after) {
+		return
+	}
+	recordTransform(whiteboardID, userID, nil, map[int]elementGeometry{before.ID: geometryBefore}, nil, []db.Element{*after})
+}
+
+// recordTransform lets the user undo a transform, given the geometry of the items before it
+// and the transformed items
+func recordTransform(whiteboardID, userID int, strokesBefore map[int]strokeGeometry, elementsBefore map[int]elementGeometry,
+	strokes []db.Stroke, elements []db.Element) {
+	op := &Operation{Kind: OperationTransform, WhiteboardID: whiteboardID, UserID: userID,
+		strokesBefore: strokesBefore, strokesAfter: map[int]strokeGeometry{},
+		elementsBefore: elementsBefore, elementsAfter: map[int]elementGeometry{}}
+	for i := range strokes {
+		op.StrokeIDs = append(op.StrokeIDs, strokes[i].ID)
+		op.strokesAfter[strokes[i].ID] = strokeGeometryOf(&strokes[i])
+	}
+	for i := range elements {
+		op.ElementIDs = append(op.ElementIDs, elements[i].ID)
+		op.elementsAfter[elements[i].ID] = elementGeometryOf(&elements[i])
+	}
+	record(op)
+}
+
+// GetHistory returns the operations a user can undo and redo on a board
+func GetHistory(whiteboardID, userID int) History {
+	histories.Lock()
+	defer histories.Unlock()
+	history := History{Undo: []*Operation{}, Redo: []*Operation{}}
+	if h, ok := histories.byUser[historyKey{whiteboardID, userID}]; ok {
+		history.Undo = append(history.Undo, h.undo...)
+		// The redo stack is kept with the next operation to redo last; list it oldest first too
+		for i := len(h.redo) - 1; i >= 0; i-- {
+			history.Redo = append(history.Redo, h.redo[i])
+		}
+	}
+	return history
+}
+
+// ForgetHistory drops every user's history of a deleted board
+func ForgetHistory(whiteboardID int) {
+	histories.Lock()
+	defer histories.Unlock()
+	for key := range histories.byUser {
+		if key.whiteboardID == whiteboardID {
+			delete(histories.byUser, key)
+		}
+	}
+}
+
+// pop takes the last operation off one of the user's stacks
+func pop(whiteboardID, userID int, redo bool) *Operation {
+	histories.Lock()
+	defer histories.Unlock()
+	h, ok := histories.byUser[historyKey{whiteboardID, userID}]
+	if !ok {
+		return nil
+	}
+	stack := &h.undo
+	if redo {
+		stack = &h.redo
+	}
+	if len(*stack) == 0 {
+		return nil
+	}
+	op := (*stack)[len(*stack)-1]
+	*stack = (*stack)[:len(*stack)-1]
+	return op
+}
+
+// push puts an operation back on one of the user's stacks
+func push(op *Operation, redo bool) {
+	histories.Lock()
+	defer histories.Unlock()
+	key := historyKey{op.WhiteboardID, op.UserID}
+	h, ok := histories.byUser[key]
+	if !ok {
+		h = &userHistory{}
+		histories.byUser[key] = h
+	}
+	if redo {
+		h.redo = append(h.redo, op)
+	} else {
+		h.undo = append(h.undo, op)
+	}
+}
+
+// Undo reverts the user's last operation on the board by applying its inverse, and
+// broadcasts what changed. Only the operation's own items are touched: items other users
+// have removed or transformed since are skipped rather than reverted.
+func Undo(whiteboardID, userID int) (HistoryResult, error) {
+	op := pop(whiteboardID, userID, false)
+	if op == nil {
+		return HistoryResult{}, ErrNothingToUndo
+	}
+	result, err := op.revert()
+	if err != nil {
+		push(op, false)
+		return result, err
+	}
+	push(op, true)
+
+	log.Printf("User %d undid %s operation %d on whiteboard ID %d\n", userID, op.Kind, op.ID, whiteboardID)
+	Broadcast(Event{Type: EventOperationUndone, WhiteboardID: whiteboardID, UserID: userID, History: &result})
+	return result, nil
+}
+
+// Redo applies the user's last undone operation again and broadcasts what changed.
+// Like Undo, it leaves items changed by other users alone.
+func Redo(whiteboardID, userID int) (HistoryResult, error) {
+	op := pop(whiteboardID, userID, true)
+	if op == nil {
+		return HistoryResult{}, ErrNothingToRedo
+	}
+	result, err := op.reapply()
+	if err != nil {
+		push(op, true)
+		return result, err
+	}
+	push(op, false)
+
+	log.Printf("User %d redid %s operation %d on whiteboard ID %d\n", userID, op.Kind, op.ID, whiteboardID)
+	Broadcast(Event{Type: EventOperationRedone, WhiteboardID: whiteboardID, UserID: userID, History: &result})
+	return result, nil
+}
+
+// revert applies the inverse of the operation
+func (op *Operation) revert() (HistoryResult, error) {
+	result := HistoryResult{Operation: op}
+	var err error
+	switch op.Kind {
+	case OperationAdd:
+		err = removeItems(op, &result)
+	case OperationErase:
+		err = restoreItems(op, &result)
+	case OperationClear:
+		// Once the clear was undone, redoing it only erased its items again
+		if op.clearUndone {
+			err = restoreItems(op, &result)
+		} else {
+			err = undoClear(op, &result)
+		}
+	case OperationTransform:
+		err = setGeometry(op, op.strokesBefore, op.strokesAfter, op.elementsBefore, op.elementsAfter, &result)
+	default:
+		err = fmt.Errorf("unknown operation kind %q", op.Kind)
+	}
+	result.normalize()
+	return result, err
+}
+
+// reapply does the operation again after it was undone
+func (op *Operation) reapply() (HistoryResult, error) {
+	result := HistoryResult{Operation: op}
+	var err error
+	switch op.Kind {
+	case OperationAdd:
+		err = restoreItems(op, &result)
+	case OperationErase, OperationClear:
+		err = removeItems(op, &result)
+	case OperationTransform:
+		err = setGeometry(op, op.strokesAfter, op.strokesBefore, op.elementsAfter, op.elementsBefore, &result)
+	default:
+		err = fmt.Errorf("unknown operation kind %q", op.Kind)
+	}
+	result.normalize()
+	return result, err
+}
+
+// normalize turns nil lists into empty ones for the JSON encoding
+func (r *HistoryResult) normalize() {
+	for _, ids := range []*[]int{&r.RemovedStrokeIDs, &r.RemovedElementIDs, &r.Skipped.StrokeIDs, &r.Skipped.ElementIDs, &r.Skipped.GroupIDs} {
+		if *ids == nil {
+			*ids = []int{}
+		}
+	}
+	if r.Strokes == nil {
+		r.Strokes = []db.Stroke{}
+	}
+	if r.Elements == nil {
+		r.Elements = []db.Element{}
+	}
+	if r.Groups == nil {
+		r.Groups = []db.Group{}
+	}
+}
+
+// missing returns the IDs in ids that aren't in found
+func missing(ids []int, found map[int]bool) []int {
+	var out []int
+	for _, id := range ids {
+		if !found[id] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// removeItems marks the operation's strokes and elements as deleted. Items already gone are skipped.
+func removeItems(op *Operation, result *HistoryResult) error {
+	strokes, err := db.GetStrokesByIDs(op.WhiteboardID, op.StrokeIDs)
+	if err != nil {
+		return err
+	}
+	elements, err := db.GetElementsByIDs(op.WhiteboardID, op.ElementIDs)
+	if err != nil {
+		return err
+	}
+	layers, err := loadLayers(op.WhiteboardID)
+	if err != nil {
+		return err
+	}
+
+	found := map[int]bool{}
+	for _, s := range strokes {
+		if !layers.editable(s.LayerID) {
+			return fmt.Errorf("%w: stroke %d is on a hidden or locked layer", ErrLocked, s.ID)
+		}
+		result.RemovedStrokeIDs = append(result.RemovedStrokeIDs, s.ID)
+		found[s.ID] = true
+	}
+	result.Skipped.StrokeIDs = missing(op.StrokeIDs, found)
+	found = map[int]bool{}
+	for _, e := range elements {
+		if !layers.editable(e.LayerID) {
+			return fmt.Errorf("%w: element %d is on a hidden or locked layer", ErrLocked, e.ID)
+		}
+		result.RemovedElementIDs = append(result.RemovedElementIDs, e.ID)
+		found[e.ID] = true
+	}
+	result.Skipped.ElementIDs = missing(op.ElementIDs, found)
+
+	followed, err := db.DeleteContent(op.WhiteboardID, result.RemovedStrokeIDs, result.RemovedElementIDs,
+		Following(result.RemovedElementIDs...),
+		LogDeleted(op.WhiteboardID, op.UserID), LogElements(op.WhiteboardID, op.UserID, LogElementsUpdated))
+	if err != nil {
+		return err
+	}
+	op.StrokeIDs, op.ElementIDs = result.RemovedStrokeIDs, result.RemovedElementIDs
+	result.Elements = append(result.Elements, followed...)
+	UnindexStrokes(op.WhiteboardID, result.RemovedStrokeIDs...)
+	UnindexElements(op.WhiteboardID, result.RemovedElementIDs...)
+	if err := StrokesDeleted(op.WhiteboardID, op.UserID, result.RemovedStrokeIDs...); err != nil {
+		return err
+	}
+	return ElementsDeleted(op.WhiteboardID, op.UserID, followed, result.RemovedElementIDs...)
+}
+
+// undoClear brings back what the operation's clear tombstoned, through the clear itself: items
+// restored or removed another way since are left alone, and a clear can't be undone twice.
+// Like any undo of a clear it needs edit rights.
+func undoClear(op *Operation, result *HistoryResult) error {
+	if err := requireEditor(op.UserID); err != nil {
+		return err
+	}
+	_, strokes, elements, err := db.UndoClear(op.WhiteboardID, op.clearID, op.UserID, time.Now(),
+		LogStrokes(op.WhiteboardID, op.UserID, LogStrokesRestored), LogElements(op.WhiteboardID, op.UserID, LogElementsRestored),
+		LogOperation(op.WhiteboardID, op.UserID, LogClearUndone, map[string]int{"clearID": op.clearID}),
+		LogGroupsCreated(op.WhiteboardID, op.UserID))
+	if err != nil {
+		return err
+	}
+	op.clearUndone = true
+	result.Strokes, result.Elements = strokes, elements
+	found := map[int]bool{}
+	for _, s := range strokes {
+		found[s.ID] = true
+	}
+	result.Skipped.StrokeIDs = missing(op.StrokeIDs, found)
+	found = map[int]bool{}
+	for _, e := range elements {
+		found[e.ID] = true
+	}
+	result.Skipped.ElementIDs = missing(op.ElementIDs, found)
+	restored := ContentIDs{StrokeIDs: idsOfStrokes(strokes), ElementIDs: idsOfElements(elements)}
+	op.StrokeIDs, op.ElementIDs = restored.StrokeIDs, restored.ElementIDs
+
+	IndexStrokes(op.WhiteboardID, strokes...)
+	IndexElements(op.WhiteboardID, elements...)
+	RefreshContentBounds(op.WhiteboardID)
+	result.Groups, err = recreatedGroups(op.WhiteboardID, restored)
+	return err
+}
+
+// restoreItems brings back the operation's deleted strokes and elements. Items that no
+// longer exist at all are skipped.
+func restoreItems(op *Operation, result *HistoryResult) error {
+	layers, err := loadLayers(op.WhiteboardID)
+	if err != nil {
+		return err
+	}
+	var ids ContentIDs
+	for _, item := range []struct {
+		kind string
+		ids  []int
+		keep *[]int
+		skip *[]int
+	}{
+		{db.ItemStroke, op.StrokeIDs, &ids.StrokeIDs, &result.Skipped.StrokeIDs},
+		{db.ItemElement, op.ElementIDs, &ids.ElementIDs, &result.Skipped.ElementIDs},
+	} {
+		itemLayers, err := db.GetItemLayers(op.WhiteboardID, item.kind, item.ids)
+		if err != nil {
+			return err
+		}
+		for _, id := range item.ids {
+			layerID, ok := itemLayers[id]
+			if !ok {
+				*item.skip = append(*item.skip, id)
+				continue
+			}
+			if !layers.editable(layerID) {
+				return fmt.Errorf("%w: %s %d is on a hidden or locked layer", ErrLocked, item.kind, id)
+			}
+			*item.keep = append(*item.keep, id)
+		}
+	}
+
+	result.Strokes, result.Elements, err = db.RestoreContent(op.WhiteboardID, ids.StrokeIDs, ids.ElementIDs,
+		LogStrokes(op.WhiteboardID, op.UserID, LogStrokesRestored), LogElements(op.WhiteboardID, op.UserID, LogElementsRestored))
+	if err != nil {
+		return err
+	}
+	op.StrokeIDs, op.ElementIDs = idsOfStrokes(result.Strokes), idsOfElements(result.Elements)
+	IndexStrokes(op.WhiteboardID, result.Strokes...)
+	IndexElements(op.WhiteboardID, result.Elements...)
+	return nil
+}
+
+// setGeometry puts the operation's items back into the target geometry. Items whose
+// current geometry isn't the expected one were changed by someone else and are skipped.
+func setGeometry(op *Operation, strokeTarget, strokeExpected map[int]strokeGeometry,
+	elementTarget, elementExpected map[int]elementGeometry, result *HistoryResult) error {
+	strokes, err := db.GetStrokesByIDs(op.WhiteboardID, op.StrokeIDs)
+	if err != nil {
+		return err
+	}
+	elements, err := db.GetElementsByIDs(op.WhiteboardID, op.ElementIDs)
+	if err != nil {
+		return err
+	}
+	layers, err := loadLayers(op.WhiteboardID)
+	if err != nil {
+		return err
+	}
+
+	var strokeIDs, elementIDs []int
+	found := map[int]bool{}
+	for i := range strokes {
+		s := &strokes[i]
+		if !strokeExpected[s.ID].matches(s) {
+			continue
+		}
+		if !layers.editable(s.LayerID) {
+			return fmt.Errorf("%w: stroke %d is on a hidden or locked layer", ErrLocked, s.ID)
+		}
+		strokeIDs = append(strokeIDs, s.ID)
+		found[s.ID] = true
+	}
+	result.Skipped.StrokeIDs = missing(op.StrokeIDs, found)
+	found = map[int]bool{}
+	for i := range elements {
+		e := &elements[i]
+		if !elementExpected[e.ID].matches(e) {
+			continue
+		}
+		if !layers.editable(e.LayerID) {
+			return fmt.Errorf("%w: element %d is on a hidden or locked layer", ErrLocked, e.ID)
+		}
+		elementIDs = append(elementIDs, e.ID)
+		found[e.ID] = true
+	}
+	result.Skipped.ElementIDs = missing(op.ElementIDs, found)
+
+	// The items are locked inside the transaction; one changed since the check above is left as is
+	changed := map[db.GroupMember]bool{}
+	strokes, elements, err = db.UpdateContentGeometry(op.WhiteboardID, strokeIDs, elementIDs,
+		func(s *db.Stroke) error {
+			if strokeExpected[s.ID].matches(s) {
+				strokeTarget[s.ID].apply(s)
+				changed[db.GroupMember{Kind: db.ItemStroke, ID: s.ID}] = true
+			}
+			return nil
+		},
+		func(e *db.Element) error {
+			if elementExpected[e.ID].matches(e) {
+				elementTarget[e.ID].apply(e)
+				changed[db.GroupMember{Kind: db.ItemElement, ID: e.ID}] = true
+			}
+			return nil
+		},
+		Following(elementIDs...),
+		LogStrokes(op.WhiteboardID, op.UserID, LogStrokesUpdated), LogElements(op.WhiteboardID, op.UserID, LogElementsUpdated))
+	if err != nil {
+		return err
+	}
+	elements, followed := elements[:len(elementIDs)], elements[len(elementIDs):]
+
+	for _, s := range strokes {
+		if changed[db.GroupMember{Kind: db.ItemStroke, ID: s.ID}] {
+			result.Strokes = append(result.Strokes, s)
+		} else {
+			result.Skipped.StrokeIDs = append(result.Skipped.StrokeIDs, s.ID)
+		}
+	}
+	for _, e := range elements {
+		if changed[db.GroupMember{Kind: db.ItemElement, ID: e.ID}] {
+			result.Elements = append(result.Elements, e)
+		} else {
+			result.Skipped.ElementIDs = append(result.Skipped.ElementIDs, e.ID)
+		}
+	}
+
+	IndexStrokes(op.WhiteboardID, result.Strokes...)
+	IndexElements(op.WhiteboardID, result.Elements...)
+	if err := StrokesChanged(op.WhiteboardID, op.UserID, idsOfStrokes(result.Strokes)...); err != nil {
+		return err
+	}
+	if err := ElementsChanged(op.WhiteboardID, op.UserID, followed, idsOfElements(result.Elements)...); err != nil {
+		return err
+	}
+	result.Elements = append(result.Elements, followed...)
+	return nil
+}
+
+func idsOfStrokes(strokes []db.Stroke) []int {
+	ids := make([]int, len(strokes))
+	for i := range strokes {
+		ids[i] = strokes[i].ID
+	}
+	return ids
+}
+
+func idsOfElements(elements []db.Element) []int {
+	ids := make([]int, len(elements))
+	for i := range elements {
+		ids[i] = elements[i].ID
+	}
+	return ids
+}
+
+func idsOfGroups(groups []db.Group) []int {
+	ids := make([]int, len(groups))
+	for i := range groups {
+		ids[i] = groups[i].ID
+	}
+	return ids
+}
+
+// recreatedGroups computes the bounds of the groups recreated around restored items and returns them
+func recreatedGroups(whiteboardID int, restored ContentIDs) ([]db.Group, error) {
+	updated, _, err := refreshGroups(whiteboardID, restored.members())
+	if err != nil {
+		return nil, fmt.Errorf("refreshing recreated groups: %w", err)
+	}
+	return updated, nil
+}
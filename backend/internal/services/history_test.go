@@ -0,0 +1,115 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+)
+
+// testDatabase connects the db package to the MySQL database named by SKETCHIVE_TEST_DSN,
+// which must have the migrations applied. Tests that need it are skipped without one.
+func testDatabase(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("SKETCHIVE_TEST_DSN")
+	if dsn == "" {
+		t.Skip("SKETCHIVE_TEST_DSN is not set")
+	}
+	database, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	db.SetDB(database)
+}
+
+// testEditor adds an editor for the test and removes it when the test ends
+func testEditor(t *testing.T, name string) int {
+	t.Helper()
+	email := fmt.Sprintf("%s-%d@example.com", name, time.Now().UnixNano())
+	result, err := db.GetDB().Exec(`INSERT INTO users (name, email, role) VALUES (?, ?, ?)`, name, email, db.RoleEditor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.GetDB().Exec(`DELETE FROM users WHERE id = ?`, id) })
+	return int(id)
+}
+
+// testBoard adds a whiteboard owned by ownerID and removes it with its history when the test ends
+func testBoard(t *testing.T, ownerID int) int {
+	t.Helper()
+	now := time.Now()
+	board := &db.Whiteboard{Name: t.Name(), OwnerID: ownerID, CreatedAt: now, UpdatedAt: now}
+	if err := db.InsertWhiteboard(board); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ForgetHistory(board.ID)
+		ForgetBoard(board.ID)
+		db.DeleteWhiteboard(board.ID)
+	})
+	return board.ID
+}
+
+func TestRedoKeepsOtherUsersErase(t *testing.T) {
+	testDatabase(t)
+	a, b := testEditor(t, "a"), testEditor(t, "b")
+	whiteboardID := testBoard(t, a)
+	layerID, err := db.DefaultLayerID(whiteboardID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stroke := db.Stroke{WhiteboardID: whiteboardID, OwnerID: a, LayerID: layerID, Color: "#000000", Width: 2,
+		StrokeStyle: db.DefaultStrokeStyle(), Path: []db.Point{{X: 10, Y: 10}, {X: 50, Y: 40}}, CreatedAt: time.Now()}
+	stroke.MinX, stroke.MaxX, stroke.MinY, stroke.MaxY = 10, 50, 10, 40
+	if err := db.InsertStroke(&stroke); err != nil {
+		t.Fatal(err)
+	}
+	IndexStrokes(whiteboardID, stroke)
+	RecordAdd(whiteboardID, a, ContentIDs{StrokeIDs: []int{stroke.ID}})
+
+	erased, err := EraseStrokesInBox(whiteboardID, b, geometry.Rect{MinX: 0, MaxX: 100, MinY: 0, MaxY: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(erased) != 1 || erased[0] != stroke.ID {
+		t.Fatalf("b erased %v, want stroke %d", erased, stroke.ID)
+	}
+
+	undone, err := Undo(whiteboardID, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(undone.Skipped.StrokeIDs) != 1 || undone.Skipped.StrokeIDs[0] != stroke.ID {
+		t.Errorf("undo skipped strokes %v, want stroke %d", undone.Skipped.StrokeIDs, stroke.ID)
+	}
+	redone, err := Redo(whiteboardID, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(redone.Strokes) != 0 {
+		t.Errorf("redo brought back %d strokes, want none", len(redone.Strokes))
+	}
+
+	strokes, err := db.GetStrokesByIDs(whiteboardID, []int{stroke.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(strokes) != 0 {
+		t.Errorf("stroke %d is back on the board after redo, b's erase was undone", stroke.ID)
+	}
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"log"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"sketchive/internal/spatial"
+)
+
+// maxIndexedBoards is how many boards keep a spatial index in memory at once
+const maxIndexedBoards = 64
+
+// boardIndex answers erase, selection and viewport queries without scanning the bounding box columns in MySQL
+var boardIndex = spatial.NewBoards(loadBoardIndex, maxIndexedBoards)
+
+func loadBoardIndex(whiteboardID int) ([]spatial.Item, error) {
+	bounds, err := db.GetItemBoundsByWhiteboardID(whiteboardID)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]spatial.Item, len(bounds))
+	for i, b := range bounds {
+		kind := spatial.KindStroke
+		if b.Kind == "element" {
+			kind = spatial.KindElement
+		}
+		items[i] = spatial.Item{
+			Key:    spatial.Key{Kind: kind, ID: b.ID},
+			Bounds: geometry.Rect{MinX: b.MinX, MaxX: b.MaxX, MinY: b.MinY, MaxY: b.MaxY},
+		}
+	}
+	log.Printf("Loaded spatial index of whiteboard ID %d with %d items", whiteboardID, len(items))
+	return items, nil
+}
+
+// StrokeBounds returns the stored bounding box of a stroke
+func StrokeBounds(s *db.Stroke) geometry.Rect {
+	return geometry.Rect{MinX: s.MinX, MaxX: s.MaxX, MinY: s.MinY, MaxY: s.MaxY}
+}
+
+// ElementBounds returns the stored bounding box of an element
+func ElementBounds(e *db.Element) geometry.Rect {
+	return geometry.Rect{MinX: e.MinX, MaxX: e.MaxX, MinY: e.MinY, MaxY: e.MaxY}
+}
+
+// IndexStrokes adds new or changed strokes to the spatial index of their board
+func IndexStrokes(whiteboardID int, strokes ...db.Stroke) {
+	items := make([]spatial.Item, len(strokes))
+	added := make([]geometry.Rect, len(strokes))
+	for i := range strokes {
+		added[i] = StrokeBounds(&strokes[i])
+		items[i] = spatial.Item{Key: spatial.Key{Kind: spatial.KindStroke, ID: strokes[i].ID}, Bounds: added[i]}
+	}
+	boardIndex.Upsert(whiteboardID, items...)
+	contentAdded(whiteboardID, added)
+}
+
+// IndexElements adds new or changed elements to the spatial index of their board
+func IndexElements(whiteboardID int, elements ...db.Element) {
+	items := make([]spatial.Item, len(elements))
+	added := make([]geometry.Rect, len(elements))
+	for i := range elements {
+		added[i] = ElementBounds(&elements[i])
+		items[i] = spatial.Item{Key: spatial.Key{Kind: spatial.KindElement, ID: elements[i].ID}, Bounds: added[i]}
+	}
+	boardIndex.Upsert(whiteboardID, items...)
+	contentAdded(whiteboardID, added)
+}
+
+// UnindexStrokes removes deleted strokes from the spatial index
+func UnindexStrokes(whiteboardID int, ids ...int) {
+	boardIndex.Remove(whiteboardID, keysOf(spatial.KindStroke, ids)...)
+	RefreshContentBounds(whiteboardID)
+}
+
+// UnindexElements removes deleted elements from the spatial index
+func UnindexElements(whiteboardID int, ids ...int) {
+	boardIndex.Remove(whiteboardID, keysOf(spatial.KindElement, ids)...)
+	RefreshContentBounds(whiteboardID)
+}
+
+// ForgetBoard drops the spatial index of a board after bulk changes like clearing it.
+// Callers that keep the board call RefreshContentBounds afterwards.
+func ForgetBoard(whiteboardID int) {
+	boardIndex.Forget(whiteboardID)
+	forgetContentBounds(whiteboardID)
+}
+
+func keysOf(kind spatial.Kind, ids []int) []spatial.Key {
+	keys := make([]spatial.Key, len(ids))
+	for i, id := range ids {
+		keys[i] = spatial.Key{Kind: kind, ID: id}
+	}
+	return keys
+}
+
+// searchBoard returns the IDs of the strokes and elements whose bounding boxes overlap r, in ID order
+func searchBoard(whiteboardID int, r geometry.Rect) (strokeIDs, elementIDs []int, err error) {
+	keys, err := boardIndex.Search(whiteboardID, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, key := range keys {
+		if key.Kind == spatial.KindStroke {
+			strokeIDs = append(strokeIDs, key.ID)
+		} else {
+			elementIDs = append(elementIDs, key.ID)
+		}
+	}
+	return strokeIDs, elementIDs, nil
+}
+
+// EraseStrokesInBox marks every stroke whose bounding box overlaps the eraser box as deleted.
+// Strokes on hidden or locked layers are left alone. userID can undo the erase.
+func EraseStrokesInBox(whiteboardID, userID int, box geometry.Rect) ([]int, error) {
+	candidateIDs, _, err := searchBoard(whiteboardID, box)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := db.GetStrokesByIDs(whiteboardID, candidateIDs)
+	if err != nil {
+		return nil, err
+	}
+	layers, err := loadLayers(whiteboardID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []int{}
+	for _, stroke := range candidates {
+		if layers.editable(stroke.LayerID) {
+			ids = append(ids, stroke.ID)
+		}
+	}
+	if err := db.MarkStrokesDeletedByIDs(whiteboardID, ids, LogDeleted(whiteboardID, userID)); err != nil {
+		return nil, err
+	}
+	UnindexStrokes(whiteboardID, ids...)
+	RecordErase(whiteboardID, userID, ContentIDs{StrokeIDs: ids})
+	if err := StrokesDeleted(whiteboardID, userID, ids...); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// EraseElementsInBox marks the elements whose real outline touches the eraser box as deleted.
+// Elements on hidden or locked layers are left alone. userID can undo the erase.
+func EraseElementsInBox(whiteboardID, userID int, box geometry.Rect) ([]int, error) {
+	_, candidateIDs, err := searchBoard(whiteboardID, box)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := db.GetElementsByIDs(whiteboardID, candidateIDs)
+	if err != nil {
+		return nil, err
+	}
+	layers, err := loadLayers(whiteboardID)
+	if err != nil {
+		return nil, err
+	}
+
+	erased := []int{}
+	for i := range candidates {
+		if layers.editable(candidates[i].LayerID) && geometry.ElementIntersectsRect(&candidates[i], box) {
+			erased = append(erased, candidates[i].ID)
+		}
+	}
+	followed, err := db.MarkElementsDeleted(whiteboardID, erased, Following(erased...),
+		LogDeleted(whiteboardID, userID), LogElements(whiteboardID, userID, LogElementsUpdated))
+	if err != nil {
+		return nil, err
+	}
+	UnindexElements(whiteboardID, erased...)
+	RecordErase(whiteboardID, userID, ContentIDs{ElementIDs: erased})
+	if err := ElementsDeleted(whiteboardID, userID, followed, erased...); err != nil {
+		return nil, err
+	}
+	ConnectorsUpdated(whiteboardID, userID, followed)
+	return erased, nil
+}
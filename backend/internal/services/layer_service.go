@@ -0,0 +1,68 @@
+package services
+
+import (
+	"fmt"
+	"sketchive/internal/db"
+)
+
+// ErrLocked is returned when changing content on a locked layer
+var ErrLocked = db.ErrLayerLocked
+
+// boardLayers maps the layer IDs of a whiteboard to their layer
+type boardLayers map[int]db.Layer
+
+func loadLayers(whiteboardID int) (boardLayers, error) {
+	layers, err := db.GetLayersByWhiteboardID(whiteboardID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(boardLayers, len(layers))
+	for _, layer := range layers {
+		byID[layer.ID] = layer
+	}
+	return byID, nil
+}
+
+// visible reports whether content on the layer is shown. Content without a layer always is.
+func (l boardLayers) visible(layerID int) bool {
+	layer, ok := l[layerID]
+	return !ok || layer.Visible
+}
+
+// editable reports whether content on the layer can be selected, erased or transformed:
+// the layer must be visible and unlocked
+func (l boardLayers) editable(layerID int) bool {
+	layer, ok := l[layerID]
+	return !ok || (layer.Visible && !layer.Locked)
+}
+
+// ResolveLayer returns the layer new content should go to: the given layer, or the board's
+// default layer when layerID is 0, after checking it belongs to the board and isn't locked
+func ResolveLayer(whiteboardID, layerID int) (int, error) {
+	if layerID == 0 {
+		var err error
+		if layerID, err = db.DefaultLayerID(whiteboardID); err != nil {
+			return 0, err
+		}
+	}
+	return layerID, EnsureLayerEditable(whiteboardID, layerID)
+}
+
+// EnsureLayerEditable fails with ErrLocked when the layer is locked.
+// Content without a layer (layerID 0) is always editable.
+func EnsureLayerEditable(whiteboardID, layerID int) error {
+	if layerID == 0 {
+		return nil
+	}
+	layer, err := db.GetLayerByID(whiteboardID, layerID)
+	if err == db.ErrLayerNotFound {
+		return invalidf("layer %d doesn't belong to whiteboard %d", layerID, whiteboardID)
+	}
+	if err != nil {
+		return err
+	}
+	if layer.Locked {
+		return fmt.Errorf("%w: %s", ErrLocked, layer.Name)
+	}
+	return nil
+}
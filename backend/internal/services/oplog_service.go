@@ -0,0 +1,367 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sketchive/internal/db"
+	"slices"
+	"time"
+)
+
+// Operation log entry types. Content entries carry the state the change produced, so
+// replaying them rebuilds the board; the others record what happened for auditing.
+const (
+	LogStrokeAdded      = "stroke_added"
+	LogStrokesUpdated   = "strokes_updated"
+	LogStrokesDeleted   = "strokes_deleted"
+	LogStrokesRestored  = "strokes_restored"
+	LogElementAdded     = "element_added"
+	LogElementsUpdated  = "elements_updated"
+	LogElementsDeleted  = "elements_deleted"
+	LogElementsRestored = "elements_restored"
+	LogBoardCleared     = "board_cleared"
+	LogLayerDeleted     = "layer_deleted"
+
+	LogBoardUpdated       = "board_updated"
+	LogLayerCreated       = "layer_created"
+	LogLayerUpdated       = "layer_updated"
+	LogLayersReordered    = "layers_reordered"
+	LogGroupCreated       = "group_created"
+	LogGroupRemoved       = "group_removed"
+	LogCanvasUpdated      = "canvas_updated"
+	LogVoteSessionStarted = "vote_session_started"
+	LogVoteSessionEnded   = "vote_session_ended"
+	LogVoteCast           = "vote_cast"
+	LogVoteRetracted      = "vote_retracted"
+	LogVersionCreated     = "version_created"
+	LogVersionRestored    = "version_restored"
+	LogClearUndone        = "clear_undone"
+	LogBundleImported     = "bundle_imported"
+)
+
+// maxLogPage caps the entries returned by one GetLog call
+const maxLogPage = 1000
+
+// LogPayload is the payload of the content entries of the operation log. Added, updated
+// and restored items are logged in full, deleted ones by ID.
+type LogPayload struct {
+	Strokes    []db.Stroke  `json:"strokes,omitempty"`
+	Elements   []db.Element `json:"elements,omitempty"`
+	StrokeIDs  []int        `json:"strokeIDs,omitempty"`
+	ElementIDs []int        `json:"elementIDs,omitempty"`
+	LayerID    int          `json:"layerID,omitempty"` // the deleted layer of layer_deleted
+	MoveTo     int          `json:"moveTo,omitempty"`  // where its content went, 0 when it was deleted
+}
+
+func init() {
+	db.SetLogBaseline(baselinePayload)
+	db.SetLogCommitted(noteLogged)
+}
+
+// LogOperation returns the journal that logs a change with the given payload. The db write
+// it is passed to appends the entry in its own transaction, so the log has exactly the
+// committed changes. The payload is encoded then, so it may point to what the write fills in.
+func LogOperation(whiteboardID, actorID int, opType string, payload any) db.Journal {
+	return func(db.Change) ([]db.LogEntry, error) {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("encoding %s log entry: %w", opType, err)
+		}
+		return []db.LogEntry{{ActorID: actorID, Type: opType, Payload: data}}, nil
+	}
+}
+
+// LogStrokes and LogElements return the journals that log the strokes or elements a write
+// stored in full, skipping writes that stored none
+func LogStrokes(whiteboardID, actorID int, opType string) db.Journal {
+	return func(change db.Change) ([]db.LogEntry, error) {
+		if len(change.Strokes) == 0 {
+			return nil, nil
+		}
+		return LogOperation(whiteboardID, actorID, opType, LogPayload{Strokes: change.Strokes})(change)
+	}
+}
+
+func LogElements(whiteboardID, actorID int, opType string) db.Journal {
+	return func(change db.Change) ([]db.LogEntry, error) {
+		if len(change.Elements) == 0 {
+			return nil, nil
+		}
+		return LogOperation(whiteboardID, actorID, opType, LogPayload{Elements: change.Elements})(change)
+	}
+}
+
+// LogGroupsCreated returns the journal that logs each group a write created, from the
+// groups the write has as its record
+func LogGroupsCreated(whiteboardID, actorID int) db.Journal {
+	return func(change db.Change) ([]db.LogEntry, error) {
+		groups, _ := change.Record.([]db.Group)
+		var entries []db.LogEntry
+		for i := range groups {
+			logged, err := LogOperation(whiteboardID, actorID, LogGroupCreated, &groups[i])(change)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, logged...)
+		}
+		return entries, nil
+	}
+}
+
+// LogDeleted returns the journal that logs the strokes and elements a write deleted,
+// skipping empty deletions
+func LogDeleted(whiteboardID, actorID int) db.Journal {
+	return func(change db.Change) ([]db.LogEntry, error) {
+		var entries []db.LogEntry
+		for _, deleted := range []struct {
+			opType  string
+			payload LogPayload
+		}{
+			{LogStrokesDeleted, LogPayload{StrokeIDs: change.StrokeIDs}},
+			{LogElementsDeleted, LogPayload{ElementIDs: change.ElementIDs}},
+		} {
+			if len(deleted.payload.StrokeIDs) == 0 && len(deleted.payload.ElementIDs) == 0 {
+				continue
+			}
+			logged, err := LogOperation(whiteboardID, actorID, deleted.opType, deleted.payload)(change)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, logged...)
+		}
+		return entries, nil
+	}
+}
+
+// baselinePayload is the board's current content, logged when its log starts
+func baselinePayload(whiteboardID int) (json.RawMessage, error) {
+	strokes, err := db.GetAllStrokes(whiteboardID)
+	if err != nil {
+		return nil, err
+	}
+	elements, err := db.GetAllElements(whiteboardID)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(LogPayload{Strokes: strokes, Elements: elements})
+}
+
+// GetLog returns up to limit entries of a whiteboard's operation log after the sequence number afterSeq
+func GetLog(whiteboardID, afterSeq, limit int) ([]db.LogEntry, error) {
+	if _, err := db.GetWhiteboardById(whiteboardID); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxLogPage {
+		limit = maxLogPage
+	}
+	return db.GetLogEntries(whiteboardID, afterSeq, limit)
+}
+
+// BoardState is the content of a board rebuilt from its operation log
+type BoardState struct {
+	Seq      int                // the last entry applied
+	Strokes  map[int]db.Stroke  // non-deleted strokes by ID
+	Elements map[int]db.Element // non-deleted elements by ID
+}
+
+// NewBoardState returns the state of a board with an empty log
+func NewBoardState() *BoardState {
+	return &BoardState{Strokes: map[int]db.Stroke{}, Elements: map[int]db.Element{}}
+}
+
+// Apply replays one log entry onto the state. Entries that don't change content only move Seq.
+func (s *BoardState) Apply(entry db.LogEntry) error {
+	s.Seq = entry.Seq
+	if !isContentEntry(entry.Type) {
+		return nil
+	}
+
+	var payload LogPayload
+	if err := json.Unmarshal(entry.Payload, &payload); err != nil {
+		return fmt.Errorf("log entry %d: %w", entry.Seq, err)
+	}
+	if entry.Type == db.LogBaseline {
+		clear(s.Strokes)
+		clear(s.Elements)
+	}
+	for _, stroke := range payload.Strokes {
+		s.Strokes[stroke.ID] = stroke
+	}
+	for _, element := range payload.Elements {
+		s.Elements[element.ID] = element
+	}
+	for _, id := range payload.StrokeIDs {
+		delete(s.Strokes, id)
+	}
+	for _, id := range payload.ElementIDs {
+		delete(s.Elements, id)
+	}
+
+	if entry.Type == LogLayerDeleted {
+		for id, stroke := range s.Strokes {
+			if stroke.LayerID != payload.LayerID {
+				continue
+			}
+			if payload.MoveTo == 0 {
+				delete(s.Strokes, id)
+			} else {
+				stroke.LayerID = payload.MoveTo
+				s.Strokes[id] = stroke
+			}
+		}
+		for id, element := range s.Elements {
+			if element.LayerID != payload.LayerID {
+				continue
+			}
+			if payload.MoveTo == 0 {
+				delete(s.Elements, id)
+			} else {
+				element.LayerID = payload.MoveTo
+				s.Elements[id] = element
+			}
+		}
+	}
+	return nil
+}
+
+// isContentEntry reports whether log entries of a type change content and carry a LogPayload
+func isContentEntry(entryType string) bool {
+	switch entryType {
+	case db.LogBaseline, LogStrokeAdded, LogStrokesUpdated, LogStrokesDeleted, LogStrokesRestored,
+		LogElementAdded, LogElementsUpdated, LogElementsDeleted, LogElementsRestored, LogBoardCleared, LogLayerDeleted:
+		return true
+	}
+	return false
+}
+
+// StrokeList returns the strokes of the state ordered by ID
+func (s *BoardState) StrokeList() []db.Stroke {
+	strokes := make([]db.Stroke, 0, len(s.Strokes))
+	for _, stroke := range s.Strokes {
+		strokes = append(strokes, stroke)
+	}
+	slices.SortFunc(strokes, func(a, b db.Stroke) int { return a.ID - b.ID })
+	return strokes
+}
+
+// ElementList returns the elements of the state ordered by ID
+func (s *BoardState) ElementList() []db.Element {
+	elements := make([]db.Element, 0, len(s.Elements))
+	for _, element := range s.Elements {
+		elements = append(elements, element)
+	}
+	slices.SortFunc(elements, func(a, b db.Element) int { return a.ID - b.ID })
+	return elements
+}
+
+// ReplayBoard rebuilds the content of a board from its operation log, up to and including
+// the entry uptoSeq, or the whole log when uptoSeq is 0
+func ReplayBoard(whiteboardID, uptoSeq int) (*BoardState, error) {
+	entries, err := db.GetLogEntries(whiteboardID, 0, uptoSeq)
+	if err != nil {
+		return nil, err
+	}
+	state := NewBoardState()
+	for _, entry := range entries {
+		if err := state.Apply(entry); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// ConsistencyReport compares the strokes and elements tables of a board with the replay of its log
+type ConsistencyReport struct {
+	WhiteboardID       int   `json:"whiteboardID"`
+	Seq                int   `json:"seq"` // the last log entry replayed
+	Consistent         bool  `json:"consistent"`
+	Strokes            int   `json:"strokes"`           // non-deleted strokes in the table
+	Elements           int   `json:"elements"`          // non-deleted elements in the table
+	MissingStrokes     []int `json:"missingStrokes"`    // in the table but not in the replay
+	ExtraStrokes       []int `json:"extraStrokes"`      // in the replay but deleted or gone from the table
+	MismatchedStrokes  []int `json:"mismatchedStrokes"` // in both, with different content
+	MissingElements    []int `json:"missingElements"`
+	ExtraElements      []int `json:"extraElements"`
+	MismatchedElements []int `json:"mismatchedElements"`
+}
+
+// CheckConsistency replays the operation log of a board and compares the result with the
+// non-deleted strokes and elements in the database. Both come from one snapshot: the log is
+// replayed up to the last entry the snapshot holds.
+func CheckConsistency(whiteboardID int) (ConsistencyReport, error) {
+	report := ConsistencyReport{WhiteboardID: whiteboardID}
+	if _, err := db.GetWhiteboardById(whiteboardID); err != nil {
+		return report, err
+	}
+
+	// A board that was never changed since logging started gets its baseline now
+	if err := db.StartLog(whiteboardID); err != nil {
+		return report, err
+	}
+	seq, content, err := db.ReadBoardContent(whiteboardID)
+	if err != nil {
+		return report, err
+	}
+	state := NewBoardState()
+	if seq > 0 {
+		if state, err = ReplayBoard(whiteboardID, seq); err != nil {
+			return report, err
+		}
+	}
+	report.Seq = state.Seq
+	strokes, elements := content.Strokes, content.Elements
+	report.Strokes, report.Elements = len(strokes), len(elements)
+
+	report.MissingStrokes, report.ExtraStrokes, report.MismatchedStrokes = compareItems(strokes, state.Strokes,
+		func(s db.Stroke) int { return s.ID },
+		func(a, b db.Stroke) bool {
+			a.CreatedAt, b.CreatedAt = time.Time{}, time.Time{}
+			return sameJSON(a, b)
+		})
+	report.MissingElements, report.ExtraElements, report.MismatchedElements = compareItems(elements, state.Elements,
+		func(e db.Element) int { return e.ID },
+		func(a, b db.Element) bool {
+			a.CreatedAt, b.CreatedAt = time.Time{}, time.Time{}
+			return sameJSON(a, b)
+		})
+
+	report.Consistent = len(report.MissingStrokes)+len(report.ExtraStrokes)+len(report.MismatchedStrokes)+
+		len(report.MissingElements)+len(report.ExtraElements)+len(report.MismatchedElements) == 0
+	if !report.Consistent {
+		log.Printf("Whiteboard ID %d doesn't match its operation log: %+v\n", whiteboardID, report)
+	}
+	return report, nil
+}
+
+// compareItems splits the stored items and the replayed ones into the IDs missing from the replay,
+// the IDs only in the replay and the IDs whose content differs, each sorted
+func compareItems[T any](stored []T, replayed map[int]T, id func(T) int, same func(a, b T) bool) (missing, extra, mismatched []int) {
+	missing, extra, mismatched = []int{}, []int{}, []int{}
+	seen := map[int]bool{}
+	for _, item := range stored {
+		seen[id(item)] = true
+		other, ok := replayed[id(item)]
+		switch {
+		case !ok:
+			missing = append(missing, id(item))
+		case !same(item, other):
+			mismatched = append(mismatched, id(item))
+		}
+	}
+	for itemID := range replayed {
+		if !seen[itemID] {
+			extra = append(extra, itemID)
+		}
+	}
+	slices.Sort(extra)
+	return missing, extra, mismatched
+}
+
+// sameJSON reports whether two values encode to the same JSON, which treats nil and empty
+// optional fields alike, as the database does
+func sameJSON(a, b any) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
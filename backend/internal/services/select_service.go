@@ -0,0 +1,156 @@
+package services
+
+import (
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+)
+
+// SelectRequest describes a selection made with either a rectangle or a lasso polygon
+type SelectRequest struct {
+	Rect  *geometry.Rect `json:"rect,omitempty"`
+	Lasso []db.Point     `json:"lasso,omitempty"`
+	Mode  string         `json:"mode"` // "contain" (default) or "intersect"
+}
+
+// SelectResult lists the IDs of the selected board items. Grouped items are selected
+// together with the rest of their group; GroupIDs lists those top-level groups.
+type SelectResult struct {
+	StrokeIDs  []int `json:"strokeIDs"`
+	ElementIDs []int `json:"elementIDs"`
+	GroupIDs   []int `json:"groupIDs"`
+}
+
+func (req SelectRequest) selection() (geometry.Selection, error) {
+	switch {
+	case req.Rect != nil && len(req.Lasso) > 0:
+		return geometry.Selection{}, invalidf("give either a rect or a lasso, not both")
+	case req.Rect != nil:
+		sel, err := geometry.RectSelection(*req.Rect)
+		if err != nil {
+			return sel, invalidf("%v", err)
+		}
+		return sel, nil
+	case len(req.Lasso) > 0:
+		sel, err := geometry.LassoSelection(req.Lasso)
+		if err != nil {
+			return sel, invalidf("%v", err)
+		}
+		return sel, nil
+	default:
+		return geometry.Selection{}, invalidf("a rect or a lasso is required")
+	}
+}
+
+// Select returns the strokes and elements of a whiteboard picked by the selection.
+// Content on hidden or locked layers can't be selected.
+// The spatial index narrows the candidates down by bounding box before the exact point in polygon
+// and segment intersection tests run on each path.
+func Select(whiteboardID int, req SelectRequest) (SelectResult, error) {
+	result := SelectResult{StrokeIDs: []int{}, ElementIDs: []int{}, GroupIDs: []int{}}
+
+	mode := req.Mode
+	if mode == "" {
+		mode = geometry.SelectContain
+	}
+	if mode != geometry.SelectContain && mode != geometry.SelectIntersect {
+		return result, invalidf("unknown selection mode %q", req.Mode)
+	}
+	sel, err := req.selection()
+	if err != nil {
+		return result, err
+	}
+	area := sel.Bounds()
+
+	strokeIDs, elementIDs, err := searchBoard(whiteboardID, area)
+	if err != nil {
+		return result, err
+	}
+
+	layers, err := loadLayers(whiteboardID)
+	if err != nil {
+		return result, err
+	}
+
+	strokes, err := db.GetStrokesByIDs(whiteboardID, strokeIDs)
+	if err != nil {
+		return result, err
+	}
+	for i := range strokes {
+		if !layers.editable(strokes[i].LayerID) {
+			continue
+		}
+		if mode == geometry.SelectContain && !area.Contains(StrokeBounds(&strokes[i])) {
+			continue
+		}
+		if sel.MatchesStroke(&strokes[i], mode) {
+			result.StrokeIDs = append(result.StrokeIDs, strokes[i].ID)
+		}
+	}
+
+	elements, err := db.GetElementsByIDs(whiteboardID, elementIDs)
+	if err != nil {
+		return result, err
+	}
+	for i := range elements {
+		if !layers.editable(elements[i].LayerID) {
+			continue
+		}
+		if sel.MatchesElement(&elements[i], mode) {
+			result.ElementIDs = append(result.ElementIDs, elements[i].ID)
+		}
+	}
+
+	groups, err := loadGroups(whiteboardID)
+	if err != nil {
+		return result, err
+	}
+	return selectGroups(result, groups, mode), nil
+}
+
+// selectGroups widens a selection to whole groups. With "intersect" touching one item of
+// a group selects all of it; with "contain" a group is only selected when all of its
+// content was, and its items are dropped otherwise.
+func selectGroups(hits SelectResult, groups boardGroups, mode string) SelectResult {
+	result := SelectResult{StrokeIDs: []int{}, ElementIDs: []int{}, GroupIDs: []int{}}
+	if len(groups.byID) == 0 {
+		result.StrokeIDs, result.ElementIDs = hits.StrokeIDs, hits.ElementIDs
+		return result
+	}
+
+	hit := map[db.GroupMember]bool{}
+	roots := []int{}
+	seenRoot := map[int]bool{}
+	for _, m := range (ContentIDs{StrokeIDs: hits.StrokeIDs, ElementIDs: hits.ElementIDs}).members() {
+		hit[m] = true
+		root := groups.root(m)
+		switch {
+		case root == 0 && m.Kind == db.ItemStroke:
+			result.StrokeIDs = append(result.StrokeIDs, m.ID)
+		case root == 0:
+			result.ElementIDs = append(result.ElementIDs, m.ID)
+		case !seenRoot[root]:
+			seenRoot[root] = true
+			roots = append(roots, root)
+		}
+	}
+
+	for _, root := range roots {
+		var content ContentIDs
+		groups.collect(root, &content, map[int]bool{})
+		if mode == geometry.SelectContain {
+			complete := true
+			for _, m := range content.members() {
+				complete = complete && hit[m]
+			}
+			if !complete {
+				continue
+			}
+		}
+		result.GroupIDs = append(result.GroupIDs, root)
+		result.StrokeIDs = append(result.StrokeIDs, content.StrokeIDs...)
+		result.ElementIDs = append(result.ElementIDs, content.ElementIDs...)
+	}
+	result.StrokeIDs = uniqueIDs(result.StrokeIDs)
+	result.ElementIDs = uniqueIDs(result.ElementIDs)
+	return result
+}
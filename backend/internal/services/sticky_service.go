@@ -0,0 +1,355 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"sketchive/internal/style"
+	"strings"
+	"time"
+)
+
+// Sticky note defaults
+const (
+	DefaultStickySize  = 200
+	DefaultStickyColor = "#fff59d"
+	stickyFontFamily   = "sans-serif"
+	stickyFontSize     = 18
+	// maxStickyText caps the length of a sticky note's text
+	maxStickyText = 2000
+	// maxVotesPerUser caps the votes a session can hand out to each participant
+	maxVotesPerUser = 100
+)
+
+// Sticky note and voting event types
+const (
+	EventStickyCreated      = "sticky_created"
+	EventStickyUpdated      = "sticky_updated"
+	EventStickyDeleted      = "sticky_deleted"
+	EventVoteSessionStarted = "vote_session_started"
+	EventVoteSessionEnded   = "vote_session_ended"
+	EventVotesUpdated       = "votes_updated"
+)
+
+// StickyChanges describes a new sticky note or the fields to change on an existing one.
+// Fields left nil keep their current value, or get their default on a new note.
+type StickyChanges struct {
+	X       *float64 `json:"x,omitempty"`
+	Y       *float64 `json:"y,omitempty"`
+	Width   *float64 `json:"width,omitempty"`
+	Height  *float64 `json:"height,omitempty"`
+	Color   *string  `json:"color,omitempty"`
+	Text    *string  `json:"text,omitempty"`
+	LayerID *int     `json:"layerID,omitempty"`
+}
+
+// VoteResults is the state of a vote session: its tallies and, when asked for a user,
+// how many votes that user has left
+type VoteResults struct {
+	Session   *db.VoteSession `json:"session"`
+	Tallies   []db.VoteTally  `json:"tallies"`
+	Remaining *int            `json:"remaining,omitempty"`
+}
+
+// PrepareSticky checks the length of a sticky note's text, fills in its color and text style
+// and wraps its text to the note
+func PrepareSticky(e *db.Element) error {
+	if e.Text != nil && len(e.Text.Content) > maxStickyText {
+		return invalidf("sticky note text can't be longer than %d characters", maxStickyText)
+	}
+	if e.Style.FillColor == "" {
+		e.Style.FillColor = DefaultStickyColor
+	}
+	if e.Text == nil {
+		e.Text = &db.TextProps{}
+	}
+	if e.Text.FontFamily == "" {
+		e.Text.FontFamily = stickyFontFamily
+	}
+	if e.Text.FontSize == 0 {
+		e.Text.FontSize = stickyFontSize
+	}
+	if e.Text.Align == "" {
+		e.Text.Align = db.AlignLeft
+	}
+	if e.Text.Color == "" {
+		e.Text.Color = "#000000"
+	}
+	geometry.SyncStickyText(e)
+	return nil
+}
+
+// apply copies the set fields onto the sticky note and validates the result
+func (c StickyChanges) apply(e *db.Element) error {
+	for _, field := range []struct {
+		value  *float64
+		target *float64
+	}{{c.X, &e.X}, {c.Y, &e.Y}, {c.Width, &e.Width}, {c.Height, &e.Height}} {
+		if field.value != nil {
+			*field.target = *field.value
+		}
+	}
+	if c.Color != nil {
+		color, err := style.NormalizeColor(*c.Color)
+		if err != nil {
+			return invalidf("%v", err)
+		}
+		e.Style.FillColor = color
+	}
+	if c.Text != nil {
+		if e.Text == nil {
+			e.Text = &db.TextProps{}
+		}
+		e.Text.Content = strings.TrimRight(*c.Text, " \t\r\n")
+	}
+
+	if err := PrepareSticky(e); err != nil {
+		return err
+	}
+	if err := geometry.ValidateElement(e); err != nil {
+		return invalidf("%v", err)
+	}
+	bounds, err := geometry.ElementBounds(e)
+	if err != nil {
+		return invalidf("%v", err)
+	}
+	e.MinX, e.MaxX, e.MinY, e.MaxY = bounds.MinX, bounds.MaxX, bounds.MinY, bounds.MaxY
+	return ValidateElementPlacement(e)
+}
+
+// CreateSticky places a new sticky note authored by userID on the whiteboard
+func CreateSticky(whiteboardID, userID int, changes StickyChanges) (db.Element, error) {
+	sticky := db.Element{
+		WhiteboardID: whiteboardID,
+		OwnerID:      userID,
+		Type:         db.ElementSticky,
+		Width:        DefaultStickySize,
+		Height:       DefaultStickySize,
+		CreatedAt:    time.Now(),
+	}
+	if err := changes.apply(&sticky); err != nil {
+		return sticky, err
+	}
+
+	layerID := 0
+	if changes.LayerID != nil {
+		layerID = *changes.LayerID
+	}
+	var err error
+	sticky.LayerID, err = ResolveLayer(whiteboardID, layerID)
+	if err != nil {
+		return sticky, err
+	}
+
+	if err := db.InsertElement(&sticky, LogElements(whiteboardID, userID, LogElementAdded)); err != nil {
+		return sticky, err
+	}
+	IndexElements(whiteboardID, sticky)
+	RecordAdd(whiteboardID, userID, ContentIDs{ElementIDs: []int{sticky.ID}})
+
+	log.Printf("User %d added sticky note %d on whiteboard ID %d\n", userID, sticky.ID, whiteboardID)
+	Broadcast(Event{Type: EventStickyCreated, WhiteboardID: whiteboardID, UserID: userID, Elements: []db.Element{sticky}})
+	return sticky, nil
+}
+
+// getSticky returns a non-deleted sticky note of the whiteboard
+func getSticky(whiteboardID, stickyID int) (*db.Element, error) {
+	sticky, err := db.GetElementByID(whiteboardID, stickyID)
+	if err != nil {
+		return nil, err
+	}
+	if sticky.Deleted || sticky.Type != db.ElementSticky {
+		return nil, fmt.Errorf("sticky note %d: %w", stickyID, db.ErrElementNotFound)
+	}
+	return sticky, nil
+}
+
+// GetStickies returns the sticky notes on the visible layers of a whiteboard
+func GetStickies(whiteboardID int) ([]db.Element, error) {
+	elements, err := db.GetElementsByWhiteboardID(whiteboardID)
+	if err != nil {
+		return nil, err
+	}
+	stickies := []db.Element{}
+	for _, e := range elements {
+		if e.Type == db.ElementSticky {
+			stickies = append(stickies, e)
+		}
+	}
+	return stickies, nil
+}
+
+// UpdateSticky moves, resizes, recolors or edits the text of a sticky note
+func UpdateSticky(whiteboardID, userID, stickyID int, changes StickyChanges) (db.Element, error) {
+	sticky, err := getSticky(whiteboardID, stickyID)
+	if err != nil {
+		return db.Element{}, err
+	}
+	if err := EnsureLayerEditable(whiteboardID, sticky.LayerID); err != nil {
+		return *sticky, err
+	}
+	if changes.LayerID != nil && *changes.LayerID != sticky.LayerID {
+		if sticky.LayerID, err = ResolveLayer(whiteboardID, *changes.LayerID); err != nil {
+			return *sticky, err
+		}
+	}
+	if err := changes.apply(sticky); err != nil {
+		return *sticky, err
+	}
+
+	followed, err := db.UpdateElement(sticky, Following(sticky.ID), LogElements(whiteboardID, userID, LogElementsUpdated))
+	if err != nil {
+		return *sticky, err
+	}
+	IndexElements(whiteboardID, *sticky)
+	if err := ElementsChanged(whiteboardID, userID, followed, sticky.ID); err != nil {
+		return *sticky, err
+	}
+
+	// The connectors bound to the note follow it in the same event
+	Broadcast(Event{Type: EventStickyUpdated, WhiteboardID: whiteboardID, UserID: userID,
+		Elements: append([]db.Element{*sticky}, followed...)})
+	return *sticky, nil
+}
+
+// DeleteSticky removes a sticky note. Its votes no longer count in the tallies.
+func DeleteSticky(whiteboardID, userID, stickyID int) error {
+	sticky, err := getSticky(whiteboardID, stickyID)
+	if err != nil {
+		return err
+	}
+	if err := EnsureLayerEditable(whiteboardID, sticky.LayerID); err != nil {
+		return err
+	}
+
+	followed, err := db.MarkElementsDeleted(whiteboardID, []int{stickyID}, Following(stickyID),
+		LogDeleted(whiteboardID, userID), LogElements(whiteboardID, userID, LogElementsUpdated))
+	if err != nil {
+		return err
+	}
+	UnindexElements(whiteboardID, stickyID)
+	RecordErase(whiteboardID, userID, ContentIDs{ElementIDs: []int{stickyID}})
+	if err := ElementsDeleted(whiteboardID, userID, followed, stickyID); err != nil {
+		return err
+	}
+
+	log.Printf("User %d deleted sticky note %d on whiteboard ID %d\n", userID, stickyID, whiteboardID)
+	// The event carries the connectors that were detached from the note
+	Broadcast(Event{Type: EventStickyDeleted, WhiteboardID: whiteboardID, UserID: userID, ElementIDs: []int{stickyID},
+		Elements: followed})
+	return nil
+}
+
+// StartVoteSession opens a round of voting where each participant gets votesPerUser votes
+func StartVoteSession(whiteboardID, userID, votesPerUser int) (*db.VoteSession, error) {
+	if votesPerUser < 1 || votesPerUser > maxVotesPerUser {
+		return nil, invalidf("votes per user must be between 1 and %d", maxVotesPerUser)
+	}
+	session := &db.VoteSession{
+		WhiteboardID: whiteboardID,
+		VotesPerUser: votesPerUser,
+		StartedBy:    userID,
+		StartedAt:    time.Now(),
+	}
+	if err := db.InsertVoteSession(session, LogOperation(whiteboardID, userID, LogVoteSessionStarted, session)); err != nil {
+		return nil, err
+	}
+
+	log.Printf("User %d started vote session %d with %d votes per user on whiteboard ID %d\n", userID, session.ID, votesPerUser, whiteboardID)
+	Broadcast(Event{Type: EventVoteSessionStarted, WhiteboardID: whiteboardID, UserID: userID,
+		Votes: &VoteResults{Session: session, Tallies: []db.VoteTally{}}})
+	return session, nil
+}
+
+// EndVoteSession closes the open vote session and returns its final tallies
+func EndVoteSession(whiteboardID, userID int) (VoteResults, error) {
+	// The final tallies are logged with the end; votes wait for the session row meanwhile
+	var results VoteResults
+	session, err := db.EndVoteSession(whiteboardID, time.Now(), func(change db.Change) ([]db.LogEntry, error) {
+		var err error
+		if results, err = voteResults(change.Record.(*db.VoteSession), 0); err != nil {
+			return nil, err
+		}
+		return LogOperation(whiteboardID, userID, LogVoteSessionEnded, results)(change)
+	})
+	if err != nil {
+		return VoteResults{}, err
+	}
+	log.Printf("User %d ended vote session %d on whiteboard ID %d\n", userID, session.ID, whiteboardID)
+	Broadcast(Event{Type: EventVoteSessionEnded, WhiteboardID: whiteboardID, UserID: userID, Votes: &results})
+	return results, nil
+}
+
+// GetVoteResults returns the tallies of the open vote session, or of the last one when voting
+// has ended. With a userID it also returns how many votes that user has left.
+func GetVoteResults(whiteboardID, userID int) (VoteResults, error) {
+	session, err := db.GetLatestVoteSession(whiteboardID)
+	if err != nil {
+		return VoteResults{}, err
+	}
+	return voteResults(session, userID)
+}
+
+// CastVote puts one of the user's votes on a sticky note. The server enforces the
+// session's per-user limit.
+func CastVote(whiteboardID, userID, stickyID int) (VoteResults, error) {
+	if userID == 0 {
+		return VoteResults{}, invalidf("a userID is required to vote")
+	}
+	session, err := db.CastVote(whiteboardID, stickyID, userID, logVote(whiteboardID, userID, LogVoteCast, stickyID))
+	if err != nil {
+		return VoteResults{}, err
+	}
+	return votesChanged(session, userID)
+}
+
+// RetractVote takes back one of the user's votes on a sticky note
+func RetractVote(whiteboardID, userID, stickyID int) (VoteResults, error) {
+	if userID == 0 {
+		return VoteResults{}, invalidf("a userID is required to vote")
+	}
+	session, err := db.RetractVote(whiteboardID, stickyID, userID, logVote(whiteboardID, userID, LogVoteRetracted, stickyID))
+	if err != nil {
+		return VoteResults{}, err
+	}
+	return votesChanged(session, userID)
+}
+
+// logVote returns the journal of a vote cast or retracted in the session the write locked
+func logVote(whiteboardID, userID int, opType string, stickyID int) db.Journal {
+	return func(change db.Change) ([]db.LogEntry, error) {
+		session := change.Record.(*db.VoteSession)
+		return LogOperation(whiteboardID, userID, opType, map[string]int{"sessionID": session.ID, "stickyID": stickyID})(change)
+	}
+}
+
+// votesChanged broadcasts the new tallies to every client and returns them,
+// along with the voter's remaining votes, to the voter
+func votesChanged(session *db.VoteSession, userID int) (VoteResults, error) {
+	results, err := voteResults(session, userID)
+	if err != nil {
+		return results, err
+	}
+	Broadcast(Event{Type: EventVotesUpdated, WhiteboardID: session.WhiteboardID, UserID: userID,
+		Votes: &VoteResults{Session: session, Tallies: results.Tallies}})
+	return results, nil
+}
+
+func voteResults(session *db.VoteSession, userID int) (VoteResults, error) {
+	results := VoteResults{Session: session}
+	var err error
+	results.Tallies, err = db.GetVoteTallies(session.ID)
+	if err != nil {
+		return results, err
+	}
+	if userID != 0 {
+		used, err := db.CountUserVotes(session.ID, userID)
+		if err != nil {
+			return results, err
+		}
+		remaining := max(session.VotesPerUser-used, 0)
+		results.Remaining = &remaining
+	}
+	return results, nil
+}
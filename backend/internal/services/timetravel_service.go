@@ -0,0 +1,260 @@
+package services
+
+import (
+	"cmp"
+	"maps"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Limits of the time travel cache
+const (
+	maxCachedReplays = 64 // boards whose replayed states are kept in memory
+	// maxReplayCheckpoints caps the states kept per board; those farthest from the last
+	// requested point are dropped first
+	maxReplayCheckpoints = 8
+	// replayCheckpointEvery is how many log entries apart replaying keeps a state, so
+	// scrubbing back a little replays at most that many entries
+	replayCheckpointEvery = 256
+)
+
+// BoardAt is the content of a whiteboard as it was at a point in time
+type BoardAt struct {
+	WhiteboardID int          `json:"whiteboardID"`
+	AsOf         time.Time    `json:"asOf"`
+	Seq          int          `json:"seq"` // the last operation log entry included, 0 when the board has no log
+	Strokes      []db.Stroke  `json:"strokes"`
+	Elements     []db.Element `json:"elements"`
+	NextCursor   string       `json:"nextCursor,omitempty"` // set by ContentPageAt when more content follows
+}
+
+// boardReplays are the states a board was rebuilt to, ordered by Seq. The log is
+// append-only, so a cached state never goes stale. States are shared and never modified.
+type boardReplays struct {
+	checkpoints []*BoardState
+	lastUsed    time.Time
+}
+
+// replays keeps the states time travel rebuilt per board, so a scrubber moving through
+// time only replays the entries between the cached state nearest to it and the cursor
+var replays = struct {
+	sync.Mutex
+	byBoard map[int]*boardReplays
+}{byBoard: map[int]*boardReplays{}}
+
+func (s *BoardState) clone() *BoardState {
+	return &BoardState{Seq: s.Seq, Strokes: maps.Clone(s.Strokes), Elements: maps.Clone(s.Elements)}
+}
+
+// nearestReplay returns the latest cached state of a board at or before seq, or nil
+func nearestReplay(whiteboardID, seq int) *BoardState {
+	replays.Lock()
+	defer replays.Unlock()
+	board := replays.byBoard[whiteboardID]
+	if board == nil {
+		return nil
+	}
+	board.lastUsed = time.Now()
+	i, _ := slices.BinarySearchFunc(board.checkpoints, seq+1, func(s *BoardState, seq int) int { return cmp.Compare(s.Seq, seq) })
+	if i == 0 {
+		return nil
+	}
+	return board.checkpoints[i-1]
+}
+
+// keepReplays caches states of a board, keeping the ones closest to cursor when there are
+// too many, and drops the least recently used boards above maxCachedReplays
+func keepReplays(whiteboardID, cursor int, states ...*BoardState) {
+	replays.Lock()
+	defer replays.Unlock()
+	board := replays.byBoard[whiteboardID]
+	if board == nil {
+		board = &boardReplays{}
+		replays.byBoard[whiteboardID] = board
+	}
+	board.lastUsed = time.Now()
+	for _, state := range states {
+		i, found := slices.BinarySearchFunc(board.checkpoints, state.Seq, func(s *BoardState, seq int) int { return cmp.Compare(s.Seq, seq) })
+		if !found {
+			board.checkpoints = slices.Insert(board.checkpoints, i, state)
+		}
+	}
+	for len(board.checkpoints) > maxReplayCheckpoints {
+		farthest := 0
+		for i, state := range board.checkpoints {
+			if distance(state.Seq, cursor) > distance(board.checkpoints[farthest].Seq, cursor) {
+				farthest = i
+			}
+		}
+		board.checkpoints = slices.Delete(board.checkpoints, farthest, farthest+1)
+	}
+
+	for len(replays.byBoard) > maxCachedReplays {
+		oldestID, oldest := 0, time.Time{}
+		for id, b := range replays.byBoard {
+			if oldest.IsZero() || b.lastUsed.Before(oldest) {
+				oldestID, oldest = id, b.lastUsed
+			}
+		}
+		delete(replays.byBoard, oldestID)
+	}
+}
+
+func distance(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// ContentAt returns every stroke and element a whiteboard had at asOf, on any layer and
+// ordered by ID, including content that was erased since. It starts from the latest version
+// before that point and replays the operation log after it.
+func ContentAt(whiteboardID int, asOf time.Time) (BoardAt, error) {
+	result := BoardAt{WhiteboardID: whiteboardID, AsOf: asOf}
+	if _, err := db.GetWhiteboardById(whiteboardID); err != nil {
+		return result, err
+	}
+
+	seq, first, logged, err := db.LogSeqAt(whiteboardID, asOf)
+	if err != nil {
+		return result, err
+	}
+	if !logged {
+		// Nothing changed since the log started, so the board looks as it does now
+		if result.Strokes, err = db.GetAllStrokes(whiteboardID); err != nil {
+			return result, err
+		}
+		result.Elements, err = db.GetAllElements(whiteboardID)
+		return result, err
+	}
+	if seq == 0 {
+		return result, invalidf("the history of this board starts at %s", first.Format(time.RFC3339))
+	}
+
+	state, err := stateAt(whiteboardID, seq)
+	if err != nil {
+		return result, err
+	}
+	result.Seq = state.Seq
+	result.Strokes, result.Elements = state.StrokeList(), state.ElementList()
+	return result, nil
+}
+
+// ContentPageAt is ContentAt for the content intersecting an optional viewport, one page at
+// a time like GetStrokesPage: up to limit items after the cursor, strokes first and then
+// elements, each in ascending ID order. Pass the returned NextCursor to get the next page.
+func ContentPageAt(whiteboardID int, asOf time.Time, viewport *geometry.Rect, limit int, cursor string) (BoardAt, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		return BoardAt{}, invalidf("limit can't be more than %d", MaxPageSize)
+	}
+	area := everywhere
+	if viewport != nil {
+		if viewport.MinX > viewport.MaxX || viewport.MinY > viewport.MaxY {
+			return BoardAt{}, invalidf("viewport has min greater than max")
+		}
+		area = *viewport
+	}
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return BoardAt{}, err
+	}
+
+	content, err := ContentAt(whiteboardID, asOf)
+	if err != nil {
+		return content, err
+	}
+	strokes, elements := content.Strokes, content.Elements
+	content.Strokes, content.Elements = []db.Stroke{}, []db.Element{}
+	count := 0
+	if !after.Elements {
+		for i := range strokes {
+			if strokes[i].ID <= after.AfterID || !StrokeBounds(&strokes[i]).Intersects(area) {
+				continue
+			}
+			if count == limit {
+				content.NextCursor = encodeCursor(pageCursor{AfterID: content.Strokes[count-1].ID})
+				return content, nil
+			}
+			content.Strokes = append(content.Strokes, strokes[i])
+			count++
+		}
+		after.AfterID = 0
+	}
+	for i := range elements {
+		if elements[i].ID <= after.AfterID || !ElementBounds(&elements[i]).Intersects(area) {
+			continue
+		}
+		if count == limit {
+			last := pageCursor{Elements: true}
+			if n := len(content.Elements); n > 0 {
+				last.AfterID = content.Elements[n-1].ID
+			}
+			content.NextCursor = encodeCursor(last)
+			return content, nil
+		}
+		content.Elements = append(content.Elements, elements[i])
+		count++
+	}
+	return content, nil
+}
+
+// stateAt rebuilds the content of a board after the log entry seq, starting from whichever
+// is closer: the nearest cached state or the latest version. The returned state may be
+// shared with the cache and must not be modified.
+func stateAt(whiteboardID, seq int) (*BoardState, error) {
+	base := nearestReplay(whiteboardID, seq)
+	if base != nil && base.Seq == seq {
+		return base, nil
+	}
+
+	version, err := db.GetLatestVersionAt(whiteboardID, seq)
+	if err != nil {
+		return nil, err
+	}
+	var state *BoardState
+	if version != nil && (base == nil || version.Seq > base.Seq) {
+		version, err = db.GetVersion(whiteboardID, version.ID)
+		if err != nil {
+			return nil, err
+		}
+		state = NewBoardState()
+		state.Seq = version.Seq
+		for _, stroke := range version.Content.Strokes {
+			state.Strokes[stroke.ID] = stroke
+		}
+		for _, element := range version.Content.Elements {
+			state.Elements[element.ID] = element
+		}
+	} else if base != nil {
+		state = base.clone()
+	} else {
+		state = NewBoardState()
+	}
+
+	// Sequence numbers have no gaps, so the entries up to seq are the next seq-state.Seq.
+	// Along the way a copy is kept every replayCheckpointEvery entries for scrubbing back.
+	var kept []*BoardState
+	if seq > state.Seq {
+		entries, err := db.GetLogEntries(whiteboardID, state.Seq, seq-state.Seq)
+		if err != nil {
+			return nil, err
+		}
+		for i, entry := range entries {
+			if err := state.Apply(entry); err != nil {
+				return nil, err
+			}
+			if state.Seq%replayCheckpointEvery == 0 && i < len(entries)-1 && seq-state.Seq <= maxReplayCheckpoints*replayCheckpointEvery {
+				kept = append(kept, state.clone())
+			}
+		}
+	}
+	keepReplays(whiteboardID, seq, append(kept, state)...)
+	return state, nil
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sketchive/internal/db"
+	"strings"
+	"time"
+)
+
+// Version event types
+const (
+	EventVersionCreated  = "version_created"
+	EventVersionRestored = "version_restored"
+)
+
+// maxVersionName is the longest version name, the size of the name column
+const maxVersionName = 255
+
+// RestoreResult is the content of a whiteboard after a version was restored
+type RestoreResult struct {
+	Version  db.Version   `json:"version"` // the version that was restored
+	Backup   db.Version   `json:"backup"`  // the automatic snapshot of the content the restore replaced
+	Strokes  []db.Stroke  `json:"strokes"`
+	Elements []db.Element `json:"elements"`
+	Groups   []db.Group   `json:"groups"`
+}
+
+// CreateVersion takes a named snapshot of everything on a whiteboard
+func CreateVersion(whiteboardID, userID int, name string) (db.Version, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return db.Version{}, invalidf("a version needs a name")
+	}
+	if len(name) > maxVersionName {
+		return db.Version{}, invalidf("version names can't be longer than %d bytes", maxVersionName)
+	}
+	if _, err := db.GetWhiteboardById(whiteboardID); err != nil {
+		return db.Version{}, err
+	}
+	return snapshot(whiteboardID, userID, name, false)
+}
+
+// AutoSnapshot takes an automatic snapshot before a destructive operation. Empty boards
+// have nothing to lose, so it returns nil for them.
+func AutoSnapshot(whiteboardID, userID int, name string) (*db.Version, error) {
+	seq, content, err := db.ReadBoardContent(whiteboardID)
+	if err != nil {
+		return nil, err
+	}
+	if len(content.Strokes) == 0 && len(content.Elements) == 0 {
+		return nil, nil
+	}
+	version := newVersion(whiteboardID, userID, name, true)
+	if err := saveVersion(&version, seq, content); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func snapshot(whiteboardID, userID int, name string, automatic bool) (db.Version, error) {
+	version := newVersion(whiteboardID, userID, name, automatic)
+	seq, content, err := db.ReadBoardContent(whiteboardID)
+	if err != nil {
+		return version, err
+	}
+	return version, saveVersion(&version, seq, content)
+}
+
+func newVersion(whiteboardID, userID int, name string, automatic bool) db.Version {
+	return db.Version{WhiteboardID: whiteboardID, Name: name, AuthorID: userID, Automatic: automatic, CreatedAt: time.Now()}
+}
+
+// saveVersion stores a version of the content read at the log entry seq and tells the clients
+func saveVersion(version *db.Version, seq int, content *db.VersionContent) error {
+	version.Seq, version.Content = seq, content
+	version.StrokeCount, version.ElementCount = len(content.Strokes), len(content.Elements)
+	if err := db.InsertVersion(version, logVersion(version.AuthorID, version)); err != nil {
+		return err
+	}
+	version.Content = nil
+
+	log.Printf("User %d saved version %d %q of whiteboard ID %d\n", version.AuthorID, version.ID, version.Name, version.WhiteboardID)
+	Broadcast(Event{Type: EventVersionCreated, WhiteboardID: version.WhiteboardID, UserID: version.AuthorID, Version: version})
+	return nil
+}
+
+// logVersion returns the journal that logs a version without its content, once the write set its ID
+func logVersion(userID int, version *db.Version) db.Journal {
+	return func(change db.Change) ([]db.LogEntry, error) {
+		logged := *version
+		logged.Content = nil
+		return LogOperation(version.WhiteboardID, userID, LogVersionCreated, logged)(change)
+	}
+}
+
+// GetVersions lists the versions of a whiteboard, newest first
+func GetVersions(whiteboardID int) ([]db.Version, error) {
+	if _, err := db.GetWhiteboardById(whiteboardID); err != nil {
+		return nil, err
+	}
+	return db.GetVersions(whiteboardID)
+}
+
+// GetVersion returns a version of a whiteboard with the content it holds
+func GetVersion(whiteboardID, versionID int) (*db.Version, error) {
+	return db.GetVersion(whiteboardID, versionID)
+}
+
+// RestoreVersion brings a whiteboard back to the content of a version. The content it
+// replaces is saved as an automatic version first, in the same transaction, so the restore
+// can itself be reverted.
+func RestoreVersion(whiteboardID, userID, versionID int) (RestoreResult, error) {
+	var result RestoreResult
+	version, err := db.GetVersion(whiteboardID, versionID)
+	if err != nil {
+		return result, err
+	}
+	content := version.Content
+	version.Content = nil
+	result.Version = *version
+
+	// Content of layers deleted since the snapshot goes to the board's default layer
+	layers, err := loadLayers(whiteboardID)
+	if err != nil {
+		return result, err
+	}
+	defaultLayer, err := ResolveLayer(whiteboardID, 0)
+	if err != nil {
+		return result, err
+	}
+	for i := range content.Strokes {
+		if _, ok := layers[content.Strokes[i].LayerID]; !ok {
+			content.Strokes[i].LayerID = defaultLayer
+		}
+	}
+	// Connectors go last, so the elements they are bound to have their IDs when they are written
+	connectorsLast(content.Elements)
+	elementIDs := make([]int, len(content.Elements))
+	for i := range content.Elements {
+		elementIDs[i] = content.Elements[i].ID
+		if _, ok := layers[content.Elements[i].LayerID]; !ok {
+			content.Elements[i].LayerID = defaultLayer
+		}
+	}
+
+	backup := newVersion(whiteboardID, userID, fmt.Sprintf("Before restoring %q", version.Name), true)
+	restored := func(change db.Change) ([]db.LogEntry, error) {
+		return LogOperation(whiteboardID, userID, LogVersionRestored, map[string]int{"versionID": version.ID, "backupID": backup.ID})(change)
+	}
+	// Connectors bound to elements that are inserted again are bound to their new IDs
+	_, err = db.RestoreVersion(&backup, content, rebindConnectors(content.Elements, elementIDs, map[int]int{}),
+		logVersion(userID, &backup), LogDeleted(whiteboardID, userID),
+		LogStrokes(whiteboardID, userID, LogStrokesRestored), LogElements(whiteboardID, userID, LogElementsRestored),
+		LogGroupsCreated(whiteboardID, userID), restored)
+	if err != nil {
+		return result, err
+	}
+	backup.Content = nil
+	result.Backup = backup
+	result.Strokes, result.Elements = content.Strokes, content.Elements
+	if result.Groups, err = db.GetGroupsByWhiteboardID(whiteboardID); err != nil {
+		return result, err
+	}
+
+	ForgetBoard(whiteboardID)
+	RefreshContentBounds(whiteboardID)
+
+	log.Printf("User %d restored version %d of whiteboard ID %d, the previous content is version %d\n",
+		userID, version.ID, whiteboardID, result.Backup.ID)
+	Broadcast(Event{Type: EventVersionCreated, WhiteboardID: whiteboardID, UserID: userID, Version: &result.Backup})
+	Broadcast(Event{Type: EventVersionRestored, WhiteboardID: whiteboardID, UserID: userID, Version: &result.Version,
+		Strokes: result.Strokes, Elements: result.Elements, Groups: result.Groups})
+	return result, nil
+}
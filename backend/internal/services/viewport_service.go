@@ -0,0 +1,126 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"sketchive/internal/spatial"
+)
+
+// Page sizes for viewport stroke loading
+const (
+	DefaultPageSize = 500
+	MaxPageSize     = 5000
+)
+
+// StrokePage is one page of the strokes intersecting a viewport
+type StrokePage struct {
+	Strokes    []db.Stroke    `json:"strokes"`
+	NextCursor string         `json:"nextCursor,omitempty"` // empty on the last page
+	Bounds     *geometry.Rect `json:"bounds"`               // box around all board content, null for an empty board
+	Layers     []db.Layer     `json:"layers"`               // the board's layers from bottom to top, to order the strokes by
+}
+
+// pageCursor is the opaque position encoded in StrokePage.NextCursor
+type pageCursor struct {
+	AfterID  int  `json:"after"`
+	Elements bool `json:"elements,omitempty"` // AfterID is an element, all strokes were returned
+}
+
+func encodeCursor(c pageCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	if s == "" {
+		return c, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, invalidf("malformed cursor")
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, invalidf("malformed cursor")
+	}
+	return c, nil
+}
+
+// everywhere is the viewport used when the client doesn't send one
+var everywhere = geometry.Rect{MinX: math.Inf(-1), MaxX: math.Inf(1), MinY: math.Inf(-1), MaxY: math.Inf(1)}
+
+// GetStrokesPage returns up to limit strokes intersecting the viewport, in ascending ID order,
+// starting after the cursor. Strokes on hidden layers are left out. A nil viewport means the whole board. The order is stable across
+// requests, so clients can page through large boards and add later pages as they arrive.
+func GetStrokesPage(whiteboardID int, viewport *geometry.Rect, limit int, cursor string) (StrokePage, error) {
+	page := StrokePage{Strokes: []db.Stroke{}}
+
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		return page, invalidf("limit can't be more than %d", MaxPageSize)
+	}
+	area := everywhere
+	if viewport != nil {
+		if viewport.MinX > viewport.MaxX || viewport.MinY > viewport.MaxY {
+			return page, invalidf("viewport has min greater than max")
+		}
+		area = *viewport
+	}
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return page, err
+	}
+
+	keys, err := boardIndex.Search(whiteboardID, area)
+	if err != nil {
+		return page, err
+	}
+	ids := make([]int, 0, limit)
+	more := false
+	for _, key := range keys {
+		if key.Kind != spatial.KindStroke || key.ID <= after.AfterID {
+			continue
+		}
+		if len(ids) == limit {
+			more = true
+			break
+		}
+		ids = append(ids, key.ID)
+	}
+
+	strokes, err := db.GetStrokesByIDs(whiteboardID, ids)
+	if err != nil {
+		return page, err
+	}
+	page.Layers, err = db.GetLayersByWhiteboardID(whiteboardID)
+	if err != nil {
+		return page, err
+	}
+	layers := make(boardLayers, len(page.Layers))
+	for _, layer := range page.Layers {
+		layers[layer.ID] = layer
+	}
+	// Hidden strokes still count towards the page, so cursors stay stable while layers are toggled
+	for _, stroke := range strokes {
+		if layers.visible(stroke.LayerID) {
+			page.Strokes = append(page.Strokes, stroke)
+		}
+	}
+	if more {
+		page.NextCursor = encodeCursor(pageCursor{AfterID: ids[len(ids)-1]})
+	}
+
+	bounds, ok, err := boardIndex.Bounds(whiteboardID)
+	if err != nil {
+		return page, err
+	}
+	if ok {
+		page.Bounds = &bounds
+	}
+	return page, nil
+}
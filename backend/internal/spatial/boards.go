@@ -0,0 +1,226 @@
+package spatial
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"sketchive/internal/geometry"
+)
+
+// Loader reads every non-deleted item of a whiteboard from the store
+type Loader func(whiteboardID int) ([]Item, error)
+
+// boardIndex is the tree of one whiteboard. ready is closed once the first load finished.
+type boardIndex struct {
+	mu       sync.RWMutex
+	tree     *Tree
+	ready    chan struct{}
+	err      error
+	lastUsed time.Time
+}
+
+var infinite = geometry.Rect{MinX: math.Inf(-1), MaxX: math.Inf(1), MinY: math.Inf(-1), MaxY: math.Inf(1)}
+
+// Boards keeps an R-tree per active whiteboard. Trees are loaded lazily on the first
+// query for a board, kept up to date by the mutation hooks, and the least recently
+// used trees are dropped once more than maxBoards are in memory.
+//
+// Mutations for boards that are not loaded are ignored: the store already has them
+// and the next load picks them up. Mutations are idempotent, so a change committed
+// to the store while its board is loading is safe to apply again afterwards.
+type Boards struct {
+	mu        sync.Mutex
+	boards    map[int]*boardIndex
+	load      Loader
+	maxBoards int
+}
+
+// NewBoards returns an index manager that loads boards with load
+func NewBoards(load Loader, maxBoards int) *Boards {
+	return &Boards{boards: map[int]*boardIndex{}, load: load, maxBoards: maxBoards}
+}
+
+// get returns the loaded index of a board, loading it first if needed
+func (b *Boards) get(whiteboardID int) (*boardIndex, error) {
+	b.mu.Lock()
+	idx, ok := b.boards[whiteboardID]
+	if ok {
+		idx.lastUsed = time.Now()
+		b.mu.Unlock()
+		<-idx.ready
+		if idx.err != nil {
+			return nil, idx.err
+		}
+		return idx, nil
+	}
+
+	// Register the board before loading, so mutations committed during the load wait for it
+	idx = &boardIndex{tree: NewTree(), ready: make(chan struct{}), lastUsed: time.Now()}
+	b.boards[whiteboardID] = idx
+	b.evictLocked()
+	b.mu.Unlock()
+
+	idx.mu.Lock()
+	items, err := b.load(whiteboardID)
+	if err == nil {
+		// Changes applied while the board was loading are replayed on top of the loaded items
+		pending := idx.tree
+		idx.tree = BuildTree(items)
+		pending.Search(infinite, func(item Item) bool {
+			idx.tree.Insert(item)
+			return true
+		})
+	}
+	idx.err = err
+	idx.mu.Unlock()
+	close(idx.ready)
+
+	if err != nil {
+		b.mu.Lock()
+		if b.boards[whiteboardID] == idx {
+			delete(b.boards, whiteboardID)
+		}
+		b.mu.Unlock()
+		return nil, err
+	}
+	return idx, nil
+}
+
+// loaded returns the index of a board only if it is in memory
+func (b *Boards) loaded(whiteboardID int) *boardIndex {
+	b.mu.Lock()
+	idx := b.boards[whiteboardID]
+	b.mu.Unlock()
+	return idx
+}
+
+// evictLocked drops the least recently used boards above the limit. b.mu must be held.
+func (b *Boards) evictLocked() {
+	for len(b.boards) > b.maxBoards {
+		oldestID, oldest := 0, time.Time{}
+		for id, idx := range b.boards {
+			if oldest.IsZero() || idx.lastUsed.Before(oldest) {
+				oldestID, oldest = id, idx.lastUsed
+			}
+		}
+		delete(b.boards, oldestID)
+	}
+}
+
+// Search returns the keys of the items of a board whose bounds overlap r, sorted by kind and ID
+func (b *Boards) Search(whiteboardID int, r geometry.Rect) ([]Key, error) {
+	idx, err := b.get(whiteboardID)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []Key
+	idx.mu.RLock()
+	idx.tree.Search(r, func(item Item) bool {
+		keys = append(keys, item.Key)
+		return true
+	})
+	idx.mu.RUnlock()
+
+	SortKeys(keys)
+	return keys, nil
+}
+
+// Bounds returns the box around all content of a board, and false for an empty board
+func (b *Boards) Bounds(whiteboardID int) (geometry.Rect, bool, error) {
+	idx, err := b.get(whiteboardID)
+	if err != nil {
+		return geometry.Rect{}, false, err
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	r, ok := idx.tree.Bounds()
+	return r, ok, nil
+}
+
+// LoadedBounds is Bounds for a board that is in memory. loaded is false, and nothing is
+// loaded, when the board isn't.
+func (b *Boards) LoadedBounds(whiteboardID int) (r geometry.Rect, ok, loaded bool) {
+	idx := b.loaded(whiteboardID)
+	if idx == nil {
+		return r, false, false
+	}
+	<-idx.ready
+	if idx.err != nil {
+		return r, false, false
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	r, ok = idx.tree.Bounds()
+	return r, ok, true
+}
+
+// Union returns the box around the given items of a board, and false when none of them is indexed
+func (b *Boards) Union(whiteboardID int, keys []Key) (geometry.Rect, bool, error) {
+	idx, err := b.get(whiteboardID)
+	if err != nil {
+		return geometry.Rect{}, false, err
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var union geometry.Rect
+	found := false
+	for _, key := range keys {
+		r, ok := idx.tree.Get(key)
+		if !ok {
+			continue
+		}
+		if !found {
+			union, found = r, true
+		} else {
+			union = union.Union(r)
+		}
+	}
+	return union, found, nil
+}
+
+// Upsert adds items to a loaded board or moves them to their new bounds
+func (b *Boards) Upsert(whiteboardID int, items ...Item) {
+	idx := b.loaded(whiteboardID)
+	if idx == nil {
+		return
+	}
+	idx.mu.Lock()
+	for _, item := range items {
+		idx.tree.Insert(item)
+	}
+	idx.mu.Unlock()
+}
+
+// Remove drops items from a loaded board
+func (b *Boards) Remove(whiteboardID int, keys ...Key) {
+	idx := b.loaded(whiteboardID)
+	if idx == nil {
+		return
+	}
+	idx.mu.Lock()
+	for _, key := range keys {
+		idx.tree.Remove(key)
+	}
+	idx.mu.Unlock()
+}
+
+// Forget drops the index of a board, so the next query reloads it from the store
+func (b *Boards) Forget(whiteboardID int) {
+	b.mu.Lock()
+	delete(b.boards, whiteboardID)
+	b.mu.Unlock()
+}
+
+// SortKeys orders keys by kind, then ID
+func SortKeys(keys []Key) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Kind != keys[j].Kind {
+			return keys[i].Kind < keys[j].Kind
+		}
+		return keys[i].ID < keys[j].ID
+	})
+}
@@ -0,0 +1,384 @@
+package spatial
+
+import (
+	"math"
+	"sketchive/internal/geometry"
+	"sort"
+)
+
+// Kind tells which table an indexed item comes from
+type Kind uint8
+
+const (
+	KindStroke Kind = iota + 1
+	KindElement
+)
+
+// Key identifies an indexed board item
+type Key struct {
+	Kind Kind
+	ID   int
+}
+
+// Item is a board item and its bounding box
+type Item struct {
+	Key    Key
+	Bounds geometry.Rect
+}
+
+// Node capacity of the R-tree. 16 keeps nodes cache friendly while the tree stays shallow:
+// 100k strokes fit in 5 levels.
+const (
+	maxEntries = 16
+	minEntries = maxEntries * 2 / 5
+)
+
+type entry struct {
+	bounds geometry.Rect
+	child  *node // nil in leaves
+	key    Key
+}
+
+type node struct {
+	leaf    bool
+	entries []entry
+}
+
+func (n *node) bounds() geometry.Rect {
+	b := n.entries[0].bounds
+	for _, e := range n.entries[1:] {
+		b = b.Union(e.bounds)
+	}
+	return b
+}
+
+// Tree is an R-tree of board items using quadratic splits. Items are keyed, so each key
+// is stored at most once and can be removed or moved without knowing its old bounds.
+// A Tree is not safe for concurrent use.
+type Tree struct {
+	root  *node
+	items map[Key]geometry.Rect
+}
+
+// NewTree returns an empty tree
+func NewTree() *Tree {
+	return &Tree{root: &node{leaf: true}, items: map[Key]geometry.Rect{}}
+}
+
+// BuildTree bulk loads items into a new tree with Sort-Tile-Recursive packing,
+// which is much faster than inserting them one by one and gives tighter nodes.
+// Later duplicates of a key replace earlier ones.
+func BuildTree(items []Item) *Tree {
+	t := NewTree()
+	for _, item := range items {
+		t.items[item.Key] = item.Bounds
+	}
+	if len(t.items) == 0 {
+		return t
+	}
+
+	entries := make([]entry, 0, len(t.items))
+	for key, b := range t.items {
+		entries = append(entries, entry{bounds: b, key: key})
+	}
+	level := packLevel(entries, true)
+	for len(level) > 1 {
+		parents := make([]entry, len(level))
+		for i, n := range level {
+			parents[i] = entry{bounds: n.bounds(), child: n}
+		}
+		level = packLevel(parents, false)
+	}
+	t.root = level[0]
+	return t
+}
+
+// packLevel groups entries into nodes of maxEntries, tiling them first by x then by y.
+// Slices and nodes share their entries evenly, so no node but a lone root ends up with
+// fewer than minEntries.
+func packLevel(entries []entry, leaf bool) []*node {
+	centerX := func(e entry) float64 { return e.bounds.MinX + e.bounds.MaxX }
+	centerY := func(e entry) float64 { return e.bounds.MinY + e.bounds.MaxY }
+
+	nodeCount := (len(entries) + maxEntries - 1) / maxEntries
+	slices := int(math.Ceil(math.Sqrt(float64(nodeCount))))
+	sliceSize := slices * maxEntries
+
+	sort.Slice(entries, func(i, j int) bool { return centerX(entries[i]) < centerX(entries[j]) })
+
+	nodes := make([]*node, 0, nodeCount)
+	for _, slice := range evenParts(entries, sliceSize) {
+		sort.Slice(slice, func(i, j int) bool { return centerY(slice[i]) < centerY(slice[j]) })
+		for _, group := range evenParts(slice, maxEntries) {
+			nodes = append(nodes, &node{leaf: leaf, entries: append([]entry(nil), group...)})
+		}
+	}
+	return nodes
+}
+
+// evenParts splits entries into the fewest parts of at most size entries, as equal in length as possible
+func evenParts(entries []entry, size int) [][]entry {
+	count := (len(entries) + size - 1) / size
+	parts := make([][]entry, 0, count)
+	start := 0
+	for i := range count {
+		end := start + (len(entries)-start)/(count-i)
+		parts = append(parts, entries[start:end])
+		start = end
+	}
+	return parts
+}
+
+// Len returns the number of items in the tree
+func (t *Tree) Len() int {
+	return len(t.items)
+}
+
+// Bounds returns the box around every item, and false when the tree is empty
+func (t *Tree) Bounds() (geometry.Rect, bool) {
+	if len(t.root.entries) == 0 {
+		return geometry.Rect{}, false
+	}
+	return t.root.bounds(), true
+}
+
+// Get returns the bounds stored for a key
+func (t *Tree) Get(key Key) (geometry.Rect, bool) {
+	b, ok := t.items[key]
+	return b, ok
+}
+
+// Insert adds an item, replacing the bounds of the key if it is already in the tree
+func (t *Tree) Insert(item Item) {
+	if _, ok := t.items[item.Key]; ok {
+		t.Remove(item.Key)
+	}
+	t.items[item.Key] = item.Bounds
+	t.insertEntry(entry{bounds: item.Bounds, key: item.Key}, 0)
+}
+
+// insertEntry inserts e at the given height above the leaves (0 for items)
+func (t *Tree) insertEntry(e entry, height int) {
+	if split := t.insert(t.root, e, t.height()-height); split != nil {
+		old := t.root
+		t.root = &node{entries: []entry{
+			{bounds: old.bounds(), child: old},
+			{bounds: split.bounds(), child: split},
+		}}
+	}
+}
+
+func (t *Tree) height() int {
+	h := 0
+	for n := t.root; !n.leaf; n = n.entries[0].child {
+		h++
+	}
+	return h
+}
+
+// insert adds e to the subtree at level (0 means n is where e belongs) and
+// returns the new sibling of n when n had to be split
+func (t *Tree) insert(n *node, e entry, level int) *node {
+	if level == 0 {
+		n.entries = append(n.entries, e)
+	} else {
+		i := chooseSubtree(n, e.bounds)
+		child := n.entries[i].child
+		split := t.insert(child, e, level-1)
+		n.entries[i].bounds = child.bounds()
+		if split != nil {
+			n.entries = append(n.entries, entry{bounds: split.bounds(), child: split})
+		}
+	}
+	if len(n.entries) > maxEntries {
+		return splitNode(n)
+	}
+	return nil
+}
+
+func area(r geometry.Rect) float64 {
+	return (r.MaxX - r.MinX) * (r.MaxY - r.MinY)
+}
+
+// chooseSubtree picks the entry needing the least enlargement to hold b, preferring smaller ones on ties
+func chooseSubtree(n *node, b geometry.Rect) int {
+	best, bestGrowth, bestArea := 0, math.Inf(1), math.Inf(1)
+	for i, e := range n.entries {
+		a := area(e.bounds)
+		growth := area(e.bounds.Union(b)) - a
+		if growth < bestGrowth || (growth == bestGrowth && a < bestArea) {
+			best, bestGrowth, bestArea = i, growth, a
+		}
+	}
+	return best
+}
+
+// splitNode moves part of n's entries into a new node using Guttman's quadratic split
+func splitNode(n *node) *node {
+	entries := n.entries
+
+	// Pick the two entries that would waste the most area together as seeds
+	seedA, seedB, worst := 0, 1, math.Inf(-1)
+	for i := range entries {
+		for j := i + 1; j < len(entries); j++ {
+			waste := area(entries[i].bounds.Union(entries[j].bounds)) - area(entries[i].bounds) - area(entries[j].bounds)
+			if waste > worst {
+				seedA, seedB, worst = i, j, waste
+			}
+		}
+	}
+
+	a := []entry{entries[seedA]}
+	b := []entry{entries[seedB]}
+	boundsA, boundsB := entries[seedA].bounds, entries[seedB].bounds
+
+	rest := make([]entry, 0, len(entries)-2)
+	for i, e := range entries {
+		if i != seedA && i != seedB {
+			rest = append(rest, e)
+		}
+	}
+
+	for len(rest) > 0 {
+		// Make sure both groups end up with at least minEntries
+		if len(a)+len(rest) == minEntries {
+			a = append(a, rest...)
+			break
+		}
+		if len(b)+len(rest) == minEntries {
+			b = append(b, rest...)
+			break
+		}
+
+		// Assign the entry with the strongest preference for one group first
+		pick, pickDiff := 0, math.Inf(-1)
+		for i, e := range rest {
+			growA := area(boundsA.Union(e.bounds)) - area(boundsA)
+			growB := area(boundsB.Union(e.bounds)) - area(boundsB)
+			if diff := math.Abs(growA - growB); diff > pickDiff {
+				pick, pickDiff = i, diff
+			}
+		}
+		e := rest[pick]
+		rest = append(rest[:pick], rest[pick+1:]...)
+
+		growA := area(boundsA.Union(e.bounds)) - area(boundsA)
+		growB := area(boundsB.Union(e.bounds)) - area(boundsB)
+		if growA < growB || (growA == growB && len(a) <= len(b)) {
+			a = append(a, e)
+			boundsA = boundsA.Union(e.bounds)
+		} else {
+			b = append(b, e)
+			boundsB = boundsB.Union(e.bounds)
+		}
+	}
+
+	n.entries = a
+	return &node{leaf: n.leaf, entries: b}
+}
+
+// Remove deletes a key from the tree and reports whether it was there
+func (t *Tree) Remove(key Key) bool {
+	b, ok := t.items[key]
+	if !ok {
+		return false
+	}
+	delete(t.items, key)
+
+	var orphans []orphan
+	t.remove(t.root, key, b, 0, &orphans)
+
+	// Shrink the tree while the root is an inner node with a single child
+	for !t.root.leaf && len(t.root.entries) == 1 {
+		t.root = t.root.entries[0].child
+	}
+	if !t.root.leaf && len(t.root.entries) == 0 {
+		t.root = &node{leaf: true}
+	}
+
+	// Entries of underfull nodes go back in at the height they came from
+	height := t.height()
+	for _, o := range orphans {
+		if o.height > height {
+			for _, e := range o.node.entries {
+				t.reinsertSubtree(e)
+			}
+			continue
+		}
+		for _, e := range o.node.entries {
+			t.insertEntry(e, o.height)
+		}
+	}
+	return true
+}
+
+type orphan struct {
+	node   *node
+	height int // height above the leaves
+}
+
+// reinsertSubtree inserts every item below e, used when the tree got shorter than the orphan
+func (t *Tree) reinsertSubtree(e entry) {
+	if e.child == nil {
+		t.insertEntry(e, 0)
+		return
+	}
+	for _, c := range e.child.entries {
+		t.reinsertSubtree(c)
+	}
+}
+
+// remove deletes key from the subtree of n, collecting underfull nodes into orphans.
+// depth is the distance from the root.
+func (t *Tree) remove(n *node, key Key, b geometry.Rect, depth int, orphans *[]orphan) bool {
+	if n.leaf {
+		for i, e := range n.entries {
+			if e.key == key {
+				n.entries = append(n.entries[:i], n.entries[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := 0; i < len(n.entries); i++ {
+		e := n.entries[i]
+		if !e.bounds.Contains(b) {
+			continue
+		}
+		if !t.remove(e.child, key, b, depth+1, orphans) {
+			continue
+		}
+		if len(e.child.entries) < minEntries {
+			n.entries = append(n.entries[:i], n.entries[i+1:]...)
+			if len(e.child.entries) > 0 {
+				*orphans = append(*orphans, orphan{node: e.child, height: t.height() - depth - 1})
+			}
+		} else {
+			n.entries[i].bounds = e.child.bounds()
+		}
+		return true
+	}
+	return false
+}
+
+// Search calls fn for every item whose bounds overlap r, stopping early when fn returns false
+func (t *Tree) Search(r geometry.Rect, fn func(Item) bool) {
+	search(t.root, r, fn)
+}
+
+func search(n *node, r geometry.Rect, fn func(Item) bool) bool {
+	for _, e := range n.entries {
+		if !e.bounds.Intersects(r) {
+			continue
+		}
+		if n.leaf {
+			if !fn(Item{Key: e.key, Bounds: e.bounds}) {
+				return false
+			}
+		} else if !search(e.child, r, fn) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,331 @@
+package spatial
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"sketchive/internal/geometry"
+)
+
+// randomItems returns n stroke sized items scattered over a board of the given side
+func randomItems(rng *rand.Rand, n int, side float64) []Item {
+	items := make([]Item, n)
+	for i := range items {
+		items[i] = Item{Key: Key{Kind: KindStroke, ID: i + 1}, Bounds: randomRect(rng, side)}
+	}
+	return items
+}
+
+func randomRect(rng *rand.Rand, side float64) geometry.Rect {
+	x, y := rng.Float64()*side, rng.Float64()*side
+	w, h := rng.Float64()*200, rng.Float64()*200
+	return geometry.Rect{MinX: x, MinY: y, MaxX: x + w, MaxY: y + h}
+}
+
+// searchKeys returns the sorted keys the tree finds in r
+func searchKeys(t *Tree, r geometry.Rect) []Key {
+	var keys []Key
+	t.Search(r, func(item Item) bool {
+		keys = append(keys, item.Key)
+		return true
+	})
+	SortKeys(keys)
+	return keys
+}
+
+// bruteForce returns the sorted keys of the items overlapping r
+func bruteForce(items map[Key]geometry.Rect, r geometry.Rect) []Key {
+	var keys []Key
+	for key, b := range items {
+		if b.Intersects(r) {
+			keys = append(keys, key)
+		}
+	}
+	SortKeys(keys)
+	return keys
+}
+
+// checkTree verifies the structure of the tree: every entry's bounds are those of its child,
+// nodes other than the root hold minEntries to maxEntries entries, all leaves are at the
+// same depth, and the leaves hold exactly the tree's items.
+func checkTree(t *testing.T, tree *Tree) {
+	t.Helper()
+	leafDepth := -1
+	found := map[Key]geometry.Rect{}
+	var walk func(n *node, depth int)
+	walk = func(n *node, depth int) {
+		if n != tree.root && (len(n.entries) < minEntries || len(n.entries) > maxEntries) {
+			t.Fatalf("node at depth %d has %d entries", depth, len(n.entries))
+		}
+		if n.leaf {
+			if leafDepth == -1 {
+				leafDepth = depth
+			} else if leafDepth != depth {
+				t.Fatalf("leaves at depths %d and %d", leafDepth, depth)
+			}
+			for _, e := range n.entries {
+				if _, ok := found[e.key]; ok {
+					t.Fatalf("key %v is stored twice", e.key)
+				}
+				found[e.key] = e.bounds
+			}
+			return
+		}
+		for _, e := range n.entries {
+			if e.child == nil {
+				t.Fatalf("inner entry at depth %d has no child", depth)
+			}
+			if e.child.bounds() != e.bounds {
+				t.Fatalf("entry bounds %v at depth %d don't match its child's %v", e.bounds, depth, e.child.bounds())
+			}
+			walk(e.child, depth+1)
+		}
+	}
+	walk(tree.root, 0)
+
+	if len(found) != tree.Len() {
+		t.Fatalf("leaves hold %d items, the tree has %d", len(found), tree.Len())
+	}
+	for key, b := range found {
+		if stored, ok := tree.Get(key); !ok || stored != b {
+			t.Fatalf("key %v is in a leaf with %v, the tree has %v", key, b, stored)
+		}
+	}
+}
+
+func TestEmptyTree(t *testing.T) {
+	tree := NewTree()
+	if _, ok := tree.Bounds(); ok {
+		t.Error("empty tree has bounds")
+	}
+	if keys := searchKeys(tree, infinite); len(keys) != 0 {
+		t.Errorf("empty tree found %v", keys)
+	}
+	if tree.Remove(Key{Kind: KindStroke, ID: 1}) {
+		t.Error("removed a key from an empty tree")
+	}
+	if BuildTree(nil).Len() != 0 {
+		t.Error("bulk loading nothing gave items")
+	}
+}
+
+func TestInsertSearch(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tree := NewTree()
+	items := map[Key]geometry.Rect{}
+	for _, item := range randomItems(rng, 2000, 10000) {
+		tree.Insert(item)
+		items[item.Key] = item.Bounds
+	}
+	checkTree(t, tree)
+
+	for i := 0; i < 200; i++ {
+		r := randomRect(rng, 10000).Expand(rng.Float64() * 500)
+		if got, want := searchKeys(tree, r), bruteForce(items, r); !slices.Equal(got, want) {
+			t.Fatalf("search %v found %d items, want %d", r, len(got), len(want))
+		}
+	}
+}
+
+func TestInsertReplacesKey(t *testing.T) {
+	tree := NewTree()
+	key := Key{Kind: KindElement, ID: 7}
+	tree.Insert(Item{Key: key, Bounds: geometry.Rect{MaxX: 10, MaxY: 10}})
+	moved := geometry.Rect{MinX: 500, MinY: 500, MaxX: 510, MaxY: 510}
+	tree.Insert(Item{Key: key, Bounds: moved})
+
+	if tree.Len() != 1 {
+		t.Fatalf("tree has %d items after moving one", tree.Len())
+	}
+	if keys := searchKeys(tree, geometry.Rect{MaxX: 20, MaxY: 20}); len(keys) != 0 {
+		t.Errorf("found %v at the old place", keys)
+	}
+	if keys := searchKeys(tree, moved); !slices.Equal(keys, []Key{key}) {
+		t.Errorf("found %v at the new place", keys)
+	}
+	if b, _ := tree.Bounds(); b != moved {
+		t.Errorf("tree bounds are %v, want %v", b, moved)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	all := randomItems(rng, 3000, 10000)
+	tree := BuildTree(all)
+	items := map[Key]geometry.Rect{}
+	for _, item := range all {
+		items[item.Key] = item.Bounds
+	}
+
+	// Remove most items in random order, checking the structure as the tree shrinks
+	for n, i := range rng.Perm(len(all))[:2900] {
+		key := all[i].Key
+		if !tree.Remove(key) {
+			t.Fatalf("key %v was not removed", key)
+		}
+		if tree.Remove(key) {
+			t.Fatalf("key %v was removed twice", key)
+		}
+		delete(items, key)
+		if n%250 == 0 {
+			checkTree(t, tree)
+		}
+	}
+	checkTree(t, tree)
+	if got, want := searchKeys(tree, infinite), bruteForce(items, infinite); !slices.Equal(got, want) {
+		t.Fatalf("tree holds %d items, want %d", len(got), len(want))
+	}
+
+	for key := range items {
+		tree.Remove(key)
+	}
+	checkTree(t, tree)
+	if _, ok := tree.Bounds(); ok || tree.Len() != 0 {
+		t.Errorf("tree still has %d items", tree.Len())
+	}
+}
+
+func TestMixedOperations(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	tree := NewTree()
+	items := map[Key]geometry.Rect{}
+	for i := 0; i < 20000; i++ {
+		key := Key{Kind: Kind(rng.Intn(2) + 1), ID: rng.Intn(1500)}
+		switch rng.Intn(3) {
+		case 0, 1:
+			b := randomRect(rng, 5000)
+			tree.Insert(Item{Key: key, Bounds: b})
+			items[key] = b
+		case 2:
+			_, want := items[key]
+			if got := tree.Remove(key); got != want {
+				t.Fatalf("removing %v reported %v, want %v", key, got, want)
+			}
+			delete(items, key)
+		}
+	}
+	checkTree(t, tree)
+	for i := 0; i < 100; i++ {
+		r := randomRect(rng, 5000).Expand(300)
+		if got, want := searchKeys(tree, r), bruteForce(items, r); !slices.Equal(got, want) {
+			t.Fatalf("search %v found %d items, want %d", r, len(got), len(want))
+		}
+	}
+}
+
+func TestBuildTree(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	all := randomItems(rng, 5000, 20000)
+	// A later duplicate of a key replaces the earlier one
+	duplicate := Item{Key: all[0].Key, Bounds: geometry.Rect{MinX: -100, MinY: -100, MaxX: -90, MaxY: -90}}
+	tree := BuildTree(append(all, duplicate))
+	checkTree(t, tree)
+
+	items := map[Key]geometry.Rect{}
+	for _, item := range all[1:] {
+		items[item.Key] = item.Bounds
+	}
+	items[duplicate.Key] = duplicate.Bounds
+	if tree.Len() != len(items) {
+		t.Fatalf("tree has %d items, want %d", tree.Len(), len(items))
+	}
+	for i := 0; i < 200; i++ {
+		r := randomRect(rng, 20000).Expand(rng.Float64() * 1000)
+		if got, want := searchKeys(tree, r), bruteForce(items, r); !slices.Equal(got, want) {
+			t.Fatalf("search %v found %d items, want %d", r, len(got), len(want))
+		}
+	}
+
+	// A bulk loaded tree keeps working with single inserts and removals
+	for _, item := range randomItems(rng, 500, 20000) {
+		item.Key.ID += 10000
+		tree.Insert(item)
+	}
+	for _, item := range all[1:1000] {
+		tree.Remove(item.Key)
+	}
+	checkTree(t, tree)
+}
+
+func TestSearchStopsEarly(t *testing.T) {
+	tree := BuildTree(randomItems(rand.New(rand.NewSource(5)), 1000, 100))
+	calls := 0
+	tree.Search(infinite, func(Item) bool {
+		calls++
+		return calls < 3
+	})
+	if calls != 3 {
+		t.Errorf("search called fn %d times after it returned false", calls)
+	}
+}
+
+// Benchmarks run on a board of 100k strokes spread over a 100k by 100k canvas
+
+const benchStrokes = 100_000
+
+func benchTree(b *testing.B) ([]Item, *Tree) {
+	b.Helper()
+	items := randomItems(rand.New(rand.NewSource(42)), benchStrokes, 100_000)
+	return items, BuildTree(items)
+}
+
+func BenchmarkBuildTree100k(b *testing.B) {
+	items := randomItems(rand.New(rand.NewSource(42)), benchStrokes, 100_000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		BuildTree(items)
+	}
+}
+
+func BenchmarkInsertOneByOne100k(b *testing.B) {
+	items := randomItems(rand.New(rand.NewSource(42)), benchStrokes, 100_000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree := NewTree()
+		for _, item := range items {
+			tree.Insert(item)
+		}
+	}
+}
+
+func BenchmarkInsert100k(b *testing.B) {
+	_, tree := benchTree(b)
+	rng := rand.New(rand.NewSource(7))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Insert(Item{Key: Key{Kind: KindElement, ID: i}, Bounds: randomRect(rng, 100_000)})
+	}
+}
+
+func BenchmarkRemove100k(b *testing.B) {
+	items, tree := benchTree(b)
+	rng := rand.New(rand.NewSource(7))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		item := items[rng.Intn(len(items))]
+		// Put the item back, so the tree keeps its size however long the benchmark runs
+		tree.Remove(item.Key)
+		tree.Insert(item)
+	}
+}
+
+func BenchmarkSearchViewport100k(b *testing.B) {
+	_, tree := benchTree(b)
+	rng := rand.New(rand.NewSource(7))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x, y := rng.Float64()*100_000, rng.Float64()*100_000
+		tree.Search(geometry.Rect{MinX: x, MinY: y, MaxX: x + 1920, MaxY: y + 1080}, func(Item) bool { return true })
+	}
+}
+
+func BenchmarkSearchPoint100k(b *testing.B) {
+	_, tree := benchTree(b)
+	rng := rand.New(rand.NewSource(7))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x, y := rng.Float64()*100_000, rng.Float64()*100_000
+		tree.Search(geometry.Rect{MinX: x, MinY: y, MaxX: x, MaxY: y}, func(Item) bool { return true })
+	}
+}
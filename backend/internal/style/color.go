@@ -0,0 +1,135 @@
+// Package style parses, validates and normalizes the styling of board content.
+package style
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Color is an 8-bit RGBA color with straight (not premultiplied) alpha
+type Color struct {
+	R, G, B, A uint8
+}
+
+// Black is the color strokes get when none is given
+var Black = Color{A: 255}
+
+// Hex returns the color as #rrggbb, or #rrggbbaa when it isn't fully opaque
+func (c Color) Hex() string {
+	if c.A == 255 {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
+
+// RGBHex returns the color as #rrggbb, dropping its alpha
+func (c Color) RGBHex() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// Alpha returns the alpha channel as a fraction between 0 and 1
+func (c Color) Alpha() float64 {
+	return float64(c.A) / 255
+}
+
+// ParseColor reads a CSS color: #rgb, #rgba, #rrggbb, #rrggbbaa, rgb(), rgba()
+// or one of the CSS named colors. Case and surrounding spaces are ignored.
+func ParseColor(s string) (Color, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case value == "":
+		return Color{}, fmt.Errorf("color is empty")
+	case strings.HasPrefix(value, "#"):
+		return parseHex(value[1:], s)
+	case strings.HasPrefix(value, "rgb"):
+		return parseFunction(value, s)
+	}
+	if c, ok := namedColors[value]; ok {
+		return c, nil
+	}
+	return Color{}, fmt.Errorf("unknown color %q", s)
+}
+
+// NormalizeColor parses a color and returns it in the canonical form stored by the server
+func NormalizeColor(s string) (string, error) {
+	c, err := ParseColor(s)
+	if err != nil {
+		return "", err
+	}
+	return c.Hex(), nil
+}
+
+func parseHex(digits, original string) (Color, error) {
+	// Expand the short forms, so #abc becomes #aabbcc
+	if len(digits) == 3 || len(digits) == 4 {
+		var long strings.Builder
+		for _, d := range digits {
+			long.WriteRune(d)
+			long.WriteRune(d)
+		}
+		digits = long.String()
+	}
+	if len(digits) == 6 {
+		digits += "ff"
+	}
+	if len(digits) != 8 {
+		return Color{}, fmt.Errorf("invalid hex color %q", original)
+	}
+	v, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil {
+		return Color{}, fmt.Errorf("invalid hex color %q", original)
+	}
+	return Color{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// parseFunction reads rgb(r, g, b) and rgba(r, g, b, a). Channels may be 0-255 or
+// percentages, alpha a fraction or a percentage. The space separated syntax
+// rgb(r g b / a) is accepted as well.
+func parseFunction(value, original string) (Color, error) {
+	open, close := strings.IndexByte(value, '('), strings.LastIndexByte(value, ')')
+	name := strings.TrimSpace(value[:max(open, 0)])
+	if open < 0 || close != len(value)-1 || (name != "rgb" && name != "rgba") {
+		return Color{}, fmt.Errorf("invalid color %q", original)
+	}
+	args := strings.FieldsFunc(value[open+1:close], func(r rune) bool {
+		return r == ',' || r == ' ' || r == '/'
+	})
+	if len(args) != 3 && len(args) != 4 {
+		return Color{}, fmt.Errorf("invalid color %q: expected 3 or 4 values", original)
+	}
+
+	var channels [4]uint8
+	channels[3] = 255
+	for i, arg := range args {
+		scale := 255.0
+		if i == 3 {
+			scale = 1
+		}
+		v, err := parseChannel(arg, scale)
+		if err != nil {
+			return Color{}, fmt.Errorf("invalid color %q: %v", original, err)
+		}
+		if i == 3 {
+			v *= 255
+		}
+		channels[i] = uint8(v + 0.5)
+	}
+	return Color{R: channels[0], G: channels[1], B: channels[2], A: channels[3]}, nil
+}
+
+// parseChannel reads a number between 0 and limit, or a percentage of limit
+func parseChannel(arg string, limit float64) (float64, error) {
+	percent := strings.HasSuffix(arg, "%")
+	v, err := strconv.ParseFloat(strings.TrimSuffix(arg, "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", arg)
+	}
+	if percent {
+		v = v / 100 * limit
+	}
+	if !(v >= 0 && v <= limit) {
+		return 0, fmt.Errorf("%q is out of range", arg)
+	}
+	return v, nil
+}
@@ -0,0 +1,121 @@
+package style
+
+import (
+	"fmt"
+	"math"
+	"sketchive/internal/db"
+)
+
+const (
+	// DefaultStrokeWidth is used for strokes sent without a width
+	DefaultStrokeWidth = 2
+	// MaxStrokeWidth is the widest stroke accepted
+	MaxStrokeWidth = 500
+	// HighlighterOpacity is the default opacity of highlighter strokes
+	HighlighterOpacity = 0.4
+	// maxDashSegments caps the length of a dash pattern
+	maxDashSegments = 16
+	// maxDashLength caps a single dash or gap
+	maxDashLength = 1000
+)
+
+var (
+	lineCaps  = map[string]bool{db.CapButt: true, db.CapRound: true, db.CapSquare: true}
+	lineJoins = map[string]bool{db.JoinMiter: true, db.JoinRound: true, db.JoinBevel: true}
+	blends    = map[string]bool{db.BlendNormal: true, db.BlendHighlighter: true}
+)
+
+// NormalizeStroke validates a stroke's style and rewrites it in canonical form: colors
+// become lowercase hex, and missing values get their defaults. An alpha channel in the
+// color is folded into the opacity, so the stored color is always #rrggbb.
+// Highlighter strokes default to a translucent, square capped line.
+func NormalizeStroke(stroke *db.Stroke) error {
+	color := Black
+	if stroke.Color != "" {
+		var err error
+		color, err = ParseColor(stroke.Color)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case stroke.Width == 0:
+		stroke.Width = DefaultStrokeWidth
+	case math.IsNaN(stroke.Width) || stroke.Width < 0 || stroke.Width > MaxStrokeWidth:
+		return fmt.Errorf("width must be between 0 and %d", MaxStrokeWidth)
+	}
+
+	s := &stroke.StrokeStyle
+	if s.Blend == "" {
+		s.Blend = db.BlendNormal
+	}
+	if !blends[s.Blend] {
+		return fmt.Errorf("unknown blend mode %q", s.Blend)
+	}
+	highlighter := s.Blend == db.BlendHighlighter
+
+	// An opacity of 0 means none was given: an invisible stroke isn't worth storing
+	switch {
+	case s.Opacity == 0 && highlighter:
+		s.Opacity = HighlighterOpacity
+	case s.Opacity == 0:
+		s.Opacity = 1
+	case math.IsNaN(s.Opacity) || s.Opacity < 0 || s.Opacity > 1:
+		return fmt.Errorf("opacity must be between 0 and 1")
+	}
+	s.Opacity = math.Round(s.Opacity*color.Alpha()*1000) / 1000
+	if s.Opacity == 0 {
+		return fmt.Errorf("stroke is fully transparent")
+	}
+	stroke.Color = color.RGBHex()
+
+	if s.LineCap == "" {
+		s.LineCap = db.CapRound
+		if highlighter {
+			s.LineCap = db.CapSquare
+		}
+	}
+	if !lineCaps[s.LineCap] {
+		return fmt.Errorf("unknown line cap %q", s.LineCap)
+	}
+	if s.LineJoin == "" {
+		s.LineJoin = db.JoinRound
+	}
+	if !lineJoins[s.LineJoin] {
+		return fmt.Errorf("unknown line join %q", s.LineJoin)
+	}
+
+	if err := validateDash(s.Dash); err != nil {
+		return err
+	}
+	if len(s.Dash) == 0 {
+		s.Dash = nil
+	}
+
+	if s.Fill != "" {
+		fill, err := NormalizeColor(s.Fill)
+		if err != nil {
+			return fmt.Errorf("fill: %w", err)
+		}
+		s.Fill = fill
+	}
+	return nil
+}
+
+func validateDash(dash []float64) error {
+	if len(dash) > maxDashSegments {
+		return fmt.Errorf("dash pattern can have at most %d values", maxDashSegments)
+	}
+	total := 0.0
+	for _, d := range dash {
+		if math.IsNaN(d) || d < 0 || d > maxDashLength {
+			return fmt.Errorf("dash values must be between 0 and %d", maxDashLength)
+		}
+		total += d
+	}
+	if len(dash) > 0 && total == 0 {
+		return fmt.Errorf("dash pattern can't be all zeros")
+	}
+	return nil
+}
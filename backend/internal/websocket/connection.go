@@ -1 +1,131 @@
 package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sketchive/internal/db"
+	"sketchive/internal/geometry"
+	"sketchive/internal/services"
+)
+
+// Message is the envelope of every operation a client sends over the WebSocket.
+// Only the fields used by Type need to be set.
+type Message struct {
+	Type         string                 `json:"type"`
+	WhiteboardID int                    `json:"whiteboardID"`
+	UserID       int                    `json:"userID"`
+	StrokeIDs    []int                  `json:"strokeIDs,omitempty"`
+	ElementIDs   []int                  `json:"elementIDs,omitempty"`
+	GroupIDs     []int                  `json:"groupIDs,omitempty"`
+	GroupID      int                    `json:"groupID,omitempty"`
+	StickyID     int                    `json:"stickyID,omitempty"`
+	Sticky       services.StickyChanges `json:"sticky"`
+	Transform    geometry.Transform     `json:"transform"`
+}
+
+func (m Message) content() services.ContentIDs {
+	return services.ContentIDs{StrokeIDs: m.StrokeIDs, ElementIDs: m.ElementIDs, GroupIDs: m.GroupIDs}
+}
+
+// Operation types handled by the server instead of being relayed as is
+const (
+	OpTransform = "transform"
+	OpGroup     = "group"
+	OpUngroup   = "ungroup"
+
+	OpStickyCreate = "sticky_create"
+	OpStickyUpdate = "sticky_update"
+	OpStickyDelete = "sticky_delete"
+	OpVote         = "vote"
+	OpUnvote       = "unvote"
+
+	OpUndo = "undo"
+	OpRedo = "redo"
+)
+
+// errorReply is sent back to the client whose operation failed
+type errorReply struct {
+	Type        string `json:"type"`
+	RequestType string `json:"requestType"`
+	Message     string `json:"message"`
+}
+
+// votesReply tells a voter the new tallies and how many votes they have left
+type votesReply struct {
+	Type        string               `json:"type"`
+	RequestType string               `json:"requestType"`
+	Votes       services.VoteResults `json:"votes"`
+}
+
+// userFacingErrors are the errors whose message is safe and useful to show to the sender
+var userFacingErrors = []error{
+	services.ErrInvalid, services.ErrLocked, services.ErrForbidden,
+	db.ErrStrokeNotFound, db.ErrElementNotFound, db.ErrGroupNotFound, db.ErrAlreadyGrouped,
+	db.ErrNoVoteSession, db.ErrVoteLimit, db.ErrNoVote,
+	services.ErrNothingToUndo, services.ErrNothingToRedo,
+}
+
+// HandleMessage applies the operation in message when it is one the server knows about.
+// Successful operations broadcast their result through the services package, so the
+// returned reply is only set when the operation failed and should go back to the sender,
+// or for votes, which tell the voter how many votes they have left.
+// handled is false for any other message, which the hub keeps relaying to every client.
+func HandleMessage(message []byte) (reply []byte, handled bool) {
+	var msg Message
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return nil, false
+	}
+
+	var err error
+	switch msg.Type {
+	case OpTransform:
+		if len(msg.ElementIDs) == 0 && len(msg.GroupIDs) == 0 {
+			_, err = services.TransformStrokes(msg.WhiteboardID, msg.UserID, msg.StrokeIDs, msg.Transform)
+		} else {
+			_, err = services.TransformContent(msg.WhiteboardID, msg.UserID, msg.content(), msg.Transform)
+		}
+	case OpGroup:
+		_, err = services.CreateGroup(msg.WhiteboardID, msg.UserID, msg.content())
+	case OpUngroup:
+		err = services.Ungroup(msg.WhiteboardID, msg.UserID, msg.GroupID)
+	case OpStickyCreate:
+		_, err = services.CreateSticky(msg.WhiteboardID, msg.UserID, msg.Sticky)
+	case OpStickyUpdate:
+		_, err = services.UpdateSticky(msg.WhiteboardID, msg.UserID, msg.StickyID, msg.Sticky)
+	case OpStickyDelete:
+		err = services.DeleteSticky(msg.WhiteboardID, msg.UserID, msg.StickyID)
+	case OpVote, OpUnvote:
+		var results services.VoteResults
+		if msg.Type == OpVote {
+			results, err = services.CastVote(msg.WhiteboardID, msg.UserID, msg.StickyID)
+		} else {
+			results, err = services.RetractVote(msg.WhiteboardID, msg.UserID, msg.StickyID)
+		}
+		if err == nil {
+			reply, _ = json.Marshal(votesReply{Type: "votes", RequestType: msg.Type, Votes: results})
+			return reply, true
+		}
+	case OpUndo:
+		_, err = services.Undo(msg.WhiteboardID, msg.UserID)
+	case OpRedo:
+		_, err = services.Redo(msg.WhiteboardID, msg.UserID)
+	default:
+		return nil, false
+	}
+
+	if err == nil {
+		return nil, true
+	}
+	log.Printf("Error handling %s operation from user %d: %v", msg.Type, msg.UserID, err)
+
+	text := "operation failed"
+	for _, target := range userFacingErrors {
+		if errors.Is(err, target) {
+			text = err.Error()
+			break
+		}
+	}
+	reply, _ = json.Marshal(errorReply{Type: "error", RequestType: msg.Type, Message: text})
+	return reply, true
+}